@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the API audit log",
+	Long:  `Query the log of authenticated REST API calls kept in the server database`,
+}
+
+var auditListFlags struct {
+	actor  string
+	ip     string
+	method string
+	route  string
+	since  time.Duration
+	limit  int
+	json   bool
+}
+
+var auditListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List audit log entries, newest first",
+	Long:  `List audit log entries, newest first. Reads the server database directly; run it from the server's working directory.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		listAuditLog()
+	},
+}
+
+func init() {
+	flags := auditListCmd.Flags()
+	flags.StringVar(&auditListFlags.actor, "actor", "", "only calls made with this API key name")
+	flags.StringVar(&auditListFlags.ip, "ip", "", "only calls from this client IP")
+	flags.StringVar(&auditListFlags.method, "method", "", "only calls with this HTTP method")
+	flags.StringVar(&auditListFlags.route, "route", "", "only calls to this route, e.g. /api/v1/services/:id")
+	flags.DurationVar(&auditListFlags.since, "since", 0, "only calls within this duration, e.g. 24h")
+	flags.IntVar(&auditListFlags.limit, "limit", 50, "maximum number of entries (0 = all)")
+	flags.BoolVar(&auditListFlags.json, "json", false, "print entries as JSON Lines")
+
+	auditCmd.AddCommand(auditListCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+func listAuditLog() {
+	if _, err := os.Stat(dbPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: database not found at %s (run from the server's working directory)\n", dbPath)
+		os.Exit(1)
+	}
+
+	store, err := storage.NewSQLiteStorage(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	if err := store.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing database: %v\n", err)
+		os.Exit(1)
+	}
+
+	query := storage.AuditLogQuery{
+		Actor:    auditListFlags.actor,
+		ClientIP: auditListFlags.ip,
+		Method:   auditListFlags.method,
+		Route:    auditListFlags.route,
+		Desc:     true,
+		Limit:    auditListFlags.limit,
+	}
+	if auditListFlags.since > 0 {
+		query.Since = time.Now().Add(-auditListFlags.since)
+	}
+
+	page, err := store.ListAuditLog(query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error querying audit log: %v\n", err)
+		os.Exit(1)
+	}
+
+	if auditListFlags.json {
+		enc := json.NewEncoder(os.Stdout)
+		for _, entry := range page.Entries {
+			enc.Encode(entry)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTOR\tCLIENT IP\tMETHOD\tPATH\tSTATUS\tPARAMS")
+	for _, entry := range page.Entries {
+		params := ""
+		if len(entry.Params) > 0 {
+			raw, _ := json.Marshal(entry.Params)
+			params = string(raw)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.CreatedAt.Local().Format(time.RFC3339),
+			entry.Actor,
+			entry.ClientIP,
+			entry.Method,
+			entry.Path,
+			strconv.Itoa(entry.Status),
+			params)
+	}
+	w.Flush()
+
+	if int64(len(page.Entries)) < page.Total {
+		fmt.Printf("\nShowing %d of %d entries; use --limit to see more\n", len(page.Entries), page.Total)
+	}
+}
@@ -9,14 +9,23 @@ import (
 
 	"github.com/arqut/arqut-server-ce/internal/acme"
 	"github.com/arqut/arqut-server-ce/internal/api"
+	"github.com/arqut/arqut-server-ce/internal/audit"
+	"github.com/arqut/arqut-server-ce/internal/authguard"
+	"github.com/arqut/arqut-server-ce/internal/authhook"
 	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/proxy"
 	"github.com/arqut/arqut-server-ce/internal/registry"
 	"github.com/arqut/arqut-server-ce/internal/signaling"
 	"github.com/arqut/arqut-server-ce/internal/storage"
 	"github.com/arqut/arqut-server-ce/internal/turn"
+	"github.com/arqut/arqut-server-ce/internal/webhook"
 	"github.com/arqut/arqut-server-ce/internal/pkg/logger"
 )
 
+// dbPath is the SQLite database of services, webhooks and audit logs
+const dbPath = "data/services.db"
+
 // runServer starts the main server
 func runServer() {
 	// Load configuration
@@ -68,12 +77,30 @@ func runServer() {
 		tlsConfig = acmeManager.GetTLSConfig()
 	}
 
+	// Resolve public_ip: "auto" before anything advertises it
+	if err := turn.ResolvePublicIP(&cfg.Turn, log.Logger); err != nil {
+		log.Error("Failed to detect public IP", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize external auth webhook (nil if not configured)
+	authHook := authhook.New(&cfg.AuthWebhook, log.Logger)
+
+	// Initialize event bus for peer, service and TURN changes
+	eventBus := events.NewBus(log.Logger)
+
+	// Initialize auth failure tracker shared by TURN and the API (nil if disabled)
+	authGuard := authguard.New(&cfg.AuthGuard, log.Logger)
+
 	// Initialize TURN server
 	turnServer, err := turn.New(&cfg.Turn, tlsConfig, log.Logger)
 	if err != nil {
 		log.Error("Failed to initialize TURN server", "error", err)
 		os.Exit(1)
 	}
+	turnServer.SetAuthWebhook(authHook)
+	turnServer.SetAuthGuard(authGuard)
+	turnServer.SetEventBus(eventBus)
 
 	if err := turnServer.Start(); err != nil {
 		log.Error("Failed to start TURN server", "error", err)
@@ -83,9 +110,7 @@ func runServer() {
 
 	// Initialize peer registry
 	peerRegistry := registry.New()
-
-	// Initialize storage for service metadata
-	dbPath := "data/services.db"
+	peerRegistry.SetEventBus(eventBus)
 
 	// Ensure data directory exists
 	if err := os.MkdirAll("data", 0o755); err != nil {
@@ -93,6 +118,7 @@ func runServer() {
 		os.Exit(1)
 	}
 
+	// Initialize storage for service metadata
 	store, err := storage.NewSQLiteStorage(dbPath)
 	if err != nil {
 		log.Error("Failed to initialize storage", "error", err)
@@ -105,13 +131,42 @@ func runServer() {
 	defer store.Close()
 	log.Info("Storage initialized", "path", dbPath)
 
+	// Deliver events to the webhooks managed via the admin API
+	webhooks := webhook.New(&cfg.Webhooks, store, log.Logger)
+	if err := webhooks.Start(eventBus); err != nil {
+		log.Error("Failed to start webhook dispatcher", "error", err)
+		os.Exit(1)
+	}
+	defer webhooks.Stop()
+
 	// Initialize signaling server (with TURN config and storage)
-	signalingServer := signaling.New(&cfg.Signaling, &cfg.Turn, peerRegistry, store, log.Logger)
+	signalingServer := signaling.New(&cfg.Signaling, &cfg.Turn, turnServer.Credentials(), peerRegistry, store, log.Logger)
+	if cfg.Signaling.WebhookAuth {
+		signalingServer.SetAuthWebhook(authHook)
+	}
+	signalingServer.SetEventBus(eventBus)
 	signalingServer.Start()
 	defer signalingServer.Stop()
 
 	// Initialize REST API server (includes WebSocket signaling)
-	apiServer := api.New(&cfg.API, &cfg.Turn, peerRegistry, store, signalingServer, tlsConfig, log.Logger)
+	apiServer := api.New(&cfg.API, &cfg.Turn, turnServer.Credentials(), authGuard, peerRegistry, store, signalingServer, tlsConfig, log.Logger)
+	apiServer.SetEventBus(eventBus)
+	apiServer.SetWebhooks(webhooks)
+
+	// Record authenticated API calls
+	auditLog, err := audit.New(&cfg.Audit, store, log.Logger)
+	if err != nil {
+		log.Error("Failed to open audit log", "error", err)
+		os.Exit(1)
+	}
+	defer auditLog.Close()
+	apiServer.SetAuditLog(auditLog)
+
+	// Route public HTTP/WebSocket traffic to edge services through tunnels
+	if cfg.Proxy.Enabled {
+		apiServer.SetProxy(proxy.New(&cfg.Proxy, store, signalingServer, log.Logger))
+		log.Info("Reverse proxy enabled", "domain", cfg.Proxy.Domain, "path_prefix", cfg.Proxy.PathPrefix)
+	}
 
 	// Start unified HTTP/HTTPS server (REST API + WebSocket)
 	if tlsConfig != nil {
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arqut/arqut-server-ce/internal/audit"
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/logger"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+	useTestStorage(t, server)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := logger.New(logger.Config{Level: "error", Format: "text"})
+	auditLog, err := audit.New(&config.AuditConfig{File: path}, server.storage, log.Logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { auditLog.Close() })
+	server.SetAuditLog(auditLog)
+	do := newJSONDoer(t, server, apiKey)
+
+	status, body := do("POST", "/api/v1/services", map[string]interface{}{
+		"edge_id": "edge-1", "name": "web", "tunnel_port": 8080, "local_host": "localhost", "local_port": 3000,
+	})
+	require.Equal(t, 200, status, body)
+	id := getData(body)["service"].(map[string]interface{})["id"].(string)
+
+	status, _ = do("PATCH", "/api/v1/services/"+id, map[string]interface{}{"tunnel_port": 0})
+	require.Equal(t, 400, status)
+
+	status, _ = do("POST", "/api/v1/admin/secrets", map[string]interface{}{"secret": "s3cret", "old_secrets": []string{"old"}})
+	require.Equal(t, 200, status)
+
+	// Credential issuance is recorded, other reads are not
+	status, _ = do("GET", "/api/v1/ice-servers?peer_id=peer-1", nil)
+	require.Equal(t, 200, status)
+	status, _ = do("GET", "/api/v1/services", nil)
+	require.Equal(t, 200, status)
+
+	// Calls with a bad key are not
+	req := httptest.NewRequest("DELETE", "/api/v1/services/"+id, nil)
+	req.Header.Set("Authorization", "Bearer arq_invalid")
+	resp, err := server.app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, 401, resp.StatusCode)
+
+	status, body = do("GET", "/api/v1/admin/audit?order=desc", nil)
+	require.Equal(t, 200, status, body)
+	entries := getDataArray(body)
+	require.Len(t, entries, 4)
+	assert.EqualValues(t, 4, body["meta"].(map[string]interface{})["pagination"].(map[string]interface{})["total"])
+
+	ice := entries[0].(map[string]interface{})
+	assert.Equal(t, "GET", ice["method"])
+	assert.Equal(t, "/api/v1/ice-servers", ice["route"])
+	assert.Equal(t, map[string]interface{}{"query": map[string]interface{}{"peer_id": "peer-1"}}, ice["params"])
+
+	secrets := entries[1].(map[string]interface{})
+	assert.Equal(t, "/api/v1/admin/secrets", secrets["path"])
+	assert.Equal(t, "test", secrets["actor"])
+	assert.Equal(t, "0.0.0.0", secrets["client_ip"])
+	assert.EqualValues(t, 200, secrets["status"])
+	assert.Equal(t, map[string]interface{}{"secret": audit.Redacted, "old_secrets": audit.Redacted},
+		secrets["params"].(map[string]interface{})["body"])
+
+	patch := entries[2].(map[string]interface{})
+	assert.Equal(t, "PATCH", patch["method"])
+	assert.Equal(t, "/api/v1/services/:id", patch["route"])
+	assert.Equal(t, "/api/v1/services/"+id, patch["path"])
+	assert.EqualValues(t, 400, patch["status"])
+	assert.Equal(t, map[string]interface{}{"id": id}, patch["params"].(map[string]interface{})["path"])
+
+	// Listing the audit log is a read and not recorded itself
+	status, body = do("GET", "/api/v1/admin/audit?method=POST&route=/api/v1/services", nil)
+	require.Equal(t, 200, status, body)
+	entries = getDataArray(body)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "web", entries[0].(map[string]interface{})["params"].(map[string]interface{})["body"].(map[string]interface{})["name"])
+
+	status, body = do("GET", "/api/v1/admin/audit?limit=2", nil)
+	require.Equal(t, 200, status, body)
+	next := body["meta"].(map[string]interface{})["pagination"].(map[string]interface{})["nextCursor"].(string)
+	status, body = do("GET", "/api/v1/admin/audit?limit=2&cursor="+next, nil)
+	require.Equal(t, 200, status, body)
+	assert.Len(t, getDataArray(body), 2)
+
+	status, _ = do("GET", "/api/v1/admin/audit?since=yesterday", nil)
+	assert.Equal(t, 400, status)
+	status, _ = do("GET", "/api/v1/admin/audit?order=desc&cursor="+next, nil)
+	assert.Equal(t, 400, status)
+
+	// The same entries are in the JSON Lines file, secrets redacted
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []models.AuditLog
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry models.AuditLog
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		lines = append(lines, entry)
+	}
+	require.Len(t, lines, 4)
+	assert.Equal(t, "/api/v1/admin/secrets", lines[2].Path)
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "s3cret")
+}
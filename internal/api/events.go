@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	sseBuffer            = 64               // Events queued per stream before dropping
+	sseHeartbeatInterval = 15 * time.Second // Keeps proxies from closing idle streams
+)
+
+// handleEvents streams peer, service and TURN events as Server-Sent Events.
+// ?types= takes a comma separated list of event types or prefixes ("service.*").
+func (s *Server) handleEvents(c *fiber.Ctx) error {
+	if s.events == nil {
+		return ErrorCodeResp(c, fiber.StatusServiceUnavailable, "event stream is not available")
+	}
+
+	var patterns []string
+	for _, p := range strings.Split(c.Query("types"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			if !events.ValidPattern(p) {
+				return ErrorBadRequestResp(c, fmt.Sprintf("unknown event type or pattern: %q", p))
+			}
+			patterns = append(patterns, p)
+		}
+	}
+
+	sub := s.events.Subscribe(sseBuffer, patterns...)
+	s.logger.Debug("Event stream opened", "addr", c.IP(), "types", patterns)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		// Flush headers immediately so clients see the stream open
+		fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case ev, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				if err := writeSSE(w, ev); err != nil {
+					s.logger.Debug("Event stream closed", "error", err)
+					return
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				if err := w.Flush(); err != nil {
+					s.logger.Debug("Event stream closed", "error", err)
+					return
+				}
+			}
+		}
+	}))
+
+	return nil
+}
+
+// writeSSE writes a single event in text/event-stream format
+func writeSSE(w *bufio.Writer, ev events.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return w.Flush()
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEventsStream tests the Server-Sent Events endpoint against a real listener
+func TestEventsStream(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+	bus := events.NewBus(server.logger)
+	server.SetEventBus(bus)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.app.Listener(ln)
+	defer server.Stop()
+
+	req, err := http.NewRequest("GET", "http://"+ln.Addr().String()+"/api/v1/events?types=service.*", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+
+	// Filtered out by ?types
+	bus.Publish(events.PeerConnected, events.PeerData{ID: "p1"})
+	bus.Publish(events.ServiceDeleted, events.ServiceData{ID: "svc-1", EdgeID: "edge-1", Source: events.SourceAPI})
+
+	frame := readSSEFrame(t, reader)
+	assert.Equal(t, "service.deleted", frame["event"])
+
+	var ev struct {
+		ID   uint64             `json:"id"`
+		Type string             `json:"type"`
+		Data events.ServiceData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(frame["data"]), &ev))
+	assert.Equal(t, "service.deleted", ev.Type)
+	assert.Equal(t, "svc-1", ev.Data.ID)
+	assert.Equal(t, "edge-1", ev.Data.EdgeID)
+}
+
+// TestEventsStream_Unavailable tests the endpoint without an event bus
+func TestEventsStream_Unavailable(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/events", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := server.app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 503, resp.StatusCode)
+}
+
+// TestEventsStream_InvalidTypes tests that unknown ?types= patterns are rejected
+func TestEventsStream_InvalidTypes(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+	server.SetEventBus(events.NewBus(server.logger))
+
+	req, _ := http.NewRequest("GET", "/api/v1/events?types=peer.connected,servce.*", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := server.app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 400, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "servce.*")
+	assert.NotContains(t, string(body), "peer.connected")
+}
+
+// readSSEFrame reads lines up to the next blank line and returns the fields
+func readSSEFrame(t *testing.T, reader *bufio.Reader) map[string]string {
+	t.Helper()
+
+	frame := map[string]string{}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(frame) > 0 {
+				return frame
+			}
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ": "); ok && key != "" {
+			frame[key] = value
+		}
+	}
+
+	t.Fatal("no event received")
+	return nil
+}
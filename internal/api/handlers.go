@@ -1,13 +1,17 @@
 package api
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/authguard"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/ice"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/signaling"
+	"github.com/arqut/arqut-server-ce/internal/storage"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -41,20 +45,19 @@ func (s *Server) handleGenerateCredentials(c *fiber.Ctx) error {
 		return ErrorBadRequestResp(c, "peer_type must be 'edge' or 'client'")
 	}
 
-	// Use configured TTL if not provided
-	ttl := req.TTL
-	if ttl == 0 {
-		ttl = s.turnCfg.Auth.TTLSeconds
+	if req.TTL < 0 {
+		return ErrorBadRequestResp(c, "ttl must not be negative")
 	}
 
-	// Generate credentials
-	username, password, expiry := s.generateTURNCredentials(req.PeerType, req.PeerID, ttl)
+	// Generate credentials (TTL 0 uses the configured default; the result is
+	// clamped to the auth, peer type and API key policies)
+	creds := s.credentials.Issue(req.PeerType, req.PeerID, req.TTL, s.cfg.APIKey.TTL)
 
 	return SuccessResp(c, fiber.Map{
-		"username": username,
-		"password": password,
-		"ttl":      ttl,
-		"expires":  time.Unix(expiry, 0).UTC().Format(time.RFC3339),
+		"username": creds.Username,
+		"password": creds.Password,
+		"ttl":      creds.TTL,
+		"expires":  time.Unix(creds.Expiry, 0).UTC().Format(time.RFC3339),
 	})
 }
 
@@ -68,86 +71,321 @@ func (s *Server) handleGetICEServers(c *fiber.Ctx) error {
 		return ErrorBadRequestResp(c, "peer_id query parameter is required")
 	}
 
-	// Generate TURN credentials
-	username, password, expiry := s.generateTURNCredentials(peerType, peerID, s.turnCfg.Auth.TTLSeconds)
-
-	// Build ICE servers list
-	iceServers := []fiber.Map{
-		{
-			"urls": []string{
-				fmt.Sprintf("stun:%s:3478", s.turnCfg.PublicIP),
-			},
-		},
-		{
-			"urls": []string{
-				fmt.Sprintf("turn:%s:3478?transport=udp", s.turnCfg.PublicIP),
-				fmt.Sprintf("turn:%s:3478?transport=tcp", s.turnCfg.PublicIP),
-			},
-			"username":   username,
-			"credential": password,
-		},
-	}
-
-	// Add TURNS if TLS is configured
-	if s.turnCfg.Ports.TLS > 0 {
-		iceServers = append(iceServers, fiber.Map{
-			"urls": []string{
-				fmt.Sprintf("turns:%s:%d?transport=tcp", s.turnCfg.PublicIP, s.turnCfg.Ports.TLS),
-			},
-			"username":   username,
-			"credential": password,
-		})
+	// Optional transport subset, e.g. ?transports=udp,tls
+	transports, err := ice.ParseTransports(c.Query("transports"))
+	if err != nil {
+		return ErrorBadRequestResp(c, err.Error())
 	}
 
+	// Generate TURN credentials
+	creds := s.credentials.Issue(peerType, peerID, 0, s.cfg.APIKey.TTL)
+
+	iceServers := s.iceBuilder.Build(creds.Username, creds.Password, transports)
+
 	return SuccessResp(c, fiber.Map{
 		"ice_servers": iceServers,
-		"expires":     time.Unix(expiry, 0).UTC().Format(time.RFC3339),
+		"expires":     time.Unix(creds.Expiry, 0).UTC().Format(time.RFC3339),
 	})
 }
 
-// List all peers
+// List connected peers, filtered, sorted and paged by the query parameters
 func (s *Server) handleListPeers(c *fiber.Ctx) error {
-	peerType := c.Query("type", "") // Optional filter by type
-
-	var peers []*models.Peer
+	query, params, err := parsePeerQuery(c)
+	if err != nil {
+		return ErrorBadRequestResp(c, err.Error())
+	}
 
-	if peerType != "" {
-		// Filter by type
-		peers = s.registry.GetPeersByType(peerType)
-	} else {
-		// Get all peers
-		peers = s.registry.GetAllPeers()
+	page, err := s.registry.ListPeers(query)
+	if err != nil {
+		return ErrorBadRequestResp(c, capitalize(err.Error()))
 	}
 
-	return SuccessResp(c, peers)
+	return SuccessResp(c, page.Peers, params.pageMeta(page.Total, page.Offset, page.NextCursor))
 }
 
+// List services, filtered, sorted and paged by the query parameters
 func (s *Server) handleListServices(c *fiber.Ctx) error {
-	services, err := s.storage.ListAllServices()
+	return s.listServices(c, c.Query("edge_id"))
+}
+
+// serviceRequest is the body of service create and update requests.
+// Pointer fields are optional for PATCH.
+type serviceRequest struct {
+	ID         *string                `json:"id"` // Assigned by the server; only checked on update
+	EdgeID     *string                `json:"edge_id"`
+	LocalID    *string                `json:"local_id"` // Edge-local ID; generated when omitted on create
+	Name       *string                `json:"name"`
+	TunnelPort *int                   `json:"tunnel_port"`
+	LocalHost  *string                `json:"local_host"`
+	LocalPort  *int                   `json:"local_port"`
+	Protocol   *string                `json:"protocol"` // Default: http
+	Options    *models.ServiceOptions `json:"options"`  // Replaced as a whole
+	Labels     *map[string]string     `json:"labels"`   // Replaced as a whole
+	Enabled    *bool                  `json:"enabled"`  // Default: true
+}
+
+// Get a specific service
+func (s *Server) handleGetService(c *fiber.Ctx) error {
+	service, err := s.storage.GetEdgeService(c.Params("id"))
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to get service")
+	}
+
+	return SuccessResp(c, service)
+}
+
+// List the services of one edge, with the same parameters as all services
+func (s *Server) handleListEdgeServices(c *fiber.Ctx) error {
+	return s.listServices(c, c.Params("id"))
+}
+
+// listServices writes one page of the services matching the query
+// parameters, limited to one edge if edgeID is set
+func (s *Server) listServices(c *fiber.Ctx, edgeID string) error {
+	query, params, err := parseServiceQuery(c)
+	if err != nil {
+		return ErrorBadRequestResp(c, err.Error())
+	}
+	query.EdgeID = edgeID
+
+	page, err := s.storage.ListServices(query)
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to list services")
+	}
+
+	return SuccessResp(c, page.Services, params.pageMeta(int(page.Total), page.Offset, page.NextCursor))
+}
+
+// Create a service. Serves both POST /services (edge_id in the body) and
+// POST /edges/:id/services.
+func (s *Server) handleCreateService(c *fiber.Ctx) error {
+	var req serviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return ErrorBadRequestResp(c, "Invalid request body")
+	}
+
+	if edgeID := c.Params("id"); edgeID != "" {
+		if req.EdgeID != nil && *req.EdgeID != edgeID {
+			return ErrorBadRequestResp(c, "edge_id does not match the URL")
+		}
+		req.EdgeID = &edgeID
+	}
+
+	if req.ID != nil {
+		return ErrorBadRequestResp(c, "id is assigned by the server, use local_id")
+	}
+
+	service := newServiceFromRequest(&req)
+	if service.LocalID == "" {
+		id, err := generateServiceID()
+		if err != nil {
+			return ErrorInternalServerErrorResp(c, "Failed to generate service ID")
+		}
+		service.LocalID = id
+	}
+
+	if err := signaling.ValidateService(service); err != nil {
+		return ErrorBadRequestResp(c, err.Error())
+	}
+
+	service.CreatedAt = time.Now()
+	service.UpdatedAt = service.CreatedAt
+	err := s.storage.Transaction(func(tx storage.Storage) error {
+		if err := tx.CreateEdgeService(service); err != nil {
+			return err
+		}
+		return s.auditService(c, tx, models.AuditCreated, nil, service)
+	})
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to create service")
+	}
+
+	s.logger.Info("Service created via API", "edge", service.EdgeID, "service_id", service.ID, "local_id", service.LocalID, "name", service.Name)
+	return s.serviceChanged(c, signaling.ServiceOpCreated, events.ServiceCreated, service)
+}
+
+// Replace a service (PUT). Omitted fields take their create defaults.
+func (s *Server) handleReplaceService(c *fiber.Ctx) error {
+	existing, err := s.storage.GetEdgeService(c.Params("id"))
 	if err != nil {
-		return ErrorInternalServerErrorResp(c, "Failed to list services")
+		return ErrorStorageResp(c, err, "Failed to get service")
 	}
 
-	return SuccessResp(c, services)
+	var req serviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return ErrorBadRequestResp(c, "Invalid request body")
+	}
+	if err := checkServiceIdentity(existing, &req); err != nil {
+		return ErrorBadRequestResp(c, err.Error())
+	}
+
+	service := newServiceFromRequest(&req)
+	service.ID = existing.ID
+	service.EdgeID = existing.EdgeID
+	service.LocalID = existing.LocalID
+	service.CreatedAt = existing.CreatedAt
+	service.Health = existing.Health
+
+	return s.saveService(c, existing, service)
+}
+
+// Update selected fields of a service (PATCH)
+func (s *Server) handleUpdateService(c *fiber.Ctx) error {
+	service, err := s.storage.GetEdgeService(c.Params("id"))
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to get service")
+	}
+
+	var req serviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return ErrorBadRequestResp(c, "Invalid request body")
+	}
+	if err := checkServiceIdentity(service, &req); err != nil {
+		return ErrorBadRequestResp(c, err.Error())
+	}
+
+	before := *service
+	applyServiceRequest(service, &req)
+
+	return s.saveService(c, &before, service)
+}
+
+// saveService validates and stores an updated service; before is the stored
+// version it replaces
+func (s *Server) saveService(c *fiber.Ctx, before, service *models.EdgeService) error {
+	if err := signaling.ValidateService(service); err != nil {
+		return ErrorBadRequestResp(c, err.Error())
+	}
+
+	service.UpdatedAt = time.Now()
+	err := s.storage.Transaction(func(tx storage.Storage) error {
+		if err := tx.UpdateEdgeService(service); err != nil {
+			return err
+		}
+		return s.auditService(c, tx, models.AuditUpdated, before, service)
+	})
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to update service")
+	}
+
+	s.logger.Info("Service updated via API", "edge", service.EdgeID, "service_id", service.ID, "name", service.Name)
+	return s.serviceChanged(c, signaling.ServiceOpUpdated, events.ServiceUpdated, service)
 }
 
 func (s *Server) handleDeleteService(c *fiber.Ctx) error {
-	err := s.storage.DeleteEdgeService(c.Params("id"))
+	id := c.Params("id")
+
+	// Look up the owning edge for the event and push
+	existing, err := s.storage.GetEdgeService(id)
 	if err != nil {
-		return ErrorInternalServerErrorResp(c, "Failed to delete service")
+		return ErrorStorageResp(c, err, "Failed to get service")
 	}
 
+	err = s.storage.Transaction(func(tx storage.Storage) error {
+		if err := tx.DeleteEdgeService(id); err != nil {
+			return err
+		}
+		return s.auditService(c, tx, models.AuditDeleted, existing, nil)
+	})
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to delete service")
+	}
+
+	s.pushServiceChange(signaling.ServiceOpDeleted, existing)
+	s.events.Publish(events.ServiceDeleted, events.ServiceData{
+		ID:     id,
+		EdgeID: existing.EdgeID,
+		Source: events.SourceAPI,
+	})
+
 	return SuccessResp(c, fiber.Map{
 		"message": "Service deleted successfully",
 	})
 }
 
+// List the change history of a service, newest first. The history of a
+// deleted service stays available.
+func (s *Server) handleServiceHistory(c *fiber.Ctx) error {
+	id := c.Params("id")
+	entries, err := s.storage.ListServiceAudit(id)
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to get service history")
+	}
+
+	// Services last changed before the audit trail existed have no entries
+	if len(entries) == 0 {
+		if _, err := s.storage.GetEdgeService(id); err != nil {
+			return ErrorStorageResp(c, err, "Failed to get service")
+		}
+	}
+
+	return SuccessResp(c, entries)
+}
+
+// auditService appends a change made through the API to the service history.
+// The actor is the name of the API key and via the route that was called.
+func (s *Server) auditService(c *fiber.Ctx, tx storage.Storage, operation string, before, after *models.EdgeService) error {
+	entry := &models.ServiceAudit{
+		Operation: operation,
+		ActorType: models.ActorAPIKey,
+		Actor:     s.cfg.APIKey.Name,
+		Via:       c.Method() + " " + c.Route().Path,
+	}
+	if before != nil {
+		snapshot := *before
+		entry.Before = &snapshot
+		entry.ServiceID, entry.EdgeID = before.ID, before.EdgeID
+	}
+	if after != nil {
+		snapshot := *after
+		entry.After = &snapshot
+		entry.ServiceID, entry.EdgeID = after.ID, after.EdgeID
+	}
+	if err := tx.CreateServiceAudit(entry); err != nil {
+		return fmt.Errorf("failed to record service change: %w", err)
+	}
+	return nil
+}
+
+// serviceChanged publishes an API-side service change, pushes it to the
+// owning edge and writes the response
+func (s *Server) serviceChanged(c *fiber.Ctx, operation, eventType string, service *models.EdgeService) error {
+	snapshot := *service
+	s.events.Publish(eventType, events.ServiceData{
+		ID:      service.ID,
+		EdgeID:  service.EdgeID,
+		Source:  events.SourceAPI,
+		Service: &snapshot,
+	})
+
+	return SuccessResp(c, fiber.Map{
+		"service":       service,
+		"edge_notified": s.pushServiceChange(operation, service),
+	})
+}
+
+// pushServiceChange forwards a change to the owning edge if it is connected
+func (s *Server) pushServiceChange(operation string, service *models.EdgeService) bool {
+	if s.signaling == nil {
+		return false
+	}
+	return s.signaling.PushServiceChange(service.EdgeID, operation, service)
+}
+
 // Serve the services dashboard HTML page
 func (s *Server) handleServicesDashboard(c *fiber.Ctx) error {
 	c.Set("Content-Type", "text/html; charset=utf-8")
 	return c.Send(servicesHTML)
 }
 
+// List the multiplexed tunnel sessions of connected edges with their stream stats
+func (s *Server) handleListTunnels(c *fiber.Ctx) error {
+	if s.signaling == nil {
+		return SuccessResp(c, []signaling.TunnelInfo{})
+	}
+	return SuccessResp(c, s.signaling.TunnelStats())
+}
+
 // Get a specific peer
 func (s *Server) handleGetPeer(c *fiber.Ctx) error {
 	peerID := c.Params("id")
@@ -160,7 +398,9 @@ func (s *Server) handleGetPeer(c *fiber.Ctx) error {
 	return SuccessResp(c, peerToMap(peer))
 }
 
-// Rotate TURN secrets (admin endpoint)
+// handleRotateSecrets replaces the TURN REST secrets. The change reaches TURN
+// auth, the API and signaling through the shared credential issuer, but is
+// not written to the configuration: the next SIGHUP reload or restart reverts it.
 func (s *Server) handleRotateSecrets(c *fiber.Ctx) error {
 	var req struct {
 		Secret     string   `json:"secret"`
@@ -175,32 +415,129 @@ func (s *Server) handleRotateSecrets(c *fiber.Ctx) error {
 		return ErrorBadRequestResp(c, "secret is required")
 	}
 
-	// TODO: Call TURN server's UpdateSecrets method
-	// This requires passing the TURN server instance to the API server
+	s.credentials.UpdateSecrets(req.Secret, req.OldSecrets, s.credentials.TTL())
 
-	s.logger.Info("TURN secrets rotation requested")
+	s.logger.Info("TURN secrets rotated", "old_secrets", len(req.OldSecrets))
 
 	return SuccessResp(c, fiber.Map{
-		"message": "Secrets rotation endpoint - to be implemented",
+		"message": "TURN secrets rotated",
 	})
 }
 
+// handleListBans lists active authentication failure bans
+func (s *Server) handleListBans(c *fiber.Ctx) error {
+	if s.authGuard == nil {
+		return ErrorCodeResp(c, fiber.StatusNotFound, "auth guard is disabled")
+	}
+
+	return SuccessResp(c, fiber.Map{
+		"bans": s.authGuard.Bans(),
+	})
+}
+
+// handleClearBans lifts bans. With ?ip= or ?username= only that subject is
+// cleared, otherwise all bans are lifted.
+func (s *Server) handleClearBans(c *fiber.Ctx) error {
+	if s.authGuard == nil {
+		return ErrorCodeResp(c, fiber.StatusNotFound, "auth guard is disabled")
+	}
+
+	var keys []string
+	if ip := c.Query("ip"); ip != "" {
+		keys = append(keys, authguard.IPKey(ip))
+	}
+	if username := c.Query("username"); username != "" {
+		keys = append(keys, authguard.UserKey(username))
+	}
+
+	if len(keys) == 0 {
+		lifted := s.authGuard.ClearAll()
+		return SuccessResp(c, fiber.Map{"cleared": lifted})
+	}
+
+	cleared := 0
+	for _, key := range keys {
+		if s.authGuard.Clear(key) {
+			cleared++
+		}
+	}
+	if cleared == 0 {
+		return ErrorNotFoundResp(c, "No ban or failure history for the given subject")
+	}
+
+	return SuccessResp(c, fiber.Map{"cleared": cleared})
+}
+
 // Helper functions
 
-// generateTURNCredentials generates coturn-compatible credentials
-func (s *Server) generateTURNCredentials(peerType, peerID string, ttl int) (username, password string, expiry int64) {
-	// Calculate expiry timestamp
-	expiry = time.Now().Unix() + int64(ttl)
+// newServiceFromRequest builds a service from a create or replace request,
+// applying the create defaults
+func newServiceFromRequest(req *serviceRequest) *models.EdgeService {
+	service := &models.EdgeService{
+		Protocol: "http",
+		Enabled:  true,
+	}
+	if req.EdgeID != nil {
+		service.EdgeID = *req.EdgeID
+	}
+	if req.LocalID != nil {
+		service.LocalID = *req.LocalID
+	}
+	applyServiceRequest(service, req)
+	return service
+}
 
-	// Generate username: peerType:peerID:timestamp
-	username = fmt.Sprintf("%s:%s:%d", peerType, peerID, expiry)
+// applyServiceRequest copies the mutable fields present in req to service
+func applyServiceRequest(service *models.EdgeService, req *serviceRequest) {
+	if req.Name != nil {
+		service.Name = *req.Name
+	}
+	if req.TunnelPort != nil {
+		service.TunnelPort = *req.TunnelPort
+	}
+	if req.LocalHost != nil {
+		service.LocalHost = *req.LocalHost
+	}
+	if req.LocalPort != nil {
+		service.LocalPort = *req.LocalPort
+	}
+	if req.Protocol != nil {
+		service.Protocol = *req.Protocol
+	}
+	if req.Options != nil {
+		service.Options = *req.Options
+	}
+	if req.Labels != nil {
+		service.Labels = *req.Labels
+	}
+	if req.Enabled != nil {
+		service.Enabled = *req.Enabled
+	}
+}
 
-	// Generate password: base64(HMAC-SHA256(secret, username))
-	mac := hmac.New(sha256.New, []byte(s.turnCfg.Auth.Secret))
-	mac.Write([]byte(username))
-	password = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+// checkServiceIdentity rejects updates that try to change a service's ID,
+// edge or local ID
+func checkServiceIdentity(existing *models.EdgeService, req *serviceRequest) error {
+	if req.ID != nil && *req.ID != existing.ID {
+		return fmt.Errorf("id cannot be changed")
+	}
+	if req.EdgeID != nil && *req.EdgeID != existing.EdgeID {
+		return fmt.Errorf("edge_id cannot be changed")
+	}
+	if req.LocalID != nil && *req.LocalID != existing.LocalID {
+		return fmt.Errorf("local_id cannot be changed")
+	}
+	return nil
+}
 
-	return username, password, expiry
+// generateServiceID returns a random 8 character local ID for services
+// created without one
+func generateServiceID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
 }
 
 // peerToMap converts a Peer to a map for JSON response
@@ -5,15 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/arqut/arqut-server-ce/internal/apikey"
+	"github.com/arqut/arqut-server-ce/internal/authguard"
 	"github.com/arqut/arqut-server-ce/internal/config"
 	"github.com/arqut/arqut-server-ce/internal/registry"
 	"github.com/arqut/arqut-server-ce/internal/pkg/logger"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/turn"
+	"github.com/pion/stun/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -54,6 +58,16 @@ func getError(body map[string]interface{}) string {
 
 // setupTestServer creates a test server with a valid API key
 func setupTestServer(t *testing.T) (*Server, string) {
+	return newTestServer(t, nil, nil)
+}
+
+// setupTestServerWithGuard creates a test server that throttles auth failures with guard
+func setupTestServerWithGuard(t *testing.T, guard *authguard.Guard) (*Server, string) {
+	return newTestServer(t, guard, nil)
+}
+
+// newTestServer creates a test server; configure may adjust the API config before startup
+func newTestServer(t *testing.T, guard *authguard.Guard, configure func(cfg *config.APIConfig)) (*Server, string) {
 	// Generate API key
 	key, hash, err := apikey.GenerateWithHash()
 	require.NoError(t, err)
@@ -64,10 +78,14 @@ func setupTestServer(t *testing.T) (*Server, string) {
 			"http://localhost:3000",
 		},
 		APIKey: config.APIKeyConfig{
+			Name:      "test",
 			Hash:      hash,
 			CreatedAt: apikey.GetCreatedAt(),
 		},
 	}
+	if configure != nil {
+		configure(cfg)
+	}
 
 	turnCfg := &config.TurnConfig{
 		PublicIP: "127.0.0.1",
@@ -90,7 +108,7 @@ func setupTestServer(t *testing.T) (*Server, string) {
 	})
 
 	// Pass nil for signaling server and tlsConfig in tests (not needed for API tests)
-	server := New(cfg, turnCfg, reg, nil, nil, nil, log.Logger)
+	server := New(cfg, turnCfg, turn.NewCredentialIssuer(&turnCfg.Auth), guard, reg, nil, nil, nil, log.Logger)
 
 	return server, key
 }
@@ -178,6 +196,33 @@ func TestGenerateCredentials(t *testing.T) {
 				assert.Equal(t, float64(3600), data["ttl"])
 			},
 		},
+		{
+			name: "negative TTL",
+			payload: map[string]interface{}{
+				"peer_type": "client",
+				"peer_id":   "client-789",
+				"ttl":       -1,
+			},
+			useAuth:        true,
+			expectedStatus: 400,
+			checkResponse: func(t *testing.T, body map[string]interface{}) {
+				assert.Contains(t, getError(body), "ttl must not be negative")
+			},
+		},
+		{
+			name: "TTL beyond ceiling is clamped",
+			payload: map[string]interface{}{
+				"peer_type": "client",
+				"peer_id":   "client-789",
+				"ttl":       7 * 24 * 3600,
+			},
+			useAuth:        true,
+			expectedStatus: 200,
+			checkResponse: func(t *testing.T, body map[string]interface{}) {
+				data := getData(body)
+				assert.Equal(t, float64(48*3600), data["ttl"])
+			},
+		},
 		{
 			name: "missing peer_type",
 			payload: map[string]interface{}{
@@ -351,6 +396,125 @@ func TestGetICEServers(t *testing.T) {
 	}
 }
 
+// TestGetICEServers_DTLS tests that a DTLS listener is advertised as turns over UDP
+func TestGetICEServers_DTLS(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+	server.turnCfg.Ports.DTLS = 5350
+
+	req := httptest.NewRequest("GET", "/api/v1/ice-servers?peer_id=test-peer", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := server.app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var result map[string]interface{}
+	body, _ := io.ReadAll(resp.Body)
+	require.NoError(t, json.Unmarshal(body, &result))
+
+	iceServers := getData(result)["ice_servers"].([]interface{})
+	turnsServer := iceServers[len(iceServers)-1].(map[string]interface{})
+	urls := turnsServer["urls"].([]interface{})
+	assert.Contains(t, urls, "turns:127.0.0.1:5349?transport=tcp")
+	assert.Contains(t, urls, "turns:127.0.0.1:5350?transport=udp")
+}
+
+func TestGetICEServers_DualStack(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+	server.turnCfg.PublicIPv6 = "2001:db8::1"
+
+	req := httptest.NewRequest("GET", "/api/v1/ice-servers?peer_id=test-peer", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := server.app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var result map[string]interface{}
+	body, _ := io.ReadAll(resp.Body)
+	require.NoError(t, json.Unmarshal(body, &result))
+
+	iceServers := getData(result)["ice_servers"].([]interface{})
+	stunURLs := iceServers[0].(map[string]interface{})["urls"].([]interface{})
+	assert.Equal(t, []interface{}{"stun:127.0.0.1:3478", "stun:[2001:db8::1]:3478"}, stunURLs)
+
+	turnURLs := iceServers[1].(map[string]interface{})["urls"].([]interface{})
+	assert.Contains(t, turnURLs, "turn:127.0.0.1:3478?transport=udp")
+	assert.Contains(t, turnURLs, "turn:[2001:db8::1]:3478?transport=udp")
+	assert.Contains(t, turnURLs, "turn:[2001:db8::1]:3478?transport=tcp")
+
+	turnsURLs := iceServers[2].(map[string]interface{})["urls"].([]interface{})
+	assert.Contains(t, turnsURLs, "turns:[2001:db8::1]:5349?transport=tcp")
+}
+
+func TestGetICEServers_Transports(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+
+	t.Run("subset", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/ice-servers?peer_id=test-peer&transports=tls", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+
+		resp, err := server.app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		var result map[string]interface{}
+		body, _ := io.ReadAll(resp.Body)
+		require.NoError(t, json.Unmarshal(body, &result))
+
+		iceServers := getData(result)["ice_servers"].([]interface{})
+		require.Len(t, iceServers, 1)
+		urls := iceServers[0].(map[string]interface{})["urls"].([]interface{})
+		assert.Equal(t, []interface{}{"turns:127.0.0.1:5349?transport=tcp"}, urls)
+	})
+
+	t.Run("invalid transport", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/ice-servers?peer_id=test-peer&transports=quic", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+
+		resp, err := server.app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+}
+
+func TestGenerateCredentials_APIKeyTTLPolicy(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+	server.cfg.APIKey.TTL = config.TTLPolicy{Min: 600, Max: 3600}
+
+	tests := []struct {
+		name    string
+		ttl     int
+		wantTTL float64
+	}{
+		{"default clamped to key max", 0, 3600},
+		{"short clamped to key min", 60, 600},
+		{"within bounds", 1800, 1800},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, _ := json.Marshal(map[string]interface{}{
+				"peer_type": "client",
+				"peer_id":   "client-1",
+				"ttl":       tt.ttl,
+			})
+			req := httptest.NewRequest("POST", "/api/v1/credentials", bytes.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+
+			resp, err := server.app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, 200, resp.StatusCode)
+
+			var result map[string]interface{}
+			body, _ := io.ReadAll(resp.Body)
+			require.NoError(t, json.Unmarshal(body, &result))
+			assert.Equal(t, tt.wantTTL, getData(result)["ttl"])
+		})
+	}
+}
+
 // TestListPeers tests the peer listing endpoint
 func TestListPeers(t *testing.T) {
 	server, apiKey := setupTestServer(t)
@@ -423,6 +587,47 @@ func TestListPeers(t *testing.T) {
 				assert.Equal(t, "client", peer["type"])
 			},
 		},
+		{
+			name:           "page sorted by id",
+			queryParams:    "?sort=id&order=desc&limit=1",
+			useAuth:        true,
+			expectedStatus: 200,
+			checkResponse: func(t *testing.T, body map[string]interface{}) {
+				peers := getDataArray(body)
+				require.Len(t, peers, 1)
+				assert.Equal(t, "edge-1", peers[0].(map[string]interface{})["id"])
+
+				meta := body["meta"].(map[string]interface{})
+				assert.Equal(t, map[string]interface{}{"sort": "id", "order": "desc"}, meta["ordering"])
+				pagination := meta["pagination"].(map[string]interface{})
+				assert.Equal(t, float64(2), pagination["total"])
+				assert.Equal(t, float64(2), pagination["totalPages"])
+				assert.NotEmpty(t, pagination["nextCursor"])
+			},
+		},
+		{
+			name:           "filter by edge and id prefix",
+			queryParams:    "?edge_id=edge-1&id_prefix=client-",
+			useAuth:        true,
+			expectedStatus: 200,
+			checkResponse: func(t *testing.T, body map[string]interface{}) {
+				peers := getDataArray(body)
+				require.Len(t, peers, 1)
+				assert.Equal(t, "client-1", peers[0].(map[string]interface{})["id"])
+			},
+		},
+		{
+			name:           "unknown sort field",
+			queryParams:    "?sort=public_key",
+			useAuth:        true,
+			expectedStatus: 400,
+		},
+		{
+			name:           "invalid cursor",
+			queryParams:    "?cursor=bogus",
+			useAuth:        true,
+			expectedStatus: 400,
+		},
 		{
 			name:           "no authentication",
 			queryParams:    "",
@@ -552,7 +757,8 @@ func TestGenerateTURNCredentials(t *testing.T) {
 	peerID := "test-peer"
 	ttl := 3600
 
-	username, password, expiry := server.generateTURNCredentials(peerType, peerID, ttl)
+	creds := server.credentials.Issue(peerType, peerID, ttl)
+	username, password, expiry := creds.Username, creds.Password, creds.Expiry
 
 	// Check username format
 	assert.Contains(t, username, fmt.Sprintf("%s:%s:", peerType, peerID))
@@ -565,3 +771,202 @@ func TestGenerateTURNCredentials(t *testing.T) {
 	assert.Greater(t, expiry, now)
 	assert.LessOrEqual(t, expiry, now+int64(ttl)+1) // Allow 1 second tolerance
 }
+
+// TestRotateSecrets tests that rotation changes the secret TURN accepts credentials for
+func TestRotateSecrets(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+	do := newJSONDoer(t, server, apiKey)
+
+	auth := turn.NewAuthHandler("rest", server.credentials, nil, server.logger)
+	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
+
+	// turnAccepts runs a request signed with creds through TURN auth and
+	// checks its MESSAGE-INTEGRITY with the key TURN would use
+	turnAccepts := func(creds turn.Credentials) bool {
+		key, ok := auth.AuthenticateRequest(creds.Username, "test.com", srcAddr)
+		if !ok {
+			return false
+		}
+		msg, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+			stun.NewUsername(creds.Username), stun.NewRealm("test.com"),
+			stun.NewLongTermIntegrity(creds.Username, "test.com", creds.Password))
+		require.NoError(t, err)
+		return stun.MessageIntegrity(key).Check(msg) == nil
+	}
+
+	before := server.credentials.Issue("edge", "e1", 0)
+	require.True(t, turnAccepts(before))
+
+	status, _ := do("POST", "/api/v1/admin/secrets", map[string]interface{}{"old_secrets": []string{"test-secret"}})
+	assert.Equal(t, 400, status)
+
+	status, body := do("POST", "/api/v1/admin/secrets", map[string]interface{}{"secret": "new-secret", "old_secrets": []string{"test-secret"}})
+	require.Equal(t, 200, status, body)
+	assert.Equal(t, "TURN secrets rotated", getData(body)["message"])
+
+	after := server.credentials.Issue("edge", "e1", 0)
+	assert.NotEqual(t, before.Password, after.Password)
+	assert.Equal(t, 86400, after.TTL, "default TTL kept")
+	assert.True(t, turnAccepts(after))
+
+	// TURN derives the key from the current secret only
+	assert.False(t, turnAccepts(before), "signed with an old secret")
+}
+
+// TestAdminBans tests listing and clearing auth failure bans
+func TestAdminBans(t *testing.T) {
+	guard := authguard.New(&config.AuthGuardConfig{
+		Enabled:        true,
+		MaxFailures:    2,
+		Window:         time.Minute,
+		BanDuration:    time.Minute,
+		MaxBanDuration: time.Hour,
+	}, logger.New(logger.Config{Level: "error", Format: "text"}).Logger)
+	server, apiKey := setupTestServerWithGuard(t, guard)
+
+	do := func(method, url string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err := server.app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	// Ban a TURN username and an IP the way the TURN server would
+	guard.Failure(authguard.UserKey("edge:e1:1"), authguard.IPKey("192.0.2.1"))
+	guard.Failure(authguard.UserKey("edge:e1:1"), authguard.IPKey("192.0.2.1"))
+
+	status, body := do("GET", "/api/v1/admin/bans")
+	assert.Equal(t, 200, status)
+	bans := getData(body)["bans"].([]interface{})
+	assert.Len(t, bans, 2)
+
+	status, body = do("DELETE", "/api/v1/admin/bans?username=edge:e1:1")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(1), getData(body)["cleared"])
+	assert.Len(t, guard.Bans(), 1)
+
+	status, _ = do("DELETE", "/api/v1/admin/bans?ip=198.51.100.1")
+	assert.Equal(t, 404, status)
+
+	status, body = do("DELETE", "/api/v1/admin/bans")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(1), getData(body)["cleared"])
+	assert.Empty(t, guard.Bans())
+}
+
+// TestAdminBans_Disabled tests the ban endpoints without an auth guard
+func TestAdminBans_Disabled(t *testing.T) {
+	server, apiKey := setupTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/bans", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := server.app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+// TestAPIKeyFailuresBanClient tests that repeated invalid API keys ban the client IP
+func TestAPIKeyFailuresBanClient(t *testing.T) {
+	guard := authguard.New(&config.AuthGuardConfig{
+		Enabled:        true,
+		MaxFailures:    2,
+		Window:         time.Minute,
+		BanDuration:    time.Minute,
+		MaxBanDuration: time.Hour,
+	}, logger.New(logger.Config{Level: "error", Format: "text"}).Logger)
+	server, apiKey := setupTestServerWithGuard(t, guard)
+
+	wrongKey, _, err := apikey.GenerateWithHash()
+	require.NoError(t, err)
+
+	send := func(key string) int {
+		req := httptest.NewRequest("GET", "/api/v1/peers", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := server.app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, 401, send(wrongKey))
+	assert.Equal(t, 401, send(wrongKey))
+	assert.Equal(t, 429, send(apiKey))
+	assert.Len(t, guard.Bans(), 1)
+}
+
+// TestRateLimit_PerIP tests the per-client-IP request limit
+func TestRateLimit_PerIP(t *testing.T) {
+	server, _ := newTestServer(t, nil, func(cfg *config.APIConfig) {
+		cfg.RateLimit.PerIP = config.RateLimit{Rate: 0.001, Burst: 2}
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := server.app.Test(httptest.NewRequest("GET", "/api/v1/health", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+
+	resp, err := server.app.Test(httptest.NewRequest("GET", "/api/v1/health", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+}
+
+// TestRateLimit_PerKey tests the per-API-key request limit
+func TestRateLimit_PerKey(t *testing.T) {
+	server, apiKey := newTestServer(t, nil, func(cfg *config.APIConfig) {
+		cfg.RateLimit.PerKey = config.RateLimit{Rate: 0.001, Burst: 1}
+	})
+
+	send := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err := server.app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, 200, send("/api/v1/peers"))
+	assert.Equal(t, 429, send("/api/v1/peers"))
+
+	// Public endpoints are not subject to the per-key limit
+	assert.Equal(t, 200, send("/api/v1/health"))
+}
+
+// TestRateLimit_PerKeyAdmin tests that admin calls take one per-key token each
+func TestRateLimit_PerKeyAdmin(t *testing.T) {
+	guard := authguard.New(&config.AuthGuardConfig{
+		Enabled:        true,
+		MaxFailures:    10,
+		Window:         time.Minute,
+		BanDuration:    time.Minute,
+		MaxBanDuration: time.Hour,
+	}, logger.New(logger.Config{Level: "error", Format: "text"}).Logger)
+	server, apiKey := newTestServer(t, guard, func(cfg *config.APIConfig) {
+		cfg.RateLimit.PerKey = config.RateLimit{Rate: 0.001, Burst: 2}
+	})
+
+	send := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err := server.app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, 200, send("/api/v1/admin/bans"))
+	assert.Equal(t, 200, send("/api/v1/admin/bans"))
+	assert.Equal(t, 429, send("/api/v1/admin/bans"))
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/registry"
+	"github.com/arqut/arqut-server-ce/internal/signaling"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Page sizes of list endpoints
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// listParams are the paging and ordering query parameters shared by list
+// endpoints: limit, cursor, sort and order
+type listParams struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Desc   bool
+}
+
+// parseListParams reads the paging and ordering parameters. sorts lists the
+// valid sort fields; the first one is the default.
+func parseListParams(c *fiber.Ctx, sorts []string) (listParams, error) {
+	params := listParams{
+		Limit:  defaultPageSize,
+		Cursor: c.Query("cursor"),
+		Sort:   c.Query("sort", sorts[0]),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		params.Limit = n
+	}
+	if !slices.Contains(sorts, params.Sort) {
+		return params, fmt.Errorf("unknown sort field: %s (must be one of %s)", params.Sort, strings.Join(sorts, ", "))
+	}
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		params.Desc = true
+	default:
+		return params, fmt.Errorf("order must be asc or desc")
+	}
+	return params, nil
+}
+
+// pageMeta returns the response metadata of one page of a list
+func (p listParams) pageMeta(total, offset int, nextCursor string) ApiResponseMeta {
+	order := "asc"
+	if p.Desc {
+		order = "desc"
+	}
+	return ApiResponseMeta{
+		Ordering: &Map{"sort": p.Sort, "order": order},
+		Pagination: &Pagination{
+			Page:       offset/p.Limit + 1,
+			PerPage:    p.Limit,
+			Total:      total,
+			TotalPages: (total + p.Limit - 1) / p.Limit,
+			NextCursor: nextCursor,
+		},
+	}
+}
+
+// parseServiceQuery reads the filters, paging and ordering of service lists
+func parseServiceQuery(c *fiber.Ctx) (storage.ServiceQuery, listParams, error) {
+	params, err := parseListParams(c, storage.ServiceSorts)
+	if err != nil {
+		return storage.ServiceQuery{}, params, err
+	}
+
+	query := storage.ServiceQuery{
+		EdgeID:     c.Query("edge_id"),
+		Protocol:   c.Query("protocol"),
+		Health:     c.Query("health"),
+		NamePrefix: c.Query("name_prefix"),
+		Sort:       params.Sort,
+		Desc:       params.Desc,
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+	}
+
+	if enabled := c.Query("enabled"); enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return query, params, fmt.Errorf("enabled must be true or false")
+		}
+		query.Enabled = &b
+	}
+	if query.Protocol != "" && !slices.Contains(signaling.Protocols, query.Protocol) {
+		return query, params, fmt.Errorf("unknown protocol: %s", query.Protocol)
+	}
+	switch query.Health {
+	case "", models.HealthUp, models.HealthDown, models.HealthUnknown:
+	default:
+		return query, params, fmt.Errorf("unknown health status: %s", query.Health)
+	}
+
+	// label=key=value matches a value, label=key any service with the key
+	for _, label := range c.Context().QueryArgs().PeekMulti("label") {
+		key, value, _ := strings.Cut(string(label), "=")
+		if key == "" {
+			return query, params, fmt.Errorf("label filter must be key or key=value")
+		}
+		if query.Labels == nil {
+			query.Labels = make(map[string]string)
+		}
+		query.Labels[key] = value
+	}
+
+	return query, params, nil
+}
+
+// parsePeerQuery reads the filters, paging and ordering of peer lists
+func parsePeerQuery(c *fiber.Ctx) (registry.PeerQuery, listParams, error) {
+	params, err := parseListParams(c, registry.PeerSorts)
+	if err != nil {
+		return registry.PeerQuery{}, params, err
+	}
+
+	return registry.PeerQuery{
+		Type:     c.Query("type"),
+		EdgeID:   c.Query("edge_id"),
+		IDPrefix: c.Query("id_prefix"),
+		Sort:     params.Sort,
+		Desc:     params.Desc,
+		Limit:    params.Limit,
+		Cursor:   params.Cursor,
+	}, params, nil
+}
+
+// parseAuditQuery reads the filters, paging and ordering of the audit log.
+// since and until are RFC 3339 times.
+func parseAuditQuery(c *fiber.Ctx) (storage.AuditLogQuery, listParams, error) {
+	params, err := parseListParams(c, []string{storage.AuditLogSortCreatedAt})
+	if err != nil {
+		return storage.AuditLogQuery{}, params, err
+	}
+
+	query := storage.AuditLogQuery{
+		Actor:    c.Query("actor"),
+		ClientIP: c.Query("client_ip"),
+		Method:   c.Query("method"),
+		Route:    c.Query("route"),
+		Desc:     params.Desc,
+		Limit:    params.Limit,
+		Cursor:   params.Cursor,
+	}
+
+	for name, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := c.Query(name); value != "" {
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				return query, params, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+		}
+	}
+
+	return query, params, nil
+}
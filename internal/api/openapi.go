@@ -0,0 +1,383 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// openAPIVersion is the version of the API described by the OpenAPI document
+const openAPIVersion = "1.0.0"
+
+// apiOperation documents one route for the OpenAPI document. Request and
+// response schemas are generated from the Go types the handlers use.
+type apiOperation struct {
+	Method      string
+	Path        string // Fiber path, e.g. /api/v1/services/:id
+	Tag         string
+	Summary     string
+	Description string
+	Public      bool       // No API key required
+	Query       []apiParam // Query parameters; path parameters come from Path
+	Body        any        // Value of the request body type; nil for none
+	Data        any        // Value of the response data type; nil for none
+	List        bool       // Data is one page of a list, with meta
+	Errors      []int      // Error statuses besides 401 and 429, which are added
+
+	// Responses that are not JSON envelopes
+	Content     string // Media type of a non-JSON response, e.g. text/event-stream
+	Raw         bool   // Data is the whole JSON response, not wrapped in the envelope
+	WebSocket   bool   // Upgrades to a WebSocket
+	PlainErrors bool   // Errors are {"error": "..."} rather than ErrorResponse
+}
+
+// apiParam documents a query parameter
+type apiParam struct {
+	Name        string
+	Type        string // string (default), integer or boolean
+	Format      string // e.g. date-time
+	Enum        []string
+	Required    bool
+	Repeated    bool // May be given more than once
+	Description string
+}
+
+// pathParam matches Fiber path parameters
+var pathParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// openAPIPath converts a Fiber path to an OpenAPI path template
+func openAPIPath(path string) string {
+	return pathParam.ReplaceAllString(path, "{$1}")
+}
+
+// buildOpenAPI returns the OpenAPI 3 document describing ops
+func buildOpenAPI(ops []apiOperation) map[string]any {
+	g := &schemaGenerator{schemas: map[string]any{}}
+	paths := map[string]map[string]any{}
+	var tags []string
+
+	for _, op := range ops {
+		path := openAPIPath(op.Path)
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(op.Method)] = g.operation(op)
+		if !slices.Contains(tags, op.Tag) {
+			tags = append(tags, op.Tag)
+		}
+	}
+
+	tagList := make([]map[string]any, len(tags))
+	for i, tag := range tags {
+		tagList[i] = map[string]any{"name": tag}
+	}
+
+	g.schemaOf(reflect.TypeOf(ApiResponseMeta{}))
+	g.schemaOf(reflect.TypeOf(ApiError{}))
+	g.schemas["ErrorResponse"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"success": map[string]any{"type": "boolean", "enum": []any{false}},
+			"error":   ref("ApiError"),
+		},
+		"required": []string{"success", "error"},
+	}
+	g.schemas["PlainError"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"error":   map[string]any{"type": "string"},
+			"success": map[string]any{"type": "boolean", "enum": []any{false}},
+		},
+		"required": []string{"error"},
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "ArqTurn Server REST API",
+			"version":     openAPIVersion,
+			"description": "TURN credentials, peers, edge services, webhooks and WebSocket signaling.",
+		},
+		"servers": []any{map[string]any{"url": "/"}},
+		"tags":    tagList,
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"apiKey": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "arq_ API key",
+				},
+			},
+		},
+	}
+}
+
+// operation returns the OpenAPI operation object of op
+func (g *schemaGenerator) operation(op apiOperation) map[string]any {
+	out := map[string]any{
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+	if op.Description != "" {
+		out["description"] = op.Description
+	}
+	if op.Public {
+		out["security"] = []any{}
+	} else {
+		out["security"] = []any{map[string]any{"apiKey": []string{}}}
+	}
+
+	var params []any
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		params = append(params, map[string]any{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	for _, p := range op.Query {
+		params = append(params, p.object())
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if op.Body != nil {
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				fiber.MIMEApplicationJSON: map[string]any{"schema": g.schemaOf(reflect.TypeOf(op.Body))},
+			},
+		}
+	}
+
+	responses := map[string]any{}
+	switch {
+	case op.WebSocket:
+		responses["101"] = map[string]any{"description": "Switching to the WebSocket protocol"}
+	case op.Content != "":
+		responses["200"] = map[string]any{
+			"description": "OK",
+			"content":     map[string]any{op.Content: map[string]any{"schema": map[string]any{"type": "string"}}},
+		}
+	case op.Raw:
+		responses["200"] = map[string]any{
+			"description": "OK",
+			"content":     map[string]any{fiber.MIMEApplicationJSON: map[string]any{"schema": g.schemaOf(reflect.TypeOf(op.Data))}},
+		}
+	default:
+		responses["200"] = map[string]any{
+			"description": "OK",
+			"content":     map[string]any{fiber.MIMEApplicationJSON: map[string]any{"schema": g.envelope(op)}},
+		}
+	}
+
+	// Rate limits and API key failures are answered by middleware
+	errorSchema := "ErrorResponse"
+	if op.PlainErrors {
+		errorSchema = "PlainError"
+	}
+	if !op.Public {
+		responses[strconv.Itoa(fiber.StatusUnauthorized)] = errorResponse(fiber.StatusUnauthorized, "ErrorResponse")
+	}
+	if strings.HasPrefix(op.Path, "/api/") {
+		responses[strconv.Itoa(fiber.StatusTooManyRequests)] = errorResponse(fiber.StatusTooManyRequests, "ErrorResponse")
+	}
+	for _, code := range op.Errors {
+		responses[strconv.Itoa(code)] = errorResponse(code, errorSchema)
+	}
+	out["responses"] = responses
+	return out
+}
+
+// errorResponse returns the response object of an error status
+func errorResponse(code int, schema string) map[string]any {
+	return map[string]any{
+		"description": http.StatusText(code),
+		"content":     map[string]any{fiber.MIMEApplicationJSON: map[string]any{"schema": ref(schema)}},
+	}
+}
+
+// envelope returns the schema of a successful ApiResponse carrying op.Data
+func (g *schemaGenerator) envelope(op apiOperation) map[string]any {
+	properties := map[string]any{
+		"success": map[string]any{"type": "boolean", "enum": []any{true}},
+	}
+	required := []string{"success"}
+	if op.Data != nil {
+		properties["data"] = g.schemaOf(reflect.TypeOf(op.Data))
+		required = append(required, "data")
+	}
+	if op.List {
+		properties["meta"] = ref("ApiResponseMeta")
+		required = append(required, "meta")
+	}
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// operationID derives a unique operation ID from the method and path, e.g.
+// getServicesIdHistory for GET /api/v1/services/:id/history
+func operationID(op apiOperation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	path := strings.TrimPrefix(op.Path, "/api/v1")
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return !isAlnum(r) }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func isAlnum(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// object returns the OpenAPI parameter object of a query parameter
+func (p apiParam) object() map[string]any {
+	schema := map[string]any{"type": "string"}
+	if p.Type != "" {
+		schema["type"] = p.Type
+	}
+	if p.Format != "" {
+		schema["format"] = p.Format
+	}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	out := map[string]any{"name": p.Name, "in": "query", "schema": schema}
+	if p.Repeated {
+		out["schema"] = map[string]any{"type": "array", "items": schema}
+		out["explode"] = true
+	}
+	if p.Required {
+		out["required"] = true
+	}
+	if p.Description != "" {
+		out["description"] = p.Description
+	}
+	return out
+}
+
+// ref returns a reference to a component schema
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaGenerator builds JSON schemas from Go types the way encoding/json
+// marshals them. Named struct types become component schemas.
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaOf returns the schema of values of type t
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		// Component names are capitalized, for types such as serviceRequest
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = map[string]any{} // Placeholder for self references
+			g.schemas[name] = g.structSchema(t)
+		}
+		return ref(name)
+	default:
+		// Interfaces hold any JSON value
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the object schema of a struct type. Fields without
+// omitempty are required, as encoding/json always writes them.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" {
+				embedded := field.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					addFields(embedded)
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = g.schemaOf(field.Type)
+			if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	out := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// handleOpenAPI serves the OpenAPI document of the REST API
+func (s *Server) handleOpenAPI(c *fiber.Ctx) error {
+	return c.JSON(s.openAPI)
+}
@@ -0,0 +1,370 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/arqut/arqut-server-ce/internal/authguard"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/registry"
+	"github.com/arqut/arqut-server-ce/internal/signaling"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Response data of routes that answer with a fiber.Map
+type (
+	messageData struct {
+		Message string `json:"message"`
+	}
+	serviceChangeData struct {
+		Service      models.EdgeService `json:"service"`
+		EdgeNotified bool               `json:"edge_notified"` // Whether the owning edge was connected and told
+	}
+	clearedData struct {
+		Cleared int `json:"cleared"`
+	}
+)
+
+// listQuery returns the paging and ordering parameters of a list endpoint.
+// The first sort field is the default.
+func listQuery(sorts []string) []apiParam {
+	return []apiParam{
+		{Name: "limit", Type: "integer", Description: "Page size, 1 to 1000 (default 100)"},
+		{Name: "cursor", Description: "nextCursor of the previous page; only valid with the same sort and order"},
+		{Name: "sort", Enum: sorts, Description: "Sort field (default " + sorts[0] + ")"},
+		{Name: "order", Enum: []string{"asc", "desc"}, Description: "Sort order (default asc)"},
+	}
+}
+
+// serviceQuery returns the filters, paging and ordering of service lists
+func serviceQuery(withEdge bool) []apiParam {
+	var params []apiParam
+	if withEdge {
+		params = append(params, apiParam{Name: "edge_id", Description: "Only services of this edge"})
+	}
+	params = append(params,
+		apiParam{Name: "protocol", Enum: signaling.Protocols},
+		apiParam{Name: "enabled", Type: "boolean"},
+		apiParam{Name: "health", Enum: []string{models.HealthUp, models.HealthDown, models.HealthUnknown}},
+		apiParam{Name: "name_prefix"},
+		apiParam{Name: "label", Repeated: true, Description: "key=value matches a label value, key any service with the label"},
+	)
+	return append(params, listQuery(storage.ServiceSorts)...)
+}
+
+// apiOperations documents every route of the REST API, including the
+// signaling routes, for the OpenAPI document. TestOpenAPICoversRoutes fails
+// when a registered route is missing here.
+var apiOperations = []apiOperation{
+	// System
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/health", Tag: "System", Public: true,
+		Summary: "Health check",
+		Data: struct {
+			Status string `json:"status"`
+			Time   string `json:"time"`
+		}{},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/openapi.json", Tag: "System", Public: true,
+		Summary: "This OpenAPI document",
+		Data:    map[string]any{}, Raw: true,
+	},
+	{
+		Method: fiber.MethodGet, Path: "/dashboard/services", Tag: "System", Public: true,
+		Summary:     "Services dashboard",
+		Description: "HTML page listing services; it asks for the API key to call the API.",
+		Content:     fiber.MIMETextHTMLCharsetUTF8,
+	},
+
+	// TURN
+	{
+		Method: fiber.MethodPost, Path: "/api/v1/credentials", Tag: "TURN",
+		Summary:     "Generate TURN credentials",
+		Description: "ttl defaults to the configured TTL and is clamped to the peer type and API key limits.",
+		Body: struct {
+			PeerType string `json:"peer_type"` // edge or client
+			PeerID   string `json:"peer_id"`
+			TTL      int    `json:"ttl,omitempty"`
+		}{},
+		Data: struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TTL      int    `json:"ttl"`
+			Expires  string `json:"expires"`
+		}{},
+		Errors: []int{fiber.StatusBadRequest},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/ice-servers", Tag: "TURN",
+		Summary:     "Get ICE servers with TURN credentials",
+		Description: "Calls are always recorded in the audit log.",
+		Query: []apiParam{
+			{Name: "peer_id", Required: true},
+			{Name: "peer_type", Enum: []string{"client", "edge"}, Description: "Default client"},
+			{Name: "transports", Description: "Comma separated subset of udp, tcp, tls and dtls (default all)"},
+		},
+		Data: struct {
+			ICEServers []models.ICEServer `json:"ice_servers"`
+			Expires    string             `json:"expires"`
+		}{},
+		Errors: []int{fiber.StatusBadRequest},
+	},
+
+	// Peers
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/peers", Tag: "Peers",
+		Summary: "List connected peers",
+		Query: append([]apiParam{
+			{Name: "type", Enum: []string{"edge", "client"}},
+			{Name: "edge_id"},
+			{Name: "id_prefix"},
+		}, listQuery(registry.PeerSorts)...),
+		Data: []models.Peer{}, List: true,
+		Errors: []int{fiber.StatusBadRequest},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/peers/:id", Tag: "Peers",
+		Summary: "Get a connected peer",
+		Data:    models.Peer{},
+		Errors:  []int{fiber.StatusNotFound},
+	},
+
+	// Services
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/services", Tag: "Services",
+		Summary: "List services",
+		Query:   serviceQuery(true),
+		Data:    []models.EdgeService{}, List: true,
+		Errors: []int{fiber.StatusBadRequest},
+	},
+	{
+		Method: fiber.MethodPost, Path: "/api/v1/services", Tag: "Services",
+		Summary:     "Create a service",
+		Description: "edge_id, name, tunnel_port, local_host and local_port are required. The change is pushed to the edge if it is connected.",
+		Body:        serviceRequest{},
+		Data:        serviceChangeData{},
+		Errors:      []int{fiber.StatusBadRequest, fiber.StatusConflict},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/services/:id", Tag: "Services",
+		Summary: "Get a service",
+		Data:    models.EdgeService{},
+		Errors:  []int{fiber.StatusNotFound},
+	},
+	{
+		Method: fiber.MethodPut, Path: "/api/v1/services/:id", Tag: "Services",
+		Summary:     "Replace a service",
+		Description: "Omitted fields are reset to their defaults. id, edge_id and local_id cannot be changed.",
+		Body:        serviceRequest{},
+		Data:        serviceChangeData{},
+		Errors:      []int{fiber.StatusBadRequest, fiber.StatusNotFound, fiber.StatusConflict},
+	},
+	{
+		Method: fiber.MethodPatch, Path: "/api/v1/services/:id", Tag: "Services",
+		Summary:     "Update a service",
+		Description: "Only the fields present are changed. id, edge_id and local_id cannot be changed.",
+		Body:        serviceRequest{},
+		Data:        serviceChangeData{},
+		Errors:      []int{fiber.StatusBadRequest, fiber.StatusNotFound, fiber.StatusConflict},
+	},
+	{
+		Method: fiber.MethodDelete, Path: "/api/v1/services/:id", Tag: "Services",
+		Summary: "Delete a service",
+		Data:    messageData{},
+		Errors:  []int{fiber.StatusNotFound},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/services/:id/history", Tag: "Services",
+		Summary:     "Get the change history of a service",
+		Description: "Newest first. The history of a deleted service stays available.",
+		Data:        []models.ServiceAudit{},
+		Errors:      []int{fiber.StatusNotFound},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/edges/:id/services", Tag: "Services",
+		Summary: "List the services of an edge",
+		Query:   serviceQuery(false),
+		Data:    []models.EdgeService{}, List: true,
+		Errors: []int{fiber.StatusBadRequest},
+	},
+	{
+		Method: fiber.MethodPost, Path: "/api/v1/edges/:id/services", Tag: "Services",
+		Summary:     "Create a service on an edge",
+		Description: "Like POST /api/v1/services with edge_id taken from the path.",
+		Body:        serviceRequest{},
+		Data:        serviceChangeData{},
+		Errors:      []int{fiber.StatusBadRequest, fiber.StatusConflict},
+	},
+
+	// Tunnels and events
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/tunnels", Tag: "Tunnels",
+		Summary: "List the multiplexed tunnel sessions of connected edges",
+		Data:    []signaling.TunnelInfo{},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/events", Tag: "Events",
+		Summary:     "Stream events as Server-Sent Events",
+		Description: "Each event is sent with its ID, its type as the event name and the JSON event as data. Comments are sent as heartbeats.",
+		Query: []apiParam{
+			{Name: "types", Description: "Comma separated event types or prefixes, e.g. service.*"},
+		},
+		Content: "text/event-stream",
+		Errors:  []int{fiber.StatusBadRequest, fiber.StatusServiceUnavailable},
+	},
+
+	// Admin
+	{
+		Method: fiber.MethodPost, Path: "/api/v1/admin/secrets", Tag: "Admin",
+		Summary:     "Rotate TURN secrets",
+		Description: "New credentials are signed with secret. TURN accepts only the current secret, so credentials signed with a previous one, including old_secrets, stop working immediately. The change is not saved to the configuration and is reverted by the next SIGHUP reload or restart.",
+		Body: struct {
+			Secret     string   `json:"secret"`
+			OldSecrets []string `json:"old_secrets,omitempty"`
+		}{},
+		Data:   messageData{},
+		Errors: []int{fiber.StatusBadRequest},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/admin/audit", Tag: "Admin",
+		Summary: "List the audit log of authenticated API calls",
+		Query: append([]apiParam{
+			{Name: "actor", Description: "API key name"},
+			{Name: "client_ip"},
+			{Name: "method"},
+			{Name: "route", Description: "Route pattern, e.g. /api/v1/services/:id"},
+			{Name: "since", Format: "date-time"},
+			{Name: "until", Format: "date-time"},
+		}, listQuery([]string{storage.AuditLogSortCreatedAt})...),
+		Data: []models.AuditLog{}, List: true,
+		Errors: []int{fiber.StatusBadRequest},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/admin/bans", Tag: "Admin",
+		Summary: "List authentication failure bans",
+		Data: struct {
+			Bans []authguard.Ban `json:"bans"`
+		}{},
+		Errors: []int{fiber.StatusNotFound},
+	},
+	{
+		Method: fiber.MethodDelete, Path: "/api/v1/admin/bans", Tag: "Admin",
+		Summary:     "Lift bans",
+		Description: "Without parameters all bans are lifted.",
+		Query: []apiParam{
+			{Name: "ip"},
+			{Name: "username"},
+		},
+		Data:   clearedData{},
+		Errors: []int{fiber.StatusNotFound},
+	},
+
+	// Webhooks
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/admin/webhooks", Tag: "Webhooks",
+		Summary: "List webhook subscriptions",
+		Data:    []models.Webhook{},
+	},
+	{
+		Method: fiber.MethodPost, Path: "/api/v1/admin/webhooks", Tag: "Webhooks",
+		Summary:     "Create a webhook subscription",
+		Description: "url is required. The signing secret is only returned in this response.",
+		Body:        webhookRequest{},
+		Data: struct {
+			Webhook models.Webhook `json:"webhook"`
+			Secret  string         `json:"secret"`
+		}{},
+		Errors: []int{fiber.StatusBadRequest},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/admin/webhooks/:id", Tag: "Webhooks",
+		Summary: "Get a webhook subscription",
+		Data:    models.Webhook{},
+		Errors:  []int{fiber.StatusNotFound},
+	},
+	{
+		Method: fiber.MethodPut, Path: "/api/v1/admin/webhooks/:id", Tag: "Webhooks",
+		Summary:     "Update a webhook subscription",
+		Description: "Only the fields present are changed. With rotate_secret a new signing secret is generated and returned.",
+		Body:        webhookRequest{},
+		Data: struct {
+			Webhook models.Webhook `json:"webhook"`
+			Secret  string         `json:"secret,omitempty"`
+		}{},
+		Errors: []int{fiber.StatusBadRequest, fiber.StatusNotFound},
+	},
+	{
+		Method: fiber.MethodDelete, Path: "/api/v1/admin/webhooks/:id", Tag: "Webhooks",
+		Summary: "Delete a webhook subscription and its dead letters",
+		Data:    messageData{},
+		Errors:  []int{fiber.StatusNotFound},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/admin/webhooks/:id/dead-letters", Tag: "Webhooks",
+		Summary: "List the events a webhook failed to receive",
+		Data:    []models.WebhookDeadLetter{},
+		Errors:  []int{fiber.StatusNotFound},
+	},
+	{
+		Method: fiber.MethodPost, Path: "/api/v1/admin/webhooks/:id/dead-letters/:letter/retry", Tag: "Webhooks",
+		Summary: "Queue a dead letter for redelivery",
+		Data:    messageData{},
+		Errors:  []int{fiber.StatusNotFound, fiber.StatusServiceUnavailable},
+	},
+	{
+		Method: fiber.MethodDelete, Path: "/api/v1/admin/webhooks/:id/dead-letters/:letter", Tag: "Webhooks",
+		Summary: "Discard a dead letter",
+		Data:    messageData{},
+		Errors:  []int{fiber.StatusNotFound},
+	},
+
+	// Signaling. These routes answer errors with {"error": "..."}.
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/signaling/ws/:type", Tag: "Signaling",
+		Summary:     "Open a signaling WebSocket",
+		Description: "type is edge or client. Peers may pass their auth webhook token as token or as a Bearer header.",
+		Query: []apiParam{
+			{Name: "id", Required: true, Description: "Peer ID"},
+			{Name: "edgeid", Description: "Edge to connect through; required for clients"},
+			{Name: "publickey"},
+			{Name: "token", Description: "Token checked by the auth webhook"},
+		},
+		WebSocket: true, PlainErrors: true,
+		Errors: []int{fiber.StatusBadRequest, fiber.StatusForbidden, fiber.StatusUpgradeRequired, fiber.StatusServiceUnavailable},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/signaling/tunnel", Tag: "Signaling",
+		Summary:     "Open the multiplexed tunnel session of an edge",
+		Description: "A new session replaces the edge's previous one.",
+		Query: []apiParam{
+			{Name: "id", Required: true, Description: "Edge ID"},
+			{Name: "token", Description: "Token checked by the auth webhook"},
+		},
+		WebSocket: true, PlainErrors: true,
+		Errors: []int{fiber.StatusBadRequest, fiber.StatusForbidden, fiber.StatusUpgradeRequired, fiber.StatusServiceUnavailable},
+	},
+	{
+		Method: fiber.MethodGet, Path: "/api/v1/signaling/tunnel/:stream", Tag: "Signaling",
+		Summary:     "Open a tunnel stream requested by the server",
+		Description: "Used by edges without a multiplexed tunnel session.",
+		Query: []apiParam{
+			{Name: "id", Required: true, Description: "Edge ID"},
+			{Name: "token", Description: "Token checked by the auth webhook"},
+		},
+		WebSocket: true, PlainErrors: true,
+		Errors: []int{fiber.StatusBadRequest, fiber.StatusForbidden, fiber.StatusNotFound, fiber.StatusUpgradeRequired, fiber.StatusServiceUnavailable},
+	},
+	{
+		Method: fiber.MethodPost, Path: "/api/v1/signaling/client/connect", Tag: "Signaling",
+		Summary:     "Ask an edge to accept a client connection",
+		Description: "Waits up to 10 seconds for the edge's answer, which is returned as data.",
+		Body:        models.ClientConnectRequest{},
+		Data: struct {
+			Success bool            `json:"success"`
+			Data    json.RawMessage `json:"data"`
+		}{},
+		Raw: true, PlainErrors: true,
+		Errors: []int{fiber.StatusBadRequest, fiber.StatusNotFound, fiber.StatusRequestTimeout, fiber.StatusInternalServerError},
+	},
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/logger"
+	"github.com/arqut/arqut-server-ce/internal/registry"
+	"github.com/arqut/arqut-server-ce/internal/signaling"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSignalingTestServer creates a test server with the signaling routes registered
+func newSignalingTestServer(t *testing.T) *Server {
+	server, _ := setupTestServer(t)
+	log := logger.New(logger.Config{Level: "error", Format: "text"})
+	sig := signaling.New(&config.SignalingConfig{}, server.turnCfg, server.credentials, registry.New(), nil, log.Logger)
+	return New(server.cfg, server.turnCfg, server.credentials, nil, server.registry, nil, sig, nil, log.Logger)
+}
+
+// fetchOpenAPI returns the document served at /api/v1/openapi.json
+func fetchOpenAPI(t *testing.T, server *Server) map[string]interface{} {
+	t.Helper()
+	resp, err := server.app.Test(httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &doc))
+	return doc
+}
+
+// TestOpenAPICoversRoutes fails when a registered route is missing from the
+// OpenAPI document, or the document describes a route that does not exist
+func TestOpenAPICoversRoutes(t *testing.T) {
+	server := newSignalingTestServer(t)
+	paths := fetchOpenAPI(t, server)["paths"].(map[string]interface{})
+
+	registered := make(map[string]bool)
+	for _, route := range server.app.GetRoutes(true) {
+		// Fiber adds a HEAD route for every GET
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+		key := route.Method + " " + openAPIPath(route.Path)
+		registered[key] = true
+
+		item, ok := paths[openAPIPath(route.Path)].(map[string]interface{})
+		if assert.True(t, ok, "route %s is missing from the OpenAPI document", key) {
+			assert.Contains(t, item, strings.ToLower(route.Method), "route %s is missing from the OpenAPI document", key)
+		}
+	}
+
+	for path, item := range paths {
+		for method := range item.(map[string]interface{}) {
+			key := strings.ToUpper(method) + " " + path
+			assert.True(t, registered[key], "OpenAPI document describes %s, which is not registered", key)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	server, _ := setupTestServer(t)
+	doc := fetchOpenAPI(t, server)
+
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	paths := doc["paths"].(map[string]interface{})
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	// Path parameters are declared and operation IDs are unique
+	history := paths["/api/v1/services/{id}/history"].(map[string]interface{})["get"].(map[string]interface{})
+	params := history["parameters"].([]interface{})
+	require.Len(t, params, 1)
+	assert.Equal(t, map[string]interface{}{
+		"name": "id", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+	}, params[0])
+
+	ids := make(map[string]string)
+	for path, item := range paths {
+		for method, op := range item.(map[string]interface{}) {
+			id := op.(map[string]interface{})["operationId"].(string)
+			assert.NotContains(t, ids, id, "operationId of %s %s is not unique", method, path)
+			ids[id] = method + " " + path
+		}
+	}
+
+	// Public routes need no API key, the others do
+	health := paths["/api/v1/health"].(map[string]interface{})["get"].(map[string]interface{})
+	assert.Empty(t, health["security"])
+	assert.NotContains(t, health["responses"], "401")
+	create := paths["/api/v1/services"].(map[string]interface{})["post"].(map[string]interface{})
+	assert.NotEmpty(t, create["security"])
+	assert.Contains(t, create["responses"], "401")
+	assert.Contains(t, create["responses"], "409")
+
+	// Schemas are generated from the handler types
+	service := schemas["EdgeService"].(map[string]interface{})
+	properties := service["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"$ref": "#/components/schemas/ServiceOptions"}, properties["options"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "date-time"}, properties["created_at"])
+	assert.Equal(t, map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}, properties["labels"])
+	assert.Contains(t, service["required"], "tunnel_port")
+	assert.NotContains(t, service["required"], "labels")
+
+	// The webhook secret is never part of a webhook
+	assert.NotContains(t, schemas["Webhook"].(map[string]interface{})["properties"], "secret")
+
+	// Embedded stats are flattened into the tunnel info
+	tunnel := schemas["TunnelInfo"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, tunnel, "edge_id")
+	assert.Contains(t, tunnel, "active_streams")
+
+	// List responses carry the paging metadata
+	list := paths["/api/v1/services"].(map[string]interface{})["get"].(map[string]interface{})
+	listSchema := list["responses"].(map[string]interface{})["200"].(map[string]interface{})["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	assert.Contains(t, listSchema["required"], "meta")
+	assert.Equal(t, map[string]interface{}{
+		"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/EdgeService"},
+	}, listSchema["properties"].(map[string]interface{})["data"])
+}
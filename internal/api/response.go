@@ -1,8 +1,10 @@
 package api
 
 import (
+	"errors"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/storage"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -10,12 +12,14 @@ import (
 // Note: In production, this would import from github.com/arqut/common/types
 type Map map[string]interface{}
 
-// Pagination contains pagination metadata
+// Pagination contains pagination metadata. List endpoints page with cursors:
+// pass NextCursor as ?cursor= to get the next page; it is empty on the last.
 type Pagination struct {
-	Page       int `json:"page"`
-	PerPage    int `json:"perPage"`
-	Total      int `json:"total"`
-	TotalPages int `json:"totalPages"`
+	Page       int    `json:"page"`
+	PerPage    int    `json:"perPage"`
+	Total      int    `json:"total"`
+	TotalPages int    `json:"totalPages"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 // ApiResponseMeta contains metadata for API responses
@@ -100,3 +104,37 @@ func ErrorBadRequestResp(c *fiber.Ctx, message ...string) error {
 func ErrorInternalServerErrorResp(c *fiber.Ctx, message ...string) error {
 	return ErrorCodeResp(c, fiber.StatusInternalServerError, message...)
 }
+
+// StorageErrorStatus maps a storage error to its HTTP status code. Errors
+// without a storage sentinel are internal errors.
+func StorageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, storage.ErrConflict):
+		return fiber.StatusConflict
+	case errors.Is(err, storage.ErrInvalidQuery):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
+
+// ErrorStorageResp returns the error response for a storage error. Typed
+// errors are reported with their own message; anything else is a 500 with
+// the given message so database details are not exposed.
+func ErrorStorageResp(c *fiber.Ctx, err error, message string) error {
+	code := StorageErrorStatus(err)
+	if code == fiber.StatusInternalServerError {
+		return ErrorInternalServerErrorResp(c, message)
+	}
+	return ErrorCodeResp(c, code, capitalize(err.Error()))
+}
+
+// capitalize upper-cases the first letter of an error message
+func capitalize(s string) string {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return s
+	}
+	return string(s[0]-'a'+'A') + s[1:]
+}
@@ -7,11 +7,20 @@ import (
 	"net"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/audit"
+	"github.com/arqut/arqut-server-ce/internal/authguard"
 	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/ice"
 	"github.com/arqut/arqut-server-ce/internal/middleware"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/proxy"
+	"github.com/arqut/arqut-server-ce/internal/ratelimit"
 	"github.com/arqut/arqut-server-ce/internal/registry"
 	"github.com/arqut/arqut-server-ce/internal/signaling"
 	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/arqut/arqut-server-ce/internal/turn"
+	"github.com/arqut/arqut-server-ce/internal/webhook"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -21,28 +30,62 @@ import (
 // SignalingServer interface to avoid circular dependency
 type SignalingServer interface {
 	RegisterRoutes(router fiber.Router)
+	PushServiceChange(edgeID, operation string, service *models.EdgeService) bool
+	TunnelStats() []signaling.TunnelInfo
 }
 
 // Server represents the REST API server
 type Server struct {
-	app       *fiber.App
-	cfg       *config.APIConfig
-	turnCfg   *config.TurnConfig
-	registry  *registry.Registry
-	storage   storage.Storage
-	signaling SignalingServer
-	tlsConfig *tls.Config
-	logger    *slog.Logger
+	app         *fiber.App
+	cfg         *config.APIConfig
+	turnCfg     *config.TurnConfig
+	credentials *turn.CredentialIssuer
+	authGuard   *authguard.Guard
+	ipLimiter   *ratelimit.Limiter
+	keyLimiter  *ratelimit.Limiter
+	events      *events.Bus
+	webhooks    *webhook.Dispatcher
+	proxy       *proxy.Proxy
+	audit       *audit.Log
+	openAPI     map[string]any // OpenAPI document served at /api/v1/openapi.json
+	done        chan struct{}  // Closed on Stop to end event streams
+	iceBuilder  *ice.Builder
+	registry    *registry.Registry
+	storage     storage.Storage
+	signaling   SignalingServer
+	tlsConfig   *tls.Config
+	logger      *slog.Logger
 }
 
 // New creates a new API server
-func New(cfg *config.APIConfig, turnCfg *config.TurnConfig, reg *registry.Registry, storage storage.Storage, sig *signaling.Server, tlsConfig *tls.Config, log *slog.Logger) *Server {
+func New(cfg *config.APIConfig, turnCfg *config.TurnConfig, credentials *turn.CredentialIssuer, authGuard *authguard.Guard, reg *registry.Registry, storage storage.Storage, sig *signaling.Server, tlsConfig *tls.Config, log *slog.Logger) *Server {
 	app := fiber.New(fiber.Config{
 		AppName:               "ArqTurn REST API",
 		DisableStartupMessage: true,
 		ErrorHandler:          errorHandler,
 	})
 
+	s := &Server{
+		app:         app,
+		cfg:         cfg,
+		turnCfg:     turnCfg,
+		credentials: credentials,
+		authGuard:   authGuard,
+		ipLimiter:   ratelimit.New(cfg.RateLimit.PerIP.Rate, cfg.RateLimit.PerIP.Burst),
+		keyLimiter:  ratelimit.New(cfg.RateLimit.PerKey.Rate, cfg.RateLimit.PerKey.Burst),
+		iceBuilder:  ice.NewBuilder(turnCfg),
+		registry:    reg,
+		storage:     storage,
+		tlsConfig:   tlsConfig,
+		logger:      log,
+		done:        make(chan struct{}),
+		openAPI:     buildOpenAPI(apiOperations),
+	}
+	// Avoid storing a typed nil so the nil checks on s.signaling hold
+	if sig != nil {
+		s.signaling = sig
+	}
+
 	// Global middleware
 	app.Use(recover.New())
 	app.Use(logger.New(logger.Config{
@@ -55,26 +98,18 @@ func New(cfg *config.APIConfig, turnCfg *config.TurnConfig, reg *registry.Regist
 		},
 	}))
 
+	// Requests addressed to edge services bypass the API middleware below
+	app.Use(s.proxyRequests)
+
 	// CORS middleware
 	if len(cfg.CORSOrigins) > 0 {
 		app.Use(cors.New(cors.Config{
 			AllowOrigins: joinOrigins(cfg.CORSOrigins),
-			AllowMethods: "GET,POST,PUT,DELETE",
+			AllowMethods: "GET,POST,PUT,PATCH,DELETE",
 			AllowHeaders: "Origin,Content-Type,Accept,Authorization",
 		}))
 	}
 
-	s := &Server{
-		app:       app,
-		cfg:       cfg,
-		turnCfg:   turnCfg,
-		registry:  reg,
-		storage:   storage,
-		signaling: sig,
-		tlsConfig: tlsConfig,
-		logger:    log,
-	}
-
 	s.setupRoutes()
 
 	return s
@@ -85,20 +120,22 @@ func (s *Server) setupRoutes() {
 	// Services dashboard UI (public, outside API group)
 	s.app.Get("/dashboard/services", s.handleServicesDashboard)
 
-	// API v1 group
-	api := s.app.Group("/api/v1")
+	// API v1 group (rate limited per client IP)
+	api := s.app.Group("/api/v1", middleware.RateLimit(s.ipLimiter, middleware.ClientIP))
 
 	// Public endpoints (no auth)
 	api.Get("/health", s.handleHealth)
+	api.Get("/openapi.json", s.handleOpenAPI)
 
-	// Protected endpoints (require API key)
-	protected := api.Group("", middleware.APIKeyAuth(s.cfg.APIKey.Hash))
+	// Protected endpoints (require API key, rate limited per key)
+	keyLimit := middleware.RateLimit(s.keyLimiter, middleware.APIKeyID)
+	protected := api.Group("", middleware.APIKeyAuthWithGuard(s.cfg.APIKey.Hash, s.authGuard), keyLimit, s.auditRequests)
 	{
 		// TURN credentials
 		protected.Post("/credentials", s.handleGenerateCredentials)
 
 		// ICE servers configuration
-		protected.Get("/ice-servers", s.handleGetICEServers)
+		protected.Get("/ice-servers", privileged, s.handleGetICEServers)
 
 		// Peer management
 		protected.Get("/peers", s.handleListPeers)
@@ -106,13 +143,44 @@ func (s *Server) setupRoutes() {
 
 		// Service management
 		protected.Get("/services", s.handleListServices)
+		protected.Post("/services", s.handleCreateService)
+		protected.Get("/services/:id", s.handleGetService)
+		protected.Put("/services/:id", s.handleReplaceService)
+		protected.Patch("/services/:id", s.handleUpdateService)
 		protected.Delete("/services/:id", s.handleDeleteService)
+		protected.Get("/services/:id/history", s.handleServiceHistory)
+		protected.Get("/edges/:id/services", s.handleListEdgeServices)
+		protected.Post("/edges/:id/services", s.handleCreateService)
+
+		// Multiplexed edge tunnel sessions
+		protected.Get("/tunnels", s.handleListTunnels)
+
+		// Server-Sent Events stream of peer, service and TURN changes
+		protected.Get("/events", s.handleEvents)
 	}
 
-	// Admin endpoints (require API key)
-	admin := api.Group("/admin", middleware.APIKeyAuth(s.cfg.APIKey.Hash))
+	// Admin endpoints. The protected group's middleware already runs for
+	// every path under /api/v1, so it must not be added again here.
+	admin := protected.Group("/admin")
 	{
 		admin.Post("/secrets", s.handleRotateSecrets)
+
+		// Audit log of authenticated API calls
+		admin.Get("/audit", s.handleListAuditLog)
+
+		// Authentication failure bans
+		admin.Get("/bans", s.handleListBans)
+		admin.Delete("/bans", s.handleClearBans)
+
+		// Outbound event webhooks
+		admin.Get("/webhooks", s.handleListWebhooks)
+		admin.Post("/webhooks", s.handleCreateWebhook)
+		admin.Get("/webhooks/:id", s.handleGetWebhook)
+		admin.Put("/webhooks/:id", s.handleUpdateWebhook)
+		admin.Delete("/webhooks/:id", s.handleDeleteWebhook)
+		admin.Get("/webhooks/:id/dead-letters", s.handleListDeadLetters)
+		admin.Post("/webhooks/:id/dead-letters/:letter/retry", s.handleRetryDeadLetter)
+		admin.Delete("/webhooks/:id/dead-letters/:letter", s.handleDeleteDeadLetter)
 	}
 
 	// WebSocket signaling routes (under /api/v1/signaling)
@@ -148,9 +216,40 @@ func (s *Server) Start() error {
 // Stop gracefully stops the API server
 func (s *Server) Stop() error {
 	s.logger.Info("Stopping REST API server")
+	close(s.done)
 	return s.app.Shutdown()
 }
 
+// SetEventBus sets the bus streamed by /api/v1/events and used to publish API-side changes
+func (s *Server) SetEventBus(bus *events.Bus) {
+	s.events = bus
+}
+
+// SetWebhooks sets the dispatcher that is reloaded when webhooks change and
+// used to redeliver dead letters
+func (s *Server) SetWebhooks(d *webhook.Dispatcher) {
+	s.webhooks = d
+}
+
+// SetProxy sets the reverse proxy that serves requests addressed to edge
+// services; without one those requests reach the API routes
+func (s *Server) SetProxy(p *proxy.Proxy) {
+	s.proxy = p
+}
+
+// SetAuditLog sets the log that records authenticated API calls
+func (s *Server) SetAuditLog(l *audit.Log) {
+	s.audit = l
+}
+
+// proxyRequests hands requests to the reverse proxy, if one is set
+func (s *Server) proxyRequests(c *fiber.Ctx) error {
+	if s.proxy == nil {
+		return c.Next()
+	}
+	return s.proxy.Handle(c)
+}
+
 // App returns the underlying Fiber app (useful for testing)
 func (s *Server) App() *fiber.App {
 	return s.app
@@ -0,0 +1,548 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/pkg/logger"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/proxy"
+	"github.com/arqut/arqut-server-ce/internal/signaling"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/arqut/arqut-server-ce/internal/tunnel"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonDoer performs an authenticated JSON request and decodes the response
+type jsonDoer func(method, url string, body interface{}) (int, map[string]interface{})
+
+func newJSONDoer(t *testing.T, server *Server, apiKey string) jsonDoer {
+	return func(method, url string, body interface{}) (int, map[string]interface{}) {
+		var raw []byte
+		if body != nil {
+			var err error
+			raw, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+
+		req := httptest.NewRequest(method, url, bytes.NewReader(raw))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+}
+
+// useTestStorage backs server with a fresh SQLite database
+func useTestStorage(t *testing.T, server *Server) *storage.SQLiteStorage {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "api.db"))
+	require.NoError(t, err)
+	require.NoError(t, store.Init())
+	t.Cleanup(func() { store.Close() })
+	server.storage = store
+	return store
+}
+
+// fakeSignaling records pushed service changes; edges in online are connected
+type fakeSignaling struct {
+	mu     sync.Mutex
+	online map[string]bool
+	pushed []string
+}
+
+func (f *fakeSignaling) RegisterRoutes(router fiber.Router) {}
+
+func (f *fakeSignaling) PushServiceChange(edgeID, operation string, service *models.EdgeService) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.online[edgeID] {
+		return false
+	}
+	f.pushed = append(f.pushed, operation+":"+service.ID)
+	return true
+}
+
+func (f *fakeSignaling) TunnelStats() []signaling.TunnelInfo {
+	return []signaling.TunnelInfo{{EdgeID: "edge-1", Stats: tunnel.Stats{ActiveStreams: 2, TotalStreams: 5}}}
+}
+
+func setupServiceServer(t *testing.T) (*storage.SQLiteStorage, *fakeSignaling, *events.Bus, jsonDoer) {
+	server, apiKey := setupTestServer(t)
+	store := useTestStorage(t, server)
+
+	sig := &fakeSignaling{online: map[string]bool{"edge-1": true}}
+	server.signaling = sig
+
+	bus := events.NewBus(logger.New(logger.Config{Level: "error", Format: "text"}).Logger)
+	server.SetEventBus(bus)
+
+	return store, sig, bus, newJSONDoer(t, server, apiKey)
+}
+
+func TestServicesCRUD(t *testing.T) {
+	store, sig, bus, do := setupServiceServer(t)
+	sub := bus.Subscribe(10, "service.*")
+	defer sub.Close()
+
+	// Create with a generated ID
+	status, body := do("POST", "/api/v1/services", map[string]interface{}{
+		"edge_id":     "edge-1",
+		"name":        "web",
+		"tunnel_port": 8080,
+		"local_host":  "localhost",
+		"local_port":  3000,
+	})
+	require.Equal(t, 200, status, body)
+	data := getData(body)
+	assert.Equal(t, true, data["edge_notified"])
+	svc := data["service"].(map[string]interface{})
+	id := svc["id"].(string)
+	assert.Len(t, id, 8)
+	assert.Equal(t, "http", svc["protocol"])
+	assert.Equal(t, true, svc["enabled"])
+
+	status, body = do("GET", "/api/v1/services/"+id, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "web", getData(body)["name"])
+
+	// PATCH changes only the given fields
+	status, body = do("PATCH", "/api/v1/services/"+id, map[string]interface{}{"enabled": false})
+	require.Equal(t, 200, status, body)
+	svc = getData(body)["service"].(map[string]interface{})
+	assert.Equal(t, false, svc["enabled"])
+	assert.Equal(t, float64(8080), svc["tunnel_port"])
+
+	// PUT replaces the service; omitted fields take the create defaults
+	status, body = do("PUT", "/api/v1/services/"+id, map[string]interface{}{
+		"name":        "web2",
+		"tunnel_port": 8081,
+		"local_host":  "127.0.0.1",
+		"local_port":  3001,
+		"protocol":    "websocket",
+	})
+	require.Equal(t, 200, status, body)
+	stored, err := store.GetEdgeService(id)
+	require.NoError(t, err)
+	assert.Equal(t, "web2", stored.Name)
+	assert.Equal(t, "websocket", stored.Protocol)
+	assert.True(t, stored.Enabled)
+	assert.Equal(t, "edge-1", stored.EdgeID)
+
+	status, _ = do("DELETE", "/api/v1/services/"+id, nil)
+	assert.Equal(t, 200, status)
+
+	assert.Equal(t, []string{"created:" + id, "updated:" + id, "updated:" + id, "deleted:" + id}, sig.pushed)
+
+	var types []string
+	for len(sub.Events()) > 0 {
+		ev := <-sub.Events()
+		assert.Equal(t, events.SourceAPI, ev.Data.(events.ServiceData).Source)
+		types = append(types, ev.Type)
+	}
+	assert.Equal(t, []string{events.ServiceCreated, events.ServiceUpdated, events.ServiceUpdated, events.ServiceDeleted}, types)
+}
+
+func TestEdgeServices(t *testing.T) {
+	store, sig, _, do := setupServiceServer(t)
+
+	require.NoError(t, store.CreateEdgeService(&models.EdgeService{
+		ID: "other1", EdgeID: "edge-2", Name: "db", TunnelPort: 5432, LocalHost: "localhost", LocalPort: 5432, Protocol: "http",
+	}))
+
+	// Offline edge: stored but not pushed
+	status, body := do("POST", "/api/v1/edges/edge-2/services", map[string]interface{}{
+		"local_id":    "svc2",
+		"name":        "api",
+		"tunnel_port": 9090,
+		"local_host":  "localhost",
+		"local_port":  9000,
+	})
+	require.Equal(t, 200, status, body)
+	assert.Equal(t, false, getData(body)["edge_notified"])
+	svc := getData(body)["service"].(map[string]interface{})
+	assert.Equal(t, "svc2", svc["local_id"])
+	assert.NotEqual(t, "svc2", svc["id"], "the server assigns the ID")
+	assert.Empty(t, sig.pushed)
+
+	status, body = do("GET", "/api/v1/edges/edge-2/services", nil)
+	assert.Equal(t, 200, status)
+	assert.Len(t, getDataArray(body), 2)
+
+	status, body = do("GET", "/api/v1/edges/edge-1/services", nil)
+	assert.Equal(t, 200, status)
+	assert.Len(t, getDataArray(body), 0)
+
+	// Local IDs, names and tunnel ports are unique per edge
+	conflicts := []map[string]interface{}{
+		{"local_id": "svc2", "name": "api2", "tunnel_port": 9091},
+		{"local_id": "svc3", "name": "api", "tunnel_port": 9091},
+		{"local_id": "svc3", "name": "api2", "tunnel_port": 9090},
+	}
+	for _, fields := range conflicts {
+		fields["local_host"] = "localhost"
+		fields["local_port"] = 9000
+		status, body = do("POST", "/api/v1/edges/edge-2/services", fields)
+		assert.Equal(t, 409, status, body)
+	}
+
+	// but may be reused by other edges
+	status, body = do("POST", "/api/v1/edges/edge-3/services", map[string]interface{}{
+		"local_id": "svc2", "name": "api", "tunnel_port": 9090, "local_host": "localhost", "local_port": 9000,
+	})
+	assert.Equal(t, 200, status, body)
+}
+
+func TestServiceProtocols(t *testing.T) {
+	store, _, _, do := setupServiceServer(t)
+
+	status, body := do("POST", "/api/v1/services", map[string]interface{}{
+		"edge_id": "edge-1", "name": "grpc", "tunnel_port": 9000, "local_host": "localhost", "local_port": 50051,
+		"protocol": "grpc",
+		"options":  map[string]interface{}{"tls": true, "sni": "grpc.internal"},
+	})
+	require.Equal(t, 200, status, body)
+	id := getData(body)["service"].(map[string]interface{})["id"].(string)
+
+	stored, err := store.GetEdgeService(id)
+	require.NoError(t, err)
+	assert.Equal(t, models.ServiceOptions{TLS: true, SNI: "grpc.internal"}, stored.Options)
+
+	status, body = do("POST", "/api/v1/services", map[string]interface{}{
+		"edge_id": "edge-1", "name": "ssh", "tunnel_port": 2222, "local_host": "localhost", "local_port": 22,
+		"protocol": "tcp",
+	})
+	require.Equal(t, 200, status, body)
+
+	// Options the protocol does not accept are rejected
+	status, _ = do("PATCH", "/api/v1/services/"+id, map[string]interface{}{"protocol": "tcp"})
+	assert.Equal(t, 400, status)
+
+	status, body = do("GET", "/api/v1/services?protocol=grpc", nil)
+	assert.Equal(t, 200, status)
+	services := getDataArray(body)
+	require.Len(t, services, 1)
+	assert.Equal(t, "grpc", services[0].(map[string]interface{})["name"])
+
+	status, body = do("GET", "/api/v1/edges/edge-1/services?protocol=tcp", nil)
+	assert.Equal(t, 200, status)
+	assert.Len(t, getDataArray(body), 1)
+
+	status, _ = do("GET", "/api/v1/services?protocol=ftp", nil)
+	assert.Equal(t, 400, status)
+}
+
+func TestServiceHealth(t *testing.T) {
+	store, _, _, do := setupServiceServer(t)
+
+	status, body := do("POST", "/api/v1/services", map[string]interface{}{
+		"edge_id": "edge-1", "name": "web", "tunnel_port": 8080, "local_host": "localhost", "local_port": 3000,
+	})
+	require.Equal(t, 200, status, body)
+	service := getData(body)["service"].(map[string]interface{})
+	id := service["id"].(string)
+	assert.Equal(t, "unknown", service["health"].(map[string]interface{})["status"])
+
+	status, body = do("POST", "/api/v1/services", map[string]interface{}{
+		"edge_id": "edge-1", "name": "api", "tunnel_port": 8081, "local_host": "localhost", "local_port": 3001,
+	})
+	require.Equal(t, 200, status, body)
+
+	checkedAt := time.Now()
+	require.NoError(t, store.UpdateServiceHealth(id, models.ServiceHealth{Status: models.HealthUp, CheckedAt: &checkedAt, LatencyMs: 3.2, Source: "edge"}))
+
+	status, body = do("GET", "/api/v1/services/"+id, nil)
+	require.Equal(t, 200, status)
+	health := getData(body)["health"].(map[string]interface{})
+	assert.Equal(t, "up", health["status"])
+	assert.Equal(t, 3.2, health["latency_ms"])
+	assert.Equal(t, "edge", health["source"])
+	assert.NotEmpty(t, health["checked_at"])
+
+	// API updates keep the health
+	status, body = do("PUT", "/api/v1/services/"+id, map[string]interface{}{
+		"name": "web2", "tunnel_port": 8080, "local_host": "localhost", "local_port": 3000,
+	})
+	require.Equal(t, 200, status, body)
+	assert.Equal(t, "up", getData(body)["service"].(map[string]interface{})["health"].(map[string]interface{})["status"])
+
+	status, body = do("GET", "/api/v1/services?health=up", nil)
+	assert.Equal(t, 200, status)
+	services := getDataArray(body)
+	require.Len(t, services, 1)
+	assert.Equal(t, "web2", services[0].(map[string]interface{})["name"])
+
+	status, body = do("GET", "/api/v1/edges/edge-1/services?health=unknown", nil)
+	assert.Equal(t, 200, status)
+	assert.Len(t, getDataArray(body), 1)
+
+	status, _ = do("GET", "/api/v1/services?health=sleepy", nil)
+	assert.Equal(t, 400, status)
+}
+
+func TestServiceHistory(t *testing.T) {
+	store, _, _, do := setupServiceServer(t)
+
+	status, body := do("POST", "/api/v1/services", map[string]interface{}{
+		"edge_id": "edge-1", "name": "web", "tunnel_port": 8080, "local_host": "localhost", "local_port": 3000,
+	})
+	require.Equal(t, 200, status, body)
+	id := getData(body)["service"].(map[string]interface{})["id"].(string)
+
+	status, body = do("PATCH", "/api/v1/services/"+id, map[string]interface{}{"name": "web2"})
+	require.Equal(t, 200, status, body)
+
+	// A rejected change is not recorded
+	status, _ = do("PATCH", "/api/v1/services/"+id, map[string]interface{}{"tunnel_port": 0})
+	require.Equal(t, 400, status)
+
+	status, body = do("DELETE", "/api/v1/services/"+id, nil)
+	require.Equal(t, 200, status, body)
+
+	// The history of a deleted service is still available, newest first
+	status, body = do("GET", "/api/v1/services/"+id+"/history", nil)
+	require.Equal(t, 200, status, body)
+	entries := getDataArray(body)
+	require.Len(t, entries, 3)
+
+	deleted := entries[0].(map[string]interface{})
+	assert.Equal(t, "deleted", deleted["operation"])
+	assert.Equal(t, "api_key", deleted["actor_type"])
+	assert.Equal(t, "test", deleted["actor"])
+	assert.Equal(t, "DELETE /api/v1/services/:id", deleted["via"])
+	assert.Equal(t, "edge-1", deleted["edge_id"])
+	assert.Equal(t, "web2", deleted["before"].(map[string]interface{})["name"])
+	assert.Nil(t, deleted["after"])
+
+	updated := entries[1].(map[string]interface{})
+	assert.Equal(t, "updated", updated["operation"])
+	assert.Equal(t, "PATCH /api/v1/services/:id", updated["via"])
+	assert.Equal(t, "web", updated["before"].(map[string]interface{})["name"])
+	assert.Equal(t, "web2", updated["after"].(map[string]interface{})["name"])
+
+	created := entries[2].(map[string]interface{})
+	assert.Equal(t, "created", created["operation"])
+	assert.Equal(t, "POST /api/v1/services", created["via"])
+	assert.Nil(t, created["before"])
+
+	// A service without changes on record has an empty history
+	service := &models.EdgeService{EdgeID: "edge-1", Name: "legacy", TunnelPort: 8081, LocalHost: "localhost", LocalPort: 3001, Protocol: "http"}
+	require.NoError(t, store.CreateEdgeService(service))
+	status, body = do("GET", "/api/v1/services/"+service.ID+"/history", nil)
+	require.Equal(t, 200, status, body)
+	assert.Empty(t, getDataArray(body))
+
+	status, _ = do("GET", "/api/v1/services/unknown/history", nil)
+	assert.Equal(t, 404, status)
+}
+
+func TestListServicesPaging(t *testing.T) {
+	_, _, _, do := setupServiceServer(t)
+
+	for i, edge := range []string{"edge-1", "edge-1", "edge-2", "edge-2", "edge-2"} {
+		status, body := do("POST", "/api/v1/services", map[string]interface{}{
+			"edge_id": edge, "name": fmt.Sprintf("svc-%d", i), "tunnel_port": 8000 + i, "local_host": "localhost", "local_port": 3000,
+			"enabled": i != 4,
+			"labels":  map[string]string{"tier": []string{"web", "db"}[i%2]},
+		})
+		require.Equal(t, 200, status, body)
+	}
+
+	names := func(body map[string]interface{}) []string {
+		var names []string
+		for _, svc := range getDataArray(body) {
+			names = append(names, svc.(map[string]interface{})["name"].(string))
+		}
+		return names
+	}
+
+	// Follow the cursor through all pages
+	var all []string
+	url := "/api/v1/services?sort=name&order=desc&limit=2"
+	for page := 1; ; page++ {
+		status, body := do("GET", url, nil)
+		require.Equal(t, 200, status, body)
+		all = append(all, names(body)...)
+
+		pagination := body["meta"].(map[string]interface{})["pagination"].(map[string]interface{})
+		assert.Equal(t, float64(page), pagination["page"])
+		assert.Equal(t, float64(5), pagination["total"])
+		assert.Equal(t, float64(3), pagination["totalPages"])
+		next, _ := pagination["nextCursor"].(string)
+		if next == "" {
+			break
+		}
+		url = "/api/v1/services?sort=name&order=desc&limit=2&cursor=" + next
+	}
+	assert.Equal(t, []string{"svc-4", "svc-3", "svc-2", "svc-1", "svc-0"}, all)
+
+	for query, want := range map[string][]string{
+		"edge_id=edge-2&enabled=true": {"svc-2", "svc-3"},
+		"enabled=false":               {"svc-4"},
+		"name_prefix=svc-1":           {"svc-1"},
+		"label=tier=db":               {"svc-1", "svc-3"},
+		"label=tier&protocol=tcp":     nil,
+	} {
+		status, body := do("GET", "/api/v1/services?"+query, nil)
+		require.Equal(t, 200, status, body)
+		assert.Equal(t, want, names(body), query)
+	}
+
+	status, body := do("GET", "/api/v1/edges/edge-1/services?edge_id=edge-2", nil)
+	require.Equal(t, 200, status)
+	assert.Equal(t, []string{"svc-0", "svc-1"}, names(body), "the path edge wins")
+
+	status, body = do("GET", "/api/v1/edges/edge-3/services", nil)
+	require.Equal(t, 200, status)
+	assert.Equal(t, []interface{}{}, body["data"], "empty pages are empty arrays")
+
+	for _, query := range []string{"limit=0", "limit=1001", "sort=local_port", "order=up", "enabled=maybe", "label==x", "cursor=bogus"} {
+		status, _ := do("GET", "/api/v1/services?"+query, nil)
+		assert.Equal(t, 400, status, query)
+	}
+
+	// A cursor only continues the order it was made for
+	status, body = do("GET", "/api/v1/services?limit=1", nil)
+	require.Equal(t, 200, status)
+	next := body["meta"].(map[string]interface{})["pagination"].(map[string]interface{})["nextCursor"].(string)
+	status, _ = do("GET", "/api/v1/services?limit=1&order=desc&cursor="+next, nil)
+	assert.Equal(t, 400, status)
+}
+
+func TestListTunnels(t *testing.T) {
+	_, _, _, do := setupServiceServer(t)
+
+	status, body := do("GET", "/api/v1/tunnels", nil)
+	require.Equal(t, 200, status)
+	tunnels := body["data"].([]interface{})
+	require.Len(t, tunnels, 1)
+	info := tunnels[0].(map[string]interface{})
+	assert.Equal(t, "edge-1", info["edge_id"])
+	assert.Equal(t, float64(2), info["active_streams"])
+	assert.Equal(t, float64(5), info["total_streams"])
+}
+
+// offlineDialer reports every edge as offline
+type offlineDialer struct{}
+
+func (offlineDialer) DialService(ctx context.Context, service *models.EdgeService) (net.Conn, error) {
+	return nil, tunnel.ErrEdgeOffline
+}
+
+// TestServiceProxy tests that requests addressed to a service reach the
+// proxy before the API routes and their authentication
+func TestServiceProxy(t *testing.T) {
+	server, _ := setupTestServer(t)
+	store := useTestStorage(t, server)
+
+	service := &models.EdgeService{
+		EdgeID: "edge-1", Name: "web", TunnelPort: 8001, LocalHost: "localhost", LocalPort: 80, Protocol: "http", Enabled: true,
+	}
+	require.NoError(t, store.CreateEdgeService(service))
+	id := service.ID
+
+	// Without a proxy the host is ignored
+	req := httptest.NewRequest("GET", "http://"+id+".proxy.test/api/v1/health", nil)
+	resp, err := server.app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	server.SetProxy(proxy.New(&config.ProxyConfig{Domain: "proxy.test", DialTimeout: time.Second}, store, offlineDialer{}, server.logger))
+
+	req = httptest.NewRequest("GET", "http://"+id+".proxy.test/api/v1/health", nil)
+	resp, err = server.app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 502, resp.StatusCode)
+
+	req = httptest.NewRequest("GET", "/api/v1/health", nil)
+	resp, err = server.app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestServicesValidation(t *testing.T) {
+	store, _, _, do := setupServiceServer(t)
+
+	require.NoError(t, store.CreateEdgeService(&models.EdgeService{
+		ID: "svc1", EdgeID: "edge-1", Name: "web", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http",
+	}))
+
+	valid := map[string]interface{}{"edge_id": "edge-1", "name": "web", "tunnel_port": 8080, "local_host": "localhost", "local_port": 3000}
+	with := func(key string, value interface{}) map[string]interface{} {
+		body := map[string]interface{}{}
+		for k, v := range valid {
+			body[k] = v
+		}
+		body[key] = value
+		return body
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   map[string]interface{}
+		want   int
+	}{
+		{"missing edge", "POST", "/api/v1/services", with("edge_id", ""), 400},
+		{"client ID", "POST", "/api/v1/services", with("id", "svc9"), 400},
+		{"change local ID", "PATCH", "/api/v1/services/svc1", map[string]interface{}{"local_id": "svc9"}, 400},
+		{"taken tunnel port", "POST", "/api/v1/services", with("name", "web2"), 409},
+		{"bad port", "POST", "/api/v1/services", with("tunnel_port", 70000), 400},
+		{"bad protocol", "POST", "/api/v1/services", with("protocol", "ftp"), 400},
+		{"bad name", "POST", "/api/v1/services", with("name", "web!"), 400},
+		{"edge mismatch", "POST", "/api/v1/edges/edge-2/services", valid, 400},
+		{"change edge", "PATCH", "/api/v1/services/svc1", map[string]interface{}{"edge_id": "edge-2"}, 400},
+		{"change id", "PUT", "/api/v1/services/svc1", with("id", "svc9"), 400},
+		{"invalid patch", "PATCH", "/api/v1/services/svc1", map[string]interface{}{"local_port": 0}, 400},
+		{"unknown service", "PATCH", "/api/v1/services/missing", map[string]interface{}{"enabled": true}, 404},
+		{"unknown service get", "GET", "/api/v1/services/missing", nil, 404},
+		{"unknown service put", "PUT", "/api/v1/services/missing", valid, 404},
+		{"unknown service delete", "DELETE", "/api/v1/services/missing", nil, 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body interface{}
+			if tt.body != nil {
+				body = tt.body
+			}
+			status, _ := do(tt.method, tt.url, body)
+			assert.Equal(t, tt.want, status)
+		})
+	}
+
+	stored, err := store.GetEdgeService("svc1")
+	require.NoError(t, err)
+	assert.Equal(t, 3000, stored.LocalPort, "rejected updates are not stored")
+}
+
+func TestStorageErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("service %w", storage.ErrNotFound), fiber.StatusNotFound},
+		{fmt.Errorf("service svc1 %w", storage.ErrConflict), fiber.StatusConflict},
+		{errors.New("disk I/O error"), fiber.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, StorageErrorStatus(tt.err), tt.err.Error())
+	}
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/webhook"
+	"github.com/gofiber/fiber/v2"
+)
+
+// webhookRequest is the body of webhook create and update requests.
+// Pointer fields are optional on update.
+type webhookRequest struct {
+	URL          *string   `json:"url"`
+	Events       *[]string `json:"events"` // Event types or prefixes; empty = all events
+	Description  *string   `json:"description"`
+	Enabled      *bool     `json:"enabled"` // Default: true
+	Secret       *string   `json:"secret"`  // Generated when omitted on create
+	RotateSecret bool      `json:"rotate_secret"`
+}
+
+// handleListWebhooks lists webhook subscriptions
+func (s *Server) handleListWebhooks(c *fiber.Ctx) error {
+	hooks, err := s.storage.ListWebhooks()
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to list webhooks")
+	}
+
+	return SuccessResp(c, hooks)
+}
+
+// handleGetWebhook returns a single webhook subscription
+func (s *Server) handleGetWebhook(c *fiber.Ctx) error {
+	hook, err := s.storage.GetWebhook(c.Params("id"))
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to get webhook")
+	}
+
+	return SuccessResp(c, hook)
+}
+
+// handleCreateWebhook creates a subscription. The signing secret is only
+// returned in this response.
+func (s *Server) handleCreateWebhook(c *fiber.Ctx) error {
+	var req webhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return ErrorBadRequestResp(c, "Invalid request body")
+	}
+	if req.URL == nil || *req.URL == "" {
+		return ErrorBadRequestResp(c, "url is required")
+	}
+
+	id, err := webhook.GenerateID()
+	if err != nil {
+		return ErrorInternalServerErrorResp(c, "Failed to generate webhook ID")
+	}
+
+	now := time.Now()
+	hook := &models.Webhook{
+		ID:        id,
+		Events:    []string{},
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := applyWebhookRequest(hook, &req); err != nil {
+		return ErrorBadRequestResp(c, err.Error())
+	}
+	if hook.Secret == "" {
+		if hook.Secret, err = webhook.GenerateSecret(); err != nil {
+			return ErrorInternalServerErrorResp(c, "Failed to generate webhook secret")
+		}
+	}
+
+	if err := s.storage.CreateWebhook(hook); err != nil {
+		return ErrorStorageResp(c, err, "Failed to create webhook")
+	}
+	s.reloadWebhooks()
+
+	s.logger.Info("Webhook created", "id", hook.ID, "url", hook.URL, "events", hook.Events)
+
+	return SuccessResp(c, fiber.Map{
+		"webhook": hook,
+		"secret":  hook.Secret,
+	})
+}
+
+// handleUpdateWebhook changes a subscription. With rotate_secret a new
+// signing secret is generated and returned.
+func (s *Server) handleUpdateWebhook(c *fiber.Ctx) error {
+	hook, err := s.storage.GetWebhook(c.Params("id"))
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to get webhook")
+	}
+
+	var req webhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return ErrorBadRequestResp(c, "Invalid request body")
+	}
+	if req.RotateSecret && req.Secret != nil {
+		return ErrorBadRequestResp(c, "secret and rotate_secret are mutually exclusive")
+	}
+
+	if err := applyWebhookRequest(hook, &req); err != nil {
+		return ErrorBadRequestResp(c, err.Error())
+	}
+	if req.RotateSecret {
+		if hook.Secret, err = webhook.GenerateSecret(); err != nil {
+			return ErrorInternalServerErrorResp(c, "Failed to generate webhook secret")
+		}
+	}
+	hook.UpdatedAt = time.Now()
+
+	if err := s.storage.UpdateWebhook(hook); err != nil {
+		return ErrorStorageResp(c, err, "Failed to update webhook")
+	}
+	s.reloadWebhooks()
+
+	s.logger.Info("Webhook updated", "id", hook.ID, "rotated_secret", req.RotateSecret)
+
+	resp := fiber.Map{"webhook": hook}
+	if req.RotateSecret {
+		resp["secret"] = hook.Secret
+	}
+	return SuccessResp(c, resp)
+}
+
+// handleDeleteWebhook removes a subscription and its dead letters
+func (s *Server) handleDeleteWebhook(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := s.storage.DeleteWebhook(id); err != nil {
+		return ErrorStorageResp(c, err, "Failed to delete webhook")
+	}
+	s.reloadWebhooks()
+
+	s.logger.Info("Webhook deleted", "id", id)
+
+	return SuccessResp(c, fiber.Map{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// handleListDeadLetters lists the events a webhook failed to receive
+func (s *Server) handleListDeadLetters(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if _, err := s.storage.GetWebhook(id); err != nil {
+		return ErrorStorageResp(c, err, "Failed to get webhook")
+	}
+
+	letters, err := s.storage.ListWebhookDeadLetters(id)
+	if err != nil {
+		return ErrorStorageResp(c, err, "Failed to list dead letters")
+	}
+
+	return SuccessResp(c, letters)
+}
+
+// handleRetryDeadLetter queues a dead-lettered event for redelivery
+func (s *Server) handleRetryDeadLetter(c *fiber.Ctx) error {
+	if s.webhooks == nil {
+		return ErrorCodeResp(c, fiber.StatusServiceUnavailable, "webhook delivery is not available")
+	}
+
+	letter, ok := s.lookupDeadLetter(c)
+	if !ok {
+		return ErrorNotFoundResp(c, "Dead letter not found")
+	}
+
+	if err := s.webhooks.Redeliver(letter.ID); err != nil {
+		if err == webhook.ErrQueueFull || err == webhook.ErrStopped {
+			return ErrorCodeResp(c, fiber.StatusServiceUnavailable, err.Error())
+		}
+		return ErrorInternalServerErrorResp(c, "Failed to queue redelivery")
+	}
+
+	return SuccessResp(c, fiber.Map{
+		"message": "Redelivery queued",
+	})
+}
+
+// handleDeleteDeadLetter discards a dead-lettered event
+func (s *Server) handleDeleteDeadLetter(c *fiber.Ctx) error {
+	letter, ok := s.lookupDeadLetter(c)
+	if !ok {
+		return ErrorNotFoundResp(c, "Dead letter not found")
+	}
+
+	if err := s.storage.DeleteWebhookDeadLetter(letter.ID); err != nil {
+		return ErrorStorageResp(c, err, "Failed to delete dead letter")
+	}
+
+	return SuccessResp(c, fiber.Map{
+		"message": "Dead letter deleted successfully",
+	})
+}
+
+// lookupDeadLetter resolves :letter, which must belong to webhook :id
+func (s *Server) lookupDeadLetter(c *fiber.Ctx) (*models.WebhookDeadLetter, bool) {
+	letterID, err := strconv.ParseUint(c.Params("letter"), 10, 0)
+	if err != nil {
+		return nil, false
+	}
+
+	letter, err := s.storage.GetWebhookDeadLetter(uint(letterID))
+	if err != nil || letter.WebhookID != c.Params("id") {
+		return nil, false
+	}
+	return letter, true
+}
+
+// reloadWebhooks refreshes the dispatcher after a subscription change
+func (s *Server) reloadWebhooks() {
+	if s.webhooks == nil {
+		return
+	}
+	if err := s.webhooks.Reload(); err != nil {
+		s.logger.Error("Failed to reload webhooks", "error", err)
+	}
+}
+
+// applyWebhookRequest validates the fields present in req and copies them to hook
+func applyWebhookRequest(hook *models.Webhook, req *webhookRequest) error {
+	if req.URL != nil {
+		url := strings.TrimSpace(*req.URL)
+		if err := webhook.ValidateURL(url); err != nil {
+			return err
+		}
+		hook.URL = url
+	}
+
+	if req.Events != nil {
+		patterns := make([]string, 0, len(*req.Events))
+		for _, p := range *req.Events {
+			p = strings.TrimSpace(p)
+			if !events.ValidPattern(p) {
+				return fmt.Errorf("unknown event type or pattern: %q", p)
+			}
+			patterns = append(patterns, p)
+		}
+		hook.Events = patterns
+	}
+
+	if req.Description != nil {
+		hook.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+	if req.Secret != nil {
+		if *req.Secret == "" {
+			return fmt.Errorf("secret must not be empty")
+		}
+		hook.Secret = *req.Secret
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/logger"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/arqut/arqut-server-ce/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupWebhookServer returns a test server backed by a real database and a
+// running (but idle) webhook dispatcher
+func setupWebhookServer(t *testing.T) (*Server, *storage.SQLiteStorage, jsonDoer) {
+	server, apiKey := setupTestServer(t)
+	store := useTestStorage(t, server)
+
+	log := logger.New(logger.Config{Level: "error", Format: "text"})
+	dispatcher := webhook.New(&config.WebhooksConfig{
+		Timeout:         time.Second,
+		MaxAttempts:     1,
+		RetryBackoff:    time.Millisecond,
+		MaxRetryBackoff: time.Millisecond,
+		Workers:         1,
+		QueueSize:       10,
+	}, store, log.Logger)
+	require.NoError(t, dispatcher.Start(nil))
+	t.Cleanup(dispatcher.Stop)
+	server.SetWebhooks(dispatcher)
+
+	return server, store, newJSONDoer(t, server, apiKey)
+}
+
+func TestWebhooksCRUD(t *testing.T) {
+	_, store, do := setupWebhookServer(t)
+
+	status, body := do("POST", "/api/v1/admin/webhooks", map[string]interface{}{
+		"url":         "https://example.com/hook",
+		"events":      []string{"service.*", "peer.disconnected"},
+		"description": "backend",
+	})
+	require.Equal(t, 200, status, body)
+	data := getData(body)
+	secret := data["secret"].(string)
+	assert.True(t, strings.HasPrefix(secret, webhook.SecretPrefix))
+	hook := data["webhook"].(map[string]interface{})
+	id := hook["id"].(string)
+	assert.Equal(t, true, hook["enabled"])
+	assert.NotContains(t, hook, "secret")
+
+	stored, err := store.GetWebhook(id)
+	require.NoError(t, err)
+	assert.Equal(t, secret, stored.Secret)
+
+	// The secret is never listed
+	status, body = do("GET", "/api/v1/admin/webhooks", nil)
+	assert.Equal(t, 200, status)
+	hooks := getDataArray(body)
+	require.Len(t, hooks, 1)
+	assert.NotContains(t, hooks[0], "secret")
+
+	// Partial update keeps other fields
+	status, body = do("PUT", "/api/v1/admin/webhooks/"+id, map[string]interface{}{"enabled": false})
+	assert.Equal(t, 200, status)
+	hook = getData(body)["webhook"].(map[string]interface{})
+	assert.Equal(t, false, hook["enabled"])
+	assert.Equal(t, "https://example.com/hook", hook["url"])
+	assert.NotContains(t, getData(body), "secret")
+
+	status, body = do("PUT", "/api/v1/admin/webhooks/"+id, map[string]interface{}{"rotate_secret": true})
+	assert.Equal(t, 200, status)
+	assert.NotEqual(t, secret, getData(body)["secret"])
+
+	status, _ = do("GET", "/api/v1/admin/webhooks/"+id, nil)
+	assert.Equal(t, 200, status)
+
+	status, _ = do("DELETE", "/api/v1/admin/webhooks/"+id, nil)
+	assert.Equal(t, 200, status)
+	status, _ = do("GET", "/api/v1/admin/webhooks/"+id, nil)
+	assert.Equal(t, 404, status)
+	status, _ = do("DELETE", "/api/v1/admin/webhooks/"+id, nil)
+	assert.Equal(t, 404, status)
+}
+
+func TestWebhooksValidation(t *testing.T) {
+	_, _, do := setupWebhookServer(t)
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"missing url", map[string]interface{}{"events": []string{"*"}}},
+		{"bad scheme", map[string]interface{}{"url": "ftp://example.com"}},
+		{"unknown event", map[string]interface{}{"url": "https://example.com", "events": []string{"service.renamed"}}},
+		{"empty secret", map[string]interface{}{"url": "https://example.com", "secret": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := do("POST", "/api/v1/admin/webhooks", tt.body)
+			assert.Equal(t, 400, status)
+		})
+	}
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	_, store, do := setupWebhookServer(t)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	require.NoError(t, store.CreateWebhook(&models.Webhook{ID: "wh-1", URL: receiver.URL, Enabled: true}))
+	require.NoError(t, store.CreateWebhook(&models.Webhook{ID: "wh-2", URL: "https://example.com", Enabled: true}))
+	letter := &models.WebhookDeadLetter{WebhookID: "wh-1", EventType: "peer.connected", Payload: "{}", Attempts: 5}
+	require.NoError(t, store.CreateWebhookDeadLetter(letter))
+
+	status, body := do("GET", "/api/v1/admin/webhooks/wh-1/dead-letters", nil)
+	assert.Equal(t, 200, status)
+	assert.Len(t, getDataArray(body), 1)
+
+	// Dead letters are scoped to their webhook
+	status, _ = do("DELETE", fmt.Sprintf("/api/v1/admin/webhooks/wh-2/dead-letters/%d", letter.ID), nil)
+	assert.Equal(t, 404, status)
+
+	status, _ = do("POST", fmt.Sprintf("/api/v1/admin/webhooks/wh-1/dead-letters/%d/retry", letter.ID), nil)
+	assert.Equal(t, 200, status)
+	_, err := store.GetWebhookDeadLetter(letter.ID)
+	assert.Error(t, err, "retried dead letter is removed from the log")
+
+	status, _ = do("POST", "/api/v1/admin/webhooks/wh-1/dead-letters/9999/retry", nil)
+	assert.Equal(t, 404, status)
+
+	status, _ = do("GET", "/api/v1/admin/webhooks/missing/dead-letters", nil)
+	assert.Equal(t, 404, status)
+}
@@ -0,0 +1,142 @@
+// Package audit records authenticated REST API calls in the database and,
+// optionally, a JSON Lines file
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+)
+
+// Redacted replaces the values of secret parameters
+const Redacted = "[REDACTED]"
+
+// secretWords mark parameter names whose values are redacted, wherever they
+// appear in the name
+var secretWords = []string{"secret", "password", "passwd", "token", "credential", "authorization", "apikey"}
+
+// Log writes audit entries to storage and the optional file. Writes are
+// synchronous so an entry is on record when the call returns. A nil Log
+// records nothing.
+type Log struct {
+	cfg    config.AuditConfig
+	store  storage.Storage
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// New creates an audit log, opening cfg.File for appending if set
+func New(cfg *config.AuditConfig, store storage.Storage, log *slog.Logger) (*Log, error) {
+	l := &Log{cfg: *cfg, store: store, logger: log}
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log file: %w", err)
+		}
+		l.file = f
+	}
+	return l, nil
+}
+
+// Records reports whether calls with the given method are recorded. Calls
+// that change state always are; reads only if privileged, such as those
+// issuing credentials, or with include_reads.
+func (l *Log) Records(method string, privileged bool) bool {
+	if l == nil {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return privileged || l.cfg.IncludeReads
+	}
+	return true
+}
+
+// Record writes an entry. Failures are logged rather than returned: the call
+// being audited has already been handled.
+func (l *Log) Record(entry *models.AuditLog) {
+	if l == nil {
+		return
+	}
+
+	if err := l.store.CreateAuditLog(entry); err != nil {
+		l.logger.Error("Failed to store audit log entry", "method", entry.Method, "path", entry.Path, "error", err)
+	}
+
+	if l.file == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		l.logger.Error("Failed to encode audit log entry", "error", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		l.logger.Error("Failed to write audit log file", "error", err)
+	}
+}
+
+// Close closes the audit log file
+func (l *Log) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Redact returns a copy of params with the values of secret parameters
+// replaced by Redacted, at any depth of nested objects and arrays
+func Redact(params map[string]any) map[string]any {
+	out := make(map[string]any, len(params))
+	for name, value := range params {
+		if isSecret(name) {
+			out[name] = Redacted
+		} else {
+			out[name] = redactValue(value)
+		}
+	}
+	return out
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return Redact(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = redactValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// isSecret reports whether a parameter name looks like it holds a secret
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	if name == "key" || strings.HasSuffix(name, "_key") {
+		return true
+	}
+	for _, word := range secretWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
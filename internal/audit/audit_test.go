@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *storage.SQLiteStorage {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "audit.db"))
+	require.NoError(t, err)
+	require.NoError(t, store.Init())
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRedact(t *testing.T) {
+	params := map[string]any{
+		"path": map[string]any{"id": "wh-1"},
+		"body": map[string]any{
+			"url":         "https://example.com/hook",
+			"secret":      "whsec_abc",
+			"old_secrets": []any{"a", "b"},
+			"api_key":     "arq_123",
+			"Password":    "hunter2",
+			"nested":      []any{map[string]any{"token": "t", "name": "n"}},
+			"labels":      map[string]any{"env": "prod"},
+		},
+	}
+
+	got := Redact(params)
+	body := got["body"].(map[string]any)
+	assert.Equal(t, "https://example.com/hook", body["url"])
+	assert.Equal(t, Redacted, body["secret"])
+	assert.Equal(t, Redacted, body["old_secrets"])
+	assert.Equal(t, Redacted, body["api_key"])
+	assert.Equal(t, Redacted, body["Password"])
+	assert.Equal(t, []any{map[string]any{"token": Redacted, "name": "n"}}, body["nested"])
+	assert.Equal(t, map[string]any{"env": "prod"}, body["labels"])
+	assert.Equal(t, map[string]any{"id": "wh-1"}, got["path"])
+
+	// The input is left as it was
+	assert.Equal(t, "whsec_abc", params["body"].(map[string]any)["secret"])
+}
+
+func TestLog_Records(t *testing.T) {
+	l, err := New(&config.AuditConfig{}, newTestStore(t), slog.Default())
+	require.NoError(t, err)
+
+	assert.True(t, l.Records("POST", false))
+	assert.True(t, l.Records("DELETE", false))
+	assert.False(t, l.Records("GET", false))
+	assert.True(t, l.Records("GET", true), "privileged reads are recorded")
+
+	l, err = New(&config.AuditConfig{IncludeReads: true}, newTestStore(t), slog.Default())
+	require.NoError(t, err)
+	assert.True(t, l.Records("GET", false))
+
+	var none *Log
+	assert.False(t, none.Records("POST", false))
+	none.Record(&models.AuditLog{Method: "POST"})
+	assert.NoError(t, none.Close())
+}
+
+func TestLog_RecordWritesStorageAndFile(t *testing.T) {
+	store := newTestStore(t)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := New(&config.AuditConfig{File: path}, store, slog.Default())
+	require.NoError(t, err)
+
+	for _, p := range []string{"/api/v1/services", "/api/v1/admin/secrets"} {
+		l.Record(&models.AuditLog{Actor: "default", ClientIP: "10.0.0.1", Method: "POST", Route: p, Path: p, Status: 200})
+	}
+	require.NoError(t, l.Close())
+
+	page, err := store.ListAuditLog(storage.AuditLogQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []models.AuditLog
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry models.AuditLog
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		lines = append(lines, entry)
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, "/api/v1/admin/secrets", lines[1].Path)
+	assert.Equal(t, page.Entries[1].ID, lines[1].ID, "the file has the stored ID")
+
+	// Reopening appends
+	l, err = New(&config.AuditConfig{File: path}, store, slog.Default())
+	require.NoError(t, err)
+	l.Record(&models.AuditLog{Method: "DELETE", Path: "/api/v1/services/x"})
+	require.NoError(t, l.Close())
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, bytes.Count(raw, []byte("\n")))
+}
@@ -0,0 +1,277 @@
+package authguard
+
+import (
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+)
+
+// maxEntries bounds the tracker; idle entries are purged when it fills up
+const maxEntries = 100000
+
+// Key prefixes for the tracked subjects
+const (
+	prefixIP   = "ip:"
+	prefixUser = "user:"
+)
+
+// IPKey returns the tracking key for a source IP
+func IPKey(ip string) string {
+	return prefixIP + ip
+}
+
+// UserKey returns the tracking key for a username
+func UserKey(username string) string {
+	return prefixUser + username
+}
+
+// AddrIP returns the IP part of a network address
+func AddrIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// Ban describes an active temporary ban
+type Ban struct {
+	Key      string    `json:"key"`
+	Until    time.Time `json:"until"`
+	BanCount int       `json:"ban_count"` // Consecutive bans; each one doubles the duration
+}
+
+type entry struct {
+	failures    int
+	windowStart time.Time
+	banCount    int
+	bannedUntil time.Time
+}
+
+// Guard tracks authentication failures per source IP and username and
+// temporarily bans subjects that keep failing. It is shared by the TURN
+// auth handler and the API key middleware.
+// All methods are safe to call on a nil Guard, which never blocks.
+type Guard struct {
+	maxFailures int
+	window      time.Duration
+	banDuration time.Duration
+	maxBan      time.Duration
+	logger      *slog.Logger
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// New creates a failure tracker. Returns nil if the guard is disabled.
+func New(cfg *config.AuthGuardConfig, logger *slog.Logger) *Guard {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	return &Guard{
+		maxFailures: cfg.MaxFailures,
+		window:      cfg.Window,
+		banDuration: cfg.BanDuration,
+		maxBan:      cfg.MaxBanDuration,
+		logger:      logger.With("component", "auth-guard"),
+		now:         time.Now,
+		entries:     make(map[string]*entry),
+	}
+}
+
+// Check reports whether any of the keys is currently banned and for how long
+func (g *Guard) Check(keys ...string) (time.Duration, bool) {
+	if g == nil {
+		return 0, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	var remaining time.Duration
+	for _, key := range keys {
+		e, ok := g.entries[key]
+		if !ok || !now.Before(e.bannedUntil) {
+			continue
+		}
+		if left := e.bannedUntil.Sub(now); left > remaining {
+			remaining = left
+		}
+	}
+
+	return remaining, remaining > 0
+}
+
+// Failure records a failed authentication for each key and bans keys that
+// reach the failure threshold within the window
+func (g *Guard) Failure(keys ...string) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if len(g.entries) >= maxEntries {
+		g.purge(now)
+	}
+
+	for _, key := range keys {
+		e, ok := g.entries[key]
+		if !ok {
+			e = &entry{windowStart: now}
+			g.entries[key] = e
+		}
+
+		// Already banned: the request was rejected anyway
+		if now.Before(e.bannedUntil) {
+			continue
+		}
+
+		// Forget earlier bans after a quiet period so backoff restarts
+		if e.banCount > 0 && now.Sub(e.bannedUntil) > g.maxBan {
+			e.banCount = 0
+		}
+
+		if now.Sub(e.windowStart) > g.window {
+			e.failures = 0
+			e.windowStart = now
+		}
+
+		e.failures++
+		if e.failures < g.maxFailures {
+			continue
+		}
+
+		e.banCount++
+		duration := g.banDuration << (e.banCount - 1)
+		if duration > g.maxBan || duration <= 0 {
+			duration = g.maxBan
+		}
+		e.bannedUntil = now.Add(duration)
+		e.failures = 0
+		e.windowStart = now
+
+		g.logger.Warn("Temporarily banned after repeated authentication failures",
+			"key", key,
+			"duration", duration,
+			"ban_count", e.banCount,
+		)
+	}
+}
+
+// Success clears the failure history of keys that are not currently banned
+func (g *Guard) Success(keys ...string) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	for _, key := range keys {
+		if e, ok := g.entries[key]; ok && !now.Before(e.bannedUntil) {
+			delete(g.entries, key)
+		}
+	}
+}
+
+// Bans lists the active bans, soonest expiry first
+func (g *Guard) Bans() []Ban {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	bans := []Ban{}
+	for key, e := range g.entries {
+		if now.Before(e.bannedUntil) {
+			bans = append(bans, Ban{Key: key, Until: e.bannedUntil, BanCount: e.banCount})
+		}
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.Before(bans[j].Until)
+	})
+	return bans
+}
+
+// Clear removes all state for a key. Returns false if the key was unknown.
+func (g *Guard) Clear(key string) bool {
+	if g == nil {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.entries[key]; !ok {
+		return false
+	}
+	delete(g.entries, key)
+	g.logger.Info("Ban cleared", "key", key)
+	return true
+}
+
+// ClearAll removes all bans and failure history, returning the number of
+// bans that were lifted
+func (g *Guard) ClearAll() int {
+	if g == nil {
+		return 0
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	lifted := 0
+	for _, e := range g.entries {
+		if now.Before(e.bannedUntil) {
+			lifted++
+		}
+	}
+	g.entries = make(map[string]*entry)
+
+	g.logger.Info("All bans cleared", "lifted", lifted)
+	return lifted
+}
+
+// purge drops entries that are neither banned nor inside a failure window.
+// Must be called with the mutex held.
+func (g *Guard) purge(now time.Time) {
+	for key, e := range g.entries {
+		if now.Before(e.bannedUntil) {
+			continue
+		}
+		if now.Sub(e.windowStart) > g.window && (e.banCount == 0 || now.Sub(e.bannedUntil) > g.maxBan) {
+			delete(g.entries, key)
+		}
+	}
+
+	// Still full: keep only active bans rather than grow without bound
+	if len(g.entries) >= maxEntries {
+		for key, e := range g.entries {
+			if !now.Before(e.bannedUntil) {
+				delete(g.entries, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package authguard
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGuard returns a guard with a controllable clock
+func newTestGuard(t *testing.T) (*Guard, *time.Time) {
+	t.Helper()
+
+	guard := New(&config.AuthGuardConfig{
+		Enabled:        true,
+		MaxFailures:    3,
+		Window:         time.Minute,
+		BanDuration:    time.Minute,
+		MaxBanDuration: 5 * time.Minute,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NotNil(t, guard)
+
+	now := time.Unix(1700000000, 0)
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+func TestNew_Disabled(t *testing.T) {
+	assert.Nil(t, New(&config.AuthGuardConfig{}, slog.Default()))
+
+	// A nil guard never blocks
+	var guard *Guard
+	guard.Failure("ip:1.2.3.4")
+	_, banned := guard.Check("ip:1.2.3.4")
+	assert.False(t, banned)
+	assert.Empty(t, guard.Bans())
+}
+
+func TestGuard_BanAfterThreshold(t *testing.T) {
+	guard, _ := newTestGuard(t)
+	key := IPKey("192.0.2.1")
+
+	guard.Failure(key)
+	guard.Failure(key)
+	_, banned := guard.Check(key)
+	assert.False(t, banned, "below threshold")
+
+	guard.Failure(key)
+	remaining, banned := guard.Check(key)
+	assert.True(t, banned)
+	assert.Equal(t, time.Minute, remaining)
+
+	// Other keys are unaffected
+	_, banned = guard.Check(IPKey("192.0.2.2"))
+	assert.False(t, banned)
+}
+
+func TestGuard_WindowExpiry(t *testing.T) {
+	guard, now := newTestGuard(t)
+	key := UserKey("alice")
+
+	guard.Failure(key)
+	guard.Failure(key)
+	*now = now.Add(2 * time.Minute)
+	guard.Failure(key)
+
+	_, banned := guard.Check(key)
+	assert.False(t, banned, "failures outside the window are forgotten")
+}
+
+func TestGuard_ExponentialBackoff(t *testing.T) {
+	guard, now := newTestGuard(t)
+	key := IPKey("192.0.2.1")
+
+	ban := func() time.Duration {
+		for i := 0; i < 3; i++ {
+			guard.Failure(key)
+		}
+		remaining, banned := guard.Check(key)
+		require.True(t, banned)
+		*now = now.Add(remaining)
+		return remaining
+	}
+
+	assert.Equal(t, time.Minute, ban())
+	assert.Equal(t, 2*time.Minute, ban())
+	assert.Equal(t, 4*time.Minute, ban())
+	assert.Equal(t, 5*time.Minute, ban(), "capped at max_ban_duration")
+
+	// A quiet period longer than the max ban resets the backoff
+	*now = now.Add(10 * time.Minute)
+	assert.Equal(t, time.Minute, ban())
+}
+
+func TestGuard_SuccessResets(t *testing.T) {
+	guard, _ := newTestGuard(t)
+	key := IPKey("192.0.2.1")
+
+	guard.Failure(key)
+	guard.Failure(key)
+	guard.Success(key)
+	guard.Failure(key)
+
+	_, banned := guard.Check(key)
+	assert.False(t, banned)
+
+	// Success does not lift an active ban
+	guard.Failure(key)
+	guard.Failure(key)
+	guard.Failure(key)
+	guard.Success(key)
+	_, banned = guard.Check(key)
+	assert.True(t, banned)
+}
+
+func TestGuard_BansAndClear(t *testing.T) {
+	guard, _ := newTestGuard(t)
+
+	for i := 0; i < 3; i++ {
+		guard.Failure(IPKey("192.0.2.1"), UserKey("alice"))
+	}
+	guard.Failure(IPKey("192.0.2.2"))
+
+	bans := guard.Bans()
+	require.Len(t, bans, 2)
+	keys := []string{bans[0].Key, bans[1].Key}
+	assert.ElementsMatch(t, []string{"ip:192.0.2.1", "user:alice"}, keys)
+	assert.Equal(t, 1, bans[0].BanCount)
+
+	assert.True(t, guard.Clear(UserKey("alice")))
+	assert.False(t, guard.Clear(UserKey("alice")))
+	assert.Len(t, guard.Bans(), 1)
+
+	assert.Equal(t, 1, guard.ClearAll())
+	assert.Empty(t, guard.Bans())
+}
+
+func TestAddrIP(t *testing.T) {
+	assert.Equal(t, "192.0.2.1", AddrIP(&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 3478}))
+	assert.Equal(t, "2001:db8::1", AddrIP(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 3478}))
+}
@@ -0,0 +1,215 @@
+package authhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+)
+
+// Request kinds sent to the webhook
+const (
+	KindTURN      = "turn"
+	KindSignaling = "signaling"
+)
+
+// maxCacheEntries bounds the decision cache; expired entries are purged when it fills up
+const maxCacheEntries = 10000
+
+// Request is the payload POSTed to the external authorization endpoint
+type Request struct {
+	Kind       string `json:"kind"` // "turn" or "signaling"
+	Username   string `json:"username,omitempty"`
+	Realm      string `json:"realm,omitempty"`
+	PeerType   string `json:"peer_type,omitempty"`
+	PeerID     string `json:"peer_id,omitempty"`
+	EdgeID     string `json:"edge_id,omitempty"`
+	Token      string `json:"token,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// Decision is the authorization result returned by the endpoint
+type Decision struct {
+	Allow    bool   `json:"allow"`
+	Password string `json:"password,omitempty"` // TURN long-term password (required for TURN requests)
+	Reason   string `json:"reason,omitempty"`
+}
+
+type cacheEntry struct {
+	decision  *Decision
+	err       error
+	expiresAt time.Time
+}
+
+// Client calls an external HTTP endpoint to authorize TURN usernames and signaling peers
+type Client struct {
+	url           string
+	token         string
+	cacheTTL      time.Duration
+	errorCacheTTL time.Duration
+	turnTimeout   time.Duration
+	failOpen      bool
+	http          *http.Client
+	logger        *slog.Logger
+
+	cacheMutex sync.Mutex
+	cache      map[string]cacheEntry
+}
+
+// New creates a webhook client. Returns nil if no URL is configured.
+func New(cfg *config.AuthWebhookConfig, logger *slog.Logger) *Client {
+	if cfg == nil || cfg.URL == "" {
+		return nil
+	}
+
+	return &Client{
+		url:           cfg.URL,
+		token:         cfg.Token,
+		cacheTTL:      cfg.CacheTTL,
+		errorCacheTTL: cfg.ErrorCacheTTL,
+		turnTimeout:   cfg.TURNTimeout,
+		failOpen:      cfg.FailOpen,
+		http:          &http.Client{Timeout: cfg.Timeout},
+		logger:        logger.With("component", "auth-webhook"),
+		cache:         make(map[string]cacheEntry),
+	}
+}
+
+// TURNTimeout returns the bound for TURN authorization calls, which block
+// the listener that received the request. Zero means no extra bound.
+func (c *Client) TURNTimeout() time.Duration {
+	return c.turnTimeout
+}
+
+// Authorize asks the endpoint whether the request is allowed.
+// Definitive answers (200 with a decision, 401, 403) are cached for the
+// configured TTL. Transport errors and unexpected statuses are cached for the
+// shorter error TTL, so an outage costs one call per request key rather than
+// one per request; with fail_open they yield an allow decision without a
+// password, otherwise the error is returned to the caller.
+func (c *Client) Authorize(ctx context.Context, req Request) (*Decision, error) {
+	key := cacheKey(req)
+	if entry, ok := c.lookup(key); ok {
+		return entry.decision, entry.err
+	}
+
+	decision, err := c.call(ctx, req)
+	if err != nil {
+		// The caller gave up; that says nothing about the endpoint
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, err
+		}
+		if c.failOpen {
+			c.logger.Warn("Auth webhook unavailable, failing open",
+				"kind", req.Kind,
+				"error", err,
+			)
+			decision, err = &Decision{Allow: true, Reason: "webhook unavailable (fail-open)"}, nil
+		}
+		c.store(key, cacheEntry{decision: decision, err: err}, c.errorCacheTTL)
+		return decision, err
+	}
+
+	c.store(key, cacheEntry{decision: decision}, c.cacheTTL)
+	return decision, nil
+}
+
+// call performs the HTTP round trip
+func (c *Client) call(ctx context.Context, req Request) (*Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling webhook request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating webhook request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("calling auth webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var decision Decision
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&decision); err != nil {
+			return nil, fmt.Errorf("decoding webhook response: %w", err)
+		}
+		return &decision, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &Decision{Allow: false, Reason: http.StatusText(resp.StatusCode)}, nil
+	default:
+		return nil, fmt.Errorf("auth webhook returned status %d", resp.StatusCode)
+	}
+}
+
+func (c *Client) lookup(key string) (cacheEntry, bool) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	entry, exists := c.cache[key]
+	if !exists {
+		return cacheEntry{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.cache, key)
+		return cacheEntry{}, false
+	}
+
+	if entry.decision != nil {
+		decision := *entry.decision
+		entry.decision = &decision
+	}
+	return entry, true
+}
+
+func (c *Client) store(key string, entry cacheEntry, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	now := time.Now()
+	if len(c.cache) >= maxCacheEntries {
+		for k, entry := range c.cache {
+			if now.After(entry.expiresAt) {
+				delete(c.cache, k)
+			}
+		}
+		// Still full: drop everything rather than grow without bound
+		if len(c.cache) >= maxCacheEntries {
+			c.cache = make(map[string]cacheEntry)
+		}
+	}
+
+	if entry.decision != nil {
+		decision := *entry.decision
+		entry.decision = &decision
+	}
+	entry.expiresAt = now.Add(ttl)
+	c.cache[key] = entry
+}
+
+// cacheKey identifies a request for caching; the remote address is deliberately
+// excluded so that a peer reconnecting from a new port reuses the decision
+func cacheKey(req Request) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s",
+		req.Kind, req.Username, req.Realm, req.PeerType, req.PeerID, req.EdgeID, req.Token)
+}
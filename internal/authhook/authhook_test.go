@@ -0,0 +1,204 @@
+package authhook
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+// newTestEndpoint starts a stand-in identity service that allows the
+// username "alice" (password "alice-pass") and the signaling token "good-token"
+func newTestEndpoint(t *testing.T, calls *int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+
+		if r.Header.Get("Authorization") != "Bearer hook-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case req.Kind == KindTURN && req.Username == "alice":
+			json.NewEncoder(w).Encode(Decision{Allow: true, Password: "alice-pass"})
+		case req.Kind == KindSignaling && req.Token == "good-token":
+			json.NewEncoder(w).Encode(Decision{Allow: true})
+		case req.Username == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(url string, cacheTTL time.Duration, failOpen bool) *Client {
+	return New(&config.AuthWebhookConfig{
+		URL:      url,
+		Token:    "hook-token",
+		Timeout:  time.Second,
+		CacheTTL: cacheTTL,
+		FailOpen: failOpen,
+	}, testLogger())
+}
+
+func TestNew_Disabled(t *testing.T) {
+	assert.Nil(t, New(&config.AuthWebhookConfig{}, testLogger()))
+	assert.Nil(t, New(nil, testLogger()))
+}
+
+func TestAuthorize(t *testing.T) {
+	var calls int32
+	srv := newTestEndpoint(t, &calls)
+	client := newTestClient(srv.URL, time.Minute, false)
+
+	t.Run("allows TURN user with password", func(t *testing.T) {
+		decision, err := client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "alice"})
+		require.NoError(t, err)
+		assert.True(t, decision.Allow)
+		assert.Equal(t, "alice-pass", decision.Password)
+	})
+
+	t.Run("allows signaling peer with token", func(t *testing.T) {
+		decision, err := client.Authorize(t.Context(), Request{Kind: KindSignaling, PeerID: "p1", Token: "good-token"})
+		require.NoError(t, err)
+		assert.True(t, decision.Allow)
+	})
+
+	t.Run("denies on 403", func(t *testing.T) {
+		decision, err := client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "mallory"})
+		require.NoError(t, err)
+		assert.False(t, decision.Allow)
+	})
+
+	t.Run("returns error on unexpected status", func(t *testing.T) {
+		_, err := client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "broken"})
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthorize_Cache(t *testing.T) {
+	var calls int32
+	srv := newTestEndpoint(t, &calls)
+	client := newTestClient(srv.URL, time.Minute, false)
+
+	for i := 0; i < 3; i++ {
+		decision, err := client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "alice", RemoteAddr: "10.0.0.1:1234"})
+		require.NoError(t, err)
+		assert.True(t, decision.Allow)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "decisions should be cached")
+
+	// Denials are cached too
+	client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "mallory"})
+	client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "mallory"})
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Errors are not cached without an error TTL
+	client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "broken"})
+	client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "broken"})
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestAuthorize_CacheExpiry(t *testing.T) {
+	var calls int32
+	srv := newTestEndpoint(t, &calls)
+	client := newTestClient(srv.URL, 50*time.Millisecond, false)
+
+	client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "alice"})
+	time.Sleep(100 * time.Millisecond)
+	client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "alice"})
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestAuthorize_ErrorCache(t *testing.T) {
+	var calls int32
+	srv := newTestEndpoint(t, &calls)
+
+	for _, failOpen := range []bool{false, true} {
+		atomic.StoreInt32(&calls, 0)
+		client := New(&config.AuthWebhookConfig{
+			URL:           srv.URL,
+			Token:         "hook-token",
+			Timeout:       time.Second,
+			CacheTTL:      time.Minute,
+			ErrorCacheTTL: 50 * time.Millisecond,
+			FailOpen:      failOpen,
+		}, testLogger())
+
+		for i := 0; i < 3; i++ {
+			decision, err := client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "broken"})
+			if failOpen {
+				require.NoError(t, err)
+				assert.True(t, decision.Allow)
+			} else {
+				assert.Error(t, err)
+			}
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "failures should be cached")
+
+		time.Sleep(100 * time.Millisecond)
+		client.Authorize(t.Context(), Request{Kind: KindTURN, Username: "broken"})
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "failures should expire quickly")
+	}
+}
+
+func TestAuthorize_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		json.NewEncoder(w).Encode(Decision{Allow: true})
+	}))
+	defer srv.Close()
+
+	client := New(&config.AuthWebhookConfig{
+		URL:     srv.URL,
+		Timeout: 50 * time.Millisecond,
+	}, testLogger())
+
+	_, err := client.Authorize(t.Context(), Request{Kind: KindSignaling, PeerID: "p1"})
+	assert.Error(t, err)
+}
+
+func TestAuthorize_FailurePolicy(t *testing.T) {
+	// Closed server: every call fails at the transport level
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	t.Run("fail closed returns error", func(t *testing.T) {
+		client := newTestClient(url, time.Minute, false)
+		decision, err := client.Authorize(t.Context(), Request{Kind: KindSignaling, PeerID: "p1"})
+		assert.Error(t, err)
+		assert.Nil(t, decision)
+	})
+
+	t.Run("fail open allows without password", func(t *testing.T) {
+		client := newTestClient(url, time.Minute, true)
+		decision, err := client.Authorize(t.Context(), Request{Kind: KindSignaling, PeerID: "p1"})
+		require.NoError(t, err)
+		assert.True(t, decision.Allow)
+		assert.Empty(t, decision.Password)
+	})
+}
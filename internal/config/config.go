@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/knadh/koanf/parsers/yaml"
@@ -21,6 +23,12 @@ type Config struct {
 	API       APIConfig       `koanf:"api"`
 	Admin     AdminConfig     `koanf:"admin"`
 	Logging   LoggingConfig   `koanf:"logging"`
+
+	AuthWebhook AuthWebhookConfig `koanf:"auth_webhook"`
+	AuthGuard   AuthGuardConfig   `koanf:"auth_guard"`
+	Webhooks    WebhooksConfig    `koanf:"webhooks"`
+	Proxy       ProxyConfig       `koanf:"proxy"`
+	Audit       AuditConfig       `koanf:"audit"`
 }
 
 // ACMEConfig holds ACME/Let's Encrypt configuration
@@ -38,18 +46,59 @@ type ACMEConfig struct {
 
 // TurnConfig holds TURN/STUN server configuration
 type TurnConfig struct {
-	Realm    string     `koanf:"realm"`
-	PublicIP string     `koanf:"public_ip"`
-	Ports    TurnPorts  `koanf:"ports"`
-	RelayPortRange PortRange `koanf:"relay_port_range"`
-	Auth     AuthConfig `koanf:"auth"`
+	Realm           string     `koanf:"realm"`
+	PublicIP        string     `koanf:"public_ip"`          // Advertised IPv4 address, or "auto" to detect via STUN
+	PublicIPv6      string     `koanf:"public_ipv6"`        // Optional advertised IPv6 address
+	BindIP          string     `koanf:"bind_ip"`            // Local IPv4 address relay sockets bind to (default: all)
+	DetectSTUN      string     `koanf:"detect_stun_server"` // STUN server (host:port) used when public_ip is "auto"
+	ListenAddresses []string   `koanf:"listen_addresses"`   // Local addresses to bind listeners on
+	Ports           TurnPorts  `koanf:"ports"`
+	RelayPortRange  PortRange  `koanf:"relay_port_range"`
+	Auth            AuthConfig `koanf:"auth"`
+	ICE             ICEConfig  `koanf:"ice"`
+}
+
+// ICEConfig controls the ICE server lists handed out to peers
+type ICEConfig struct {
+	Hostname       string            `koanf:"hostname"`        // DNS name for TURNS URLs (default: domain)
+	PreferHostname bool              `koanf:"prefer_hostname"` // Also use the hostname for stun/turn URLs instead of public IPs
+	ExtraServers   []ICEServerConfig `koanf:"extra_servers"`   // Additional STUN/TURN servers appended to every list
+}
+
+// ICEServerConfig describes an external STUN/TURN server
+type ICEServerConfig struct {
+	URLs       []string `koanf:"urls"`
+	Username   string   `koanf:"username"`
+	Credential string   `koanf:"credential"`
+}
+
+// PublicIPAuto makes the server detect its public IPv4 address at startup
+const PublicIPAuto = "auto"
+
+// DefaultListenAddresses binds TURN listeners on all IPv4 and IPv6 interfaces
+// when turn.listen_addresses is empty. Unlike configured addresses, the IPv6
+// wildcard may fail on hosts without IPv6.
+var DefaultListenAddresses = []string{"0.0.0.0", "::"}
+
+// AdvertisedHosts returns the public addresses to put in ICE server URLs,
+// with IPv6 literals bracketed
+func (t *TurnConfig) AdvertisedHosts() []string {
+	var hosts []string
+	if t.PublicIP != "" {
+		hosts = append(hosts, t.PublicIP)
+	}
+	if t.PublicIPv6 != "" {
+		hosts = append(hosts, "["+t.PublicIPv6+"]")
+	}
+	return hosts
 }
 
 // TurnPorts defines TURN server port configuration
 type TurnPorts struct {
-	UDP int `koanf:"udp"`
-	TCP int `koanf:"tcp"`
-	TLS int `koanf:"tls"`
+	UDP  int `koanf:"udp"`
+	TCP  int `koanf:"tcp"`
+	TLS  int `koanf:"tls"`
+	DTLS int `koanf:"dtls"` // Optional TURN over DTLS (0 = disabled)
 }
 
 // PortRange defines a range of ports
@@ -61,23 +110,114 @@ type PortRange struct {
 // AuthConfig holds authentication configuration
 type AuthConfig struct {
 	Mode        string   `koanf:"mode"`
+	Chain       []string `koanf:"chain"` // Ordered backends for "chain" mode
 	Secret      string   `koanf:"secret"`
 	OldSecrets  []string `koanf:"old_secrets"`
 	TTLSeconds  int      `koanf:"ttl_seconds"`
+	MinTTLSeconds int    `koanf:"min_ttl_seconds"` // Shortest credential lifetime issued (0 = no minimum)
+	MaxTTLSeconds int    `koanf:"max_ttl_seconds"` // Longest credential lifetime issued and accepted by TURN (default: 48h)
+	PeerTTL     map[string]TTLPolicy `koanf:"peer_ttl"` // Per peer type ("edge", "client") bounds
+	UsernameFormat string `koanf:"username_format"` // REST username layout: "peer" (default) or "timestamp"
 	StaticUsers []StaticUser `koanf:"static_users"`
 }
 
+// TTLPolicy bounds credential lifetimes in seconds (0 = unbounded)
+type TTLPolicy struct {
+	Min int `koanf:"min"`
+	Max int `koanf:"max"`
+}
+
+// validate checks that the bounds are non-negative and ordered
+func (p TTLPolicy) validate(name string) error {
+	if p.Min < 0 || p.Max < 0 {
+		return fmt.Errorf("%s ttl bounds must not be negative", name)
+	}
+	if p.Max > 0 && p.Min > p.Max {
+		return fmt.Errorf("%s min ttl (%d) exceeds max ttl (%d)", name, p.Min, p.Max)
+	}
+	return nil
+}
+
 // StaticUser represents a static username/password pair
 type StaticUser struct {
 	Username string `koanf:"username"`
 	Password string `koanf:"password"`
 }
 
+// AuthWebhookConfig holds the external authorization webhook configuration
+type AuthWebhookConfig struct {
+	URL      string        `koanf:"url"`
+	Token    string        `koanf:"token"` // Sent as Bearer token to the endpoint
+	Timeout  time.Duration `koanf:"timeout"`
+	CacheTTL time.Duration `koanf:"cache_ttl"`
+	FailOpen bool          `koanf:"fail_open"` // Allow requests when the endpoint is unreachable
+
+	// TURN requests are authorized inside the listener's read loop, so they
+	// get a shorter bound than Timeout. Failures and fail-open results are
+	// cached for ErrorCacheTTL so an outage does not stall every request.
+	TURNTimeout   time.Duration `koanf:"turn_timeout"`
+	ErrorCacheTTL time.Duration `koanf:"error_cache_ttl"`
+}
+
+// AuthGuardConfig controls throttling of repeated authentication failures
+type AuthGuardConfig struct {
+	Enabled        bool          `koanf:"enabled"`
+	MaxFailures    int           `koanf:"max_failures"`     // Failures within window before a ban
+	Window         time.Duration `koanf:"window"`
+	BanDuration    time.Duration `koanf:"ban_duration"`     // First ban; doubles on each repeat ban
+	MaxBanDuration time.Duration `koanf:"max_ban_duration"`
+}
+
+// WebhooksConfig controls delivery of outbound event webhooks. Subscriptions
+// themselves are stored in the database and managed via the admin API.
+type WebhooksConfig struct {
+	Timeout         time.Duration `koanf:"timeout"`           // Per-attempt HTTP timeout
+	MaxAttempts     int           `koanf:"max_attempts"`      // Attempts before an event is dead-lettered
+	RetryBackoff    time.Duration `koanf:"retry_backoff"`     // Delay before the first retry; doubles each retry
+	MaxRetryBackoff time.Duration `koanf:"max_retry_backoff"`
+	Workers         int           `koanf:"workers"`    // Concurrent deliveries
+	QueueSize       int           `koanf:"queue_size"` // Pending deliveries before new ones are dead-lettered
+}
+
+// AuditConfig controls the audit log of authenticated REST API calls. Entries
+// are always stored in the database; File additionally appends them as JSON
+// Lines, e.g. for a log collector.
+type AuditConfig struct {
+	File         string `koanf:"file"`          // JSON Lines file; empty = database only
+	IncludeReads bool   `koanf:"include_reads"` // Also record GET requests that issue no credentials
+}
+
+// ProxyConfig controls the public reverse proxy that routes HTTP and
+// WebSocket traffic to edge services through edge-initiated tunnels
+type ProxyConfig struct {
+	Enabled     bool          `koanf:"enabled"`
+	Domain      string        `koanf:"domain"`       // Services are served at <service-id>.<domain> (default: domain)
+	PathPrefix  string        `koanf:"path_prefix"`  // Also serve them at <path_prefix>/<service-id>/ (empty = host routing only)
+	DialTimeout time.Duration `koanf:"dial_timeout"` // Time the edge has to open a tunnel
+}
+
 // SignalingConfig holds WebRTC signaling configuration
 type SignalingConfig struct {
 	Ports           SignalingPorts `koanf:"ports"`
 	MaxPeersPerRoom int            `koanf:"max_peers_per_room"`
 	SessionTimeout  time.Duration  `koanf:"session_timeout"`
+	WebhookAuth     bool           `koanf:"webhook_auth"` // Authorize WebSocket peers via auth_webhook
+
+	// Per-peer WebSocket message limit; peers exceeding it for
+	// max_rate_violations consecutive messages are disconnected
+	MessageRate       RateLimit `koanf:"message_rate"`
+	MaxRateViolations int       `koanf:"max_rate_violations"`
+
+	HealthCheck HealthCheckConfig `koanf:"health_check"`
+}
+
+// HealthCheckConfig controls server-side probing of edge services through
+// the tunnel. Edges can report service health themselves either way.
+type HealthCheckConfig struct {
+	Enabled  bool          `koanf:"enabled"`
+	Interval time.Duration `koanf:"interval"`
+	Timeout  time.Duration `koanf:"timeout"` // Per-probe limit, including opening the tunnel
+	Path     string        `koanf:"path"`    // Requested from http, https and websocket services
 }
 
 // SignalingPorts defines signaling server ports
@@ -88,15 +228,30 @@ type SignalingPorts struct {
 
 // APIConfig holds REST API configuration
 type APIConfig struct {
-	Port        int      `koanf:"port"`
-	CORSOrigins []string `koanf:"cors_origins"`
-	APIKey      APIKeyConfig `koanf:"api_key"`
+	Port        int                `koanf:"port"`
+	CORSOrigins []string           `koanf:"cors_origins"`
+	APIKey      APIKeyConfig       `koanf:"api_key"`
+	RateLimit   APIRateLimitConfig `koanf:"rate_limit"`
+}
+
+// APIRateLimitConfig holds REST API request limits
+type APIRateLimitConfig struct {
+	PerIP  RateLimit `koanf:"per_ip"`  // Applied to every /api/v1 request by client IP
+	PerKey RateLimit `koanf:"per_key"` // Applied to authenticated requests by API key
+}
+
+// RateLimit is a token bucket: a sustained rate plus a burst allowance
+type RateLimit struct {
+	Rate  float64 `koanf:"rate"`  // Tokens per second (0 = unlimited)
+	Burst int     `koanf:"burst"` // Bucket size (default: rate rounded up)
 }
 
 // APIKeyConfig holds API key configuration
 type APIKeyConfig struct {
-	Hash      string `koanf:"hash"`
-	CreatedAt string `koanf:"created_at"`
+	Name      string    `koanf:"name"` // Recorded as the actor of changes made with this key
+	Hash      string    `koanf:"hash"`
+	CreatedAt string    `koanf:"created_at"`
+	TTL       TTLPolicy `koanf:"ttl"` // Credential lifetime bounds for requests made with this key
 }
 
 // AdminConfig holds admin API configuration
@@ -178,6 +333,9 @@ func applyDefaults(cfg *Config) {
 	if cfg.Turn.Ports.TLS == 0 {
 		cfg.Turn.Ports.TLS = 5349
 	}
+	if cfg.Turn.ICE.Hostname == "" {
+		cfg.Turn.ICE.Hostname = cfg.Domain
+	}
 	if cfg.Turn.RelayPortRange.Min == 0 {
 		cfg.Turn.RelayPortRange.Min = 49152
 	}
@@ -187,6 +345,12 @@ func applyDefaults(cfg *Config) {
 	if cfg.Turn.Auth.TTLSeconds == 0 {
 		cfg.Turn.Auth.TTLSeconds = 86400
 	}
+	if cfg.Turn.Auth.MaxTTLSeconds == 0 {
+		cfg.Turn.Auth.MaxTTLSeconds = 172800 // 48h
+	}
+	if cfg.Turn.Auth.Mode == "chain" && len(cfg.Turn.Auth.Chain) == 0 {
+		cfg.Turn.Auth.Chain = []string{"rest", "static"}
+	}
 
 	// Signaling defaults
 	if cfg.Signaling.Ports.WS == 0 {
@@ -201,11 +365,90 @@ func applyDefaults(cfg *Config) {
 	if cfg.Signaling.SessionTimeout == 0 {
 		cfg.Signaling.SessionTimeout = 300 * time.Second
 	}
+	if cfg.Signaling.MessageRate.Rate > 0 && cfg.Signaling.MaxRateViolations == 0 {
+		cfg.Signaling.MaxRateViolations = 20
+	}
+	if cfg.Signaling.HealthCheck.Enabled {
+		if cfg.Signaling.HealthCheck.Interval == 0 {
+			cfg.Signaling.HealthCheck.Interval = 30 * time.Second
+		}
+		if cfg.Signaling.HealthCheck.Timeout == 0 {
+			cfg.Signaling.HealthCheck.Timeout = 5 * time.Second
+		}
+		if cfg.Signaling.HealthCheck.Path == "" {
+			cfg.Signaling.HealthCheck.Path = "/"
+		}
+	}
+
+	// Auth webhook defaults
+	if cfg.AuthWebhook.URL != "" {
+		if cfg.AuthWebhook.Timeout == 0 {
+			cfg.AuthWebhook.Timeout = 2 * time.Second
+		}
+		if cfg.AuthWebhook.CacheTTL == 0 {
+			cfg.AuthWebhook.CacheTTL = 60 * time.Second
+		}
+		if cfg.AuthWebhook.TURNTimeout == 0 {
+			cfg.AuthWebhook.TURNTimeout = 500 * time.Millisecond
+		}
+		if cfg.AuthWebhook.ErrorCacheTTL == 0 {
+			cfg.AuthWebhook.ErrorCacheTTL = 5 * time.Second
+		}
+	}
+
+	// Auth guard defaults
+	if cfg.AuthGuard.Enabled {
+		if cfg.AuthGuard.MaxFailures == 0 {
+			cfg.AuthGuard.MaxFailures = 10
+		}
+		if cfg.AuthGuard.Window == 0 {
+			cfg.AuthGuard.Window = time.Minute
+		}
+		if cfg.AuthGuard.BanDuration == 0 {
+			cfg.AuthGuard.BanDuration = time.Minute
+		}
+		if cfg.AuthGuard.MaxBanDuration == 0 {
+			cfg.AuthGuard.MaxBanDuration = time.Hour
+		}
+	}
+
+	// Webhook delivery defaults
+	if cfg.Webhooks.Timeout == 0 {
+		cfg.Webhooks.Timeout = 5 * time.Second
+	}
+	if cfg.Webhooks.MaxAttempts == 0 {
+		cfg.Webhooks.MaxAttempts = 5
+	}
+	if cfg.Webhooks.RetryBackoff == 0 {
+		cfg.Webhooks.RetryBackoff = time.Second
+	}
+	if cfg.Webhooks.MaxRetryBackoff == 0 {
+		cfg.Webhooks.MaxRetryBackoff = time.Minute
+	}
+	if cfg.Webhooks.Workers == 0 {
+		cfg.Webhooks.Workers = 4
+	}
+	if cfg.Webhooks.QueueSize == 0 {
+		cfg.Webhooks.QueueSize = 1000
+	}
+
+	// Proxy defaults
+	if cfg.Proxy.Enabled {
+		if cfg.Proxy.Domain == "" {
+			cfg.Proxy.Domain = cfg.Domain
+		}
+		if cfg.Proxy.DialTimeout == 0 {
+			cfg.Proxy.DialTimeout = 10 * time.Second
+		}
+	}
 
 	// API defaults
 	if cfg.API.Port == 0 {
 		cfg.API.Port = 9000
 	}
+	if cfg.API.APIKey.Name == "" {
+		cfg.API.APIKey.Name = "default"
+	}
 
 	// Admin defaults
 	if cfg.Admin.Port == 0 {
@@ -242,16 +485,108 @@ func validate(cfg *Config) error {
 		}
 	}
 
-	if cfg.Turn.Auth.Mode != "rest" && cfg.Turn.Auth.Mode != "static" {
-		return fmt.Errorf("invalid auth mode: %s (must be 'rest' or 'static')", cfg.Turn.Auth.Mode)
+	for _, addr := range cfg.Turn.ListenAddresses {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("invalid turn listen address: %s", addr)
+		}
+	}
+
+	if cfg.Turn.PublicIP == PublicIPAuto && cfg.Turn.DetectSTUN == "" {
+		return fmt.Errorf("turn detect_stun_server is required when public_ip is %q", PublicIPAuto)
+	}
+
+	if cfg.Turn.BindIP != "" {
+		if ip := net.ParseIP(cfg.Turn.BindIP); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("turn bind_ip must be an IPv4 address: %s", cfg.Turn.BindIP)
+		}
+	}
+
+	if cfg.Turn.PublicIPv6 != "" {
+		if ip := net.ParseIP(cfg.Turn.PublicIPv6); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("turn public_ipv6 must be an IPv6 address: %s", cfg.Turn.PublicIPv6)
+		}
+	}
+
+	for i, server := range cfg.Turn.ICE.ExtraServers {
+		if len(server.URLs) == 0 {
+			return fmt.Errorf("turn ice extra_servers[%d] must list at least one url", i)
+		}
+		for _, url := range server.URLs {
+			if !strings.HasPrefix(url, "stun:") && !strings.HasPrefix(url, "turn:") && !strings.HasPrefix(url, "turns:") {
+				return fmt.Errorf("invalid ice server url: %s (must start with stun:, turn: or turns:)", url)
+			}
+		}
+	}
+
+	if cfg.Turn.Ports.DTLS != 0 && cfg.Turn.Ports.DTLS == cfg.Turn.Ports.UDP {
+		return fmt.Errorf("turn dtls port must differ from the udp port (%d)", cfg.Turn.Ports.UDP)
+	}
+
+	if err := validateAuth(&cfg.Turn.Auth, &cfg.AuthWebhook); err != nil {
+		return err
 	}
 
-	if cfg.Turn.Auth.Mode == "rest" && cfg.Turn.Auth.Secret == "" {
-		return fmt.Errorf("auth secret is required for REST mode")
+	if err := validateTTL(&cfg.Turn.Auth, cfg.API.APIKey.TTL); err != nil {
+		return err
 	}
 
-	if cfg.Turn.Auth.Mode == "static" && len(cfg.Turn.Auth.StaticUsers) == 0 {
-		return fmt.Errorf("at least one static user is required for static auth mode")
+	for name, limit := range map[string]RateLimit{
+		"api.rate_limit.per_ip":   cfg.API.RateLimit.PerIP,
+		"api.rate_limit.per_key":  cfg.API.RateLimit.PerKey,
+		"signaling.message_rate": cfg.Signaling.MessageRate,
+	} {
+		if limit.Rate < 0 || limit.Burst < 0 {
+			return fmt.Errorf("%s: rate and burst must not be negative", name)
+		}
+	}
+
+	if cfg.AuthGuard.Enabled {
+		if cfg.AuthGuard.MaxFailures < 1 {
+			return fmt.Errorf("auth_guard.max_failures must be at least 1")
+		}
+		if cfg.AuthGuard.Window < 0 || cfg.AuthGuard.BanDuration < 0 {
+			return fmt.Errorf("auth_guard durations must not be negative")
+		}
+		if cfg.AuthGuard.MaxBanDuration < cfg.AuthGuard.BanDuration {
+			return fmt.Errorf("auth_guard.max_ban_duration must not be less than ban_duration")
+		}
+	}
+
+	if cfg.Webhooks.MaxAttempts < 1 || cfg.Webhooks.Workers < 1 || cfg.Webhooks.QueueSize < 1 {
+		return fmt.Errorf("webhooks: max_attempts, workers and queue_size must be at least 1")
+	}
+	if cfg.Webhooks.Timeout < 0 || cfg.Webhooks.RetryBackoff < 0 {
+		return fmt.Errorf("webhooks durations must not be negative")
+	}
+	if cfg.Webhooks.MaxRetryBackoff < cfg.Webhooks.RetryBackoff {
+		return fmt.Errorf("webhooks.max_retry_backoff must not be less than retry_backoff")
+	}
+
+	if cfg.Signaling.WebhookAuth && cfg.AuthWebhook.URL == "" {
+		return fmt.Errorf("auth_webhook.url is required when signaling webhook_auth is enabled")
+	}
+
+	if hc := cfg.Signaling.HealthCheck; hc.Enabled {
+		if hc.Interval <= 0 || hc.Timeout <= 0 {
+			return fmt.Errorf("signaling.health_check: interval and timeout must be positive")
+		}
+		if !strings.HasPrefix(hc.Path, "/") {
+			return fmt.Errorf("signaling.health_check.path must start with '/': %s", hc.Path)
+		}
+	}
+
+	if cfg.Proxy.Enabled {
+		if prefix := cfg.Proxy.PathPrefix; prefix != "" {
+			if !strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+				return fmt.Errorf("proxy.path_prefix must start and not end with '/': %s", prefix)
+			}
+			if prefix == "/api" || strings.HasPrefix(prefix, "/api/") || prefix == "/dashboard" || strings.HasPrefix(prefix, "/dashboard/") {
+				return fmt.Errorf("proxy.path_prefix must not overlap the API or dashboard routes: %s", prefix)
+			}
+		}
+		if cfg.Proxy.DialTimeout < 0 {
+			return fmt.Errorf("proxy.dial_timeout must not be negative")
+		}
 	}
 
 	if cfg.Admin.Token == "" {
@@ -260,3 +595,71 @@ func validate(cfg *Config) error {
 
 	return nil
 }
+
+// validateTTL checks the credential lifetime policies
+func validateTTL(auth *AuthConfig, keyPolicy TTLPolicy) error {
+	global := TTLPolicy{Min: auth.MinTTLSeconds, Max: auth.MaxTTLSeconds}
+	if err := global.validate("auth"); err != nil {
+		return err
+	}
+	if auth.TTLSeconds > auth.MaxTTLSeconds {
+		return fmt.Errorf("auth ttl_seconds (%d) exceeds max_ttl_seconds (%d)", auth.TTLSeconds, auth.MaxTTLSeconds)
+	}
+
+	for peerType, policy := range auth.PeerTTL {
+		if peerType != "edge" && peerType != "client" {
+			return fmt.Errorf("invalid peer type in auth peer_ttl: %s (must be 'edge' or 'client')", peerType)
+		}
+		if err := policy.validate("auth peer_ttl." + peerType); err != nil {
+			return err
+		}
+	}
+
+	return keyPolicy.validate("api_key")
+}
+
+// validateAuth checks the TURN auth mode and the settings each backend needs
+func validateAuth(auth *AuthConfig, webhook *AuthWebhookConfig) error {
+	var backends []string
+	switch auth.Mode {
+	case "rest", "static", "webhook":
+		backends = []string{auth.Mode}
+	case "chain":
+		if len(auth.Chain) == 0 {
+			return fmt.Errorf("auth chain must list at least one backend")
+		}
+		backends = auth.Chain
+	default:
+		return fmt.Errorf("invalid auth mode: %s (must be 'rest', 'static', 'webhook' or 'chain')", auth.Mode)
+	}
+
+	seen := make(map[string]bool)
+	for _, backend := range backends {
+		if seen[backend] {
+			return fmt.Errorf("duplicate auth backend in chain: %s", backend)
+		}
+		seen[backend] = true
+
+		switch backend {
+		case "rest":
+			if auth.Secret == "" {
+				return fmt.Errorf("auth secret is required for REST mode")
+			}
+			if auth.UsernameFormat != "" && auth.UsernameFormat != "peer" && auth.UsernameFormat != "timestamp" {
+				return fmt.Errorf("invalid auth username_format: %s (must be 'peer' or 'timestamp')", auth.UsernameFormat)
+			}
+		case "static":
+			if len(auth.StaticUsers) == 0 {
+				return fmt.Errorf("at least one static user is required for static auth mode")
+			}
+		case "webhook":
+			if webhook.URL == "" {
+				return fmt.Errorf("auth_webhook.url is required for webhook auth")
+			}
+		default:
+			return fmt.Errorf("invalid auth backend in chain: %s (must be 'rest', 'static' or 'webhook')", backend)
+		}
+	}
+
+	return nil
+}
@@ -107,6 +107,7 @@ admin:
 				assert.Equal(t, 10, cfg.Signaling.MaxPeersPerRoom)
 				assert.Equal(t, 300*time.Second, cfg.Signaling.SessionTimeout)
 				assert.Equal(t, 9000, cfg.API.Port)
+				assert.Equal(t, "default", cfg.API.APIKey.Name)
 				assert.Equal(t, 9001, cfg.Admin.Port)
 				assert.Equal(t, "127.0.0.1", cfg.Admin.Bind)
 				assert.Equal(t, "info", cfg.Logging.Level)
@@ -139,6 +140,333 @@ admin:
 				assert.Equal(t, "pass1", cfg.Turn.Auth.StaticUsers[0].Password)
 			},
 		},
+		{
+			name: "chain auth mode with default order",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+
+turn:
+  auth:
+    mode: "chain"
+    secret: "secret"
+    static_users:
+      - username: "device1"
+        password: "pass1"
+
+admin:
+  token: "token"
+`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "chain", cfg.Turn.Auth.Mode)
+				assert.Equal(t, []string{"rest", "static"}, cfg.Turn.Auth.Chain)
+			},
+		},
+		{
+			name: "chain auth mode with explicit order",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+
+turn:
+  auth:
+    mode: "chain"
+    chain: ["static", "rest"]
+    secret: "secret"
+    static_users:
+      - username: "device1"
+        password: "pass1"
+
+admin:
+  token: "token"
+`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, []string{"static", "rest"}, cfg.Turn.Auth.Chain)
+			},
+		},
+		{
+			name: "chain auth mode without static users",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "chain"
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "at least one static user is required",
+		},
+		{
+			name: "chain auth mode with unknown backend",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "chain"
+    chain: ["rest", "ldap"]
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "invalid auth backend in chain",
+		},
+		{
+			name: "chain auth mode with duplicate backend",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "chain"
+    chain: ["rest", "rest"]
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "duplicate auth backend in chain",
+		},
+		{
+			name: "webhook auth mode",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+
+turn:
+  auth:
+    mode: "webhook"
+
+signaling:
+  webhook_auth: true
+
+auth_webhook:
+  url: "http://127.0.0.1:8000/authorize"
+  token: "hook-token"
+
+admin:
+  token: "token"
+`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "webhook", cfg.Turn.Auth.Mode)
+				assert.True(t, cfg.Signaling.WebhookAuth)
+				assert.Equal(t, "http://127.0.0.1:8000/authorize", cfg.AuthWebhook.URL)
+				assert.Equal(t, 2*time.Second, cfg.AuthWebhook.Timeout)
+				assert.Equal(t, 60*time.Second, cfg.AuthWebhook.CacheTTL)
+				assert.Equal(t, 500*time.Millisecond, cfg.AuthWebhook.TURNTimeout)
+				assert.Equal(t, 5*time.Second, cfg.AuthWebhook.ErrorCacheTTL)
+				assert.False(t, cfg.AuthWebhook.FailOpen)
+			},
+		},
+		{
+			name: "webhook auth mode without url",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "webhook"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "auth_webhook.url is required for webhook auth",
+		},
+		{
+			name: "signaling webhook auth without url",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+signaling:
+  webhook_auth: true
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "auth_webhook.url is required when signaling webhook_auth is enabled",
+		},
+		{
+			name: "dtls port clashing with udp port",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  ports:
+    udp: 3478
+    dtls: 3478
+  auth:
+    mode: "rest"
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "turn dtls port must differ from the udp port",
+		},
+		{
+			name: "invalid listen address",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  listen_addresses: ["0.0.0.0", "not-an-ip"]
+  auth:
+    mode: "rest"
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "invalid turn listen address: not-an-ip",
+		},
+		{
+			name: "ipv4 literal as public_ipv6",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  public_ipv6: "203.0.113.1"
+  auth:
+    mode: "rest"
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "turn public_ipv6 must be an IPv6 address",
+		},
+		{
+			name: "auto public ip without stun server",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  public_ip: "auto"
+  auth:
+    mode: "rest"
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "turn detect_stun_server is required when public_ip is \"auto\"",
+		},
+		{
+			name: "invalid bind ip",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  bind_ip: "::1"
+  auth:
+    mode: "rest"
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "turn bind_ip must be an IPv4 address",
+		},
+		{
+			name: "invalid extra ice server url",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  ice:
+    extra_servers:
+      - urls: ["http://stun.example.com"]
+  auth:
+    mode: "rest"
+    secret: "secret"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "invalid ice server url: http://stun.example.com",
+		},
+		{
+			name: "invalid username format",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+    username_format: "uuid"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "invalid auth username_format: uuid",
+		},
+		{
+			name: "ttl above max ttl",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+    ttl_seconds: 86400
+    max_ttl_seconds: 3600
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "auth ttl_seconds (86400) exceeds max_ttl_seconds (3600)",
+		},
+		{
+			name: "invalid peer ttl type",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+    peer_ttl:
+      robot:
+        max: 600
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "invalid peer type in auth peer_ttl: robot",
+		},
+		{
+			name: "api key ttl min above max",
+			configYAML: `
+domain: "turn.test.com"
+email: "test@test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+api:
+  api_key:
+    ttl:
+      min: 7200
+      max: 600
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "api_key min ttl (7200) exceeds max ttl (600)",
+		},
 		{
 			name:        "missing domain",
 			configYAML:  `email: "test@test.com"`,
@@ -234,6 +562,208 @@ turn:
 			wantErr:     true,
 			errContains: "admin token is required",
 		},
+		{
+			name: "auth guard defaults",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+auth_guard:
+  enabled: true
+  max_failures: 5
+admin:
+  token: "token"
+`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 5, cfg.AuthGuard.MaxFailures)
+				assert.Equal(t, time.Minute, cfg.AuthGuard.Window)
+				assert.Equal(t, time.Minute, cfg.AuthGuard.BanDuration)
+				assert.Equal(t, time.Hour, cfg.AuthGuard.MaxBanDuration)
+			},
+		},
+		{
+			name: "auth guard max ban below ban duration",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+auth_guard:
+  enabled: true
+  ban_duration: 10m
+  max_ban_duration: 1m
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "auth_guard.max_ban_duration",
+		},
+		{
+			name: "webhook delivery defaults",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+webhooks:
+  max_attempts: 3
+admin:
+  token: "token"
+`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 3, cfg.Webhooks.MaxAttempts)
+				assert.Equal(t, 5*time.Second, cfg.Webhooks.Timeout)
+				assert.Equal(t, time.Second, cfg.Webhooks.RetryBackoff)
+				assert.Equal(t, time.Minute, cfg.Webhooks.MaxRetryBackoff)
+				assert.Equal(t, 4, cfg.Webhooks.Workers)
+				assert.Equal(t, 1000, cfg.Webhooks.QueueSize)
+			},
+		},
+		{
+			name: "webhook max retry backoff below retry backoff",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+webhooks:
+  retry_backoff: 5m
+  max_retry_backoff: 1m
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "webhooks.max_retry_backoff",
+		},
+		{
+			name: "rate limits",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+api:
+  rate_limit:
+    per_ip:
+      rate: 5
+      burst: 10
+signaling:
+  message_rate:
+    rate: 50
+admin:
+  token: "token"
+`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, RateLimit{Rate: 5, Burst: 10}, cfg.API.RateLimit.PerIP)
+				assert.Equal(t, RateLimit{}, cfg.API.RateLimit.PerKey)
+				assert.Equal(t, 20, cfg.Signaling.MaxRateViolations)
+			},
+		},
+		{
+			name: "negative rate limit",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+api:
+  rate_limit:
+    per_key:
+      rate: -1
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "api.rate_limit.per_key",
+		},
+		{
+			name: "proxy defaults",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+proxy:
+  enabled: true
+  path_prefix: "/s"
+admin:
+  token: "token"
+`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "turn.test.com", cfg.Proxy.Domain)
+				assert.Equal(t, "/s", cfg.Proxy.PathPrefix)
+				assert.Equal(t, 10*time.Second, cfg.Proxy.DialTimeout)
+			},
+		},
+		{
+			name: "proxy path prefix overlapping the API",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+proxy:
+  enabled: true
+  path_prefix: "/api/v1"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "proxy.path_prefix",
+		},
+		{
+			name: "health check defaults",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+signaling:
+  health_check:
+    enabled: true
+    interval: 10s
+admin:
+  token: "token"
+`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 10*time.Second, cfg.Signaling.HealthCheck.Interval)
+				assert.Equal(t, 5*time.Second, cfg.Signaling.HealthCheck.Timeout)
+				assert.Equal(t, "/", cfg.Signaling.HealthCheck.Path)
+			},
+		},
+		{
+			name: "health check path without leading slash",
+			configYAML: `
+domain: "turn.test.com"
+turn:
+  auth:
+    mode: "rest"
+    secret: "secret"
+signaling:
+  health_check:
+    enabled: true
+    path: "healthz"
+admin:
+  token: "token"
+`,
+			wantErr:     true,
+			errContains: "signaling.health_check.path",
+		},
 	}
 
 	for _, tt := range tests {
@@ -299,6 +829,8 @@ func TestApplyDefaults(t *testing.T) {
 	assert.Equal(t, 3478, cfg.Turn.Ports.TCP)
 	assert.Equal(t, 5349, cfg.Turn.Ports.TLS)
 	assert.Equal(t, 86400, cfg.Turn.Auth.TTLSeconds)
+	assert.Equal(t, 172800, cfg.Turn.Auth.MaxTTLSeconds)
+	assert.Empty(t, cfg.Turn.ListenAddresses, "left empty so the TURN server can tell the default apart")
 	assert.Equal(t, "info", cfg.Logging.Level)
 	assert.Equal(t, "text", cfg.Logging.Format)
 }
@@ -334,4 +866,24 @@ func TestApplyDefaults_RealmFromDomain(t *testing.T) {
 	applyDefaults(cfg)
 
 	assert.Equal(t, "turn.example.com", cfg.Turn.Realm)
+	assert.Equal(t, "turn.example.com", cfg.Turn.ICE.Hostname)
+}
+
+func TestTurnConfig_AdvertisedHosts(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TurnConfig
+		want []string
+	}{
+		{"ipv4 only", TurnConfig{PublicIP: "203.0.113.1"}, []string{"203.0.113.1"}},
+		{"dual stack", TurnConfig{PublicIP: "203.0.113.1", PublicIPv6: "2001:db8::1"}, []string{"203.0.113.1", "[2001:db8::1]"}},
+		{"ipv6 only", TurnConfig{PublicIPv6: "2001:db8::1"}, []string{"[2001:db8::1]"}},
+		{"none", TurnConfig{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cfg.AdvertisedHosts())
+		})
+	}
 }
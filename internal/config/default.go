@@ -18,10 +18,20 @@ acme:
 turn:
   realm: "example.com"
   public_ip: "127.0.0.1"
+  # public_ip: "auto"            # Detect via STUN (requires detect_stun_server)
+  # detect_stun_server: "stun.l.google.com:19302"
+  # bind_ip: "10.0.0.5"           # Local address for relay sockets (default: all)
+  # public_ipv6: "2001:db8::1"  # Optional, advertised to IPv6 clients
+  # listen_addresses: ["0.0.0.0", "::"]
   ports:
     udp: 3478
     tcp: 3478
     tls: 5349
+    # dtls: 5350  # Optional TURN over DTLS (requires TLS certificate)
+  # ice:
+  #   hostname: "turn.example.com"  # Used in turns: URLs (default: domain)
+  #   extra_servers:
+  #     - urls: ["stun:stun.l.google.com:19302"]
   relay_port_range:
     min: 49152
     max: 65535
@@ -30,9 +40,43 @@ turn:
     secret: "change-this-secret-in-production"
     ttl_seconds: 86400
 
+auth_guard:
+  enabled: true
+  max_failures: 10      # Failed attempts per IP/username within window before a ban
+  window: 1m
+  ban_duration: 1m      # Doubles on each repeat ban
+  max_ban_duration: 1h
+
+webhooks:               # Outbound event webhooks (subscriptions are managed via the admin API)
+  timeout: 5s
+  max_attempts: 5       # Failed events are kept in the dead-letter log
+  retry_backoff: 1s     # Doubles on each retry
+  max_retry_backoff: 1m
+  workers: 4
+  queue_size: 1000
+
+proxy:                  # Public reverse proxy to edge HTTP/WebSocket services
+  enabled: false
+  # domain: "example.com"     # Services served at <service-id>.<domain> (default: domain)
+  # path_prefix: "/s"         # Also serve them at /s/<service-id>/
+  dial_timeout: 10s       # Time the edge has to open a tunnel
+
+audit:                  # Log of authenticated API calls ("arqut-server audit list" to query)
+  # file: "data/audit.jsonl"  # Also append entries as JSON Lines
+  include_reads: false  # Also record GET requests other than /ice-servers
+
 signaling:
   max_peers_per_room: 10
   session_timeout: 300s
+  message_rate:         # Per-peer WebSocket messages per second
+    rate: 50
+    burst: 100
+  max_rate_violations: 20  # Disconnect after this many consecutive dropped messages
+  health_check:         # Probe edge services through the tunnel (edges may also report health)
+    enabled: false
+    interval: 30s
+    timeout: 5s
+    path: "/"           # Requested from http, https and websocket services
 
 api:
   port: 9000  # Unified HTTP/HTTPS port for REST API and WebSocket signaling
@@ -40,6 +84,13 @@ api:
   cors_origins:
     - "http://localhost:3000"
     - "https://app.example.com"
+  rate_limit:           # Token buckets; rate is requests per second (0 = unlimited)
+    per_ip:
+      rate: 20
+      burst: 40
+    per_key:
+      rate: 100
+      burst: 200
 
 admin:
   port: 9001
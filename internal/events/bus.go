@@ -0,0 +1,176 @@
+package events
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types
+const (
+	PeerConnected         = "peer.connected"
+	PeerDisconnected      = "peer.disconnected"
+	EdgeRegistered        = "edge.registered"
+	ServiceCreated        = "service.created"
+	ServiceUpdated        = "service.updated"
+	ServiceDeleted        = "service.deleted"
+	ServiceHealthChanged  = "service.health_changed"
+	TurnAllocationCreated = "turn.allocation.created"
+	TurnAllocationDeleted = "turn.allocation.deleted"
+)
+
+// Types lists all event types, in documentation order
+var Types = []string{
+	PeerConnected,
+	PeerDisconnected,
+	EdgeRegistered,
+	ServiceCreated,
+	ServiceUpdated,
+	ServiceDeleted,
+	ServiceHealthChanged,
+	TurnAllocationCreated,
+	TurnAllocationDeleted,
+}
+
+// Event is a single state change published on the bus
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Bus fans events out to subscribers. Publishing never blocks: a subscriber
+// whose buffer is full misses the event.
+// All methods are safe to call on a nil Bus, which discards events.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	seq    atomic.Uint64
+	logger *slog.Logger
+}
+
+// NewBus creates an event bus
+func NewBus(logger *slog.Logger) *Bus {
+	return &Bus{
+		subs:   make(map[*Subscription]struct{}),
+		logger: logger.With("component", "events"),
+	}
+}
+
+// Publish sends an event to all matching subscribers
+func (b *Bus) Publish(eventType string, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	event := Event{
+		ID:   b.seq.Add(1),
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: data,
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if !Match(sub.patterns, eventType) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+			b.logger.Debug("Subscriber buffer full, event dropped",
+				"type", eventType,
+				"id", event.ID,
+			)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for events matching patterns (see Match).
+// No patterns subscribes to everything. The caller must Close the subscription.
+func (b *Bus) Subscribe(buffer int, patterns ...string) *Subscription {
+	sub := &Subscription{
+		bus:      b,
+		patterns: patterns,
+		ch:       make(chan Event, buffer),
+	}
+	if b == nil {
+		return sub
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// Subscription receives events from a Bus
+type Subscription struct {
+	bus      *Bus
+	patterns []string
+	ch       chan Event
+	dropped  atomic.Uint64
+	once     sync.Once
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events missed because the buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unregisters the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		if s.bus != nil {
+			s.bus.mu.Lock()
+			delete(s.bus.subs, s)
+			s.bus.mu.Unlock()
+		}
+		close(s.ch)
+	})
+}
+
+// Match reports whether eventType matches any of patterns. A pattern is an
+// exact type, a prefix ending in ".*" (e.g. "service.*") or "*".
+// An empty pattern list matches everything.
+func Match(patterns []string, eventType string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		switch {
+		case p == "*" || p == eventType:
+			return true
+		case strings.HasSuffix(p, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(p, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// ValidPattern reports whether p is "*", a known event type, or a prefix
+// pattern ("service.*") that matches at least one known type
+func ValidPattern(p string) bool {
+	if p == "*" {
+		return true
+	}
+	for _, t := range Types {
+		if Match([]string{p}, t) {
+			return true
+		}
+	}
+	return false
+}
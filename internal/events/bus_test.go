@@ -0,0 +1,90 @@
+package events
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		patterns  []string
+		eventType string
+		want      bool
+	}{
+		{nil, ServiceCreated, true},
+		{[]string{"*"}, PeerConnected, true},
+		{[]string{ServiceCreated}, ServiceCreated, true},
+		{[]string{ServiceCreated}, ServiceDeleted, false},
+		{[]string{"service.*"}, ServiceDeleted, true},
+		{[]string{"turn.*"}, TurnAllocationCreated, true},
+		{[]string{"service.*"}, PeerConnected, false},
+		{[]string{"peer.connected", "edge.*"}, EdgeRegistered, true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Match(tt.patterns, tt.eventType), "%v / %s", tt.patterns, tt.eventType)
+	}
+}
+
+func TestValidPattern(t *testing.T) {
+	for _, p := range []string{"*", PeerConnected, "service.*", "turn.*", "turn.allocation.*"} {
+		assert.True(t, ValidPattern(p), p)
+	}
+	for _, p := range []string{"", "service", "service.renamed", "bogus.*", "*.created"} {
+		assert.False(t, ValidPattern(p), p)
+	}
+}
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	bus := NewBus(slog.Default())
+
+	all := bus.Subscribe(10)
+	services := bus.Subscribe(10, "service.*")
+
+	bus.Publish(PeerConnected, PeerData{ID: "p1"})
+	bus.Publish(ServiceCreated, ServiceData{ID: "s1"})
+
+	require.Len(t, all.Events(), 2)
+	first := <-all.Events()
+	second := <-all.Events()
+	assert.Equal(t, PeerConnected, first.Type)
+	assert.Equal(t, ServiceCreated, second.Type)
+	assert.Greater(t, second.ID, first.ID)
+
+	require.Len(t, services.Events(), 1)
+	assert.Equal(t, ServiceData{ID: "s1"}, (<-services.Events()).Data)
+
+	// Closed subscriptions stop receiving and their channel is closed
+	services.Close()
+	services.Close()
+	bus.Publish(ServiceDeleted, nil)
+	_, ok := <-services.Events()
+	assert.False(t, ok)
+
+	all.Close()
+}
+
+func TestBus_SlowSubscriberDoesNotBlock(t *testing.T) {
+	bus := NewBus(slog.Default())
+	sub := bus.Subscribe(1)
+	defer sub.Close()
+
+	bus.Publish(PeerConnected, nil)
+	bus.Publish(PeerDisconnected, nil)
+	bus.Publish(PeerConnected, nil)
+
+	assert.Len(t, sub.Events(), 1)
+	assert.Equal(t, uint64(2), sub.Dropped())
+}
+
+func TestBus_Nil(t *testing.T) {
+	var bus *Bus
+	bus.Publish(PeerConnected, nil)
+
+	sub := bus.Subscribe(1)
+	assert.Empty(t, sub.Events())
+	sub.Close()
+}
@@ -0,0 +1,34 @@
+package events
+
+import "github.com/arqut/arqut-server-ce/internal/pkg/models"
+
+// Event sources for service changes
+const (
+	SourceEdge  = "edge"  // Reported by the edge over signaling
+	SourceAPI   = "api"   // Made through the REST API
+	SourceProbe = "probe" // Found by a server health check
+)
+
+// PeerData is the payload of peer and edge events
+type PeerData struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	EdgeID string `json:"edge_id,omitempty"`
+	Reason string `json:"reason,omitempty"` // Disconnect reason, e.g. "stale"
+}
+
+// ServiceData is the payload of service events
+type ServiceData struct {
+	ID      string              `json:"id"`
+	EdgeID  string              `json:"edge_id"`
+	Source  string              `json:"source"`
+	Service *models.EdgeService `json:"service,omitempty"` // Omitted for deletions
+}
+
+// AllocationData is the payload of TURN allocation events
+type AllocationData struct {
+	Username  string `json:"username"`
+	Protocol  string `json:"protocol"`
+	SrcAddr   string `json:"src_addr"`
+	RelayAddr string `json:"relay_addr,omitempty"`
+}
@@ -0,0 +1,145 @@
+package ice
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+)
+
+// Transports a caller can request
+const (
+	TransportUDP  = "udp"  // STUN and TURN over UDP
+	TransportTCP  = "tcp"  // TURN over TCP
+	TransportTLS  = "tls"  // TURNS over TLS
+	TransportDTLS = "dtls" // TURNS over DTLS
+)
+
+// AllTransports lists every transport in the order servers are emitted
+var AllTransports = []string{TransportUDP, TransportTCP, TransportTLS, TransportDTLS}
+
+// Builder assembles ICE server lists from the TURN configuration.
+// It is shared by the REST API and the signaling server so both hand out
+// identical URLs.
+type Builder struct {
+	cfg *config.TurnConfig
+}
+
+// NewBuilder creates an ICE server builder
+func NewBuilder(cfg *config.TurnConfig) *Builder {
+	return &Builder{cfg: cfg}
+}
+
+// Build returns this server's STUN/TURN/TURNS entries for the requested
+// transports (all when empty) followed by the configured external servers
+func (b *Builder) Build(username, credential string, transports []string) []models.ICEServer {
+	servers := b.Servers(username, credential, transports)
+
+	for _, extra := range b.cfg.ICE.ExtraServers {
+		servers = append(servers, models.ICEServer{
+			URLs:       extra.URLs,
+			Username:   extra.Username,
+			Credential: extra.Credential,
+		})
+	}
+
+	return servers
+}
+
+// Servers returns only this server's STUN/TURN/TURNS entries
+func (b *Builder) Servers(username, credential string, transports []string) []models.ICEServer {
+	want := make(map[string]bool)
+	if len(transports) == 0 {
+		transports = AllTransports
+	}
+	for _, transport := range transports {
+		want[transport] = true
+	}
+
+	ports := b.cfg.Ports
+	var stunURLs, turnURLs, turnsURLs []string
+
+	for _, host := range b.hosts() {
+		if want[TransportUDP] && ports.UDP > 0 {
+			stunURLs = append(stunURLs, fmt.Sprintf("stun:%s:%d", host, ports.UDP))
+			turnURLs = append(turnURLs, fmt.Sprintf("turn:%s:%d?transport=udp", host, ports.UDP))
+		}
+		if want[TransportTCP] && ports.TCP > 0 {
+			turnURLs = append(turnURLs, fmt.Sprintf("turn:%s:%d?transport=tcp", host, ports.TCP))
+		}
+	}
+
+	for _, host := range b.tlsHosts() {
+		if want[TransportTLS] && ports.TLS > 0 {
+			turnsURLs = append(turnsURLs, fmt.Sprintf("turns:%s:%d?transport=tcp", host, ports.TLS))
+		}
+		if want[TransportDTLS] && ports.DTLS > 0 {
+			turnsURLs = append(turnsURLs, fmt.Sprintf("turns:%s:%d?transport=udp", host, ports.DTLS))
+		}
+	}
+
+	var servers []models.ICEServer
+	if len(stunURLs) > 0 {
+		servers = append(servers, models.ICEServer{URLs: stunURLs})
+	}
+	if len(turnURLs) > 0 {
+		servers = append(servers, models.ICEServer{URLs: turnURLs, Username: username, Credential: credential})
+	}
+	if len(turnsURLs) > 0 {
+		servers = append(servers, models.ICEServer{URLs: turnsURLs, Username: username, Credential: credential})
+	}
+
+	return servers
+}
+
+// hosts returns the hosts used for stun/turn URLs
+func (b *Builder) hosts() []string {
+	if b.cfg.ICE.PreferHostname && b.cfg.ICE.Hostname != "" {
+		return []string{b.cfg.ICE.Hostname}
+	}
+	return b.cfg.AdvertisedHosts()
+}
+
+// tlsHosts returns the hosts used for turns URLs. Clients validate the
+// certificate against the URL host, so the hostname wins when configured.
+func (b *Builder) tlsHosts() []string {
+	if b.cfg.ICE.Hostname != "" {
+		return []string{b.cfg.ICE.Hostname}
+	}
+	return b.cfg.AdvertisedHosts()
+}
+
+// URLs flattens the URLs of a server list
+func URLs(servers []models.ICEServer) []string {
+	var urls []string
+	for _, server := range servers {
+		urls = append(urls, server.URLs...)
+	}
+	return urls
+}
+
+// ParseTransports parses a comma separated transport list such as "udp,tls".
+// An empty value selects all transports.
+func ParseTransports(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	return ValidateTransports(strings.Split(value, ","))
+}
+
+// ValidateTransports normalizes and checks a transport list
+func ValidateTransports(values []string) ([]string, error) {
+	var transports []string
+	for _, value := range values {
+		transport := strings.ToLower(strings.TrimSpace(value))
+		switch transport {
+		case TransportUDP, TransportTCP, TransportTLS, TransportDTLS:
+			transports = append(transports, transport)
+		case "":
+		default:
+			return nil, fmt.Errorf("invalid transport: %s (must be 'udp', 'tcp', 'tls' or 'dtls')", value)
+		}
+	}
+	return transports, nil
+}
@@ -0,0 +1,149 @@
+package ice
+
+import (
+	"testing"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *config.TurnConfig {
+	return &config.TurnConfig{
+		PublicIP: "203.0.113.1",
+		Ports: config.TurnPorts{
+			UDP:  3478,
+			TCP:  3479,
+			TLS:  5349,
+			DTLS: 5350,
+		},
+	}
+}
+
+func TestBuilder_Build(t *testing.T) {
+	servers := NewBuilder(testConfig()).Build("user", "pass", nil)
+
+	require.Len(t, servers, 3)
+	assert.Equal(t, models.ICEServer{URLs: []string{"stun:203.0.113.1:3478"}}, servers[0])
+	assert.Equal(t, models.ICEServer{
+		URLs: []string{
+			"turn:203.0.113.1:3478?transport=udp",
+			"turn:203.0.113.1:3479?transport=tcp",
+		},
+		Username:   "user",
+		Credential: "pass",
+	}, servers[1])
+	assert.Equal(t, models.ICEServer{
+		URLs: []string{
+			"turns:203.0.113.1:5349?transport=tcp",
+			"turns:203.0.113.1:5350?transport=udp",
+		},
+		Username:   "user",
+		Credential: "pass",
+	}, servers[2])
+}
+
+func TestBuilder_Hostname(t *testing.T) {
+	t.Run("turns uses hostname", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.ICE.Hostname = "turn.example.com"
+
+		urls := URLs(NewBuilder(cfg).Build("user", "pass", nil))
+		assert.Contains(t, urls, "turn:203.0.113.1:3478?transport=udp")
+		assert.Contains(t, urls, "turns:turn.example.com:5349?transport=tcp")
+		assert.NotContains(t, urls, "turns:203.0.113.1:5349?transport=tcp")
+	})
+
+	t.Run("prefer hostname everywhere", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.ICE.Hostname = "turn.example.com"
+		cfg.ICE.PreferHostname = true
+
+		for _, url := range URLs(NewBuilder(cfg).Build("user", "pass", nil)) {
+			assert.Contains(t, url, "turn.example.com")
+		}
+	})
+}
+
+func TestBuilder_DualStack(t *testing.T) {
+	cfg := testConfig()
+	cfg.PublicIPv6 = "2001:db8::1"
+
+	urls := URLs(NewBuilder(cfg).Build("user", "pass", nil))
+	assert.Contains(t, urls, "stun:[2001:db8::1]:3478")
+	assert.Contains(t, urls, "turn:[2001:db8::1]:3479?transport=tcp")
+	assert.Contains(t, urls, "turns:[2001:db8::1]:5350?transport=udp")
+}
+
+func TestBuilder_TransportSubset(t *testing.T) {
+	builder := NewBuilder(testConfig())
+
+	tests := []struct {
+		name       string
+		transports []string
+		want       []string
+	}{
+		{"udp only", []string{TransportUDP}, []string{"stun:203.0.113.1:3478", "turn:203.0.113.1:3478?transport=udp"}},
+		{"tcp only", []string{TransportTCP}, []string{"turn:203.0.113.1:3479?transport=tcp"}},
+		{"tls and dtls", []string{TransportTLS, TransportDTLS}, []string{"turns:203.0.113.1:5349?transport=tcp", "turns:203.0.113.1:5350?transport=udp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, URLs(builder.Build("user", "pass", tt.transports)))
+		})
+	}
+}
+
+func TestBuilder_DisabledPorts(t *testing.T) {
+	cfg := testConfig()
+	cfg.Ports = config.TurnPorts{UDP: 3478}
+
+	servers := NewBuilder(cfg).Build("user", "pass", nil)
+	assert.Equal(t, []string{"stun:203.0.113.1:3478", "turn:203.0.113.1:3478?transport=udp"}, URLs(servers))
+}
+
+func TestBuilder_ExtraServers(t *testing.T) {
+	cfg := testConfig()
+	cfg.ICE.ExtraServers = []config.ICEServerConfig{
+		{URLs: []string{"stun:stun.l.google.com:19302"}},
+		{URLs: []string{"turn:backup.example.com:3478"}, Username: "backup", Credential: "secret"},
+	}
+
+	builder := NewBuilder(cfg)
+
+	servers := builder.Build("user", "pass", []string{TransportUDP})
+	require.Len(t, servers, 4)
+	assert.Equal(t, models.ICEServer{URLs: []string{"stun:stun.l.google.com:19302"}}, servers[2])
+	assert.Equal(t, "backup", servers[3].Username)
+
+	// Servers excludes external entries
+	assert.Len(t, builder.Servers("user", "pass", []string{TransportUDP}), 2)
+}
+
+func TestParseTransports(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"udp", []string{"udp"}, false},
+		{"UDP, tls", []string{"udp", "tls"}, false},
+		{"udp,,dtls", []string{"udp", "dtls"}, false},
+		{"quic", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTransports(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
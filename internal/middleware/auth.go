@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/arqut/arqut-server-ce/internal/apikey"
+	"github.com/arqut/arqut-server-ce/internal/authguard"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -32,9 +34,32 @@ func ErrorUnauthorizedResp(c *fiber.Ctx, message string) error {
 	})
 }
 
+// ErrorTooManyRequestsResp returns a 429 Too Many Requests error response
+func ErrorTooManyRequestsResp(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusTooManyRequests).JSON(&APIResponse{
+		Success: false,
+		Error: &APIError{
+			Code:    fiber.StatusTooManyRequests,
+			Message: message,
+		},
+	})
+}
+
 // APIKeyAuth creates a middleware that validates API key authentication
 func APIKeyAuth(apiKeyHash string) fiber.Handler {
+	return APIKeyAuthWithGuard(apiKeyHash, nil)
+}
+
+// APIKeyAuthWithGuard validates API key authentication and records invalid
+// keys per client IP in guard, rejecting banned clients with 429
+func APIKeyAuthWithGuard(apiKeyHash string, guard *authguard.Guard) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		ipKey := authguard.IPKey(c.IP())
+		if remaining, banned := guard.Check(ipKey); banned {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(remaining.Seconds())+1))
+			return ErrorTooManyRequestsResp(c, "Too many failed authentication attempts")
+		}
+
 		// Get Authorization header
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -51,15 +76,18 @@ func APIKeyAuth(apiKeyHash string) fiber.Handler {
 
 		// Validate API key format
 		if !apikey.ValidateFormat(providedKey) {
+			guard.Failure(ipKey)
 			return ErrorUnauthorizedResp(c, "Invalid API key format")
 		}
 
 		// Validate against hash
 		if !apikey.Validate(providedKey, apiKeyHash) {
+			guard.Failure(ipKey)
 			return ErrorUnauthorizedResp(c, "Invalid API key")
 		}
 
 		// API key is valid, continue
+		guard.Success(ipKey)
 		return c.Next()
 	}
 }
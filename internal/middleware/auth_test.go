@@ -2,10 +2,15 @@ package middleware
 
 import (
 	"io"
+	"log/slog"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/arqut/arqut-server-ce/internal/apikey"
+	"github.com/arqut/arqut-server-ce/internal/authguard"
+	"github.com/arqut/arqut-server-ce/internal/config"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -174,6 +179,49 @@ func TestAPIKeyAuth_MultipleRequests(t *testing.T) {
 	}
 }
 
+func TestAPIKeyAuthWithGuard_BansRepeatedFailures(t *testing.T) {
+	key, hash, err := apikey.GenerateWithHash()
+	require.NoError(t, err)
+
+	guard := authguard.New(&config.AuthGuardConfig{
+		Enabled:        true,
+		MaxFailures:    2,
+		Window:         time.Minute,
+		BanDuration:    time.Minute,
+		MaxBanDuration: time.Hour,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	app := fiber.New()
+	app.Use(APIKeyAuthWithGuard(hash, guard))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString("success")
+	})
+
+	otherKey, _, err := apikey.GenerateWithHash()
+	require.NoError(t, err)
+
+	send := func(apiKey string) *http.Response {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	assert.Equal(t, fiber.StatusUnauthorized, send(otherKey).StatusCode)
+	assert.Equal(t, fiber.StatusUnauthorized, send(otherKey).StatusCode)
+
+	// Banned: even the valid key is rejected until the ban expires
+	resp := send(key)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	// Clearing the ban restores access
+	guard.ClearAll()
+	assert.Equal(t, fiber.StatusOK, send(key).StatusCode)
+}
+
 func BenchmarkAPIKeyAuth(b *testing.B) {
 	key, hash, err := apikey.GenerateWithHash()
 	require.NoError(b, err)
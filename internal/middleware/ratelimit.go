@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/arqut/arqut-server-ce/internal/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimit creates a middleware that rejects requests with 429 once the
+// bucket selected by keyFunc is empty. A nil limiter disables limiting.
+func RateLimit(limiter *ratelimit.Limiter, keyFunc func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if limiter == nil {
+			return c.Next()
+		}
+
+		allowed, wait := limiter.Allow(keyFunc(c))
+		if !allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return ErrorTooManyRequestsResp(c, "Rate limit exceeded")
+		}
+
+		return c.Next()
+	}
+}
+
+// ClientIP keys rate limits by the client IP address
+func ClientIP(c *fiber.Ctx) string {
+	return c.IP()
+}
+
+// APIKeyID keys rate limits by the bearer token. The token is hashed so raw
+// keys are never held in memory longer than the request.
+func APIKeyID(c *fiber.Ctx) string {
+	token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
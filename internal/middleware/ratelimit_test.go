@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arqut/arqut-server-ce/internal/ratelimit"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	app := fiber.New()
+	app.Use(RateLimit(ratelimit.New(1, 2), APIKeyID))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString("success")
+	})
+
+	send := func(key string) (int, string) {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("Retry-After")
+	}
+
+	status, _ := send("key-a")
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = send("key-a")
+	assert.Equal(t, fiber.StatusOK, status)
+
+	status, retryAfter := send("key-a")
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	assert.Equal(t, "1", retryAfter)
+
+	// Separate bucket per key
+	status, _ = send("key-b")
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	app := fiber.New()
+	app.Use(RateLimit(nil, ClientIP))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString("success")
+	})
+
+	for i := 0; i < 10; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/test", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+}
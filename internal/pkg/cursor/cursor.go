@@ -0,0 +1,63 @@
+// Package cursor encodes the opaque keyset cursors of paginated list endpoints
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalid means a cursor could not be decoded or was made for another
+// sort order
+var ErrInvalid = errors.New("invalid cursor")
+
+// Cursor is the position after the last item of a page. Lists are ordered by
+// the sort field and then by ID, so the sort value and ID of the last item
+// identify where the next page starts even if items are added or removed.
+type Cursor struct {
+	Sort   string          `json:"s"`           // Sort field the cursor was made for
+	Desc   bool            `json:"d,omitempty"` // Descending order
+	Value  json.RawMessage `json:"v,omitempty"` // Sort value of the last item
+	ID     string          `json:"id"`          // ID of the last item
+	Offset int             `json:"n"`           // Items before the next page
+}
+
+// New returns the cursor after an item with the given sort value and ID
+func New(sort string, desc bool, value any, id string, offset int) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	c := Cursor{Sort: sort, Desc: desc, Value: raw, ID: id, Offset: offset}
+	return c.Encode(), nil
+}
+
+// Encode returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Decode parses a cursor and checks that it was made for the given order
+func Decode(s, sort string, desc bool) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	var c Cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" || c.Offset < 0 {
+		return nil, ErrInvalid
+	}
+	if c.Sort != sort || c.Desc != desc {
+		return nil, ErrInvalid
+	}
+	return &c, nil
+}
+
+// Unmarshal decodes the sort value into v
+func (c *Cursor) Unmarshal(v any) error {
+	if err := json.Unmarshal(c.Value, v); err != nil {
+		return ErrInvalid
+	}
+	return nil
+}
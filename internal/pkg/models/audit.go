@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// ServiceAudit records one change of a service. Entries are only ever
+// appended and outlive the service they describe, so the history of a
+// deleted service stays readable.
+type ServiceAudit struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	ServiceID string       `json:"service_id" gorm:"type:varchar(8);index;not null"`
+	EdgeID    string       `json:"edge_id" gorm:"type:varchar(64)"`
+	Operation string       `json:"operation" gorm:"type:varchar(10)"`  // One of the Audit constants
+	ActorType string       `json:"actor_type" gorm:"type:varchar(10)"` // One of the Actor constants
+	Actor     string       `json:"actor"`                              // Edge ID or API key name
+	Via       string       `json:"via"`                                // Signaling message type or API route
+	Before    *EdgeService `json:"before" gorm:"serializer:json"`      // nil for creations
+	After     *EdgeService `json:"after" gorm:"serializer:json"`       // nil for deletions
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Service audit operations
+const (
+	AuditCreated = "created"
+	AuditUpdated = "updated"
+	AuditDeleted = "deleted"
+)
+
+// Service audit actor types
+const (
+	ActorEdge   = "edge"    // An edge over signaling; Actor is the edge ID
+	ActorAPIKey = "api_key" // A REST API client; Actor is the API key name
+)
+
+// AuditLog records one authenticated call to the REST API. Secrets in the
+// request parameters are redacted before the entry is written.
+type AuditLog struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	Actor      string         `json:"actor" gorm:"type:varchar(64);index"` // API key name
+	ClientIP   string         `json:"client_ip" gorm:"type:varchar(45)"`
+	Method     string         `json:"method" gorm:"type:varchar(10)"`
+	Route      string         `json:"route" gorm:"type:varchar(128);index"` // Route pattern, e.g. /api/v1/services/:id
+	Path       string         `json:"path"`
+	Params     map[string]any `json:"params,omitempty" gorm:"serializer:json"` // "path", "query" and "body" parameters
+	Status     int            `json:"status"`
+	DurationMs float64        `json:"duration_ms"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"index"`
+}
@@ -52,9 +52,17 @@ type ConnectRequestData struct {
 
 // TurnCredentials represents TURN server credentials
 type TurnCredentials struct {
-	Username string   `json:"username"`
-	Password string   `json:"password"`
-	TTL      int      `json:"ttl"`
-	Expires  string   `json:"expires"`
-	URLs     []string `json:"urls"`
+	Username   string      `json:"username"`
+	Password   string      `json:"password"`
+	TTL        int         `json:"ttl"`
+	Expires    string      `json:"expires"`
+	URLs       []string    `json:"urls"`
+	ICEServers []ICEServer `json:"ice_servers,omitempty"` // Ready-to-use RTCIceServer list, including external servers
+}
+
+// ICEServer mirrors the WebRTC RTCIceServer dictionary
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
 }
@@ -2,18 +2,61 @@ package models
 
 import "time"
 
-// EdgeService represents a service exposed by an edge device
+// EdgeService represents a service exposed by an edge device. ID is assigned
+// by the server and unique across edges; LocalID is the edge's own ID for the
+// service and only unique per edge. Name and TunnelPort are unique per edge too.
 type EdgeService struct {
-	ID         string    `json:"id" gorm:"type:varchar(8);primaryKey"`
-	EdgeID     string    `json:"edge_id" gorm:"type:varchar(64);index;not null"`
-	Name       string    `json:"name" gorm:"type:varchar(128)"`
-	TunnelPort int       `json:"tunnel_port"`
-	LocalHost  string    `json:"local_host"`
-	LocalPort  int       `json:"local_port"`
-	Protocol   string    `json:"protocol" gorm:"type:varchar(10)"` // "http" or "websocket"
-	Enabled    bool      `json:"enabled"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID         string            `json:"id" gorm:"type:varchar(8);primaryKey"`
+	EdgeID     string            `json:"edge_id" gorm:"type:varchar(64);index;not null;uniqueIndex:idx_edge_services_local_id,priority:1;uniqueIndex:idx_edge_services_name,priority:1;uniqueIndex:idx_edge_services_tunnel_port,priority:1"`
+	LocalID    string            `json:"local_id" gorm:"type:varchar(8);not null;uniqueIndex:idx_edge_services_local_id,priority:2"`
+	Name       string            `json:"name" gorm:"type:varchar(128);uniqueIndex:idx_edge_services_name,priority:2"`
+	TunnelPort int               `json:"tunnel_port" gorm:"uniqueIndex:idx_edge_services_tunnel_port,priority:2"`
+	LocalHost  string            `json:"local_host"`
+	LocalPort  int               `json:"local_port"`
+	Protocol   string            `json:"protocol" gorm:"type:varchar(10)"` // One of the Protocol constants
+	Options    ServiceOptions    `json:"options" gorm:"serializer:json"`
+	Enabled    bool              `json:"enabled"`
+	Labels     map[string]string `json:"labels,omitempty" gorm:"serializer:json"` // Free-form key/value pairs for filtering
+	Health     ServiceHealth     `json:"health" gorm:"embedded;embeddedPrefix:health_"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// Service protocols
+const (
+	ProtocolHTTP      = "http"
+	ProtocolHTTPS     = "https"
+	ProtocolWebSocket = "websocket"
+	ProtocolGRPC      = "grpc"
+	ProtocolTCP       = "tcp"
+	ProtocolUDP       = "udp"
+)
+
+// ServiceHealth is the last known health of a service, reported by its edge
+// or probed by the server through the tunnel. It is stored with the service
+// but is not part of its configuration: updates and syncs leave it as is.
+type ServiceHealth struct {
+	Status    string     `json:"status" gorm:"type:varchar(10);default:unknown"` // One of the Health constants
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	LatencyMs float64    `json:"latency_ms"`
+	Error     string     `json:"error,omitempty"`
+	Source    string     `json:"source,omitempty"` // edge|probe
+}
+
+// Service health statuses
+const (
+	HealthUnknown = "unknown"
+	HealthUp      = "up"
+	HealthDown    = "down"
+)
+
+// ServiceOptions are protocol-specific settings for reaching the local
+// service. Which options a protocol accepts is checked by validation.
+type ServiceOptions struct {
+	TLS           bool   `json:"tls,omitempty"`             // grpc: use TLS to the local service (https always does)
+	TLSSkipVerify bool   `json:"tls_skip_verify,omitempty"` // https, grpc: accept any local certificate
+	SNI           string `json:"sni,omitempty"`             // https, grpc: server name sent in the TLS handshake
+	HostRewrite   string `json:"host_rewrite,omitempty"`    // http, https, websocket: Host header sent to the local service
 }
 
 // ServiceSyncMessage represents a single service sync message
@@ -27,7 +70,7 @@ type ServiceSyncMessage struct {
 type ServiceSyncAckMessage struct {
 	Type     string `json:"type"`
 	LocalID  string `json:"localId"`  // Echo back edge's local ID
-	ServerID string `json:"serverId"` // Server's UUID for this service
+	ServerID string `json:"serverId"` // Server-assigned service ID
 	Status   string `json:"status"`   // success|error
 	Error    string `json:"error,omitempty"`
 }
@@ -38,6 +81,15 @@ type ServiceSyncBatchMessage struct {
 	Services []EdgeService  `json:"services"`
 }
 
+// ServiceSyncResult is the outcome for one service in a batch sync ack
+type ServiceSyncResult struct {
+	Index    *int   `json:"index,omitempty"`     // Position in the batch; absent for deletions
+	ID       string `json:"id,omitempty"`        // Edge-local service ID
+	ServerID string `json:"server_id,omitempty"` // Server-assigned service ID
+	Status   string `json:"status"`              // created|updated|unchanged|deleted|failed
+	Error    string `json:"error,omitempty"`
+}
+
 // ServiceListResponseMessage represents service list response
 type ServiceListResponseMessage struct {
 	Type     string         `json:"type"`
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Webhook is an outbound webhook subscription managed through the admin API
+type Webhook struct {
+	ID          string    `json:"id" gorm:"type:varchar(16);primaryKey"`
+	URL         string    `json:"url" gorm:"not null"`
+	Events      []string  `json:"events" gorm:"serializer:json"` // Event type patterns; empty = all
+	Secret      string    `json:"-"`                             // HMAC-SHA256 signing key
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDeadLetter records an event that could not be delivered to a webhook
+type WebhookDeadLetter struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	WebhookID  string    `json:"webhook_id" gorm:"type:varchar(16);index;not null"`
+	EventID    uint64    `json:"event_id"`
+	EventType  string    `json:"event_type" gorm:"type:varchar(64)"`
+	Payload    string    `json:"payload"` // JSON body that was sent
+	Attempts   int       `json:"attempts"`
+	LastStatus int       `json:"last_status,omitempty"` // HTTP status of the last attempt, 0 if none
+	LastError  string    `json:"last_error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
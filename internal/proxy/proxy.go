@@ -0,0 +1,334 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/arqut/arqut-server-ce/internal/tunnel"
+	"github.com/gofiber/fiber/v2"
+)
+
+// hopHeaders are connection-specific and not forwarded (RFC 7230 section 6.1)
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy routes public HTTP and WebSocket requests to edge services. A
+// service is addressed by host (<service-id>.<domain>) or, if a path prefix
+// is configured, by path (<prefix>/<service-id>/...).
+type Proxy struct {
+	domain      string
+	pathPrefix  string
+	dialTimeout time.Duration
+	storage     storage.Storage
+	dialer      tunnel.Dialer
+	logger      *slog.Logger
+}
+
+// New creates a reverse proxy that reaches edges through dialer
+func New(cfg *config.ProxyConfig, store storage.Storage, dialer tunnel.Dialer, logger *slog.Logger) *Proxy {
+	return &Proxy{
+		domain:      strings.ToLower(cfg.Domain),
+		pathPrefix:  cfg.PathPrefix,
+		dialTimeout: cfg.DialTimeout,
+		storage:     store,
+		dialer:      dialer,
+		logger:      logger.With("component", "proxy"),
+	}
+}
+
+// Handle proxies requests addressed to a service and passes the rest on to
+// the next handler
+func (p *Proxy) Handle(c *fiber.Ctx) error {
+	serviceID, uri, prefix, ok := p.route(c)
+	if !ok {
+		return c.Next()
+	}
+	return p.serve(c, serviceID, uri, prefix)
+}
+
+// route extracts the service ID and the request URI to forward. prefix is
+// the stripped path prefix, if the service was addressed by path.
+func (p *Proxy) route(c *fiber.Ctx) (serviceID, uri, prefix string, ok bool) {
+	if p.domain != "" {
+		host := strings.ToLower(c.Hostname())
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if label, found := strings.CutSuffix(host, "."+p.domain); found && label != "" && !strings.Contains(label, ".") {
+			return label, requestURI(c), "", true
+		}
+	}
+
+	if p.pathPrefix != "" {
+		rest, found := strings.CutPrefix(requestURI(c), p.pathPrefix+"/")
+		if !found {
+			return "", "", "", false
+		}
+		end := strings.IndexAny(rest, "/?")
+		if end == -1 {
+			end = len(rest)
+		}
+		serviceID, uri = rest[:end], rest[end:]
+		if serviceID == "" {
+			return "", "", "", false
+		}
+		if !strings.HasPrefix(uri, "/") {
+			uri = "/" + uri
+		}
+		return serviceID, uri, p.pathPrefix + "/" + serviceID, true
+	}
+
+	return "", "", "", false
+}
+
+// serve forwards the request to the service and relays the response
+func (p *Proxy) serve(c *fiber.Ctx, serviceID, uri, prefix string) error {
+	service, err := p.storage.GetEdgeService(serviceID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "service not found")
+		}
+		p.logger.Error("Failed to look up service", "service_id", serviceID, "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to look up service")
+	}
+	if !service.Enabled {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "service is disabled")
+	}
+	if !proxied(service.Protocol) {
+		return fiber.NewError(fiber.StatusBadRequest, "service protocol "+service.Protocol+" cannot be proxied over HTTP")
+	}
+
+	req, err := p.outboundRequest(c, service, uri, prefix)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request URI")
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), p.dialTimeout)
+	conn, err := p.dialer.DialService(ctx, service)
+	cancel()
+	if err != nil {
+		p.logger.Warn("Failed to open tunnel", "service_id", service.ID, "edge", service.EdgeID, "error", err)
+		switch {
+		case errors.Is(err, tunnel.ErrEdgeOffline):
+			return fiber.NewError(fiber.StatusBadGateway, "edge is offline")
+		case errors.Is(err, tunnel.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+			return fiber.NewError(fiber.StatusGatewayTimeout, "edge did not open a tunnel in time")
+		default:
+			return fiber.NewError(fiber.StatusBadGateway, "failed to open tunnel to edge")
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := roundTrip(conn, reader, req)
+	if err != nil {
+		conn.Close()
+		p.logger.Warn("Proxied request failed", "service_id", service.ID, "error", err)
+		return fiber.NewError(fiber.StatusBadGateway, "service did not respond")
+	}
+
+	p.logger.Debug("Proxied request",
+		"service_id", service.ID,
+		"method", req.Method,
+		"uri", uri,
+		"status", resp.StatusCode,
+	)
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return p.upgrade(c, conn, reader, resp)
+	}
+
+	c.Status(resp.StatusCode)
+	c.Response().Header.SetNoDefaultContentType(true)
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		if key == "Content-Length" || key == "Date" {
+			continue
+		}
+		for _, value := range values {
+			c.Response().Header.Add(key, value)
+		}
+	}
+
+	if c.Method() == fiber.MethodHead || !bodyAllowed(resp.StatusCode) {
+		resp.Body.Close()
+		conn.Close()
+		if resp.ContentLength >= 0 {
+			c.Response().Header.SetContentLength(int(resp.ContentLength))
+		}
+		c.Response().SkipBody = true
+		return nil
+	}
+
+	// The body is streamed after the handler returns; closing it closes the tunnel
+	c.Context().SetBodyStream(&tunnelBody{ReadCloser: resp.Body, conn: conn}, int(resp.ContentLength))
+	return nil
+}
+
+// outboundRequest builds the request sent through the tunnel
+func (p *Proxy) outboundRequest(c *fiber.Ctx, service *models.EdgeService, uri, prefix string) (*http.Request, error) {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method:     c.Method(),
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       c.Hostname(),
+	}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		req.Header.Add(string(key), string(value))
+	})
+	req.Header.Del("Host")
+
+	upgrade := upgradeType(req.Header)
+	removeHopHeaders(req.Header)
+	if upgrade != "" {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", upgrade)
+	}
+
+	if body := c.Request().Body(); len(body) > 0 {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+
+	if service.Options.HostRewrite != "" {
+		req.Host = service.Options.HostRewrite
+	}
+	if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
+		req.Header.Set("X-Forwarded-For", prior+", "+c.IP())
+	} else {
+		req.Header.Set("X-Forwarded-For", c.IP())
+	}
+	req.Header.Set("X-Forwarded-Host", c.Hostname())
+	req.Header.Set("X-Forwarded-Proto", c.Protocol())
+	if prefix != "" {
+		req.Header.Set("X-Forwarded-Prefix", prefix)
+	}
+
+	return req, nil
+}
+
+// upgrade relays the switching-protocols response and then copies bytes
+// both ways between the client and the tunnel until either side closes
+func (p *Proxy) upgrade(c *fiber.Ctx, conn net.Conn, reader *bufio.Reader, resp *http.Response) error {
+	c.Status(http.StatusSwitchingProtocols)
+	c.Response().Header.SetNoDefaultContentType(true)
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Response().Header.Add(key, value)
+		}
+	}
+
+	c.Context().Hijack(func(client net.Conn) {
+		defer conn.Close()
+
+		done := make(chan struct{}, 2)
+		go func() {
+			io.Copy(conn, client)
+			done <- struct{}{}
+		}()
+		go func() {
+			io.Copy(client, reader)
+			done <- struct{}{}
+		}()
+		<-done
+	})
+	return nil
+}
+
+// requestURI returns the raw path and query of the request, also for
+// requests sent in absolute form
+func requestURI(c *fiber.Ctx) string {
+	uri := c.Request().URI()
+	if query := uri.QueryString(); len(query) > 0 {
+		return string(uri.PathOriginal()) + "?" + string(query)
+	}
+	return string(uri.PathOriginal())
+}
+
+// roundTrip writes req to the tunnel and reads the response
+func roundTrip(conn net.Conn, reader *bufio.Reader, req *http.Request) (*http.Response, error) {
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(reader, req)
+}
+
+// tunnelBody closes the tunnel together with the response body
+type tunnelBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *tunnelBody) Close() error {
+	b.ReadCloser.Close()
+	return b.conn.Close()
+}
+
+// proxied reports whether services of the protocol speak HTTP
+func proxied(protocol string) bool {
+	switch protocol {
+	case models.ProtocolHTTP, models.ProtocolHTTPS, models.ProtocolWebSocket:
+		return true
+	}
+	return false
+}
+
+// bodyAllowed reports whether a response with the status may have a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// upgradeType returns the protocol requested by an Upgrade request, if any
+func upgradeType(h http.Header) string {
+	for _, value := range h.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return h.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
+
+// removeHopHeaders deletes hop-by-hop headers, including those named in
+// the Connection header
+func removeHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
@@ -0,0 +1,277 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/pkg/logger"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/arqut/arqut-server-ce/internal/tunnel"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEdge serves tunnel streams in process with handler, or fails dials with err
+type fakeEdge struct {
+	handler http.Handler
+	err     error
+
+	mu     sync.Mutex
+	dialed []string
+}
+
+func (f *fakeEdge) DialService(ctx context.Context, service *models.EdgeService) (net.Conn, error) {
+	f.mu.Lock()
+	f.dialed = append(f.dialed, service.ID)
+	f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	server, client := net.Pipe()
+	go http.Serve(&oneConnListener{conn: server}, f.handler)
+	return client, nil
+}
+
+// oneConnListener accepts a single connection
+type oneConnListener struct {
+	conn net.Conn
+	once sync.Once
+}
+
+func (l *oneConnListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = l.conn })
+	if conn == nil {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (l *oneConnListener) Close() error   { return nil }
+func (l *oneConnListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+func setupProxy(t *testing.T, edge *fakeEdge) (*fiber.App, *storage.SQLiteStorage) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "proxy.db"))
+	require.NoError(t, err)
+	require.NoError(t, store.Init())
+	t.Cleanup(func() { store.Close() })
+
+	log := logger.New(logger.Config{Level: "error", Format: "text"})
+	p := New(&config.ProxyConfig{
+		Domain:      "proxy.test",
+		PathPrefix:  "/s",
+		DialTimeout: time.Second,
+	}, store, edge, log.Logger)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(p.Handle)
+	app.Get("/api/v1/health", func(c *fiber.Ctx) error {
+		return c.SendString("api")
+	})
+	return app, store
+}
+
+func createService(t *testing.T, store storage.Storage, protocol string, enabled bool, opts models.ServiceOptions) *models.EdgeService {
+	service := &models.EdgeService{
+		EdgeID:     "edge-1",
+		Name:       "svc-" + protocol + fmt.Sprint(enabled) + opts.HostRewrite,
+		TunnelPort: 10000 + len(protocol)*100 + len(opts.HostRewrite),
+		LocalHost:  "localhost",
+		LocalPort:  8080,
+		Protocol:   protocol,
+		Enabled:    enabled,
+		Options:    opts,
+	}
+	if !enabled {
+		service.TunnelPort++
+	}
+	require.NoError(t, store.CreateEdgeService(service))
+	return service
+}
+
+// echoHandler describes the request it received
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("X-Backend", "edge")
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "%s %s host=%s xff=%s xfh=%s prefix=%s body=%s",
+		r.Method, r.URL.RequestURI(), r.Host,
+		r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Forwarded-Host"),
+		r.Header.Get("X-Forwarded-Prefix"), body)
+}
+
+func doRequest(t *testing.T, app *fiber.App, method, target, body string) (*http.Response, string) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	resp, err := app.Test(req, 5000)
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp, string(data)
+}
+
+func TestProxyRouting(t *testing.T) {
+	edge := &fakeEdge{handler: http.HandlerFunc(echoHandler)}
+	app, store := setupProxy(t, edge)
+	service := createService(t, store, models.ProtocolHTTP, true, models.ServiceOptions{})
+	host := service.ID + ".proxy.test"
+
+	t.Run("by host", func(t *testing.T) {
+		resp, body := doRequest(t, app, "GET", "http://"+host+"/hello?x=1", "")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "edge", resp.Header.Get("X-Backend"))
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+		assert.Contains(t, body, "GET /hello?x=1 host="+host)
+		assert.Contains(t, body, "xfh="+host)
+		assert.Contains(t, body, "xff=0.0.0.0")
+		assert.Contains(t, body, "prefix= ")
+	})
+
+	t.Run("host with port", func(t *testing.T) {
+		_, body := doRequest(t, app, "GET", "http://"+host+":9000/", "")
+		assert.Contains(t, body, "GET / ")
+	})
+
+	t.Run("by path prefix", func(t *testing.T) {
+		resp, body := doRequest(t, app, "GET", "http://api.test/s/"+service.ID+"/a/b?q=2", "")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Contains(t, body, "GET /a/b?q=2 ")
+		assert.Contains(t, body, "prefix=/s/"+service.ID+" ")
+
+		_, body = doRequest(t, app, "GET", "http://api.test/s/"+service.ID, "")
+		assert.Contains(t, body, "GET / ")
+
+		_, body = doRequest(t, app, "GET", "http://api.test/s/"+service.ID+"?q=3", "")
+		assert.Contains(t, body, "GET /?q=3 ")
+	})
+
+	t.Run("request body", func(t *testing.T) {
+		_, body := doRequest(t, app, "POST", "http://"+host+"/submit", "payload")
+		assert.Contains(t, body, "POST /submit ")
+		assert.Contains(t, body, "body=payload")
+	})
+
+	t.Run("other requests pass through", func(t *testing.T) {
+		for _, target := range []string{
+			"http://api.test/api/v1/health",
+			"http://proxy.test/api/v1/health",
+			"http://a.b.proxy.test/api/v1/health",
+		} {
+			resp, body := doRequest(t, app, "GET", target, "")
+			assert.Equal(t, http.StatusOK, resp.StatusCode, target)
+			assert.Equal(t, "api", body, target)
+		}
+	})
+
+	edge.mu.Lock()
+	defer edge.mu.Unlock()
+	for _, id := range edge.dialed {
+		assert.Equal(t, service.ID, id)
+	}
+}
+
+func TestProxyHostRewrite(t *testing.T) {
+	edge := &fakeEdge{handler: http.HandlerFunc(echoHandler)}
+	app, store := setupProxy(t, edge)
+	service := createService(t, store, models.ProtocolHTTPS, true, models.ServiceOptions{HostRewrite: "internal.lan:8443"})
+
+	_, body := doRequest(t, app, "GET", "http://"+service.ID+".proxy.test/", "")
+	assert.Contains(t, body, "host=internal.lan:8443")
+	assert.Contains(t, body, "xfh="+service.ID+".proxy.test")
+}
+
+func TestProxyErrors(t *testing.T) {
+	edge := &fakeEdge{handler: http.HandlerFunc(echoHandler)}
+	app, store := setupProxy(t, edge)
+	enabled := createService(t, store, models.ProtocolHTTP, true, models.ServiceOptions{})
+	disabled := createService(t, store, models.ProtocolHTTP, false, models.ServiceOptions{})
+	tcp := createService(t, store, models.ProtocolTCP, true, models.ServiceOptions{})
+
+	tests := []struct {
+		name     string
+		host     string
+		dialErr  error
+		wantCode int
+	}{
+		{"unknown service", "deadbeef.proxy.test", nil, http.StatusNotFound},
+		{"disabled service", disabled.ID + ".proxy.test", nil, http.StatusServiceUnavailable},
+		{"non-HTTP protocol", tcp.ID + ".proxy.test", nil, http.StatusBadRequest},
+		{"edge offline", enabled.ID + ".proxy.test", tunnel.ErrEdgeOffline, http.StatusBadGateway},
+		{"edge timeout", enabled.ID + ".proxy.test", tunnel.ErrTimeout, http.StatusGatewayTimeout},
+		{"edge refused", enabled.ID + ".proxy.test", fmt.Errorf("connection refused"), http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edge.err = tt.dialErr
+			resp, _ := doRequest(t, app, "GET", "http://"+tt.host+"/", "")
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestProxyWebSocketUpgrade(t *testing.T) {
+	// The edge side accepts an "echo" upgrade and echoes lines back
+	edge := &fakeEdge{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" || !strings.EqualFold(r.Header.Get("Connection"), "upgrade") {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			rw.WriteString("echo: " + line)
+			rw.Flush()
+		}
+	})}
+	app, store := setupProxy(t, edge)
+	service := createService(t, store, models.ProtocolWebSocket, true, models.ServiceOptions{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s.proxy.test\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n", service.ID)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "echo", resp.Header.Get("Upgrade"))
+
+	for _, msg := range []string{"hello", "world"} {
+		fmt.Fprintf(conn, "%s\n", msg)
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "echo: "+msg+"\n", line)
+	}
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped from a Limiter
+const sweepInterval = time.Minute
+
+// Bucket is a token bucket refilled at a fixed rate up to its burst size.
+// A nil Bucket allows everything. Bucket is not safe for concurrent use.
+type Bucket struct {
+	rate   float64 // Tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a full bucket. Returns nil if rate is not positive.
+func NewBucket(rate float64, burst int) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Allow takes a token if one is available
+func (b *Bucket) Allow() bool {
+	ok, _ := b.AllowAt(time.Now())
+	return ok
+}
+
+// AllowAt takes a token at the given time. If none is available it returns
+// how long until the next token.
+func (b *Bucket) AllowAt(now time.Time) (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// refill adds the tokens accrued since the last call
+func (b *Bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+			b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		}
+	}
+	b.last = now
+}
+
+// full reports whether the bucket has refilled completely by now
+func (b *Bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// Limiter keeps one token bucket per key (client IP, API key, ...).
+// A nil Limiter allows everything.
+type Limiter struct {
+	rate      float64
+	burst     int
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// New creates a keyed limiter. Returns nil if rate is not positive.
+func New(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &Limiter{
+		rate:    rate,
+		burst:   burst,
+		now:     time.Now,
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. If none is available it returns
+// how long until the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = NewBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+
+	return b.AllowAt(now)
+}
+
+// sweep drops buckets that have refilled completely; they are recreated
+// full on demand. Must be called with the mutex held.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucket_Burst(t *testing.T) {
+	b := NewBucket(1, 3)
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := b.AllowAt(now)
+		assert.True(t, ok, "within burst")
+	}
+
+	ok, wait := b.AllowAt(now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// One token refills per second
+	ok, _ = b.AllowAt(now.Add(time.Second))
+	assert.True(t, ok)
+	ok, _ = b.AllowAt(now.Add(time.Second))
+	assert.False(t, ok)
+}
+
+func TestBucket_RefillCapsAtBurst(t *testing.T) {
+	b := NewBucket(10, 2)
+	now := time.Unix(1700000000, 0)
+	b.AllowAt(now)
+
+	later := now.Add(time.Hour)
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if ok, _ := b.AllowAt(later); ok {
+			allowed++
+		}
+	}
+	assert.Equal(t, 2, allowed)
+}
+
+func TestBucket_Disabled(t *testing.T) {
+	assert.Nil(t, NewBucket(0, 10))
+
+	var b *Bucket
+	assert.True(t, b.Allow())
+
+	var l *Limiter
+	ok, _ := l.Allow("any")
+	assert.True(t, ok)
+	assert.Nil(t, New(0, 10))
+}
+
+func TestLimiter_PerKey(t *testing.T) {
+	l := New(1, 1)
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+
+	ok, _ := l.Allow("a")
+	assert.True(t, ok)
+	ok, _ = l.Allow("a")
+	assert.False(t, ok)
+
+	// Keys have independent buckets
+	ok, _ = l.Allow("b")
+	assert.True(t, ok)
+}
+
+func TestLimiter_SweepsIdleBuckets(t *testing.T) {
+	l := New(1, 1)
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+
+	l.Allow("a")
+	l.Allow("b")
+	assert.Len(t, l.buckets, 2)
+
+	now = now.Add(2 * sweepInterval)
+	l.Allow("c")
+	assert.Len(t, l.buckets, 1)
+}
@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/arqut/arqut-server-ce/internal/pkg/cursor"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+)
+
+// ErrInvalidQuery means a peer query has an unknown sort field or a cursor
+// from a different query
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Peer sort fields for PeerQuery.Sort
+const (
+	PeerSortCreatedAt = "created_at"
+	PeerSortLastPing  = "last_ping"
+	PeerSortType      = "type"
+	PeerSortID        = "id"
+)
+
+// PeerSorts lists the valid PeerQuery.Sort values
+var PeerSorts = []string{PeerSortCreatedAt, PeerSortLastPing, PeerSortType, PeerSortID}
+
+// PeerQuery filters, orders and pages ListPeers. Zero fields do not filter.
+type PeerQuery struct {
+	Type     string
+	EdgeID   string
+	IDPrefix string
+
+	Sort   string // One of PeerSorts (default created_at); ties are ordered by ID
+	Desc   bool
+	Limit  int    // Page size; 0 returns all matching peers
+	Cursor string // NextCursor of the previous page
+}
+
+// PeerPage is one page of ListPeers. Peers are copies taken under the
+// registry lock.
+type PeerPage struct {
+	Peers      []*models.Peer
+	Total      int    // Peers matching the filters, on all pages
+	Offset     int    // Peers on the pages before this one
+	NextCursor string // Empty on the last page
+}
+
+// ListPeers returns one page of the connected peers matching query, ordered
+// by the sort field and then by ID
+func (r *Registry) ListPeers(query PeerQuery) (*PeerPage, error) {
+	sortField := query.Sort
+	if sortField == "" {
+		sortField = PeerSortCreatedAt
+	}
+	if !slices.Contains(PeerSorts, sortField) {
+		return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, sortField)
+	}
+	if query.Limit < 0 {
+		return nil, fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+
+	var after *models.Peer
+	page := &PeerPage{}
+	if query.Cursor != "" {
+		c, err := cursor.Decode(query.Cursor, sortField, query.Desc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+		}
+		if after, err = peerFromCursor(c, sortField); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+		}
+		page.Offset = c.Offset
+	}
+
+	r.mu.RLock()
+	peers := make([]*models.Peer, 0, len(r.peers))
+	for _, peer := range r.peers {
+		if (query.Type == "" || peer.Type == query.Type) &&
+			(query.EdgeID == "" || peer.EdgeID == query.EdgeID) &&
+			strings.HasPrefix(peer.ID, query.IDPrefix) {
+			snapshot := *peer
+			peers = append(peers, &snapshot)
+		}
+	}
+	r.mu.RUnlock()
+
+	compare := func(a, b *models.Peer) int {
+		c := comparePeers(a, b, sortField)
+		if query.Desc {
+			return -c
+		}
+		return c
+	}
+	slices.SortFunc(peers, compare)
+	page.Total = len(peers)
+
+	if after != nil {
+		start, _ := slices.BinarySearchFunc(peers, after, compare)
+		if start < len(peers) && compare(peers[start], after) == 0 {
+			start++
+		}
+		peers = peers[start:]
+	}
+
+	if query.Limit > 0 && len(peers) > query.Limit {
+		peers = peers[:query.Limit]
+		last := peers[len(peers)-1]
+		next, err := cursor.New(sortField, query.Desc, peerSortValue(last, sortField), last.ID, page.Offset+len(peers))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		page.NextCursor = next
+	}
+	page.Peers = peers
+	return page, nil
+}
+
+// comparePeers orders peers by a sort field and then by ID
+func comparePeers(a, b *models.Peer, field string) int {
+	var c int
+	switch field {
+	case PeerSortCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case PeerSortLastPing:
+		c = a.LastPing.Compare(b.LastPing)
+	case PeerSortType:
+		c = cmp.Compare(a.Type, b.Type)
+	}
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// peerSortValue returns the value of a peer's sort field
+func peerSortValue(peer *models.Peer, field string) any {
+	switch field {
+	case PeerSortCreatedAt:
+		return peer.CreatedAt
+	case PeerSortLastPing:
+		return peer.LastPing
+	case PeerSortType:
+		return peer.Type
+	default:
+		return peer.ID
+	}
+}
+
+// peerFromCursor returns a peer with the sort value and ID of a cursor, to
+// compare the listed peers against
+func peerFromCursor(c *cursor.Cursor, field string) (*models.Peer, error) {
+	peer := &models.Peer{ID: c.ID}
+	var err error
+	switch field {
+	case PeerSortCreatedAt:
+		err = c.Unmarshal(&peer.CreatedAt)
+	case PeerSortLastPing:
+		err = c.Unmarshal(&peer.LastPing)
+	case PeerSortType:
+		err = c.Unmarshal(&peer.Type)
+	}
+	return peer, err
+}
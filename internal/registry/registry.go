@@ -4,13 +4,15 @@ import (
 	"sync"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/events"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
 )
 
 // Registry manages connected peers
 type Registry struct {
-	peers map[string]*models.Peer
-	mu    sync.RWMutex
+	peers  map[string]*models.Peer
+	mu     sync.RWMutex
+	events *events.Bus
 }
 
 // New creates a new peer registry
@@ -20,11 +22,14 @@ func New() *Registry {
 	}
 }
 
+// SetEventBus sets the bus that peer connect/disconnect events are published to
+func (r *Registry) SetEventBus(bus *events.Bus) {
+	r.events = bus
+}
+
 // AddPeer adds or updates a peer in the registry
 func (r *Registry) AddPeer(peer *models.Peer) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	if peer.CreatedAt.IsZero() {
 		peer.CreatedAt = time.Now()
 	}
@@ -32,6 +37,9 @@ func (r *Registry) AddPeer(peer *models.Peer) {
 	peer.LastPing = time.Now()
 
 	r.peers[peer.ID] = peer
+	r.mu.Unlock()
+
+	r.events.Publish(events.PeerConnected, peerData(peer, ""))
 }
 
 // GetPeer retrieves a peer by ID
@@ -46,12 +54,16 @@ func (r *Registry) GetPeer(id string) (*models.Peer, bool) {
 // RemovePeer removes a peer from the registry
 func (r *Registry) RemovePeer(id string) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if peer, exists := r.peers[id]; exists {
+	peer, exists := r.peers[id]
+	if exists {
 		peer.Connected = false
 		delete(r.peers, id)
 	}
+	r.mu.Unlock()
+
+	if exists {
+		r.events.Publish(events.PeerDisconnected, peerData(peer, ""))
+	}
 }
 
 // GetAllPeers returns all peers
@@ -103,9 +115,9 @@ func (r *Registry) GetPeerCount() int {
 // CleanupStale removes peers that haven't pinged in the specified timeout
 func (r *Registry) CleanupStale(timeout time.Duration) []string {
 	r.mu.Lock()
-	defer r.mu.Unlock()
 
 	removed := []string{}
+	stale := []*models.Peer{}
 	now := time.Now()
 
 	for id, peer := range r.peers {
@@ -113,8 +125,24 @@ func (r *Registry) CleanupStale(timeout time.Duration) []string {
 			peer.Connected = false
 			delete(r.peers, id)
 			removed = append(removed, id)
+			stale = append(stale, peer)
 		}
 	}
+	r.mu.Unlock()
+
+	for _, peer := range stale {
+		r.events.Publish(events.PeerDisconnected, peerData(peer, "stale"))
+	}
 
 	return removed
 }
+
+// peerData builds the event payload for a peer
+func peerData(peer *models.Peer, reason string) events.PeerData {
+	return events.PeerData{
+		ID:     peer.ID,
+		Type:   peer.Type,
+		EdgeID: peer.EdgeID,
+		Reason: reason,
+	}
+}
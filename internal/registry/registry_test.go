@@ -2,10 +2,12 @@ package registry
 
 import (
 	"fmt"
+	"log/slog"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/events"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -498,3 +500,98 @@ func BenchmarkRegistry_CleanupStale(b *testing.B) {
 		reg.CleanupStale(5 * time.Minute)
 	}
 }
+
+func TestRegistry_Events(t *testing.T) {
+	bus := events.NewBus(slog.Default())
+	sub := bus.Subscribe(10)
+	defer sub.Close()
+
+	reg := New()
+	reg.SetEventBus(bus)
+
+	reg.AddPeer(&models.Peer{ID: "client-1", Type: "client", EdgeID: "edge-1"})
+	reg.RemovePeer("client-1")
+	reg.RemovePeer("client-1") // Unknown peers publish nothing
+
+	reg.AddPeer(&models.Peer{ID: "edge-1", Type: "edge"})
+	reg.peers["edge-1"].LastPing = time.Now().Add(-time.Hour)
+	reg.CleanupStale(time.Minute)
+
+	want := []struct {
+		eventType string
+		data      events.PeerData
+	}{
+		{events.PeerConnected, events.PeerData{ID: "client-1", Type: "client", EdgeID: "edge-1"}},
+		{events.PeerDisconnected, events.PeerData{ID: "client-1", Type: "client", EdgeID: "edge-1"}},
+		{events.PeerConnected, events.PeerData{ID: "edge-1", Type: "edge"}},
+		{events.PeerDisconnected, events.PeerData{ID: "edge-1", Type: "edge", Reason: "stale"}},
+	}
+
+	require.Len(t, sub.Events(), len(want))
+	for _, w := range want {
+		ev := <-sub.Events()
+		assert.Equal(t, w.eventType, ev.Type)
+		assert.Equal(t, w.data, ev.Data)
+	}
+}
+
+func TestRegistry_ListPeers(t *testing.T) {
+	reg := New()
+	base := time.Now()
+	for i, p := range []struct{ id, typ, edge string }{
+		{"edge-b", "edge", ""},
+		{"edge-a", "edge", ""},
+		{"client-1", "client", "edge-a"},
+		{"client-2", "client", "edge-b"},
+		{"client-3", "client", "edge-a"},
+	} {
+		reg.AddPeer(&models.Peer{ID: p.id, Type: p.typ, EdgeID: p.edge, CreatedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+
+	ids := func(page *PeerPage) []string {
+		var ids []string
+		for _, peer := range page.Peers {
+			ids = append(ids, peer.ID)
+		}
+		return ids
+	}
+
+	page, err := reg.ListPeers(PeerQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"edge-b", "edge-a", "client-1", "client-2", "client-3"}, ids(page))
+	assert.Equal(t, 5, page.Total)
+
+	page, err = reg.ListPeers(PeerQuery{Type: "client", EdgeID: "edge-a", Sort: PeerSortID, Desc: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"client-3", "client-1"}, ids(page))
+
+	page, err = reg.ListPeers(PeerQuery{IDPrefix: "edge-", Sort: PeerSortID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"edge-a", "edge-b"}, ids(page))
+
+	// Pages follow each other, also when peers leave in between
+	query := PeerQuery{Sort: PeerSortType, Limit: 2}
+	page, err = reg.ListPeers(query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"client-1", "client-2"}, ids(page))
+	require.NotEmpty(t, page.NextCursor)
+
+	reg.RemovePeer("client-3")
+	query.Cursor = page.NextCursor
+	page, err = reg.ListPeers(query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"edge-a", "edge-b"}, ids(page))
+	assert.Equal(t, 4, page.Total)
+	assert.Equal(t, 2, page.Offset)
+	assert.Empty(t, page.NextCursor)
+
+	// Listed peers are copies
+	page.Peers[0].Type = "changed"
+	peer, _ := reg.GetPeer("edge-a")
+	assert.Equal(t, "edge", peer.Type)
+
+	_, err = reg.ListPeers(PeerQuery{Sort: "account_id"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = reg.ListPeers(PeerQuery{Sort: PeerSortID, Cursor: query.Cursor})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
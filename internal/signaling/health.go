@@ -0,0 +1,236 @@
+package signaling
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+)
+
+// MessageTypeServiceHealth is sent by edges to report the health of their services
+const MessageTypeServiceHealth = "service-health"
+
+// maxConcurrentProbes limits the health checks run at once
+const maxConcurrentProbes = 8
+
+// serviceHealthReport is one entry of a service-health message. Services are
+// identified by their local ID, like in service sync.
+type serviceHealthReport struct {
+	ID        string  `json:"id"`
+	LocalID   string  `json:"local_id"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error"`
+}
+
+// handleServiceHealth records the service health reported by an edge
+func (s *Server) handleServiceHealth(from *PeerConnection, msg *models.SignalingMessage) {
+	if from.Peer.Type != "edge" {
+		s.sendError(from.Conn, "Only edges can report service health")
+		return
+	}
+
+	raw, err := json.Marshal(msg.Data)
+	if err != nil {
+		s.sendError(from.Conn, "Invalid service health message")
+		return
+	}
+	var data struct {
+		Services []serviceHealthReport `json:"services"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		s.sendError(from.Conn, "Invalid service health message")
+		return
+	}
+
+	now := time.Now()
+	var failed []string
+	for _, report := range data.Services {
+		localID := report.LocalID
+		if localID == "" {
+			localID = report.ID
+		}
+		switch report.Status {
+		case models.HealthUp, models.HealthDown, models.HealthUnknown:
+		default:
+			failed = append(failed, fmt.Sprintf("%s: invalid status %q", localID, report.Status))
+			continue
+		}
+
+		service, err := s.storage.GetEdgeServiceByLocalID(from.Peer.ID, localID)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				failed = append(failed, fmt.Sprintf("%s: unknown service", localID))
+			} else {
+				s.logger.Error("Failed to get service for health report", "edge", from.Peer.ID, "local_id", localID, "error", err)
+				failed = append(failed, fmt.Sprintf("%s: internal error", localID))
+			}
+			continue
+		}
+
+		s.recordHealth(service, models.ServiceHealth{
+			Status:    report.Status,
+			CheckedAt: &now,
+			LatencyMs: report.LatencyMs,
+			Error:     report.Error,
+			Source:    events.SourceEdge,
+		})
+	}
+
+	if len(failed) > 0 {
+		s.sendError(from.Conn, "Service health not recorded for "+strings.Join(failed, "; "))
+	}
+}
+
+// recordHealth stores the health of a service and publishes
+// service.health_changed if its status changed
+func (s *Server) recordHealth(service *models.EdgeService, health models.ServiceHealth) {
+	if err := s.storage.UpdateServiceHealth(service.ID, health); err != nil {
+		s.logger.Error("Failed to record service health", "service_id", service.ID, "error", err)
+		return
+	}
+
+	previous := service.Health.Status
+	service.Health = health
+	if previous == health.Status {
+		return
+	}
+
+	s.logger.Info("Service health changed",
+		"edge", service.EdgeID,
+		"service_id", service.ID,
+		"from", previous,
+		"to", health.Status,
+		"source", health.Source)
+
+	snapshot := *service
+	s.events.Publish(events.ServiceHealthChanged, events.ServiceData{
+		ID:      service.ID,
+		EdgeID:  service.EdgeID,
+		Source:  health.Source,
+		Service: &snapshot,
+	})
+}
+
+// healthCheckLoop probes all enabled services every interval until the
+// server stops
+func (s *Server) healthCheckLoop() {
+	ticker := time.NewTicker(s.config.HealthCheck.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkServices()
+		}
+	}
+}
+
+// checkServices probes the enabled services once. Services of offline edges
+// are reported down; udp services cannot be probed through a stream and are
+// left to their edge.
+func (s *Server) checkServices() {
+	services, err := s.storage.ListAllEnabledServices()
+	if err != nil {
+		s.logger.Error("Failed to list services for health checks", "error", err)
+		return
+	}
+
+	sem := make(chan struct{}, maxConcurrentProbes)
+	var wg sync.WaitGroup
+	for _, service := range services {
+		if service.Protocol == models.ProtocolUDP {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(service *models.EdgeService) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			s.recordHealth(service, s.probeService(service))
+		}(service)
+	}
+	wg.Wait()
+}
+
+// probeService checks a service through the tunnel. Opening a stream is
+// enough for tcp and grpc; http, https and websocket services must also
+// answer a GET of the configured path with a status below 500.
+func (s *Server) probeService(service *models.EdgeService) models.ServiceHealth {
+	ctx, cancel := context.WithTimeout(s.ctx, s.config.HealthCheck.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	health := models.ServiceHealth{
+		Status:    models.HealthDown,
+		CheckedAt: &start,
+		Source:    events.SourceProbe,
+	}
+
+	conn, err := s.DialService(ctx, service)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	defer conn.Close()
+
+	switch service.Protocol {
+	case models.ProtocolHTTP, models.ProtocolHTTPS, models.ProtocolWebSocket, "":
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		if err := probeHTTP(conn, service, s.config.HealthCheck.Path); err != nil {
+			health.Error = err.Error()
+			return health
+		}
+	}
+
+	health.Status = models.HealthUp
+	health.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	return health
+}
+
+// probeHTTP sends a GET request over conn and checks the response status
+func probeHTTP(conn net.Conn, service *models.EdgeService, path string) error {
+	host := service.Options.HostRewrite
+	if host == "" {
+		host = net.JoinHostPort(service.LocalHost, strconv.Itoa(service.LocalPort))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = host
+	req.Close = true
+	req.Header.Set("User-Agent", "arqut-health-check")
+	if err := req.Write(conn); err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
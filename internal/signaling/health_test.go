@@ -0,0 +1,160 @@
+package signaling
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/arqut/arqut-server-ce/internal/tunnel"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleServiceHealth(t *testing.T) {
+	server, reg := setupTestServer(t)
+	mockStorage := new(MockStorage)
+	server.storage = mockStorage
+
+	bus := events.NewBus(server.logger)
+	sub := bus.Subscribe(10, "service.*")
+	defer sub.Close()
+	server.SetEventBus(bus)
+
+	peer := &models.Peer{ID: "edge-1", Type: "edge"}
+	reg.AddPeer(peer)
+	mockConn := &mockWebSocketConn{}
+	peerConn := &PeerConnection{Peer: peer, Conn: mockConn}
+
+	report := func(services ...map[string]interface{}) {
+		server.handleMessage(peerConn, &models.SignalingMessage{
+			Type: MessageTypeServiceHealth,
+			Data: map[string]interface{}{"services": services},
+		})
+	}
+
+	stored := &models.EdgeService{ID: "a1b2c3d4", LocalID: "web", EdgeID: "edge-1", Health: models.ServiceHealth{Status: models.HealthUnknown}}
+	mockStorage.On("GetEdgeServiceByLocalID", "edge-1", "web").Return(stored, nil)
+	mockStorage.On("GetEdgeServiceByLocalID", "edge-1", "gone").Return(nil, storage.ErrNotFound)
+	mockStorage.On("UpdateServiceHealth", "a1b2c3d4", mock.MatchedBy(func(h models.ServiceHealth) bool {
+		return h.Status == models.HealthUp && h.LatencyMs == 12.5 && h.Source == events.SourceEdge && h.CheckedAt != nil
+	})).Return(nil)
+
+	report(map[string]interface{}{"id": "web", "status": "up", "latency_ms": 12.5})
+
+	ev := <-sub.Events()
+	assert.Equal(t, events.ServiceHealthChanged, ev.Type)
+	data := ev.Data.(events.ServiceData)
+	assert.Equal(t, "a1b2c3d4", data.ID)
+	assert.Equal(t, events.SourceEdge, data.Source)
+	assert.Equal(t, models.HealthUp, data.Service.Health.Status)
+	assert.Empty(t, mockConn.sentMessages)
+
+	// An unchanged status is recorded without an event
+	report(map[string]interface{}{"local_id": "web", "status": "up", "latency_ms": 12.5})
+	mockStorage.AssertNumberOfCalls(t, "UpdateServiceHealth", 2)
+
+	// Unknown services and statuses are rejected
+	report(
+		map[string]interface{}{"id": "gone", "status": "up"},
+		map[string]interface{}{"id": "web", "status": "sleepy"},
+	)
+	require.Len(t, mockConn.sentMessages, 1)
+	assert.Equal(t, "error", mockConn.sentMessages[0].Type)
+	mockStorage.AssertNumberOfCalls(t, "UpdateServiceHealth", 2)
+
+	select {
+	case ev := <-sub.Events():
+		t.Fatalf("unexpected event %s", ev.Type)
+	default:
+	}
+}
+
+func TestCheckServices(t *testing.T) {
+	server, _ := setupTestServer(t)
+	defer server.Stop()
+	mockStorage := new(MockStorage)
+	server.storage = mockStorage
+	server.config.HealthCheck.Timeout = 2 * time.Second
+	server.config.HealthCheck.Path = "/healthz"
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	server.RegisterRoutes(app.Group("/api/v1"))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	// Fake edge: answers HTTP probes with 200, or 503 for the "broken" service
+	paths := make(chan string, 10)
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/api/v1/signaling/tunnel?id=edge-1", nil)
+	require.NoError(t, err)
+	edge := tunnel.NewSession(tunnel.NewWSConn(ws), tunnel.Config{Client: true, AcceptStreams: true})
+	defer edge.Close()
+	go func() {
+		for {
+			stream, err := edge.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer stream.Close()
+				open, err := tunnel.ReadOpenRequest(stream)
+				if err != nil {
+					return
+				}
+				tunnel.WriteOpenResponse(stream, nil)
+				if open.Protocol == models.ProtocolTCP {
+					return
+				}
+				req, err := http.ReadRequest(bufio.NewReader(stream))
+				if err != nil {
+					return
+				}
+				paths <- req.URL.Path
+				resp := &http.Response{StatusCode: http.StatusOK, ProtoMajor: 1, ProtoMinor: 1, Request: req}
+				if open.LocalID == "broken" {
+					resp.StatusCode = http.StatusServiceUnavailable
+				}
+				resp.Write(stream)
+			}()
+		}
+	}()
+	require.Eventually(t, func() bool {
+		return len(server.TunnelStats()) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	services := []*models.EdgeService{
+		{ID: "svc00001", LocalID: "web", EdgeID: "edge-1", Protocol: models.ProtocolHTTP, Enabled: true},
+		{ID: "svc00002", LocalID: "broken", EdgeID: "edge-1", Protocol: models.ProtocolHTTP, Enabled: true},
+		{ID: "svc00003", LocalID: "db", EdgeID: "edge-1", Protocol: models.ProtocolTCP, Enabled: true},
+		{ID: "svc00004", LocalID: "dns", EdgeID: "edge-1", Protocol: models.ProtocolUDP, Enabled: true},
+		{ID: "svc00005", LocalID: "web", EdgeID: "edge-2", Protocol: models.ProtocolHTTP, Enabled: true},
+	}
+	mockStorage.On("ListAllEnabledServices").Return(services, nil)
+	mockStorage.On("UpdateServiceHealth", mock.Anything, mock.Anything).Return(nil)
+
+	server.checkServices()
+
+	mockStorage.AssertNumberOfCalls(t, "UpdateServiceHealth", 4)
+	mockStorage.AssertNotCalled(t, "UpdateServiceHealth", "svc00004", mock.Anything)
+	assert.Equal(t, models.HealthUp, services[0].Health.Status)
+	assert.Equal(t, events.SourceProbe, services[0].Health.Source)
+	assert.Equal(t, models.HealthDown, services[1].Health.Status)
+	assert.Equal(t, "HTTP 503", services[1].Health.Error)
+	assert.Equal(t, models.HealthUp, services[2].Health.Status)
+	assert.Equal(t, models.HealthDown, services[4].Health.Status)
+	assert.Equal(t, tunnel.ErrEdgeOffline.Error(), services[4].Health.Error)
+
+	close(paths)
+	for path := range paths {
+		assert.Equal(t, "/healthz", path)
+	}
+}
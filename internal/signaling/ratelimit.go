@@ -0,0 +1,33 @@
+package signaling
+
+import (
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/ratelimit"
+)
+
+// messageLimiter enforces the per-peer WebSocket message rate for one connection
+type messageLimiter struct {
+	bucket        *ratelimit.Bucket
+	maxViolations int
+	violations    int // Consecutive dropped messages
+}
+
+// newMessageLimiter creates a limiter from the signaling config. A zero rate disables limiting.
+func newMessageLimiter(cfg *config.SignalingConfig) *messageLimiter {
+	return &messageLimiter{
+		bucket:        ratelimit.NewBucket(cfg.MessageRate.Rate, cfg.MessageRate.Burst),
+		maxViolations: cfg.MaxRateViolations,
+	}
+}
+
+// allow reports whether the next message may be processed, and whether the
+// peer has exceeded the limit long enough to be disconnected
+func (l *messageLimiter) allow() (allowed, disconnect bool) {
+	if l.bucket.Allow() {
+		l.violations = 0
+		return true, false
+	}
+
+	l.violations++
+	return false, l.maxViolations > 0 && l.violations >= l.maxViolations
+}
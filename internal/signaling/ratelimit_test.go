@@ -0,0 +1,39 @@
+package signaling
+
+import (
+	"testing"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageLimiter(t *testing.T) {
+	limiter := newMessageLimiter(&config.SignalingConfig{
+		MessageRate:       config.RateLimit{Rate: 0.001, Burst: 2},
+		MaxRateViolations: 3,
+	})
+
+	for i := 0; i < 2; i++ {
+		allowed, disconnect := limiter.allow()
+		assert.True(t, allowed, "within burst")
+		assert.False(t, disconnect)
+	}
+
+	allowed, disconnect := limiter.allow()
+	assert.False(t, allowed)
+	assert.False(t, disconnect, "single violation is tolerated")
+
+	limiter.allow()
+	_, disconnect = limiter.allow()
+	assert.True(t, disconnect, "sustained violations disconnect")
+}
+
+func TestMessageLimiter_Disabled(t *testing.T) {
+	limiter := newMessageLimiter(&config.SignalingConfig{})
+
+	for i := 0; i < 1000; i++ {
+		allowed, disconnect := limiter.allow()
+		assert.True(t, allowed)
+		assert.False(t, disconnect)
+	}
+}
@@ -2,17 +2,20 @@ package signaling
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/authhook"
 	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/ice"
 	"github.com/arqut/arqut-server-ce/internal/registry"
 	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/arqut/arqut-server-ce/internal/tunnel"
+	"github.com/arqut/arqut-server-ce/internal/turn"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
@@ -35,6 +38,26 @@ type WebSocketConn interface {
 	SetWriteDeadline(t time.Time) error
 }
 
+// lockedConn serializes writes to a WebSocket, which allows only one
+// concurrent writer. Peers are written to from their read loop, the ping
+// loop and API handlers.
+type lockedConn struct {
+	WebSocketConn
+	mu sync.Mutex
+}
+
+func (c *lockedConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.WebSocketConn.WriteJSON(v)
+}
+
+func (c *lockedConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.WebSocketConn.WriteMessage(messageType, data)
+}
+
 // PeerConnection represents a WebSocket connection for a peer
 type PeerConnection struct {
 	Peer            *models.Peer
@@ -48,26 +71,36 @@ type PeerConnection struct {
 type Server struct {
 	config      *config.SignalingConfig
 	turnConfig  *config.TurnConfig
+	iceBuilder  *ice.Builder
+	credentials *turn.CredentialIssuer
 	logger      *slog.Logger
 	registry    *registry.Registry
 	storage     storage.Storage
+	authHook    *authhook.Client
+	events      *events.Bus
 	connections map[string]*PeerConnection
+	streams     map[string]*pendingStream // Tunnel streams awaiting the edge, by stream ID
+	sessions    map[string]*tunnel.Session // Multiplexed tunnel sessions, by edge ID
 	mu          sync.RWMutex
 	ctx         context.Context
 	cancel      context.CancelFunc
 }
 
 // New creates a new signaling server
-func New(cfg *config.SignalingConfig, turnCfg *config.TurnConfig, reg *registry.Registry, store storage.Storage, logger *slog.Logger) *Server {
+func New(cfg *config.SignalingConfig, turnCfg *config.TurnConfig, credentials *turn.CredentialIssuer, reg *registry.Registry, store storage.Storage, logger *slog.Logger) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Server{
 		config:      cfg,
 		turnConfig:  turnCfg,
+		iceBuilder:  ice.NewBuilder(turnCfg),
+		credentials: credentials,
 		logger:      logger.With("component", "signaling"),
 		registry:    reg,
 		storage:     store,
 		connections: make(map[string]*PeerConnection),
+		streams:     make(map[string]*pendingStream),
+		sessions:    make(map[string]*tunnel.Session),
 		ctx:         ctx,
 		cancel:      cancel,
 	}
@@ -79,6 +112,10 @@ func (s *Server) Start() {
 
 	// Start stale connection cleanup
 	go s.cleanupLoop()
+
+	if s.config.HealthCheck.Enabled {
+		go s.healthCheckLoop()
+	}
 }
 
 // Stop stops the signaling server
@@ -96,12 +133,25 @@ func (s *Server) Stop() error {
 			conn.Conn.Close()
 		}
 	}
+	for _, session := range s.sessions {
+		session.Close()
+	}
 	s.mu.Unlock()
 
 	s.logger.Info("Signaling server stopped")
 	return nil
 }
 
+// SetAuthWebhook enables authorization of WebSocket peers through an external endpoint
+func (s *Server) SetAuthWebhook(client *authhook.Client) {
+	s.authHook = client
+}
+
+// SetEventBus sets the bus that edge registration and service sync events are published to
+func (s *Server) SetEventBus(bus *events.Bus) {
+	s.events = bus
+}
+
 // RegisterRoutes registers the signaling routes with Fiber
 func (s *Server) RegisterRoutes(router fiber.Router) {
 	ws := router.Group("/signaling")
@@ -109,6 +159,12 @@ func (s *Server) RegisterRoutes(router fiber.Router) {
 	// WebSocket endpoint: /signaling/ws/:type?id=xxx&edgeid=xxx
 	ws.Get("/ws/:type", s.wsMiddleware(), s.handleWebSocket())
 
+	// Multiplexed tunnel session opened by edges: /signaling/tunnel?id=xxx
+	ws.Get("/tunnel", s.sessionMiddleware(), s.handleSession())
+
+	// Tunnel streams opened by edges on request: /signaling/tunnel/:stream?id=xxx
+	ws.Get("/tunnel/:stream", s.tunnelMiddleware(), s.handleTunnel())
+
 	// REST endpoint for client connection requests
 	ws.Post("/client/connect", s.handleClientConnect())
 }
@@ -142,10 +198,61 @@ func (s *Server) wsMiddleware() fiber.Handler {
 			})
 		}
 
+		// Authorize peer against the external webhook, if configured
+		if ok, err := s.authorizePeer(c, peerType); !ok {
+			return err
+		}
+
 		return c.Next()
 	}
 }
 
+// authorizePeer checks the peer against the auth webhook, if configured.
+// When the peer is rejected it writes the response and returns false.
+func (s *Server) authorizePeer(c *fiber.Ctx, peerType string) (bool, error) {
+	if s.authHook == nil {
+		return true, nil
+	}
+
+	decision, err := s.authHook.Authorize(c.UserContext(), authhook.Request{
+		Kind:       authhook.KindSignaling,
+		PeerType:   peerType,
+		PeerID:     c.Query("id"),
+		EdgeID:     c.Query("edgeid"),
+		Token:      peerToken(c),
+		RemoteAddr: c.IP(),
+	})
+	if err != nil {
+		s.logger.Warn("Auth webhook error", "id", c.Query("id"), "error", err)
+		return false, c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "authorization service unavailable",
+		})
+	}
+	if !decision.Allow {
+		s.logger.Warn("Peer rejected by auth webhook",
+			"id", c.Query("id"),
+			"type", peerType,
+			"reason", decision.Reason,
+		)
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "peer not authorized",
+		})
+	}
+	return true, nil
+}
+
+// peerToken extracts the peer's auth token from the token query parameter
+// (browsers cannot set headers on WebSocket upgrades) or a Bearer header
+func peerToken(c *fiber.Ctx) string {
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+	if auth := c.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
 // handleWebSocket handles WebSocket connections
 func (s *Server) handleWebSocket() fiber.Handler {
 	return websocket.New(func(conn *websocket.Conn) {
@@ -166,7 +273,7 @@ func (s *Server) handleWebSocket() fiber.Handler {
 		ctx, cancel := context.WithCancel(s.ctx)
 		peerConn := &PeerConnection{
 			Peer:   peer,
-			Conn:   conn,
+			Conn:   &lockedConn{WebSocketConn: conn},
 			Ctx:    ctx,
 			Cancel: cancel,
 		}
@@ -176,8 +283,8 @@ func (s *Server) handleWebSocket() fiber.Handler {
 			peerConn.ClientDataChans = make(map[string]chan *models.SignalingMessage)
 		}
 
-		// Add to registry and connections
-		s.registry.AddPeer(peer)
+		// Add to registry and connections. Both change under s.mu so a
+		// replaced connection's cleanup cannot remove its successor.
 		s.mu.Lock()
 		// Check for existing connection and close it first
 		if oldConn, exists := s.connections[id]; exists {
@@ -193,6 +300,7 @@ func (s *Server) handleWebSocket() fiber.Handler {
 			}
 		}
 		s.connections[id] = peerConn
+		s.registry.AddPeer(peer)
 		s.mu.Unlock()
 
 		s.logger.Info("Peer connected",
@@ -207,10 +315,20 @@ func (s *Server) handleWebSocket() fiber.Handler {
 		defer func() {
 			cancel()
 			conn.Close()
-			s.registry.RemovePeer(id)
+
+			// A reconnect replaces this connection; the peer stays registered
 			s.mu.Lock()
-			delete(s.connections, id)
+			current := s.connections[id] == peerConn
+			if current {
+				delete(s.connections, id)
+				s.registry.RemovePeer(id)
+			}
 			s.mu.Unlock()
+
+			if !current {
+				s.logger.Debug("Replaced connection closed", "id", id, "type", peerType)
+				return
+			}
 			s.logger.Info("Peer disconnected", "id", id, "type", peerType)
 		}()
 
@@ -224,6 +342,7 @@ func (s *Server) handleWebSocket() fiber.Handler {
 		})
 
 		// Read loop
+		limiter := newMessageLimiter(s.config)
 		for {
 			conn.SetReadDeadline(time.Now().Add(readWait))
 
@@ -233,6 +352,27 @@ func (s *Server) handleWebSocket() fiber.Handler {
 				break
 			}
 
+			allowed, disconnect := limiter.allow()
+			if disconnect {
+				s.logger.Warn("Disconnecting peer for exceeding message rate limit",
+					"peer", id,
+					"type", peerType,
+					"dropped", limiter.violations,
+				)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+					time.Now().Add(writeWait),
+				)
+				break
+			}
+			if !allowed {
+				// Notify once per burst of dropped messages
+				if limiter.violations == 1 {
+					s.sendError(peerConn.Conn, "rate limit exceeded, message dropped")
+				}
+				continue
+			}
+
 			s.logger.Debug("Received message",
 				"from", id,
 				"type", msg.Type,
@@ -261,7 +401,7 @@ func (s *Server) handleMessage(from *PeerConnection, msg *models.SignalingMessag
 		s.handleAPIConnectResponse(from, msg)
 
 	case "turn-request":
-		s.handleTurnRequest(from)
+		s.handleTurnRequest(from, msg)
 
 	case MessageTypeServiceSync:
 		s.handleServiceSync(from, msg)
@@ -272,9 +412,15 @@ func (s *Server) handleMessage(from *PeerConnection, msg *models.SignalingMessag
 	case MessageTypeServiceListRequest:
 		s.handleServiceListRequest(from, msg)
 
+	case MessageTypeServiceHealth:
+		s.handleServiceHealth(from, msg)
+
 	case "connect-response", "offer", "answer", "ice-candidate":
 		s.forwardMessage(msg)
 
+	case MessageTypeTunnelError:
+		s.handleTunnelError(from, msg)
+
 	case "get-peers":
 		s.handleGetPeers(from)
 
@@ -310,6 +456,7 @@ func (s *Server) handleEdgeRegistration(from *PeerConnection, msg *models.Signal
 	}
 
 	s.logger.Info("Edge registered", "edge_id", edgeID)
+	s.events.Publish(events.EdgeRegistered, events.PeerData{ID: edgeID, Type: from.Peer.Type})
 
 	// Send confirmation
 	s.sendMessage(from.Conn, &models.SignalingMessage{
@@ -396,40 +543,34 @@ func (s *Server) handleAPIConnectResponse(from *PeerConnection, msg *models.Sign
 	}
 }
 
-// handleTurnRequest sends TURN credentials via WebSocket
-func (s *Server) handleTurnRequest(from *PeerConnection) {
+// handleTurnRequest sends TURN credentials via WebSocket.
+// The request may carry {"transports": ["udp", "tls"]} (or "udp,tls") to limit the URLs returned.
+func (s *Server) handleTurnRequest(from *PeerConnection, msg *models.SignalingMessage) {
 	s.logger.Debug("Handling turn-request", "peer", from.Peer.ID)
 
-	if s.turnConfig == nil {
+	if s.turnConfig == nil || s.credentials == nil {
 		s.sendError(from.Conn, "TURN configuration not available")
 		return
 	}
 
-	// Generate TURN credentials
-	username, password, expiry := s.generateTURNCredentials(
-		from.Peer.Type,
-		from.Peer.ID,
-		s.turnConfig.Auth.TTLSeconds,
-	)
-
-	// Build TURN server URLs
-	urls := []string{
-		fmt.Sprintf("stun:%s:3478", s.turnConfig.PublicIP),
-		fmt.Sprintf("turn:%s:3478?transport=udp", s.turnConfig.PublicIP),
-		fmt.Sprintf("turn:%s:3478?transport=tcp", s.turnConfig.PublicIP),
+	transports, err := requestedTransports(msg)
+	if err != nil {
+		s.sendError(from.Conn, err.Error())
+		return
 	}
 
-	// Add TURNS if TLS is configured
-	if s.turnConfig.Ports.TLS > 0 {
-		urls = append(urls, fmt.Sprintf("turns:%s:%d?transport=tcp", s.turnConfig.PublicIP, s.turnConfig.Ports.TLS))
-	}
+	// Generate TURN credentials
+	issued := s.credentials.Issue(from.Peer.Type, from.Peer.ID, 0)
 
+	// URLs lists only this server (the credentials apply to it);
+	// ICEServers also includes configured external servers
 	creds := models.TurnCredentials{
-		Username: username,
-		Password: password,
-		TTL:      s.turnConfig.Auth.TTLSeconds,
-		Expires:  time.Unix(expiry, 0).UTC().Format(time.RFC3339),
-		URLs:     urls,
+		Username:   issued.Username,
+		Password:   issued.Password,
+		TTL:        issued.TTL,
+		Expires:    time.Unix(issued.Expiry, 0).UTC().Format(time.RFC3339),
+		URLs:       ice.URLs(s.iceBuilder.Servers(issued.Username, issued.Password, transports)),
+		ICEServers: s.iceBuilder.Build(issued.Username, issued.Password, transports),
 	}
 
 	s.sendMessage(from.Conn, &models.SignalingMessage{
@@ -438,16 +579,31 @@ func (s *Server) handleTurnRequest(from *PeerConnection) {
 	})
 }
 
-// generateTURNCredentials generates coturn-compatible credentials
-func (s *Server) generateTURNCredentials(peerType, peerID string, ttl int) (username, password string, expiry int64) {
-	expiry = time.Now().Unix() + int64(ttl)
-	username = fmt.Sprintf("%s:%s:%d", peerType, peerID, expiry)
-
-	mac := hmac.New(sha256.New, []byte(s.turnConfig.Auth.Secret))
-	mac.Write([]byte(username))
-	password = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+// requestedTransports extracts the optional transport subset from a turn-request
+func requestedTransports(msg *models.SignalingMessage) ([]string, error) {
+	dataMap, ok := msg.Data.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
 
-	return username, password, expiry
+	switch value := dataMap["transports"].(type) {
+	case string:
+		return ice.ParseTransports(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			str, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("transports must be a list of strings")
+			}
+			values = append(values, str)
+		}
+		return ice.ValidateTransports(values)
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("transports must be a list of strings")
+	}
 }
 
 // handleClientConnect handles REST API client connection requests
@@ -2,10 +2,16 @@ package signaling
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/authhook"
+	"github.com/arqut/arqut-server-ce/internal/config"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -324,7 +330,7 @@ func TestHandleTurnRequest(t *testing.T) {
 	}
 
 	t.Run("generates TURN credentials successfully", func(t *testing.T) {
-		server.handleTurnRequest(peerConn)
+		server.handleTurnRequest(peerConn, &models.SignalingMessage{Type: "turn-request"})
 
 		// Verify turn-response was sent
 		require.Equal(t, 1, len(mockConn.sentMessages))
@@ -341,7 +347,7 @@ func TestHandleTurnRequest(t *testing.T) {
 	})
 
 	t.Run("handles missing TURN config gracefully", func(t *testing.T) {
-		serverNoTurn := New(server.config, nil, server.registry, nil, server.logger)
+		serverNoTurn := New(server.config, nil, nil, server.registry, nil, server.logger)
 		mockConn2 := &mockWebSocketConn{}
 		peerConn2 := &PeerConnection{
 			Peer:   peer,
@@ -350,7 +356,7 @@ func TestHandleTurnRequest(t *testing.T) {
 			Cancel: cancel,
 		}
 
-		serverNoTurn.handleTurnRequest(peerConn2)
+		serverNoTurn.handleTurnRequest(peerConn2, &models.SignalingMessage{Type: "turn-request"})
 
 		// Should send error
 		require.Equal(t, 1, len(mockConn2.sentMessages))
@@ -358,6 +364,63 @@ func TestHandleTurnRequest(t *testing.T) {
 	})
 }
 
+func TestHandleTurnRequest_Transports(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		data     interface{}
+		wantURLs []string
+		wantErr  bool
+	}{
+		{
+			name:     "list",
+			data:     map[string]interface{}{"transports": []interface{}{"tcp"}},
+			wantURLs: []string{"turn:203.0.113.1:3478?transport=tcp"},
+		},
+		{
+			name:     "comma separated",
+			data:     map[string]interface{}{"transports": "tls"},
+			wantURLs: []string{"turns:203.0.113.1:5349?transport=tcp"},
+		},
+		{
+			name:    "invalid transport",
+			data:    map[string]interface{}{"transports": []interface{}{"quic"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConn := &mockWebSocketConn{}
+			peerConn := &PeerConnection{
+				Peer:   &models.Peer{ID: "client-1", Type: "client"},
+				Conn:   mockConn,
+				Ctx:    ctx,
+				Cancel: cancel,
+			}
+
+			server.handleTurnRequest(peerConn, &models.SignalingMessage{Type: "turn-request", Data: tt.data})
+
+			require.Equal(t, 1, len(mockConn.sentMessages))
+			msg := mockConn.sentMessages[0]
+			if tt.wantErr {
+				assert.Equal(t, "error", msg.Type)
+				return
+			}
+
+			creds, ok := msg.Data.(models.TurnCredentials)
+			require.True(t, ok)
+			assert.Equal(t, tt.wantURLs, creds.URLs)
+			require.Len(t, creds.ICEServers, 1)
+			assert.Equal(t, creds.Username, creds.ICEServers[0].Username)
+		})
+	}
+}
+
 func TestHandleConnectRequest(t *testing.T) {
 	server, reg := setupTestServer(t)
 
@@ -439,6 +502,74 @@ func TestHandleAPIConnectRequest(t *testing.T) {
 	assert.Equal(t, 0, len(mockConn.sentMessages))
 }
 
+func TestWSMiddleware_AuthWebhook(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	var lastRequest authhook.Request
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&lastRequest)
+		switch lastRequest.Token {
+		case "good-token":
+			json.NewEncoder(w).Encode(authhook.Decision{Allow: true})
+		case "broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer endpoint.Close()
+
+	server.SetAuthWebhook(authhook.New(&config.AuthWebhookConfig{
+		URL:     endpoint.URL,
+		Timeout: time.Second,
+	}, server.logger))
+
+	app := fiber.New()
+	app.Get("/ws/:type", server.wsMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendString("upgraded")
+	})
+
+	upgradeRequest := func(url, authHeader string) *http.Request {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		authHeader     string
+		expectedStatus int
+	}{
+		{"token in query allowed", "/ws/client?id=c1&edgeid=e1&token=good-token", "", fiber.StatusOK},
+		{"token in bearer header allowed", "/ws/edge?id=e1", "Bearer good-token", fiber.StatusOK},
+		{"bad token rejected", "/ws/edge?id=e1&token=bad-token", "", fiber.StatusForbidden},
+		{"missing token rejected", "/ws/edge?id=e1", "", fiber.StatusForbidden},
+		{"endpoint failure rejected", "/ws/edge?id=e1&token=broken", "", fiber.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(upgradeRequest(tt.url, tt.authHeader))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+
+	t.Run("forwards peer identity to endpoint", func(t *testing.T) {
+		_, err := app.Test(upgradeRequest("/ws/client?id=c9&edgeid=e9&token=good-token", ""))
+		require.NoError(t, err)
+		assert.Equal(t, authhook.KindSignaling, lastRequest.Kind)
+		assert.Equal(t, "client", lastRequest.PeerType)
+		assert.Equal(t, "c9", lastRequest.PeerID)
+		assert.Equal(t, "e9", lastRequest.EdgeID)
+	})
+}
+
 // Mock WebSocket connection for testing
 type mockWebSocketConn struct {
 	sentMessages []*models.SignalingMessage
@@ -2,14 +2,19 @@ package signaling
 
 import (
 	"context"
+	"net"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
 	"github.com/arqut/arqut-server-ce/internal/registry"
 	"github.com/arqut/arqut-server-ce/internal/pkg/logger"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/turn"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -40,7 +45,7 @@ func setupTestServer(t *testing.T) (*Server, *registry.Registry) {
 	})
 
 	reg := registry.New()
-	server := New(cfg, turnCfg, reg, nil, log.Logger)
+	server := New(cfg, turnCfg, turn.NewCredentialIssuer(&turnCfg.Auth), reg, nil, log.Logger)
 
 	return server, reg
 }
@@ -79,7 +84,8 @@ func TestGenerateTURNCredentials(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			username, password, expiry := server.generateTURNCredentials(tt.peerType, tt.peerID, tt.ttl)
+			creds := server.credentials.Issue(tt.peerType, tt.peerID, tt.ttl)
+			username, password, expiry := creds.Username, creds.Password, creds.Expiry
 
 			// Verify username format: peerType:peerID:timestamp
 			parts := strings.Split(username, ":")
@@ -97,7 +103,8 @@ func TestGenerateTURNCredentials(t *testing.T) {
 			assert.Greater(t, len(password), 20) // HMAC-SHA256 base64 should be longer
 
 			// Verify credentials are consistent for same timestamp
-			username2, password2, expiry2 := server.generateTURNCredentials(tt.peerType, tt.peerID, tt.ttl)
+			creds2 := server.credentials.Issue(tt.peerType, tt.peerID, tt.ttl)
+			username2, password2, expiry2 := creds2.Username, creds2.Password, creds2.Expiry
 			assert.Equal(t, username, username2)
 			assert.Equal(t, password, password2)
 			assert.Equal(t, expiry, expiry2)
@@ -131,12 +138,12 @@ func TestGenerateTURNCredentials_DifferentSecrets(t *testing.T) {
 	log := logger.New(logger.Config{Level: "error", Format: "text"})
 	reg := registry.New()
 
-	server1 := New(cfg, turnCfg1, reg, nil, log.Logger)
-	server2 := New(cfg, turnCfg2, reg, nil, log.Logger)
+	server1 := New(cfg, turnCfg1, turn.NewCredentialIssuer(&turnCfg1.Auth), reg, nil, log.Logger)
+	server2 := New(cfg, turnCfg2, turn.NewCredentialIssuer(&turnCfg2.Auth), reg, nil, log.Logger)
 
 	// Generate credentials with same parameters but different secrets
-	_, password1, _ := server1.generateTURNCredentials("client", "test", 3600)
-	_, password2, _ := server2.generateTURNCredentials("client", "test", 3600)
+	password1 := server1.credentials.Issue("client", "test", 3600).Password
+	password2 := server2.credentials.Issue("client", "test", 3600).Password
 
 	// Passwords should be different
 	assert.NotEqual(t, password1, password2, "Different secrets should produce different passwords")
@@ -318,3 +325,65 @@ func TestServerStartStop(t *testing.T) {
 		t.Fatal("Server context should be cancelled after Stop")
 	}
 }
+
+// TestReconnectKeepsPeer tests that closing a replaced connection does not
+// remove the peer that replaced it
+func TestReconnectKeepsPeer(t *testing.T) {
+	server, reg := setupTestServer(t)
+	defer server.Stop()
+
+	bus := events.NewBus(server.logger)
+	sub := bus.Subscribe(10, events.PeerDisconnected)
+	defer sub.Close()
+	reg.SetEventBus(bus)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	server.RegisterRoutes(app.Group("/api/v1"))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	current := func() *PeerConnection {
+		server.mu.RLock()
+		defer server.mu.RUnlock()
+		return server.connections["edge-1"]
+	}
+
+	url := "ws://" + ln.Addr().String() + "/api/v1/signaling/ws/edge?id=edge-1"
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer first.Close()
+	require.Eventually(t, func() bool { return current() != nil }, 2*time.Second, 10*time.Millisecond)
+	replaced := current()
+
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer second.Close()
+	require.Eventually(t, func() bool { return current() != replaced }, 2*time.Second, 10*time.Millisecond)
+	live := current()
+
+	// The replaced connection's handler exits once its client goes away
+	first.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	_, exists := reg.GetPeer("edge-1")
+	assert.True(t, exists, "peer should still be registered")
+	assert.Same(t, live, current())
+	select {
+	case ev := <-sub.Events():
+		t.Fatalf("unexpected %s event", ev.Type)
+	default:
+	}
+
+	// Closing the live connection does remove the peer
+	second.Close()
+	select {
+	case ev := <-sub.Events():
+		assert.Equal(t, events.PeerDisconnected, ev.Type)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no peer.disconnected event")
+	}
+	_, exists = reg.GetPeer("edge-1")
+	assert.False(t, exists)
+}
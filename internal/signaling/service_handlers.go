@@ -2,10 +2,14 @@ package signaling
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/events"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
 )
 
 // Message type constants for service sync
@@ -15,6 +19,20 @@ const (
 	MessageTypeServiceSyncBatch    = "service-sync-batch"
 	MessageTypeServiceListRequest  = "service-list-request"
 	MessageTypeServiceListResponse = "service-list-response"
+	MessageTypeServicePush         = "service-push" // Server-side change the edge must apply
+)
+
+// Service operations carried by sync and push messages
+const (
+	ServiceOpCreated = "created"
+	ServiceOpUpdated = "updated"
+	ServiceOpDeleted = "deleted"
+)
+
+// Additional per-service statuses in a batch sync ack
+const (
+	SyncStatusUnchanged = "unchanged"
+	SyncStatusFailed    = "failed"
 )
 
 // handleServiceSync processes single service sync from edge
@@ -51,31 +69,31 @@ func (s *Server) handleServiceSync(from *PeerConnection, msg *models.SignalingMe
 	s.logger.Info("Processing service sync",
 		"edge", from.Peer.ID,
 		"operation", operation,
-		"service_id", service.ID,
+		"local_id", service.LocalID,
 		"name", service.Name,
 		"tunnel_port", service.TunnelPort)
 
 	// Validate service data
-	if err := validateService(service); err != nil {
+	if err := ValidateService(service); err != nil {
 		s.logger.Warn("Service validation failed",
 			"edge", from.Peer.ID,
-			"service_id", service.ID,
+			"local_id", service.LocalID,
 			"error", err)
-		s.sendServiceSyncAck(from, service.ID, service.ID, "error", err.Error())
+		s.sendServiceSyncAck(from, service.LocalID, "", "error", err.Error())
 		return
 	}
 
 	// Process based on operation
 	switch operation {
-	case "created":
+	case ServiceOpCreated:
 		err = s.createService(service)
-	case "updated":
+	case ServiceOpUpdated:
 		err = s.updateService(service)
-	case "deleted":
-		err = s.deleteService(service.ID)
+	case ServiceOpDeleted:
+		err = s.deleteService(service)
 	default:
 		s.logger.Warn("Invalid service sync operation", "edge", from.Peer.ID, "operation", operation)
-		s.sendServiceSyncAck(from, service.ID, "", "error", "invalid operation")
+		s.sendServiceSyncAck(from, service.LocalID, "", "error", "invalid operation")
 		return
 	}
 
@@ -83,22 +101,24 @@ func (s *Server) handleServiceSync(from *PeerConnection, msg *models.SignalingMe
 		s.logger.Error("Service sync operation failed",
 			"edge", from.Peer.ID,
 			"operation", operation,
-			"service_id", service.ID,
+			"local_id", service.LocalID,
 			"error", err)
-		s.sendServiceSyncAck(from, service.ID, "", "error", err.Error())
+		s.sendServiceSyncAck(from, service.LocalID, "", "error", err.Error())
 		return
 	}
 
 	s.logger.Info("Service sync completed successfully",
 		"edge", from.Peer.ID,
 		"operation", operation,
+		"local_id", service.LocalID,
 		"service_id", service.ID)
 
-	// Send success acknowledgment
-	s.sendServiceSyncAck(from, service.ID, service.ID, "success", "")
+	// Send success acknowledgment with the server-assigned ID
+	s.sendServiceSyncAck(from, service.LocalID, service.ID, "success", "")
 }
 
-// handleServiceSyncBatch processes bulk sync on reconnection
+// handleServiceSyncBatch processes bulk sync on reconnection. The batch is
+// authoritative for the edge: services it does not contain are deleted.
 func (s *Server) handleServiceSyncBatch(from *PeerConnection, msg *models.SignalingMessage) {
 	s.logger.Debug("Received batch sync message", "edge", from.Peer.ID, "from", from.Peer.Type)
 
@@ -135,84 +155,231 @@ func (s *Server) handleServiceSyncBatch(from *PeerConnection, msg *models.Signal
 
 	s.logger.Info("Processing batch sync", "edge", from.Peer.ID, "count", len(servicesData))
 
-	// Process each service (upsert pattern)
-	successCount := 0
-	failedCount := 0
-	for i, svcData := range servicesData {
-		s.logger.Debug("Processing batch service", "edge", from.Peer.ID, "index", i)
-
-		svcMap, ok := svcData.(map[string]interface{})
-		if !ok {
-			s.logger.Warn("Invalid service data in batch",
-				"edge", from.Peer.ID,
-				"index", i,
-				"type", fmt.Sprintf("%T", svcData))
-			failedCount++
-			continue
+	var (
+		results          []models.ServiceSyncResult
+		counts           map[string]int
+		changes          []serviceChange
+		deletionsSkipped bool
+	)
+	// Results of batch entries are reported in batch order, deletions last
+	record := func(result models.ServiceSyncResult) {
+		if result.Index != nil {
+			results[*result.Index] = result
+		} else {
+			results = append(results, result)
 		}
+		counts[result.Status]++
+	}
 
-		service, err := s.parseEdgeService(svcMap)
+	// The whole batch, including deletions, is applied in one transaction.
+	// Entries rejected by validation or conflict checks fail individually;
+	// any other storage error rolls everything back.
+	err := s.storage.Transaction(func(tx storage.Storage) error {
+		results = make([]models.ServiceSyncResult, len(servicesData))
+		counts = make(map[string]int)
+		changes = nil
+
+		existing, err := tx.ListEdgeServices(from.Peer.ID)
 		if err != nil {
-			s.logger.Warn("Failed to parse service in batch",
-				"edge", from.Peer.ID,
-				"index", i,
-				"error", err)
-			failedCount++
-			continue
+			return fmt.Errorf("failed to list services: %w", err)
 		}
+		stored := make(map[string]*models.EdgeService, len(existing))
+		for _, svc := range existing {
+			stored[svc.LocalID] = svc
+		}
+
+		// Local IDs present in the batch, valid or not; their stored copies are kept
+		seen := make(map[string]bool, len(servicesData))
+		// An entry without a readable ID could be any stored service, so
+		// deletions are only safe when every entry was identified
+		allIdentified := true
+		// Names and tunnel ports claimed by earlier valid entries
+		names := make(map[string]bool, len(servicesData))
+		ports := make(map[int]bool, len(servicesData))
+
+		type pendingService struct {
+			index   int
+			service *models.EdgeService
+		}
+		var pending []pendingService
 
-		// Set EdgeID from peer connection
-		service.EdgeID = from.Peer.ID
+		for i, svcData := range servicesData {
+			index := i
+			s.logger.Debug("Processing batch service", "edge", from.Peer.ID, "index", i)
 
-		s.logger.Debug("Validating batch service",
-			"edge", from.Peer.ID,
-			"index", i,
-			"service_id", service.ID,
-			"name", service.Name)
+			svcMap, ok := svcData.(map[string]interface{})
+			if !ok {
+				s.logger.Warn("Invalid service data in batch",
+					"edge", from.Peer.ID,
+					"index", i,
+					"type", fmt.Sprintf("%T", svcData))
+				allIdentified = false
+				record(models.ServiceSyncResult{Index: &index, Status: SyncStatusFailed, Error: "invalid service data format"})
+				continue
+			}
+
+			service, err := s.parseEdgeService(svcMap)
+			if err != nil {
+				s.logger.Warn("Failed to parse service in batch",
+					"edge", from.Peer.ID,
+					"index", i,
+					"error", err)
+				allIdentified = false
+				record(models.ServiceSyncResult{Index: &index, Status: SyncStatusFailed, Error: err.Error()})
+				continue
+			}
 
-		if err := validateService(service); err != nil {
-			s.logger.Warn("Invalid service in batch",
+			// Set EdgeID from peer connection
+			service.EdgeID = from.Peer.ID
+
+			if service.LocalID == "" {
+				allIdentified = false
+			} else if seen[service.LocalID] {
+				record(models.ServiceSyncResult{Index: &index, ID: service.LocalID, Status: SyncStatusFailed, Error: "duplicate service ID in batch"})
+				continue
+			}
+			seen[service.LocalID] = true
+
+			s.logger.Debug("Validating batch service",
 				"edge", from.Peer.ID,
 				"index", i,
-				"service_id", service.ID,
-				"error", err)
-			failedCount++
-			continue
+				"local_id", service.LocalID,
+				"name", service.Name)
+
+			if err := ValidateService(service); err != nil {
+				s.logger.Warn("Invalid service in batch",
+					"edge", from.Peer.ID,
+					"index", i,
+					"local_id", service.LocalID,
+					"error", err)
+				record(models.ServiceSyncResult{Index: &index, ID: service.LocalID, Status: SyncStatusFailed, Error: err.Error()})
+				continue
+			}
+
+			switch {
+			case names[service.Name]:
+				record(models.ServiceSyncResult{Index: &index, ID: service.LocalID, Status: SyncStatusFailed, Error: "duplicate service name in batch"})
+				continue
+			case ports[service.TunnelPort]:
+				record(models.ServiceSyncResult{Index: &index, ID: service.LocalID, Status: SyncStatusFailed, Error: "duplicate tunnel port in batch"})
+				continue
+			}
+			names[service.Name] = true
+			ports[service.TunnelPort] = true
+
+			pending = append(pending, pendingService{index: index, service: service})
 		}
 
-		// Try to update first, create if not exists
-		err = s.updateService(service)
-		if err != nil {
-			// Service doesn't exist, create it
-			s.logger.Debug("Service not found, creating new",
+		// Remove services the edge no longer has first, so their names and
+		// tunnel ports can be taken by the batch
+		var missing []string
+		for _, svc := range existing {
+			if !seen[svc.LocalID] {
+				missing = append(missing, svc.ID)
+			}
+		}
+		switch {
+		case len(missing) == 0:
+		case !allIdentified:
+			deletionsSkipped = true
+			s.logger.Warn("Skipped deleting services missing from batch: batch has unidentified entries",
 				"edge", from.Peer.ID,
-				"service_id", service.ID)
-			err = s.createService(service)
-			if err != nil {
+				"count", len(missing))
+		default:
+			if err := tx.DeleteEdgeServices(from.Peer.ID, missing); err != nil {
+				return err
+			}
+			for _, svc := range existing {
+				if !seen[svc.LocalID] {
+					if err := auditService(tx, models.AuditDeleted, MessageTypeServiceSyncBatch, svc, nil); err != nil {
+						return err
+					}
+					changes = append(changes, serviceChange{eventType: events.ServiceDeleted, id: svc.ID})
+					record(models.ServiceSyncResult{ID: svc.LocalID, ServerID: svc.ID, Status: ServiceOpDeleted})
+				}
+			}
+		}
+
+		for _, p := range pending {
+			index, service := p.index, p.service
+
+			if current := stored[service.LocalID]; current != nil && sameServiceConfig(current, service) {
+				record(models.ServiceSyncResult{Index: &index, ID: service.LocalID, ServerID: current.ID, Status: SyncStatusUnchanged})
+				continue
+			}
+
+			created, err := tx.UpsertEdgeService(service)
+			switch {
+			case errors.Is(err, storage.ErrConflict):
 				s.logger.Warn("Failed to sync service",
 					"edge", from.Peer.ID,
-					"index", i,
-					"service_id", service.ID,
+					"index", index,
+					"local_id", service.LocalID,
 					"error", err)
-				failedCount++
+				record(models.ServiceSyncResult{Index: &index, ID: service.LocalID, Status: SyncStatusFailed, Error: err.Error()})
 				continue
+			case err != nil:
+				return err
+			}
+
+			status, eventType, operation := ServiceOpUpdated, events.ServiceUpdated, models.AuditUpdated
+			if created {
+				status, eventType, operation = ServiceOpCreated, events.ServiceCreated, models.AuditCreated
+			}
+			if err := auditService(tx, operation, MessageTypeServiceSyncBatch, stored[service.LocalID], service); err != nil {
+				return err
 			}
+			changes = append(changes, serviceChange{eventType: eventType, id: service.ID, service: service})
+			record(models.ServiceSyncResult{Index: &index, ID: service.LocalID, ServerID: service.ID, Status: status})
 		}
-		successCount++
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			s.logger.Warn("Batch sync raced a concurrent change, no changes applied", "edge", from.Peer.ID, "error", err)
+			s.sendError(from.Conn, "Batch sync conflicted with a concurrent change, no changes were applied; retry the sync")
+			return
+		}
+		s.logger.Error("Batch sync failed, no changes applied", "edge", from.Peer.ID, "error", err)
+		s.sendError(from.Conn, "Batch sync failed, no changes were applied")
+		return
+	}
+
+	// Publish only after the transaction committed
+	for _, change := range changes {
+		s.logger.Info("Service synced", "edge", from.Peer.ID, "service_id", change.id, "event", change.eventType)
+		s.publishService(change.eventType, from.Peer.ID, change.id, change.service)
 	}
 
 	s.logger.Info("Batch sync completed",
 		"edge", from.Peer.ID,
-		"success", successCount,
-		"failed", failedCount,
+		"created", counts[ServiceOpCreated],
+		"updated", counts[ServiceOpUpdated],
+		"unchanged", counts[SyncStatusUnchanged],
+		"deleted", counts[ServiceOpDeleted],
+		"failed", counts[SyncStatusFailed],
 		"total", len(servicesData))
 
+	status := "success"
+	if counts[SyncStatusFailed] > 0 || deletionsSkipped {
+		status = "partial"
+	}
+
 	// Send acknowledgment
 	s.sendMessage(from.Conn, &models.SignalingMessage{
 		Type: MessageTypeServiceSyncAck,
 		Data: map[string]interface{}{
-			"status":  "success",
-			"message": fmt.Sprintf("Synced %d services", successCount),
+			"status": status,
+			"message": fmt.Sprintf("Created %d, updated %d, unchanged %d, deleted %d, failed %d",
+				counts[ServiceOpCreated], counts[ServiceOpUpdated], counts[SyncStatusUnchanged],
+				counts[ServiceOpDeleted], counts[SyncStatusFailed]),
+			"created":           counts[ServiceOpCreated],
+			"updated":           counts[ServiceOpUpdated],
+			"unchanged":         counts[SyncStatusUnchanged],
+			"deleted":           counts[ServiceOpDeleted],
+			"failed":            counts[SyncStatusFailed],
+			"deletions_skipped": deletionsSkipped,
+			"results":           results,
 		},
 	})
 }
@@ -242,35 +409,74 @@ func (s *Server) handleServiceListRequest(from *PeerConnection, msg *models.Sign
 	s.logger.Debug("Service list sent", "edge", from.Peer.ID, "count", len(services))
 }
 
+// PushServiceChange sends a service change made through the REST API to the
+// owning edge so it converges to the stored configuration. Returns false if
+// the edge is not connected; it then picks the change up with its next
+// service-list-request.
+func (s *Server) PushServiceChange(edgeID, operation string, service *models.EdgeService) bool {
+	s.mu.RLock()
+	edgeConn, exists := s.connections[edgeID]
+	s.mu.RUnlock()
+
+	if !exists || edgeConn.Peer.Type != "edge" {
+		s.logger.Debug("Edge not connected, service change not pushed", "edge", edgeID, "operation", operation)
+		return false
+	}
+
+	data := map[string]interface{}{
+		"operation": operation,
+		"service":   service,
+	}
+	if err := s.sendMessage(edgeConn.Conn, &models.SignalingMessage{
+		Type: MessageTypeServicePush,
+		Data: data,
+	}); err != nil {
+		s.logger.Warn("Failed to push service change", "edge", edgeID, "operation", operation, "error", err)
+		return false
+	}
+
+	s.logger.Info("Service change pushed to edge", "edge", edgeID, "operation", operation, "service_id", service.ID)
+	return true
+}
+
 // Helper functions
 
+// createService stores a service reported by an edge and sets its
+// server-assigned ID
 func (s *Server) createService(service *models.EdgeService) error {
 	// Set timestamps
 	service.CreatedAt = time.Now()
 	service.UpdatedAt = time.Now()
 
-	if err := s.storage.CreateEdgeService(service); err != nil {
-		return fmt.Errorf("failed to create service: %w", err)
+	err := s.storage.Transaction(func(tx storage.Storage) error {
+		if err := tx.CreateEdgeService(service); err != nil {
+			return fmt.Errorf("failed to create service: %w", err)
+		}
+		return auditService(tx, models.AuditCreated, MessageTypeServiceSync, nil, service)
+	})
+	if err != nil {
+		return err
 	}
 
 	s.logger.Info("Service created",
 		"edge", service.EdgeID,
 		"service_id", service.ID,
+		"local_id", service.LocalID,
 		"name", service.Name)
 
+	s.publishService(events.ServiceCreated, service.EdgeID, service.ID, service)
 	return nil
 }
 
+// updateService applies an edge's change to the service with the same local
+// ID and sets the server-assigned ID
 func (s *Server) updateService(service *models.EdgeService) error {
-	existing, err := s.storage.GetEdgeService(service.ID)
+	existing, err := s.storage.GetEdgeServiceByLocalID(service.EdgeID, service.LocalID)
 	if err != nil {
-		return fmt.Errorf("service not found: %w", err)
-	}
-
-	// Verify edge ownership
-	if existing.EdgeID != service.EdgeID {
-		return fmt.Errorf("service belongs to different edge")
+		return err
 	}
+	service.ID = existing.ID
+	before := *existing
 
 	// Update fields
 	existing.Name = service.Name
@@ -278,30 +484,116 @@ func (s *Server) updateService(service *models.EdgeService) error {
 	existing.LocalHost = service.LocalHost
 	existing.LocalPort = service.LocalPort
 	existing.Protocol = service.Protocol
+	existing.Options = service.Options
+	existing.Labels = service.Labels
 	existing.Enabled = service.Enabled
 	existing.UpdatedAt = time.Now()
 
-	if err := s.storage.UpdateEdgeService(existing); err != nil {
-		return fmt.Errorf("failed to update service: %w", err)
+	err = s.storage.Transaction(func(tx storage.Storage) error {
+		if err := tx.UpdateEdgeService(existing); err != nil {
+			return fmt.Errorf("failed to update service: %w", err)
+		}
+		return auditService(tx, models.AuditUpdated, MessageTypeServiceSync, &before, existing)
+	})
+	if err != nil {
+		return err
 	}
 
 	s.logger.Info("Service updated",
 		"edge", service.EdgeID,
 		"service_id", service.ID,
+		"local_id", service.LocalID,
 		"name", service.Name)
 
+	s.publishService(events.ServiceUpdated, existing.EdgeID, existing.ID, existing)
 	return nil
 }
 
-func (s *Server) deleteService(id string) error {
-	if err := s.storage.DeleteEdgeService(id); err != nil {
-		return fmt.Errorf("failed to delete service: %w", err)
+// deleteService deletes the service with the edge's local ID and sets the
+// server-assigned ID it had
+func (s *Server) deleteService(service *models.EdgeService) error {
+	existing, err := s.storage.GetEdgeServiceByLocalID(service.EdgeID, service.LocalID)
+	if err != nil {
+		return err
+	}
+	service.ID = existing.ID
+
+	err = s.storage.Transaction(func(tx storage.Storage) error {
+		if err := tx.DeleteEdgeService(existing.ID); err != nil {
+			return fmt.Errorf("failed to delete service: %w", err)
+		}
+		return auditService(tx, models.AuditDeleted, MessageTypeServiceSync, existing, nil)
+	})
+	if err != nil {
+		return err
 	}
 
-	s.logger.Info("Service deleted", "service_id", id)
+	s.logger.Info("Service deleted", "service_id", existing.ID, "local_id", existing.LocalID)
+
+	s.publishService(events.ServiceDeleted, existing.EdgeID, existing.ID, nil)
 	return nil
 }
 
+// publishService publishes a service change reported by an edge
+func (s *Server) publishService(eventType, edgeID, id string, service *models.EdgeService) {
+	// Subscribers get a snapshot; the stored service may change later
+	if service != nil {
+		snapshot := *service
+		service = &snapshot
+	}
+	s.events.Publish(eventType, events.ServiceData{
+		ID:      id,
+		EdgeID:  edgeID,
+		Source:  events.SourceEdge,
+		Service: service,
+	})
+}
+
+// auditService appends a change an edge made to a service to the service
+// history. before is nil for creations and after for deletions; both are
+// copied as they are now.
+func auditService(tx storage.Storage, operation, via string, before, after *models.EdgeService) error {
+	entry := &models.ServiceAudit{
+		Operation: operation,
+		ActorType: models.ActorEdge,
+		Via:       via,
+	}
+	if before != nil {
+		snapshot := *before
+		entry.Before = &snapshot
+		entry.ServiceID, entry.EdgeID = before.ID, before.EdgeID
+	}
+	if after != nil {
+		snapshot := *after
+		entry.After = &snapshot
+		entry.ServiceID, entry.EdgeID = after.ID, after.EdgeID
+	}
+	entry.Actor = entry.EdgeID
+	if err := tx.CreateServiceAudit(entry); err != nil {
+		return fmt.Errorf("failed to record service change: %w", err)
+	}
+	return nil
+}
+
+// serviceChange is a committed change to publish after a batch sync
+type serviceChange struct {
+	eventType string
+	id        string
+	service   *models.EdgeService // nil for deletions
+}
+
+// sameServiceConfig reports whether two services have the same edge-managed fields
+func sameServiceConfig(a, b *models.EdgeService) bool {
+	return a.Name == b.Name &&
+		a.TunnelPort == b.TunnelPort &&
+		a.LocalHost == b.LocalHost &&
+		a.LocalPort == b.LocalPort &&
+		a.Protocol == b.Protocol &&
+		a.Options == b.Options &&
+		maps.Equal(a.Labels, b.Labels) &&
+		a.Enabled == b.Enabled
+}
+
 func (s *Server) sendServiceSyncAck(peer *PeerConnection, localID, serverID, status, errorMsg string) {
 	s.sendMessage(peer.Conn, &models.SignalingMessage{
 		Type: MessageTypeServiceSyncAck,
@@ -314,6 +606,9 @@ func (s *Server) sendServiceSyncAck(peer *PeerConnection, localID, serverID, sta
 	})
 }
 
+// parseEdgeService decodes a service sent by an edge. Edges identify services
+// by their local ID, sent as local_id or, by older edges, as id; the server
+// ID is never taken from the edge.
 func (s *Server) parseEdgeService(data map[string]interface{}) (*models.EdgeService, error) {
 	// Marshal and unmarshal to convert map to struct
 	jsonData, err := json.Marshal(data)
@@ -326,5 +621,10 @@ func (s *Server) parseEdgeService(data map[string]interface{}) (*models.EdgeServ
 		return nil, fmt.Errorf("failed to unmarshal service data: %w", err)
 	}
 
+	if service.LocalID == "" {
+		service.LocalID = service.ID
+	}
+	service.ID = ""
+
 	return &service, nil
 }
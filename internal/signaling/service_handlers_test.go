@@ -3,16 +3,21 @@ package signaling
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/arqut/arqut-server-ce/internal/events"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockStorage is a mock implementation of storage.Storage
 type MockStorage struct {
 	mock.Mock
+	audits []*models.ServiceAudit // Entries passed to CreateServiceAudit
 }
 
 func (m *MockStorage) Init() error {
@@ -30,11 +35,31 @@ func (m *MockStorage) UpdateEdgeService(service *models.EdgeService) error {
 	return args.Error(0)
 }
 
+func (m *MockStorage) UpdateServiceHealth(id string, health models.ServiceHealth) error {
+	args := m.Called(id, health)
+	return args.Error(0)
+}
+
 func (m *MockStorage) DeleteEdgeService(id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
+// Transaction runs fn directly against the mock
+func (m *MockStorage) Transaction(fn func(tx storage.Storage) error) error {
+	return fn(m)
+}
+
+func (m *MockStorage) UpsertEdgeService(service *models.EdgeService) (bool, error) {
+	args := m.Called(service)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) DeleteEdgeServices(edgeID string, ids []string) error {
+	args := m.Called(edgeID, ids)
+	return args.Error(0)
+}
+
 func (m *MockStorage) GetEdgeService(id string) (*models.EdgeService, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
@@ -43,6 +68,14 @@ func (m *MockStorage) GetEdgeService(id string) (*models.EdgeService, error) {
 	return args.Get(0).(*models.EdgeService), args.Error(1)
 }
 
+func (m *MockStorage) GetEdgeServiceByLocalID(edgeID, localID string) (*models.EdgeService, error) {
+	args := m.Called(edgeID, localID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.EdgeService), args.Error(1)
+}
+
 func (m *MockStorage) ListEdgeServices(edgeID string) ([]*models.EdgeService, error) {
 	args := m.Called(edgeID)
 	if args.Get(0) == nil {
@@ -67,11 +100,98 @@ func (m *MockStorage) ListAllServices() ([]*models.EdgeService, error) {
 	return args.Get(0).([]*models.EdgeService), args.Error(1)
 }
 
+func (m *MockStorage) ListServices(query storage.ServiceQuery) (*storage.ServicePage, error) {
+	args := m.Called(query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.ServicePage), args.Error(1)
+}
+
 func (m *MockStorage) Close() error {
 	args := m.Called()
 	return args.Error(0)
 }
 
+func (m *MockStorage) CreateWebhook(hook *models.Webhook) error {
+	return m.Called(hook).Error(0)
+}
+
+func (m *MockStorage) UpdateWebhook(hook *models.Webhook) error {
+	return m.Called(hook).Error(0)
+}
+
+func (m *MockStorage) DeleteWebhook(id string) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *MockStorage) GetWebhook(id string) (*models.Webhook, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *MockStorage) ListWebhooks() ([]*models.Webhook, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Webhook), args.Error(1)
+}
+
+// CreateServiceAudit records the entry without an expectation, so only tests
+// about the audit trail have to look at it
+func (m *MockStorage) CreateServiceAudit(entry *models.ServiceAudit) error {
+	m.audits = append(m.audits, entry)
+	return nil
+}
+
+func (m *MockStorage) ListServiceAudit(serviceID string) ([]*models.ServiceAudit, error) {
+	args := m.Called(serviceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.ServiceAudit), args.Error(1)
+}
+
+func (m *MockStorage) CreateAuditLog(entry *models.AuditLog) error {
+	return m.Called(entry).Error(0)
+}
+
+func (m *MockStorage) ListAuditLog(query storage.AuditLogQuery) (*storage.AuditLogPage, error) {
+	args := m.Called(query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.AuditLogPage), args.Error(1)
+}
+
+func (m *MockStorage) CreateWebhookDeadLetter(letter *models.WebhookDeadLetter) error {
+	return m.Called(letter).Error(0)
+}
+
+func (m *MockStorage) GetWebhookDeadLetter(id uint) (*models.WebhookDeadLetter, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookDeadLetter), args.Error(1)
+}
+
+func (m *MockStorage) ListWebhookDeadLetters(webhookID string) ([]*models.WebhookDeadLetter, error) {
+	args := m.Called(webhookID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.WebhookDeadLetter), args.Error(1)
+}
+
+func (m *MockStorage) DeleteWebhookDeadLetter(id uint) error {
+	return m.Called(id).Error(0)
+}
+
 func TestHandleServiceSync(t *testing.T) {
 	server, reg := setupTestServer(t)
 	mockStorage := new(MockStorage)
@@ -113,7 +233,11 @@ func TestHandleServiceSync(t *testing.T) {
 			},
 		}
 
-		mockStorage.On("CreateEdgeService", mock.AnythingOfType("*models.EdgeService")).Return(nil)
+		mockStorage.On("CreateEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
+			return svc.ID == "" && svc.LocalID == "svc-1"
+		})).Run(func(args mock.Arguments) {
+			args.Get(0).(*models.EdgeService).ID = "a1b2c3d4"
+		}).Return(nil)
 
 		server.handleServiceSync(peerConn, msg)
 
@@ -125,9 +249,11 @@ func TestHandleServiceSync(t *testing.T) {
 		ackMsg := mockConn.sentMessages[0]
 		assert.Equal(t, MessageTypeServiceSyncAck, ackMsg.Type)
 
-		// Check ack contains success status
+		// Check ack contains success status and maps the local ID to the server ID
 		ackData := ackMsg.Data.(map[string]interface{})
 		assert.Equal(t, "success", ackData["status"])
+		assert.Equal(t, "svc-1", ackData["localId"])
+		assert.Equal(t, "a1b2c3d4", ackData["serverId"])
 	})
 
 	t.Run("update service successfully", func(t *testing.T) {
@@ -135,7 +261,8 @@ func TestHandleServiceSync(t *testing.T) {
 		mockConn.sentMessages = nil
 
 		existingService := &models.EdgeService{
-			ID:         "svc-1",
+			ID:         "a1b2c3d4",
+			LocalID:    "svc-1",
 			EdgeID:     edgeID,
 			Name:       "Old Name",
 			TunnelPort: 8080,
@@ -162,8 +289,10 @@ func TestHandleServiceSync(t *testing.T) {
 			},
 		}
 
-		mockStorage.On("GetEdgeService", "svc-1").Return(existingService, nil)
-		mockStorage.On("UpdateEdgeService", mock.AnythingOfType("*models.EdgeService")).Return(nil)
+		mockStorage.On("GetEdgeServiceByLocalID", edgeID, "svc-1").Return(existingService, nil)
+		mockStorage.On("UpdateEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
+			return svc.ID == "a1b2c3d4" && svc.Name == "Updated Name"
+		})).Return(nil)
 
 		server.handleServiceSync(peerConn, msg)
 
@@ -174,6 +303,7 @@ func TestHandleServiceSync(t *testing.T) {
 		assert.Equal(t, 1, len(mockConn.sentMessages))
 		ackData := mockConn.sentMessages[0].Data.(map[string]interface{})
 		assert.Equal(t, "success", ackData["status"])
+		assert.Equal(t, "a1b2c3d4", ackData["serverId"])
 	})
 
 	t.Run("delete service successfully", func(t *testing.T) {
@@ -196,7 +326,9 @@ func TestHandleServiceSync(t *testing.T) {
 			},
 		}
 
-		mockStorage.On("DeleteEdgeService", "svc-1").Return(nil)
+		mockStorage.On("GetEdgeServiceByLocalID", edgeID, "svc-1").
+			Return(&models.EdgeService{ID: "a1b2c3d4", LocalID: "svc-1", EdgeID: edgeID}, nil)
+		mockStorage.On("DeleteEdgeService", "a1b2c3d4").Return(nil)
 
 		server.handleServiceSync(peerConn, msg)
 
@@ -385,18 +517,14 @@ func TestHandleServiceSyncBatch(t *testing.T) {
 			},
 		}
 
-		// Mock storage - first update fails (not found), then create succeeds
-		mockStorage.On("GetEdgeService", "svc-1").
-			Return(nil, errors.New("not found"))
-		mockStorage.On("CreateEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
-			return svc.ID == "svc-1"
-		})).Return(nil)
-
-		mockStorage.On("GetEdgeService", "svc-2").
-			Return(nil, errors.New("not found"))
-		mockStorage.On("CreateEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
-			return svc.ID == "svc-2"
-		})).Return(nil)
+		// Mock storage - the edge has no stored services, so both are created
+		mockStorage.On("ListEdgeServices", edgeID).Return([]*models.EdgeService{}, nil)
+		mockStorage.On("UpsertEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
+			return svc.LocalID == "svc-1"
+		})).Return(true, nil)
+		mockStorage.On("UpsertEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
+			return svc.LocalID == "svc-2"
+		})).Return(true, nil)
 
 		server.handleServiceSyncBatch(peerConn, msg)
 
@@ -509,11 +637,10 @@ func TestHandleServiceSyncBatch(t *testing.T) {
 		}
 
 		// Only the valid service should be created
-		mockStorage.On("GetEdgeService", "svc-ok").
-			Return(nil, errors.New("not found"))
-		mockStorage.On("CreateEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
-			return svc.ID == "svc-ok"
-		})).Return(nil)
+		mockStorage.On("ListEdgeServices", edgeID).Return([]*models.EdgeService{}, nil)
+		mockStorage.On("UpsertEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
+			return svc.LocalID == "svc-ok"
+		})).Return(true, nil)
 
 		server.handleServiceSyncBatch(peerConn, msg)
 
@@ -614,3 +741,299 @@ func TestHandleServiceListRequest(t *testing.T) {
 		assert.Equal(t, "error", mockConn.sentMessages[0].Type)
 	})
 }
+
+func TestHandleServiceSync_PublishesEvents(t *testing.T) {
+	server, reg := setupTestServer(t)
+	mockStorage := new(MockStorage)
+	server.storage = mockStorage
+
+	bus := events.NewBus(server.logger)
+	sub := bus.Subscribe(10, "service.*")
+	defer sub.Close()
+	server.SetEventBus(bus)
+
+	peer := &models.Peer{ID: "edge-1", Type: "edge"}
+	reg.AddPeer(peer)
+	peerConn := &PeerConnection{Peer: peer, Conn: &mockWebSocketConn{}}
+
+	sync := func(operation string) {
+		server.handleServiceSync(peerConn, &models.SignalingMessage{
+			Type: MessageTypeServiceSync,
+			Data: map[string]interface{}{
+				"operation": operation,
+				"service": map[string]interface{}{
+					"id":          "svc-1",
+					"name":        "web",
+					"tunnel_port": 8080,
+					"local_host":  "localhost",
+					"local_port":  3000,
+					"protocol":    "http",
+				},
+			},
+		})
+	}
+
+	mockStorage.On("CreateEdgeService", mock.AnythingOfType("*models.EdgeService")).Run(func(args mock.Arguments) {
+		args.Get(0).(*models.EdgeService).ID = "a1b2c3d4"
+	}).Return(nil)
+	mockStorage.On("GetEdgeServiceByLocalID", "edge-1", "svc-1").
+		Return(&models.EdgeService{ID: "a1b2c3d4", LocalID: "svc-1", EdgeID: "edge-1"}, nil)
+	mockStorage.On("DeleteEdgeService", "a1b2c3d4").Return(nil)
+	sync("created")
+	sync("deleted")
+
+	created := <-sub.Events()
+	assert.Equal(t, events.ServiceCreated, created.Type)
+	data := created.Data.(events.ServiceData)
+	assert.Equal(t, "a1b2c3d4", data.ID)
+	assert.Equal(t, "edge-1", data.EdgeID)
+	assert.Equal(t, events.SourceEdge, data.Source)
+	assert.Equal(t, "web", data.Service.Name)
+
+	deleted := <-sub.Events()
+	assert.Equal(t, events.ServiceDeleted, deleted.Type)
+	assert.Equal(t, events.ServiceData{ID: "a1b2c3d4", EdgeID: "edge-1", Source: events.SourceEdge}, deleted.Data)
+
+	require.Len(t, mockStorage.audits, 2)
+	for i, operation := range []string{models.AuditCreated, models.AuditDeleted} {
+		audit := mockStorage.audits[i]
+		assert.Equal(t, operation, audit.Operation)
+		assert.Equal(t, "a1b2c3d4", audit.ServiceID)
+		assert.Equal(t, models.ActorEdge, audit.ActorType)
+		assert.Equal(t, "edge-1", audit.Actor)
+		assert.Equal(t, MessageTypeServiceSync, audit.Via)
+	}
+}
+
+func TestPushServiceChange(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	edgeConn := &mockWebSocketConn{}
+	clientConn := &mockWebSocketConn{}
+	server.connections["edge-1"] = &PeerConnection{Peer: &models.Peer{ID: "edge-1", Type: "edge"}, Conn: edgeConn}
+	server.connections["client-1"] = &PeerConnection{Peer: &models.Peer{ID: "client-1", Type: "client"}, Conn: clientConn}
+
+	service := &models.EdgeService{ID: "svc-1", EdgeID: "edge-1", Name: "web"}
+
+	assert.True(t, server.PushServiceChange("edge-1", ServiceOpUpdated, service))
+	require.Len(t, edgeConn.sentMessages, 1)
+	msg := edgeConn.sentMessages[0]
+	assert.Equal(t, MessageTypeServicePush, msg.Type)
+	data := msg.Data.(map[string]interface{})
+	assert.Equal(t, ServiceOpUpdated, data["operation"])
+	assert.Equal(t, service, data["service"])
+
+	// Offline edges and non-edge peers are not pushed to
+	assert.False(t, server.PushServiceChange("edge-2", ServiceOpDeleted, service))
+	assert.False(t, server.PushServiceChange("client-1", ServiceOpDeleted, service))
+	assert.Empty(t, clientConn.sentMessages)
+}
+
+func TestHandleServiceSyncBatch_Reconcile(t *testing.T) {
+	server, reg := setupTestServer(t)
+	mockStorage := new(MockStorage)
+	server.storage = mockStorage
+
+	edgeID := "edge-1"
+	peer := &models.Peer{ID: edgeID, Type: "edge"}
+	reg.AddPeer(peer)
+
+	mockConn := &mockWebSocketConn{}
+	peerConn := &PeerConnection{Peer: peer, Conn: mockConn}
+
+	stored := func() []*models.EdgeService {
+		return []*models.EdgeService{
+			{ID: "srv-keep", LocalID: "keep", EdgeID: edgeID, Name: "Keep", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http", Enabled: true},
+			{ID: "srv-chg", LocalID: "change", EdgeID: edgeID, Name: "Change", TunnelPort: 8081, LocalHost: "localhost", LocalPort: 3001, Protocol: "http", Enabled: true},
+			{ID: "srv-g1", LocalID: "gone-1", EdgeID: edgeID, Name: "Gone 1", TunnelPort: 8082, LocalHost: "localhost", LocalPort: 3002, Protocol: "http"},
+			{ID: "srv-g2", LocalID: "gone-2", EdgeID: edgeID, Name: "Gone 2", TunnelPort: 8083, LocalHost: "localhost", LocalPort: 3003, Protocol: "http"},
+		}
+	}
+	entry := func(id, name string, tunnelPort int) map[string]interface{} {
+		return map[string]interface{}{
+			"id":          id,
+			"name":        name,
+			"tunnel_port": tunnelPort,
+			"local_host":  "localhost",
+			"local_port":  tunnelPort - 5080,
+			"protocol":    "http",
+			"enabled":     true,
+		}
+	}
+	batch := func(services ...interface{}) *models.SignalingMessage {
+		return &models.SignalingMessage{
+			Type: MessageTypeServiceSyncBatch,
+			From: edgeID,
+			Data: map[string]interface{}{"services": services},
+		}
+	}
+	ack := func() map[string]interface{} {
+		require.Len(t, mockConn.sentMessages, 1)
+		assert.Equal(t, MessageTypeServiceSyncAck, mockConn.sentMessages[0].Type)
+		return mockConn.sentMessages[0].Data.(map[string]interface{})
+	}
+	statuses := func(data map[string]interface{}) map[string]string {
+		out := map[string]string{}
+		for _, r := range data["results"].([]models.ServiceSyncResult) {
+			out[r.ID] = r.Status
+		}
+		return out
+	}
+
+	t.Run("creates, updates, keeps and deletes", func(t *testing.T) {
+		mockStorage.ExpectedCalls = nil
+		mockStorage.Calls = nil
+		mockConn.sentMessages = nil
+
+		services := stored()
+		mockStorage.On("ListEdgeServices", edgeID).Return(services, nil)
+		mockStorage.On("UpsertEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
+			return svc.LocalID == "change" && svc.Name == "Changed"
+		})).Run(func(args mock.Arguments) {
+			args.Get(0).(*models.EdgeService).ID = "srv-chg"
+		}).Return(false, nil)
+		mockStorage.On("UpsertEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
+			return svc.LocalID == "new" && svc.ID == ""
+		})).Run(func(args mock.Arguments) {
+			args.Get(0).(*models.EdgeService).ID = "srv-new"
+		}).Return(true, nil)
+		mockStorage.On("DeleteEdgeServices", edgeID, []string{"srv-g1", "srv-g2"}).Return(nil)
+
+		server.handleServiceSyncBatch(peerConn, batch(
+			entry("keep", "Keep", 8080),
+			entry("change", "Changed", 8081),
+			entry("new", "New", 8084),
+		))
+
+		mockStorage.AssertExpectations(t)
+		data := ack()
+		assert.Equal(t, "success", data["status"])
+		assert.Equal(t, 1, data["created"])
+		assert.Equal(t, 1, data["updated"])
+		assert.Equal(t, 1, data["unchanged"])
+		assert.Equal(t, 2, data["deleted"])
+		assert.Equal(t, 0, data["failed"])
+		assert.Equal(t, map[string]string{
+			"keep":   SyncStatusUnchanged,
+			"change": ServiceOpUpdated,
+			"new":    ServiceOpCreated,
+			"gone-1": ServiceOpDeleted,
+			"gone-2": ServiceOpDeleted,
+		}, statuses(data))
+
+		results := data["results"].([]models.ServiceSyncResult)
+		assert.Equal(t, "srv-keep", results[0].ServerID)
+		assert.Equal(t, "srv-new", results[2].ServerID)
+		assert.Equal(t, "srv-g1", results[3].ServerID)
+
+		// Every change is on record as made by the edge's batch sync
+		audits := map[string]*models.ServiceAudit{}
+		for _, a := range mockStorage.audits {
+			assert.Equal(t, models.ActorEdge, a.ActorType)
+			assert.Equal(t, edgeID, a.Actor)
+			assert.Equal(t, MessageTypeServiceSyncBatch, a.Via)
+			audits[a.ServiceID] = a
+		}
+		require.Len(t, audits, 4)
+		assert.Equal(t, models.AuditDeleted, audits["srv-g1"].Operation)
+		assert.Equal(t, "Gone 1", audits["srv-g1"].Before.Name)
+		assert.Nil(t, audits["srv-g1"].After)
+		assert.Equal(t, models.AuditDeleted, audits["srv-g2"].Operation)
+		assert.Equal(t, models.AuditUpdated, audits["srv-chg"].Operation)
+		assert.Equal(t, "Change", audits["srv-chg"].Before.Name)
+		assert.Equal(t, "Changed", audits["srv-chg"].After.Name)
+		assert.Equal(t, models.AuditCreated, audits["srv-new"].Operation)
+		assert.Nil(t, audits["srv-new"].Before)
+	})
+
+	t.Run("invalid entries keep their stored copy", func(t *testing.T) {
+		mockStorage.ExpectedCalls = nil
+		mockStorage.Calls = nil
+		mockConn.sentMessages = nil
+
+		mockStorage.On("ListEdgeServices", edgeID).Return(stored(), nil)
+		mockStorage.On("DeleteEdgeServices", edgeID, []string{"srv-g1", "srv-g2"}).Return(nil)
+
+		invalid := entry("change", "", 8081) // empty name
+		server.handleServiceSyncBatch(peerConn, batch(entry("keep", "Keep", 8080), invalid, entry("keep", "Keep", 8080)))
+
+		mockStorage.AssertExpectations(t)
+		data := ack()
+		assert.Equal(t, "partial", data["status"])
+		assert.Equal(t, 2, data["failed"])
+		results := data["results"].([]models.ServiceSyncResult)
+		assert.Equal(t, "duplicate service ID in batch", results[2].Error)
+		assert.Equal(t, 2, *results[2].Index)
+	})
+
+	t.Run("unidentified entries skip deletions", func(t *testing.T) {
+		mockStorage.ExpectedCalls = nil
+		mockStorage.Calls = nil
+		mockConn.sentMessages = nil
+
+		mockStorage.On("ListEdgeServices", edgeID).Return(stored(), nil)
+
+		server.handleServiceSyncBatch(peerConn, batch(entry("keep", "Keep", 8080), "not a service"))
+
+		mockStorage.AssertExpectations(t)
+		mockStorage.AssertNotCalled(t, "DeleteEdgeServices", mock.Anything, mock.Anything)
+		data := ack()
+		assert.Equal(t, "partial", data["status"])
+		assert.Equal(t, true, data["deletions_skipped"])
+		assert.Equal(t, 0, data["deleted"])
+	})
+
+	t.Run("failed delete rolls back the batch", func(t *testing.T) {
+		mockStorage.ExpectedCalls = nil
+		mockStorage.Calls = nil
+		mockConn.sentMessages = nil
+
+		services := stored()
+		mockStorage.On("ListEdgeServices", edgeID).Return(services[:1], nil)
+		mockStorage.On("DeleteEdgeServices", edgeID, []string{"srv-keep"}).Return(errors.New("database is locked"))
+
+		server.handleServiceSyncBatch(peerConn, batch())
+
+		require.Len(t, mockConn.sentMessages, 1)
+		assert.Equal(t, "error", mockConn.sentMessages[0].Type)
+	})
+
+	t.Run("conflicting entries fail individually", func(t *testing.T) {
+		mockStorage.ExpectedCalls = nil
+		mockStorage.Calls = nil
+		mockConn.sentMessages = nil
+
+		mockStorage.On("ListEdgeServices", edgeID).Return([]*models.EdgeService{}, nil)
+		mockStorage.On("UpsertEdgeService", mock.MatchedBy(func(svc *models.EdgeService) bool {
+			return svc.LocalID == "a"
+		})).Return(false, fmt.Errorf("service with tunnel port 8080 %w on edge %s", storage.ErrConflict, edgeID))
+
+		server.handleServiceSyncBatch(peerConn, batch(
+			entry("a", "A", 8080),
+			entry("b", "B", 8080), // Same tunnel port as a
+			entry("c", "A", 8081), // Same name as a
+		))
+
+		mockStorage.AssertExpectations(t)
+		data := ack()
+		assert.Equal(t, "partial", data["status"])
+		results := data["results"].([]models.ServiceSyncResult)
+		require.Len(t, results, 3)
+		assert.Equal(t, "service with tunnel port 8080 already exists on edge edge-1", results[0].Error)
+		assert.Equal(t, "duplicate tunnel port in batch", results[1].Error)
+		assert.Equal(t, "duplicate service name in batch", results[2].Error)
+	})
+
+	t.Run("storage error aborts the batch", func(t *testing.T) {
+		mockStorage.ExpectedCalls = nil
+		mockStorage.Calls = nil
+		mockConn.sentMessages = nil
+
+		mockStorage.On("ListEdgeServices", edgeID).Return(nil, errors.New("database is locked"))
+
+		server.handleServiceSyncBatch(peerConn, batch(entry("keep", "Keep", 8080)))
+
+		require.Len(t, mockConn.sentMessages, 1)
+		assert.Equal(t, "error", mockConn.sentMessages[0].Type)
+	})
+}
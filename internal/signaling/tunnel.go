@@ -0,0 +1,294 @@
+package signaling
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/tunnel"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Tunnel message types
+const (
+	MessageTypeTunnelOpen  = "tunnel:open"  // Server asks the edge to open a stream to a service
+	MessageTypeTunnelError = "tunnel:error" // Edge reports it could not open the stream
+)
+
+// pendingStream is a tunnel stream requested from an edge. The edge either
+// connects to the tunnel endpoint or reports an error; done is closed when
+// the requester stops waiting.
+type pendingStream struct {
+	edgeID string
+	result chan streamResult
+	done   chan struct{}
+}
+
+type streamResult struct {
+	conn net.Conn
+	err  error
+}
+
+// deliver hands the result to the requester. Returns false if it stopped waiting.
+func (p *pendingStream) deliver(result streamResult) bool {
+	select {
+	case p.result <- result:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// TunnelInfo describes the multiplexed tunnel session of an edge
+type TunnelInfo struct {
+	EdgeID string `json:"edge_id"`
+	tunnel.Stats
+}
+
+// DialService opens a stream to the service. Edges with a multiplexed
+// tunnel session get a new stream on it; otherwise the edge receives a
+// tunnel:open message over its signaling socket and connects the stream to
+// the tunnel endpoint.
+func (s *Server) DialService(ctx context.Context, service *models.EdgeService) (net.Conn, error) {
+	s.mu.RLock()
+	session := s.sessions[service.EdgeID]
+	edgeConn, exists := s.connections[service.EdgeID]
+	s.mu.RUnlock()
+
+	if session != nil {
+		return session.OpenService(ctx, service)
+	}
+
+	if !exists || edgeConn.Peer.Type != "edge" {
+		return nil, tunnel.ErrEdgeOffline
+	}
+
+	streamID, err := newStreamID()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := &pendingStream{
+		edgeID: service.EdgeID,
+		result: make(chan streamResult),
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.streams[streamID] = pending
+	s.mu.Unlock()
+
+	defer func() {
+		close(pending.done)
+		s.mu.Lock()
+		delete(s.streams, streamID)
+		s.mu.Unlock()
+	}()
+
+	if err := s.sendMessage(edgeConn.Conn, &models.SignalingMessage{
+		Type: MessageTypeTunnelOpen,
+		Data: tunnel.NewOpenRequest(streamID, service),
+	}); err != nil {
+		return nil, fmt.Errorf("sending tunnel request: %w", err)
+	}
+
+	select {
+	case result := <-pending.result:
+		return result.conn, result.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, tunnel.ErrTimeout
+		}
+		return nil, ctx.Err()
+	case <-edgeConn.Ctx.Done():
+		return nil, tunnel.ErrEdgeOffline
+	}
+}
+
+// newStreamID returns a random stream ID. It is only sent to the edge over
+// its signaling socket, so it also authenticates the tunnel connection.
+func newStreamID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating stream ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// takeStream removes and returns the pending stream if it was requested from edgeID
+func (s *Server) takeStream(streamID, edgeID string) *pendingStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, exists := s.streams[streamID]
+	if !exists || pending.edgeID != edgeID {
+		return nil
+	}
+	delete(s.streams, streamID)
+	return pending
+}
+
+// tunnelMiddleware validates tunnel stream upgrade requests
+func (s *Server) tunnelMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+
+		if c.Query("id") == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "missing id parameter",
+			})
+		}
+
+		s.mu.RLock()
+		pending, exists := s.streams[c.Params("stream")]
+		s.mu.RUnlock()
+		if !exists || pending.edgeID != c.Query("id") {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "unknown tunnel stream",
+			})
+		}
+
+		// Authorize the edge like its signaling socket
+		if ok, err := s.authorizePeer(c, "edge"); !ok {
+			return err
+		}
+
+		return c.Next()
+	}
+}
+
+// handleTunnel hands a stream opened by an edge to the waiting requester and
+// keeps the connection open until the stream is closed
+func (s *Server) handleTunnel() fiber.Handler {
+	return websocket.New(func(conn *websocket.Conn) {
+		streamID := conn.Params("stream")
+		edgeID := conn.Query("id")
+
+		pending := s.takeStream(streamID, edgeID)
+		if pending == nil {
+			conn.Close()
+			return
+		}
+
+		stream := tunnel.NewWSConn(conn)
+		if !pending.deliver(streamResult{conn: stream}) {
+			s.logger.Debug("Tunnel stream opened after the request gave up", "edge", edgeID, "stream", streamID)
+			stream.Close()
+			return
+		}
+
+		s.logger.Debug("Tunnel stream opened", "edge", edgeID, "stream", streamID)
+
+		select {
+		case <-stream.Done():
+		case <-s.ctx.Done():
+			stream.Close()
+		}
+	})
+}
+
+// handleTunnelError fails a pending stream the edge could not open
+func (s *Server) handleTunnelError(from *PeerConnection, msg *models.SignalingMessage) {
+	dataMap, ok := msg.Data.(map[string]interface{})
+	if !ok {
+		s.sendError(from.Conn, "Invalid tunnel error data")
+		return
+	}
+
+	streamID, _ := dataMap["streamId"].(string)
+	reason, _ := dataMap["error"].(string)
+
+	pending := s.takeStream(streamID, from.Peer.ID)
+	if pending == nil {
+		s.logger.Debug("Tunnel error for unknown stream", "edge", from.Peer.ID, "stream", streamID)
+		return
+	}
+
+	s.logger.Warn("Edge could not open tunnel stream", "edge", from.Peer.ID, "stream", streamID, "error", reason)
+	pending.deliver(streamResult{err: fmt.Errorf("edge could not open tunnel: %s", reason)})
+}
+
+// TunnelStats returns the multiplexed tunnel sessions ordered by edge ID
+func (s *Server) TunnelStats() []TunnelInfo {
+	s.mu.RLock()
+	infos := make([]TunnelInfo, 0, len(s.sessions))
+	for edgeID, session := range s.sessions {
+		infos = append(infos, TunnelInfo{EdgeID: edgeID, Stats: session.Stats()})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].EdgeID < infos[j].EdgeID
+	})
+	return infos
+}
+
+// sessionMiddleware validates tunnel session upgrade requests. Edges are
+// authenticated like on the signaling socket.
+func (s *Server) sessionMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+
+		if c.Query("id") == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "missing id parameter",
+			})
+		}
+
+		if ok, err := s.authorizePeer(c, "edge"); !ok {
+			return err
+		}
+
+		return c.Next()
+	}
+}
+
+// handleSession runs a multiplexed tunnel session for an edge. A new
+// session replaces the edge's previous one.
+func (s *Server) handleSession() fiber.Handler {
+	return websocket.New(func(conn *websocket.Conn) {
+		edgeID := conn.Query("id")
+		session := tunnel.NewSession(tunnel.NewWSConn(conn), tunnel.DefaultConfig())
+
+		s.mu.Lock()
+		old := s.sessions[edgeID]
+		s.sessions[edgeID] = session
+		s.mu.Unlock()
+
+		if old != nil {
+			s.logger.Warn("Duplicate tunnel session, closing old session", "edge", edgeID)
+			old.Close()
+		}
+		s.logger.Info("Tunnel session opened", "edge", edgeID)
+
+		select {
+		case <-session.Done():
+		case <-s.ctx.Done():
+			session.Close()
+		}
+
+		s.mu.Lock()
+		if s.sessions[edgeID] == session {
+			delete(s.sessions, edgeID)
+		}
+		s.mu.Unlock()
+
+		stats := session.Stats()
+		s.logger.Info("Tunnel session closed",
+			"edge", edgeID,
+			"streams", stats.TotalStreams,
+			"bytes_in", stats.BytesIn,
+			"bytes_out", stats.BytesOut,
+			"reason", session.Err(),
+		)
+	})
+}
@@ -0,0 +1,219 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/tunnel"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runFakeEdge answers tunnel:open requests by connecting the stream back and
+// echoing it. Services with local ID "refuse" are reported as unreachable,
+// those with "ignore" are never opened.
+func runFakeEdge(t *testing.T, conn *websocket.Conn, base, edgeID string) {
+	for {
+		var msg struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Type != MessageTypeTunnelOpen {
+			continue
+		}
+
+		var req tunnel.OpenRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			t.Errorf("invalid tunnel:open data: %v", err)
+			return
+		}
+
+		switch req.LocalID {
+		case "ignore":
+		case "refuse":
+			conn.WriteJSON(&models.SignalingMessage{
+				Type: MessageTypeTunnelError,
+				Data: map[string]string{"streamId": req.StreamID, "error": "connection refused"},
+			})
+		default:
+			ws, _, err := websocket.DefaultDialer.Dial(base+"/tunnel/"+req.StreamID+"?id="+edgeID, nil)
+			if err != nil {
+				t.Errorf("opening tunnel stream: %v", err)
+				return
+			}
+			go func() {
+				stream := tunnel.NewWSConn(ws)
+				defer stream.Close()
+				io.Copy(stream, stream)
+			}()
+		}
+	}
+}
+
+func TestDialService(t *testing.T) {
+	server, _ := setupTestServer(t)
+	defer server.Stop()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	server.RegisterRoutes(app.Group("/api/v1"))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	base := "ws://" + ln.Addr().String() + "/api/v1/signaling"
+	edge, _, err := websocket.DefaultDialer.Dial(base+"/ws/edge?id=edge-1", nil)
+	require.NoError(t, err)
+	defer edge.Close()
+	go runFakeEdge(t, edge, base, "edge-1")
+
+	require.Eventually(t, func() bool {
+		server.mu.RLock()
+		defer server.mu.RUnlock()
+		return server.connections["edge-1"] != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	service := func(localID string) *models.EdgeService {
+		return &models.EdgeService{
+			ID:        "abcd1234",
+			LocalID:   localID,
+			EdgeID:    "edge-1",
+			LocalHost: "localhost",
+			LocalPort: 8080,
+			Protocol:  models.ProtocolHTTP,
+		}
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		conn, err := server.DialService(ctx, service("web"))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+	})
+
+	t.Run("edge refuses", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		_, err := server.DialService(ctx, service("refuse"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "connection refused")
+	})
+
+	t.Run("edge does not answer", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := server.DialService(ctx, service("ignore"))
+		assert.ErrorIs(t, err, tunnel.ErrTimeout)
+
+		server.mu.RLock()
+		assert.Empty(t, server.streams)
+		server.mu.RUnlock()
+	})
+
+	t.Run("edge offline", func(t *testing.T) {
+		offline := service("web")
+		offline.EdgeID = "edge-2"
+		_, err := server.DialService(context.Background(), offline)
+		assert.ErrorIs(t, err, tunnel.ErrEdgeOffline)
+	})
+
+	t.Run("unknown stream", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(base+"/tunnel/0123456789abcdef?id=edge-1", nil)
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestTunnelSession(t *testing.T) {
+	server, _ := setupTestServer(t)
+	defer server.Stop()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	server.RegisterRoutes(app.Group("/api/v1"))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	// Fake edge: a session that accepts streams and echoes them after the open exchange
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/api/v1/signaling/tunnel?id=edge-1", nil)
+	require.NoError(t, err)
+	edge := tunnel.NewSession(tunnel.NewWSConn(ws), tunnel.Config{Client: true, AcceptStreams: true})
+	go func() {
+		for {
+			stream, err := edge.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer stream.Close()
+				req, err := tunnel.ReadOpenRequest(stream)
+				if err != nil {
+					return
+				}
+				tunnel.WriteOpenResponse(stream, nil)
+				stream.Write([]byte(req.LocalID + ":"))
+				io.Copy(stream, stream)
+			}()
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(server.TunnelStats()) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The edge has no signaling socket; the session alone serves the stream
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := server.DialService(ctx, &models.EdgeService{ID: "abcd1234", LocalID: "web", EdgeID: "edge-1"})
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, len("web:ping"))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "web:ping", string(buf))
+
+	stats := server.TunnelStats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "edge-1", stats[0].EdgeID)
+	assert.Equal(t, uint64(1), stats[0].TotalStreams)
+	assert.Equal(t, 1, stats[0].ActiveStreams)
+	// Byte counts include the open request and response lines
+	assert.Greater(t, stats[0].BytesOut, uint64(len("ping")))
+	assert.Equal(t, uint64(len("{}\n")+len("web:ping")), stats[0].BytesIn)
+	conn.Close()
+
+	// Once the edge disconnects, the session is dropped
+	edge.Close()
+	require.Eventually(t, func() bool {
+		return len(server.TunnelStats()) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err = server.DialService(context.Background(), &models.EdgeService{ID: "abcd1234", LocalID: "web", EdgeID: "edge-1"})
+	assert.ErrorIs(t, err, tunnel.ErrEdgeOffline)
+}
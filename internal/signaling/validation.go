@@ -2,20 +2,24 @@ package signaling
 
 import (
 	"fmt"
+	"net"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
 )
 
 var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)
 
-// validateService validates service data
-func validateService(service *models.EdgeService) error {
-	// ID: required, max 8 chars
-	if service.ID == "" {
+// ValidateService validates service data. It is shared by edge sync and the REST API.
+func ValidateService(service *models.EdgeService) error {
+	// LocalID: the edge's service ID, required, max 8 chars. The server ID is
+	// assigned by storage.
+	if service.LocalID == "" {
 		return fmt.Errorf("service ID is required")
 	}
-	if len(service.ID) > 8 {
+	if len(service.LocalID) > 8 {
 		return fmt.Errorf("service ID too long (max 8 characters)")
 	}
 
@@ -50,13 +54,97 @@ func validateService(service *models.EdgeService) error {
 		return fmt.Errorf("invalid local port: %d (must be 1-65535)", service.LocalPort)
 	}
 
-	// Protocol: http|websocket
-	validProtocols := map[string]bool{
-		"http":      true,
-		"websocket": true,
+	// Labels: at most 32, keys alphanumeric + dots/slashes/hyphens/underscores
+	if err := validateLabels(service.Labels); err != nil {
+		return err
 	}
-	if !validProtocols[service.Protocol] {
-		return fmt.Errorf("invalid protocol: %s (must be http or websocket)", service.Protocol)
+
+	// Protocol and its options
+	options, ok := protocolOptions[service.Protocol]
+	if !ok {
+		return fmt.Errorf("invalid protocol: %s (must be one of %s)", service.Protocol, strings.Join(Protocols, ", "))
+	}
+	return validateOptions(service.Protocol, &service.Options, options)
+}
+
+var labelKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9._/-]{1,63}$`)
+
+// validateLabels checks the number, keys and values of service labels
+func validateLabels(labels map[string]string) error {
+	if len(labels) > 32 {
+		return fmt.Errorf("too many labels (max 32)")
+	}
+	for key, value := range labels {
+		if !labelKeyRegex.MatchString(key) {
+			return fmt.Errorf("invalid label key: %q (1-63 alphanumeric, '.', '/', '-' or '_' characters)", key)
+		}
+		if len(value) > 255 {
+			return fmt.Errorf("label %s value too long (max 255 characters)", key)
+		}
+	}
+	return nil
+}
+
+// Protocols lists the supported service protocols
+var Protocols = []string{
+	models.ProtocolHTTP,
+	models.ProtocolHTTPS,
+	models.ProtocolWebSocket,
+	models.ProtocolGRPC,
+	models.ProtocolTCP,
+	models.ProtocolUDP,
+}
+
+// protocolOptions lists the options each protocol accepts, by JSON name
+var protocolOptions = map[string][]string{
+	models.ProtocolHTTP:      {"host_rewrite"},
+	models.ProtocolHTTPS:     {"tls_skip_verify", "sni", "host_rewrite"},
+	models.ProtocolWebSocket: {"host_rewrite"},
+	models.ProtocolGRPC:      {"tls", "tls_skip_verify", "sni"},
+	models.ProtocolTCP:       nil,
+	models.ProtocolUDP:       nil,
+}
+
+var hostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// validateOptions rejects options the protocol does not accept and checks
+// the values of the others
+func validateOptions(protocol string, opts *models.ServiceOptions, allowed []string) error {
+	set := map[string]bool{
+		"tls":             opts.TLS,
+		"tls_skip_verify": opts.TLSSkipVerify,
+		"sni":             opts.SNI != "",
+		"host_rewrite":    opts.HostRewrite != "",
+	}
+	for _, name := range allowed {
+		delete(set, name)
+	}
+	for _, name := range []string{"tls", "tls_skip_verify", "sni", "host_rewrite"} {
+		if set[name] {
+			return fmt.Errorf("option %s is not supported for protocol %s", name, protocol)
+		}
+	}
+
+	// gRPC speaks plaintext HTTP/2 unless tls is set
+	if protocol == models.ProtocolGRPC && !opts.TLS && (opts.TLSSkipVerify || opts.SNI != "") {
+		return fmt.Errorf("options tls_skip_verify and sni require tls for protocol grpc")
+	}
+
+	if opts.SNI != "" && (len(opts.SNI) > 253 || !hostnameRegex.MatchString(opts.SNI)) {
+		return fmt.Errorf("invalid sni: %s (must be a hostname)", opts.SNI)
+	}
+
+	if opts.HostRewrite != "" {
+		host := opts.HostRewrite
+		if h, port, err := net.SplitHostPort(host); err == nil {
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("invalid host_rewrite: %s (invalid port)", opts.HostRewrite)
+			}
+			host = h
+		}
+		if len(host) > 253 || !hostnameRegex.MatchString(host) {
+			return fmt.Errorf("invalid host_rewrite: %s (must be host or host:port)", opts.HostRewrite)
+		}
 	}
 
 	return nil
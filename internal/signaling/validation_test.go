@@ -17,7 +17,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "valid service",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       "my-service",
 				TunnelPort: 8080,
@@ -31,7 +31,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "valid service with underscores and hyphens",
 			service: &models.EdgeService{
-				ID:         "svc-456",
+				LocalID:    "svc-456",
 				EdgeID:     "edge-1",
 				Name:       "my_web-service_123",
 				TunnelPort: 8080,
@@ -45,7 +45,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "empty name",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       "",
 				TunnelPort: 8080,
@@ -59,7 +59,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "name too long",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       string(make([]byte, 256)),
 				TunnelPort: 8080,
@@ -73,7 +73,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "invalid name characters",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       "my service!",
 				TunnelPort: 8080,
@@ -87,7 +87,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "empty ID",
 			service: &models.EdgeService{
-				ID:         "",
+				LocalID:    "",
 				EdgeID:     "edge-1",
 				Name:       "my-service",
 				TunnelPort: 8080,
@@ -101,7 +101,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "empty edge ID",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "",
 				Name:       "my-service",
 				TunnelPort: 8080,
@@ -115,7 +115,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "empty local host",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       "my-service",
 				TunnelPort: 8080,
@@ -129,7 +129,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "invalid tunnel port - too low",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       "my-service",
 				TunnelPort: 0,
@@ -143,7 +143,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "invalid tunnel port - too high",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       "my-service",
 				TunnelPort: 65536,
@@ -157,7 +157,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "invalid local port",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       "my-service",
 				TunnelPort: 8080,
@@ -171,13 +171,13 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "invalid protocol",
 			service: &models.EdgeService{
-				ID:         "svc-123",
+				LocalID:    "svc-123",
 				EdgeID:     "edge-1",
 				Name:       "my-service",
 				TunnelPort: 8080,
 				LocalHost:  "localhost",
 				LocalPort:  3000,
-				Protocol:   "grpc",
+				Protocol:   "ftp",
 			},
 			expectError: true,
 			errorMsg:    "invalid protocol",
@@ -185,7 +185,7 @@ func TestValidateService(t *testing.T) {
 		{
 			name: "ID too long",
 			service: &models.EdgeService{
-				ID:         "svc-12345",
+				LocalID:    "svc-12345",
 				EdgeID:     "edge-1",
 				Name:       "my-service",
 				TunnelPort: 8080,
@@ -196,11 +196,40 @@ func TestValidateService(t *testing.T) {
 			expectError: true,
 			errorMsg:    "service ID too long",
 		},
+		{
+			name: "valid labels",
+			service: &models.EdgeService{
+				LocalID:    "svc-123",
+				EdgeID:     "edge-1",
+				Name:       "my-service",
+				TunnelPort: 8080,
+				LocalHost:  "localhost",
+				LocalPort:  3000,
+				Protocol:   "http",
+				Labels:     map[string]string{"env": "prod", "example.com/team": ""},
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid label key",
+			service: &models.EdgeService{
+				LocalID:    "svc-123",
+				EdgeID:     "edge-1",
+				Name:       "my-service",
+				TunnelPort: 8080,
+				LocalHost:  "localhost",
+				LocalPort:  3000,
+				Protocol:   "http",
+				Labels:     map[string]string{"team name": "a"},
+			},
+			expectError: true,
+			errorMsg:    "invalid label key",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateService(tt.service)
+			err := ValidateService(tt.service)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -213,3 +242,48 @@ func TestValidateService(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateServiceProtocols(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		options  models.ServiceOptions
+		errorMsg string
+	}{
+		{"tcp", "tcp", models.ServiceOptions{}, ""},
+		{"udp", "udp", models.ServiceOptions{}, ""},
+		{"https with options", "https", models.ServiceOptions{TLSSkipVerify: true, SNI: "api.internal", HostRewrite: "api.internal:8443"}, ""},
+		{"http host rewrite", "http", models.ServiceOptions{HostRewrite: "example.com"}, ""},
+		{"websocket host rewrite", "websocket", models.ServiceOptions{HostRewrite: "example.com"}, ""},
+		{"plaintext grpc", "grpc", models.ServiceOptions{}, ""},
+		{"grpc over tls", "grpc", models.ServiceOptions{TLS: true, SNI: "grpc.internal"}, ""},
+		{"tcp with sni", "tcp", models.ServiceOptions{SNI: "db.internal"}, "option sni is not supported for protocol tcp"},
+		{"udp with host rewrite", "udp", models.ServiceOptions{HostRewrite: "example.com"}, "option host_rewrite is not supported for protocol udp"},
+		{"http with tls", "http", models.ServiceOptions{TLSSkipVerify: true}, "option tls_skip_verify is not supported for protocol http"},
+		{"https with tls flag", "https", models.ServiceOptions{TLS: true}, "option tls is not supported for protocol https"},
+		{"grpc sni without tls", "grpc", models.ServiceOptions{SNI: "grpc.internal"}, "require tls"},
+		{"bad sni", "https", models.ServiceOptions{SNI: "not a host"}, "invalid sni"},
+		{"bad host rewrite", "https", models.ServiceOptions{HostRewrite: "example.com:0"}, "invalid host_rewrite"},
+		{"bad host rewrite host", "http", models.ServiceOptions{HostRewrite: "exa mple.com"}, "invalid host_rewrite"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateService(&models.EdgeService{
+				LocalID:    "svc-1",
+				EdgeID:     "edge-1",
+				Name:       "service",
+				TunnelPort: 8080,
+				LocalHost:  "localhost",
+				LocalPort:  3000,
+				Protocol:   tt.protocol,
+				Options:    tt.options,
+			})
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.errorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package storage
+
+import "errors"
+
+// Errors returned by Storage implementations, wrapped with context. Test for
+// them with errors.Is.
+var (
+	// ErrNotFound means the requested record does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict means the write collides with an existing record
+	ErrConflict = errors.New("already exists")
+
+	// ErrInvalidQuery means a list query has an unknown sort field, a
+	// malformed filter or a cursor from a different query
+	ErrInvalidQuery = errors.New("invalid query")
+)
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+)
+
+// Service sort fields for ServiceQuery.Sort
+const (
+	ServiceSortCreatedAt  = "created_at"
+	ServiceSortUpdatedAt  = "updated_at"
+	ServiceSortName       = "name"
+	ServiceSortEdgeID     = "edge_id"
+	ServiceSortTunnelPort = "tunnel_port"
+	ServiceSortID         = "id"
+)
+
+// ServiceSorts lists the valid ServiceQuery.Sort values
+var ServiceSorts = []string{
+	ServiceSortCreatedAt,
+	ServiceSortUpdatedAt,
+	ServiceSortName,
+	ServiceSortEdgeID,
+	ServiceSortTunnelPort,
+	ServiceSortID,
+}
+
+// ServiceQuery filters, orders and pages ListServices. Zero fields do not
+// filter.
+type ServiceQuery struct {
+	EdgeID     string
+	Enabled    *bool
+	Protocol   string
+	Health     string            // Health status
+	NamePrefix string            // Case-sensitive
+	Labels     map[string]string // All must match; an empty value matches any value of the key
+
+	Sort   string // One of ServiceSorts (default created_at); ties are ordered by ID
+	Desc   bool
+	Limit  int    // Page size; 0 returns all matching services
+	Cursor string // NextCursor of the previous page
+}
+
+// ServicePage is one page of ListServices
+type ServicePage struct {
+	Services   []*models.EdgeService
+	Total      int64  // Services matching the filters, on all pages
+	Offset     int    // Services on the pages before this one
+	NextCursor string // Empty on the last page
+}
+
+// AuditLogSortCreatedAt is the only sort field of ListAuditLog; entries are
+// ordered as they were written
+const AuditLogSortCreatedAt = "created_at"
+
+// AuditLogQuery filters and pages ListAuditLog. Zero fields do not filter.
+type AuditLogQuery struct {
+	Actor    string
+	ClientIP string
+	Method   string
+	Route    string    // Route pattern, e.g. /api/v1/services/:id
+	Since    time.Time // Inclusive
+	Until    time.Time // Exclusive
+
+	Desc   bool   // Newest first
+	Limit  int    // Page size; 0 returns all matching entries
+	Cursor string // NextCursor of the previous page
+}
+
+// AuditLogPage is one page of ListAuditLog
+type AuditLogPage struct {
+	Entries    []*models.AuditLog
+	Total      int64  // Entries matching the filters, on all pages
+	Offset     int    // Entries on the pages before this one
+	NextCursor string // Empty on the last page
+}
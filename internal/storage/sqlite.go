@@ -1,8 +1,18 @@
 package storage
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/arqut/arqut-server-ce/internal/pkg/cursor"
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
@@ -17,7 +27,8 @@ type SQLiteStorage struct {
 // NewSQLiteStorage creates a new SQLite storage instance
 func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent), // Suppress SQL logs
+		Logger:         logger.Default.LogMode(logger.Silent), // Suppress SQL logs
+		TranslateError: true,                                  // Map constraint violations to gorm.ErrDuplicatedKey
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -27,10 +38,24 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 	return storage, nil
 }
 
+// Transaction runs fn inside a database transaction
+func (s *SQLiteStorage) Transaction(fn func(tx Storage) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&SQLiteStorage{db: tx})
+	})
+}
+
 // Init initializes the database schema
 func (s *SQLiteStorage) Init() error {
-	// Auto-migrate the EdgeService model
-	if err := s.db.AutoMigrate(&models.EdgeService{}); err != nil {
+	if err := s.migrateLocalIDs(); err != nil {
+		return err
+	}
+	if err := s.checkDuplicateServices(); err != nil {
+		return err
+	}
+
+	// Auto-migrate the models
+	if err := s.db.AutoMigrate(&models.EdgeService{}, &models.Webhook{}, &models.WebhookDeadLetter{}, &models.ServiceAudit{}, &models.AuditLog{}); err != nil {
 		return fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
@@ -45,6 +70,69 @@ func (s *SQLiteStorage) Init() error {
 	return nil
 }
 
+// migrateLocalIDs adds the local_id column to databases created before
+// service IDs were assigned by the server. Edges used to pick the service ID
+// themselves, so it becomes the local ID of existing services.
+func (s *SQLiteStorage) migrateLocalIDs() error {
+	m := s.db.Migrator()
+	if !m.HasTable(&models.EdgeService{}) || m.HasColumn(&models.EdgeService{}, "LocalID") {
+		return nil
+	}
+
+	if err := s.db.Exec(`ALTER TABLE edge_services ADD COLUMN local_id varchar(8) NOT NULL DEFAULT ''`).Error; err != nil {
+		return fmt.Errorf("failed to add local_id column: %w", err)
+	}
+	if err := s.db.Exec(`UPDATE edge_services SET local_id = id`).Error; err != nil {
+		return fmt.Errorf("failed to populate local_id: %w", err)
+	}
+	return nil
+}
+
+// checkDuplicateServices fails with the offending rows if an edge has two
+// services with the same name or tunnel port, which older versions allowed.
+// AutoMigrate cannot create the per-edge unique indexes until they are
+// renamed or removed, and would only report a bare constraint error.
+func (s *SQLiteStorage) checkDuplicateServices() error {
+	m := s.db.Migrator()
+	if !m.HasTable(&models.EdgeService{}) {
+		return nil
+	}
+
+	var problems []string
+	for _, column := range []string{"name", "tunnel_port"} {
+		if m.HasIndex(&models.EdgeService{}, "idx_edge_services_"+column) {
+			continue
+		}
+
+		var rows []struct {
+			ID         string
+			EdgeID     string
+			Name       string
+			TunnelPort int
+		}
+		err := s.db.Raw(`
+			SELECT s.id, s.edge_id, s.name, s.tunnel_port FROM edge_services s
+			JOIN (SELECT edge_id, ` + column + ` AS value FROM edge_services
+				GROUP BY edge_id, ` + column + ` HAVING COUNT(*) > 1) d
+			ON s.edge_id = d.edge_id AND s.` + column + ` = d.value
+			ORDER BY s.edge_id, s.` + column + `, s.id
+		`).Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to check duplicate service %s: %w", column, err)
+		}
+		for _, r := range rows {
+			problems = append(problems, fmt.Sprintf("edge %s service %s (name %q, tunnel port %d) duplicates %s",
+				r.EdgeID, r.ID, r.Name, r.TunnelPort, column))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("services must be unique per edge by name and tunnel port; rename or remove duplicates before upgrading: %s: %w",
+			strings.Join(problems, "; "), ErrConflict)
+	}
+	return nil
+}
+
 // Close closes the database connection
 func (s *SQLiteStorage) Close() error {
 	sqlDB, err := s.db.DB()
@@ -54,18 +142,126 @@ func (s *SQLiteStorage) Close() error {
 	return sqlDB.Close()
 }
 
-// CreateEdgeService creates a new service entry
+// CreateEdgeService creates a new service entry. An empty ID is assigned by
+// the server and an empty LocalID defaults to it.
 func (s *SQLiteStorage) CreateEdgeService(service *models.EdgeService) error {
-	if err := s.db.Create(service).Error; err != nil {
-		return fmt.Errorf("failed to create service: %w", err)
-	}
-	return nil
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if service.ID == "" {
+			id, err := newServiceID(tx)
+			if err != nil {
+				return err
+			}
+			service.ID = id
+		}
+		if service.LocalID == "" {
+			service.LocalID = service.ID
+		}
+		if service.Health.Status == "" {
+			service.Health.Status = models.HealthUnknown
+		}
+		if err := checkServiceConflicts(tx, service); err != nil {
+			return err
+		}
+
+		if err := tx.Create(service).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return fmt.Errorf("service %s %w", service.ID, ErrConflict)
+			}
+			return fmt.Errorf("failed to create service: %w", err)
+		}
+		return nil
+	})
 }
 
-// UpdateEdgeService updates an existing service
+// healthColumns are the columns of models.ServiceHealth, which only
+// UpdateServiceHealth writes
+var healthColumns = []string{"health_status", "health_checked_at", "health_latency_ms", "health_error", "health_source"}
+
+// UpdateEdgeService updates an existing service. It never inserts: updating
+// a service that does not exist returns ErrNotFound. The stored health is
+// kept.
 func (s *SQLiteStorage) UpdateEdgeService(service *models.EdgeService) error {
-	if err := s.db.Save(service).Error; err != nil {
-		return fmt.Errorf("failed to update service: %w", err)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkServiceConflicts(tx, service); err != nil {
+			return err
+		}
+
+		result := tx.Model(service).Select("*").Omit(healthColumns...).Updates(service)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+				return fmt.Errorf("service %s %w", service.ID, ErrConflict)
+			}
+			return fmt.Errorf("failed to update service: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("service %w", ErrNotFound)
+		}
+		return nil
+	})
+}
+
+// UpsertEdgeService creates or updates the service with the given edge and
+// local ID atomically. The server ID, CreatedAt and health are kept for
+// existing services; UpdatedAt is always refreshed.
+func (s *SQLiteStorage) UpsertEdgeService(service *models.EdgeService) (bool, error) {
+	if service.LocalID == "" {
+		return false, fmt.Errorf("service local ID is required")
+	}
+
+	created := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		service.UpdatedAt = now
+
+		var existing models.EdgeService
+		result := tx.Where("edge_id = ? AND local_id = ?", service.EdgeID, service.LocalID).First(&existing)
+		switch {
+		case errors.Is(result.Error, gorm.ErrRecordNotFound):
+			id, err := newServiceID(tx)
+			if err != nil {
+				return err
+			}
+			service.ID = id
+			service.CreatedAt = now
+			service.Health = models.ServiceHealth{Status: models.HealthUnknown}
+			created = true
+		case result.Error != nil:
+			return fmt.Errorf("failed to get service: %w", result.Error)
+		default:
+			service.ID = existing.ID
+			service.CreatedAt = existing.CreatedAt
+			service.Health = existing.Health
+		}
+
+		if err := checkServiceConflicts(tx, service); err != nil {
+			return err
+		}
+		if err := tx.Save(service).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return fmt.Errorf("service %s %w", service.ID, ErrConflict)
+			}
+			return fmt.Errorf("failed to save service: %w", err)
+		}
+		return nil
+	})
+	return created, err
+}
+
+// UpdateServiceHealth records the health of a service without touching its
+// configuration or UpdatedAt
+func (s *SQLiteStorage) UpdateServiceHealth(id string, health models.ServiceHealth) error {
+	result := s.db.Model(&models.EdgeService{}).Where("id = ?", id).UpdateColumns(map[string]any{
+		"health_status":     health.Status,
+		"health_checked_at": health.CheckedAt,
+		"health_latency_ms": health.LatencyMs,
+		"health_error":      health.Error,
+		"health_source":     health.Source,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update service health: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("service %w", ErrNotFound)
 	}
 	return nil
 }
@@ -79,20 +275,54 @@ func (s *SQLiteStorage) DeleteEdgeService(id string) error {
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("service not found")
+		return fmt.Errorf("service %w", ErrNotFound)
 	}
 
 	return nil
 }
 
+// DeleteEdgeServices deletes several services of one edge in a single
+// transaction. If any of them no longer exists nothing is deleted.
+func (s *SQLiteStorage) DeleteEdgeServices(edgeID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.EdgeService{}, "edge_id = ? AND id IN ?", edgeID, ids)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete services: %w", result.Error)
+		}
+		if result.RowsAffected != int64(len(ids)) {
+			return fmt.Errorf("services changed during delete: %d of %d found: %w", result.RowsAffected, len(ids), ErrConflict)
+		}
+		return nil
+	})
+}
+
 // GetEdgeService retrieves a service by ID
 func (s *SQLiteStorage) GetEdgeService(id string) (*models.EdgeService, error) {
 	var service models.EdgeService
 	result := s.db.Where("id = ?", id).First(&service)
 
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("service not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("service %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get service: %w", result.Error)
+	}
+
+	return &service, nil
+}
+
+// GetEdgeServiceByLocalID retrieves a service by its edge-local ID
+func (s *SQLiteStorage) GetEdgeServiceByLocalID(edgeID, localID string) (*models.EdgeService, error) {
+	var service models.EdgeService
+	result := s.db.Where("edge_id = ? AND local_id = ?", edgeID, localID).First(&service)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("service %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get service: %w", result.Error)
 	}
@@ -138,3 +368,415 @@ func (s *SQLiteStorage) ListAllServices() ([]*models.EdgeService, error) {
 
 	return services, nil
 }
+
+// ListServices returns one page of the services matching query, ordered by
+// the sort field and then by ID. Filters and paging run in SQL; Total counts
+// the matches on all pages.
+func (s *SQLiteStorage) ListServices(query ServiceQuery) (*ServicePage, error) {
+	sortField := query.Sort
+	if sortField == "" {
+		sortField = ServiceSortCreatedAt
+	}
+	if !slices.Contains(ServiceSorts, sortField) {
+		return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, sortField)
+	}
+	if query.Limit < 0 {
+		return nil, fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+
+	db := s.db.Model(&models.EdgeService{})
+	if query.EdgeID != "" {
+		db = db.Where("edge_id = ?", query.EdgeID)
+	}
+	if query.Enabled != nil {
+		db = db.Where("enabled = ?", *query.Enabled)
+	}
+	if query.Protocol != "" {
+		db = db.Where("protocol = ?", query.Protocol)
+	}
+	if query.Health != "" {
+		db = db.Where("health_status = ?", query.Health)
+	}
+	if query.NamePrefix != "" {
+		// substr instead of LIKE, which is case-insensitive and treats % and _ as wildcards
+		db = db.Where("substr(name, 1, ?) = ?", utf8.RuneCountInString(query.NamePrefix), query.NamePrefix)
+	}
+	keys := make([]string, 0, len(query.Labels))
+	for key := range query.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "" || strings.ContainsAny(key, `"\`) {
+			return nil, fmt.Errorf("%w: label key %q", ErrInvalidQuery, key)
+		}
+		path := `$."` + key + `"`
+		if value := query.Labels[key]; value != "" {
+			db = db.Where("json_extract(labels, ?) = ?", path, value)
+		} else {
+			db = db.Where("json_extract(labels, ?) IS NOT NULL", path)
+		}
+	}
+	db = db.Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count services: %w", err)
+	}
+
+	page := &ServicePage{Total: total}
+	op, dir := ">", "ASC"
+	if query.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	find := db
+	if query.Cursor != "" {
+		c, err := cursor.Decode(query.Cursor, sortField, query.Desc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+		}
+		page.Offset = c.Offset
+
+		if sortField == ServiceSortID {
+			find = find.Where("id "+op+" ?", c.ID)
+		} else {
+			value, err := serviceCursorValue(c, sortField)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+			}
+			find = find.Where(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortField, op), value, value, c.ID)
+		}
+	}
+
+	find = find.Order(fmt.Sprintf("%s %s, id %s", sortField, dir, dir))
+	if query.Limit > 0 {
+		find = find.Limit(query.Limit + 1)
+	}
+
+	var services []*models.EdgeService
+	if err := find.Find(&services).Error; err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	if query.Limit > 0 && len(services) > query.Limit {
+		services = services[:query.Limit]
+		last := services[len(services)-1]
+		next, err := cursor.New(sortField, query.Desc, serviceSortValue(last, sortField), last.ID, page.Offset+len(services))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		page.NextCursor = next
+	}
+	page.Services = services
+	return page, nil
+}
+
+// serviceSortValue returns the value of a service's sort field
+func serviceSortValue(service *models.EdgeService, field string) any {
+	switch field {
+	case ServiceSortCreatedAt:
+		return service.CreatedAt
+	case ServiceSortUpdatedAt:
+		return service.UpdatedAt
+	case ServiceSortName:
+		return service.Name
+	case ServiceSortEdgeID:
+		return service.EdgeID
+	case ServiceSortTunnelPort:
+		return service.TunnelPort
+	default:
+		return service.ID
+	}
+}
+
+// serviceCursorValue decodes the sort value of a cursor into the type of
+// the sort field
+func serviceCursorValue(c *cursor.Cursor, field string) (any, error) {
+	switch field {
+	case ServiceSortCreatedAt, ServiceSortUpdatedAt:
+		var t time.Time
+		err := c.Unmarshal(&t)
+		return t, err
+	case ServiceSortTunnelPort:
+		var port int
+		err := c.Unmarshal(&port)
+		return port, err
+	default:
+		var value string
+		err := c.Unmarshal(&value)
+		return value, err
+	}
+}
+
+// checkServiceConflicts returns ErrConflict if another service of the same
+// edge uses the service's local ID, name or tunnel port. The unique indexes
+// enforce the same; this only produces a readable error.
+func checkServiceConflicts(tx *gorm.DB, service *models.EdgeService) error {
+	var other models.EdgeService
+	result := tx.Where("edge_id = ? AND id <> ? AND (local_id = ? OR name = ? OR tunnel_port = ?)",
+		service.EdgeID, service.ID, service.LocalID, service.Name, service.TunnelPort).
+		First(&other)
+	switch {
+	case errors.Is(result.Error, gorm.ErrRecordNotFound):
+		return nil
+	case result.Error != nil:
+		return fmt.Errorf("failed to check service conflicts: %w", result.Error)
+	case other.LocalID == service.LocalID:
+		return fmt.Errorf("service with local ID %q %w on edge %s", service.LocalID, ErrConflict, service.EdgeID)
+	case other.Name == service.Name:
+		return fmt.Errorf("service named %q %w on edge %s", service.Name, ErrConflict, service.EdgeID)
+	default:
+		return fmt.Errorf("service with tunnel port %d %w on edge %s", service.TunnelPort, ErrConflict, service.EdgeID)
+	}
+}
+
+// newServiceID returns a random service ID that is not in use
+func newServiceID(tx *gorm.DB) (string, error) {
+	for i := 0; i < 5; i++ {
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("failed to generate service ID: %w", err)
+		}
+		id := hex.EncodeToString(b)
+
+		var count int64
+		if err := tx.Model(&models.EdgeService{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check service ID: %w", err)
+		}
+		if count == 0 {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate a unique service ID")
+}
+
+// CreateWebhook creates a new webhook subscription
+func (s *SQLiteStorage) CreateWebhook(hook *models.Webhook) error {
+	if err := s.db.Create(hook).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("webhook %s %w", hook.ID, ErrConflict)
+		}
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// UpdateWebhook updates an existing webhook subscription. Updating one that
+// does not exist returns ErrNotFound.
+func (s *SQLiteStorage) UpdateWebhook(hook *models.Webhook) error {
+	result := s.db.Model(hook).Select("*").Updates(hook)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update webhook: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("webhook %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteWebhook deletes a webhook subscription and its dead letters
+func (s *SQLiteStorage) DeleteWebhook(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Webhook{}, "id = ?", id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete webhook: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("webhook %w", ErrNotFound)
+		}
+
+		if err := tx.Delete(&models.WebhookDeadLetter{}, "webhook_id = ?", id).Error; err != nil {
+			return fmt.Errorf("failed to delete dead letters: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetWebhook retrieves a webhook subscription by ID
+func (s *SQLiteStorage) GetWebhook(id string) (*models.Webhook, error) {
+	var hook models.Webhook
+	result := s.db.Where("id = ?", id).First(&hook)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("webhook %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", result.Error)
+	}
+
+	return &hook, nil
+}
+
+// ListWebhooks lists all webhook subscriptions
+func (s *SQLiteStorage) ListWebhooks() ([]*models.Webhook, error) {
+	var hooks []*models.Webhook
+	if err := s.db.Order("created_at").Find(&hooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// CreateServiceAudit appends an entry to the service change history
+func (s *SQLiteStorage) CreateServiceAudit(entry *models.ServiceAudit) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if err := s.db.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to create service audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListServiceAudit lists the change history of a service, newest first
+func (s *SQLiteStorage) ListServiceAudit(serviceID string) ([]*models.ServiceAudit, error) {
+	var entries []*models.ServiceAudit
+	result := s.db.Where("service_id = ?", serviceID).
+		Order("created_at DESC, id DESC").
+		Find(&entries)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list service audit entries: %w", result.Error)
+	}
+
+	return entries, nil
+}
+
+// CreateAuditLog appends an entry to the API audit log
+func (s *SQLiteStorage) CreateAuditLog(entry *models.AuditLog) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if err := s.db.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to create audit log entry: %w", err)
+	}
+	return nil
+}
+
+// ListAuditLog returns one page of the API audit log. Entries are ordered by
+// ID, which follows the order they were written in.
+func (s *SQLiteStorage) ListAuditLog(query AuditLogQuery) (*AuditLogPage, error) {
+	if query.Limit < 0 {
+		return nil, fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+
+	db := s.db.Model(&models.AuditLog{})
+	if query.Actor != "" {
+		db = db.Where("actor = ?", query.Actor)
+	}
+	if query.ClientIP != "" {
+		db = db.Where("client_ip = ?", query.ClientIP)
+	}
+	if query.Method != "" {
+		db = db.Where("method = ?", strings.ToUpper(query.Method))
+	}
+	if query.Route != "" {
+		db = db.Where("route = ?", query.Route)
+	}
+	if !query.Since.IsZero() {
+		db = db.Where("created_at >= ?", query.Since)
+	}
+	if !query.Until.IsZero() {
+		db = db.Where("created_at < ?", query.Until)
+	}
+	db = db.Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count audit log entries: %w", err)
+	}
+
+	page := &AuditLogPage{Total: total}
+	op, dir := ">", "ASC"
+	if query.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	find := db
+	if query.Cursor != "" {
+		c, err := cursor.Decode(query.Cursor, AuditLogSortCreatedAt, query.Desc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+		}
+		id, err := strconv.ParseUint(c.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, cursor.ErrInvalid)
+		}
+		page.Offset = c.Offset
+		find = find.Where("id "+op+" ?", id)
+	}
+
+	find = find.Order("id " + dir)
+	if query.Limit > 0 {
+		find = find.Limit(query.Limit + 1)
+	}
+
+	var entries []*models.AuditLog
+	if err := find.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list audit log entries: %w", err)
+	}
+
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+		last := entries[len(entries)-1]
+		next, err := cursor.New(AuditLogSortCreatedAt, query.Desc, last.CreatedAt, strconv.FormatUint(uint64(last.ID), 10), page.Offset+len(entries))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		page.NextCursor = next
+	}
+	page.Entries = entries
+	return page, nil
+}
+
+// CreateWebhookDeadLetter records an undeliverable webhook event
+func (s *SQLiteStorage) CreateWebhookDeadLetter(letter *models.WebhookDeadLetter) error {
+	if err := s.db.Create(letter).Error; err != nil {
+		return fmt.Errorf("failed to create dead letter: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookDeadLetter retrieves a dead letter by ID
+func (s *SQLiteStorage) GetWebhookDeadLetter(id uint) (*models.WebhookDeadLetter, error) {
+	var letter models.WebhookDeadLetter
+	result := s.db.Where("id = ?", id).First(&letter)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("dead letter %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", result.Error)
+	}
+
+	return &letter, nil
+}
+
+// ListWebhookDeadLetters lists the dead letters of a webhook, newest first
+func (s *SQLiteStorage) ListWebhookDeadLetters(webhookID string) ([]*models.WebhookDeadLetter, error) {
+	var letters []*models.WebhookDeadLetter
+	result := s.db.Where("webhook_id = ?", webhookID).
+		Order("created_at DESC, id DESC").
+		Find(&letters)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", result.Error)
+	}
+
+	return letters, nil
+}
+
+// DeleteWebhookDeadLetter deletes a dead letter by ID
+func (s *SQLiteStorage) DeleteWebhookDeadLetter(id uint) error {
+	result := s.db.Delete(&models.WebhookDeadLetter{}, "id = ?", id)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("dead letter %w", ErrNotFound)
+	}
+
+	return nil
+}
@@ -1,13 +1,18 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func setupTestStorage(t *testing.T) (*SQLiteStorage, func()) {
@@ -89,7 +94,7 @@ func TestCreateEdgeService_DuplicateID(t *testing.T) {
 	}
 
 	err = storage.CreateEdgeService(service2)
-	assert.Error(t, err) // Should fail due to primary key constraint
+	assert.ErrorIs(t, err, ErrConflict) // Should fail due to primary key constraint
 }
 
 func TestCreateEdgeService_DifferentEdgesSameLocalID(t *testing.T) {
@@ -167,6 +172,18 @@ func TestUpdateEdgeService(t *testing.T) {
 	assert.Equal(t, false, retrieved.Enabled)
 }
 
+func TestUpdateEdgeService_NotFound(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	err := storage.UpdateEdgeService(&models.EdgeService{ID: "svc-999", EdgeID: "edge-1", Name: "missing"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Updating must not insert
+	_, err = storage.GetEdgeService("svc-999")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
 func TestDeleteEdgeService(t *testing.T) {
 	storage, cleanup := setupTestStorage(t)
 	defer cleanup()
@@ -202,7 +219,7 @@ func TestDeleteEdgeService_NotFound(t *testing.T) {
 	defer cleanup()
 
 	err := storage.DeleteEdgeService("svc-999")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 	assert.Contains(t, err.Error(), "service not found")
 }
 
@@ -361,3 +378,554 @@ func TestListAllEnabledServices(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, enabledServices, 2) // Only enabled services (not disabled)
 }
+
+func TestWebhookCRUD(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	hook := &models.Webhook{
+		ID:      "wh-1",
+		URL:     "https://example.com/hook",
+		Events:  []string{"service.*", "peer.disconnected"},
+		Secret:  "s3cret",
+		Enabled: true,
+	}
+	require.NoError(t, storage.CreateWebhook(hook))
+
+	got, err := storage.GetWebhook("wh-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"service.*", "peer.disconnected"}, got.Events)
+	assert.Equal(t, "s3cret", got.Secret)
+
+	got.Enabled = false
+	require.NoError(t, storage.UpdateWebhook(got))
+
+	hooks, err := storage.ListWebhooks()
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.False(t, hooks[0].Enabled)
+
+	require.NoError(t, storage.DeleteWebhook("wh-1"))
+	_, err = storage.GetWebhook("wh-1")
+	assert.Contains(t, err.Error(), "webhook not found")
+	assert.ErrorIs(t, storage.DeleteWebhook("wh-1"), ErrNotFound)
+	assert.ErrorIs(t, storage.UpdateWebhook(got), ErrNotFound)
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	require.NoError(t, storage.CreateWebhook(&models.Webhook{ID: "wh-1", URL: "https://example.com/hook"}))
+
+	for i := 1; i <= 2; i++ {
+		require.NoError(t, storage.CreateWebhookDeadLetter(&models.WebhookDeadLetter{
+			WebhookID: "wh-1",
+			EventID:   uint64(i),
+			EventType: "service.deleted",
+			Payload:   `{}`,
+			Attempts:  5,
+			LastError: "connection refused",
+		}))
+	}
+
+	letters, err := storage.ListWebhookDeadLetters("wh-1")
+	require.NoError(t, err)
+	require.Len(t, letters, 2)
+	assert.Equal(t, uint64(2), letters[0].EventID, "newest first")
+
+	require.NoError(t, storage.DeleteWebhookDeadLetter(letters[0].ID))
+	_, err = storage.GetWebhookDeadLetter(letters[0].ID)
+	assert.Error(t, err)
+
+	// Deleting the webhook removes its dead letters
+	require.NoError(t, storage.DeleteWebhook("wh-1"))
+	letters, err = storage.ListWebhookDeadLetters("wh-1")
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func TestServiceAudit(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	service := &models.EdgeService{EdgeID: "edge-1", LocalID: "local-1", Name: "web", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http", Labels: map[string]string{"env": "prod"}}
+	require.NoError(t, storage.CreateEdgeService(service))
+	require.NoError(t, storage.CreateServiceAudit(&models.ServiceAudit{
+		ServiceID: service.ID,
+		EdgeID:    "edge-1",
+		Operation: models.AuditCreated,
+		ActorType: models.ActorEdge,
+		Actor:     "edge-1",
+		Via:       "service-sync",
+		After:     service,
+	}))
+
+	require.NoError(t, storage.DeleteEdgeService(service.ID))
+	require.NoError(t, storage.CreateServiceAudit(&models.ServiceAudit{
+		ServiceID: service.ID,
+		EdgeID:    "edge-1",
+		Operation: models.AuditDeleted,
+		ActorType: models.ActorAPIKey,
+		Actor:     "default",
+		Via:       "DELETE /api/v1/services/:id",
+		Before:    service,
+	}))
+
+	// The history outlives the service, newest first
+	entries, err := storage.ListServiceAudit(service.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, models.AuditDeleted, entries[0].Operation)
+	assert.Equal(t, models.ActorAPIKey, entries[0].ActorType)
+	assert.Nil(t, entries[0].After)
+	require.NotNil(t, entries[0].Before)
+	assert.Equal(t, "web", entries[0].Before.Name)
+	assert.Equal(t, map[string]string{"env": "prod"}, entries[0].Before.Labels)
+	assert.False(t, entries[0].CreatedAt.IsZero())
+
+	assert.Equal(t, models.AuditCreated, entries[1].Operation)
+	assert.Nil(t, entries[1].Before)
+	require.NotNil(t, entries[1].After)
+	assert.Equal(t, 8080, entries[1].After.TunnelPort)
+
+	entries, err = storage.ListServiceAudit("unknown")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestListAuditLog(t *testing.T) {
+	store, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		method := "POST"
+		if i%2 == 1 {
+			method = "DELETE"
+		}
+		require.NoError(t, store.CreateAuditLog(&models.AuditLog{
+			Actor:     "default",
+			ClientIP:  "10.0.0.1",
+			Method:    method,
+			Route:     "/api/v1/services/:id",
+			Path:      fmt.Sprintf("/api/v1/services/s%d", i),
+			Params:    map[string]any{"path": map[string]any{"id": fmt.Sprintf("s%d", i)}},
+			Status:    200,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+	require.NoError(t, store.CreateAuditLog(&models.AuditLog{Actor: "ops", ClientIP: "10.0.0.2", Method: "POST", Route: "/api/v1/admin/secrets", Path: "/api/v1/admin/secrets"}))
+
+	page, err := store.ListAuditLog(AuditLogQuery{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, page.Total)
+	assert.Equal(t, "/api/v1/services/s0", page.Entries[0].Path)
+	assert.Equal(t, map[string]any{"path": map[string]any{"id": "s0"}}, page.Entries[0].Params)
+
+	// Filters
+	for name, tc := range map[string]struct {
+		query AuditLogQuery
+		want  int64
+	}{
+		"actor":  {AuditLogQuery{Actor: "ops"}, 1},
+		"ip":     {AuditLogQuery{ClientIP: "10.0.0.1"}, 5},
+		"method": {AuditLogQuery{Method: "delete"}, 2},
+		"route":  {AuditLogQuery{Route: "/api/v1/admin/secrets"}, 1},
+		"since":  {AuditLogQuery{Since: start.Add(3 * time.Minute)}, 3},
+		"until":  {AuditLogQuery{Until: start.Add(2 * time.Minute)}, 2},
+	} {
+		page, err := store.ListAuditLog(tc.query)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.want, page.Total, name)
+		assert.Len(t, page.Entries, int(tc.want), name)
+	}
+
+	// Newest first, two at a time
+	var paths []string
+	query := AuditLogQuery{Desc: true, Limit: 2}
+	for {
+		page, err := store.ListAuditLog(query)
+		require.NoError(t, err)
+		assert.Equal(t, len(paths), page.Offset)
+		for _, entry := range page.Entries {
+			paths = append(paths, entry.Path)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{
+		"/api/v1/admin/secrets",
+		"/api/v1/services/s4",
+		"/api/v1/services/s3",
+		"/api/v1/services/s2",
+		"/api/v1/services/s1",
+		"/api/v1/services/s0",
+	}, paths)
+
+	// A cursor only fits the order it was made for
+	page, err = store.ListAuditLog(AuditLogQuery{Limit: 2})
+	require.NoError(t, err)
+	_, err = store.ListAuditLog(AuditLogQuery{Desc: true, Limit: 2, Cursor: page.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestDeleteEdgeServices(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	for _, svc := range []*models.EdgeService{
+		{ID: "svc-1", EdgeID: "edge-1", Name: "a", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http"},
+		{ID: "svc-2", EdgeID: "edge-1", Name: "b", TunnelPort: 8081, LocalHost: "localhost", LocalPort: 3001, Protocol: "http"},
+		{ID: "svc-3", EdgeID: "edge-2", Name: "c", TunnelPort: 8082, LocalHost: "localhost", LocalPort: 3002, Protocol: "http"},
+	} {
+		require.NoError(t, storage.CreateEdgeService(svc))
+	}
+
+	// A service of another edge aborts the whole delete
+	err := storage.DeleteEdgeServices("edge-1", []string{"svc-1", "svc-3"})
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = storage.GetEdgeService("svc-1")
+	assert.NoError(t, err, "rolled back")
+
+	require.NoError(t, storage.DeleteEdgeServices("edge-1", []string{"svc-1", "svc-2"}))
+	services, err := storage.ListEdgeServices("edge-1")
+	require.NoError(t, err)
+	assert.Empty(t, services)
+
+	_, err = storage.GetEdgeService("svc-3")
+	assert.NoError(t, err)
+	assert.NoError(t, storage.DeleteEdgeServices("edge-1", nil))
+}
+
+func TestUpsertEdgeService(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	service := &models.EdgeService{LocalID: "svc-1", EdgeID: "edge-1", Name: "web", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http"}
+	created, err := storage.UpsertEdgeService(service)
+	require.NoError(t, err)
+	assert.True(t, created)
+	id := service.ID
+	assert.Len(t, id, 8, "server-assigned ID")
+	createdAt := service.CreatedAt
+	assert.False(t, createdAt.IsZero())
+
+	update := &models.EdgeService{LocalID: "svc-1", EdgeID: "edge-1", Name: "web2", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http"}
+	created, err = storage.UpsertEdgeService(update)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, id, update.ID)
+
+	got, err := storage.GetEdgeService(id)
+	require.NoError(t, err)
+	assert.Equal(t, "web2", got.Name)
+	assert.True(t, got.CreatedAt.Equal(createdAt), "created_at is preserved")
+
+	// The same local ID on another edge is a different service
+	other := &models.EdgeService{LocalID: "svc-1", EdgeID: "edge-2", Name: "web", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http"}
+	created, err = storage.UpsertEdgeService(other)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.NotEqual(t, id, other.ID)
+
+	got, err = storage.GetEdgeServiceByLocalID("edge-2", "svc-1")
+	require.NoError(t, err)
+	assert.Equal(t, other.ID, got.ID)
+	_, err = storage.GetEdgeServiceByLocalID("edge-3", "svc-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = storage.UpsertEdgeService(&models.EdgeService{EdgeID: "edge-1", Name: "x"})
+	assert.Error(t, err, "local ID is required")
+}
+
+func TestUpdateServiceHealth(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	service := &models.EdgeService{EdgeID: "edge-1", Name: "web", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http"}
+	require.NoError(t, storage.CreateEdgeService(service))
+	assert.Equal(t, models.HealthUnknown, service.Health.Status)
+
+	got, err := storage.GetEdgeService(service.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.HealthUnknown, got.Health.Status)
+	updatedAt := got.UpdatedAt
+
+	checkedAt := time.Now()
+	health := models.ServiceHealth{Status: models.HealthDown, CheckedAt: &checkedAt, LatencyMs: 4.5, Error: "HTTP 502", Source: "probe"}
+	require.NoError(t, storage.UpdateServiceHealth(service.ID, health))
+
+	got, err = storage.GetEdgeService(service.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.HealthDown, got.Health.Status)
+	assert.Equal(t, 4.5, got.Health.LatencyMs)
+	assert.Equal(t, "HTTP 502", got.Health.Error)
+	assert.Equal(t, "probe", got.Health.Source)
+	require.NotNil(t, got.Health.CheckedAt)
+	assert.True(t, got.Health.CheckedAt.Equal(checkedAt))
+	assert.True(t, got.UpdatedAt.Equal(updatedAt), "updated_at is not touched")
+
+	// Configuration updates and syncs keep the health
+	got.Name = "web2"
+	got.Health = models.ServiceHealth{}
+	require.NoError(t, storage.UpdateEdgeService(got))
+	_, err = storage.UpsertEdgeService(&models.EdgeService{LocalID: service.LocalID, EdgeID: "edge-1", Name: "web3", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3000, Protocol: "http"})
+	require.NoError(t, err)
+
+	got, err = storage.GetEdgeService(service.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "web3", got.Name)
+	assert.Equal(t, models.HealthDown, got.Health.Status)
+	assert.Equal(t, "HTTP 502", got.Health.Error)
+
+	assert.ErrorIs(t, storage.UpdateServiceHealth("missing1", health), ErrNotFound)
+}
+
+func TestListServices(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, svc := range []struct {
+		edge, name, protocol string
+		enabled              bool
+		labels               map[string]string
+	}{
+		{"edge-1", "web", "http", true, map[string]string{"env": "prod", "team": "a"}},
+		{"edge-1", "Web2", "http", false, map[string]string{"env": "dev"}},
+		{"edge-1", "ssh", "tcp", true, nil},
+		{"edge-2", "web", "http", true, map[string]string{"env": "prod"}},
+		{"edge-2", "web_3", "grpc", true, nil},
+	} {
+		service := &models.EdgeService{
+			EdgeID: svc.edge, Name: svc.name, TunnelPort: 8000 + i, LocalHost: "localhost", LocalPort: 3000,
+			Protocol: svc.protocol, Enabled: svc.enabled, Labels: svc.labels,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, storage.CreateEdgeService(service))
+	}
+
+	names := func(page *ServicePage) []string {
+		var names []string
+		for _, svc := range page.Services {
+			names = append(names, svc.EdgeID+"/"+svc.Name)
+		}
+		return names
+	}
+
+	enabled := true
+	for _, tt := range []struct {
+		name  string
+		query ServiceQuery
+		want  []string
+	}{
+		{"all", ServiceQuery{}, []string{"edge-1/web", "edge-1/Web2", "edge-1/ssh", "edge-2/web", "edge-2/web_3"}},
+		{"edge", ServiceQuery{EdgeID: "edge-2"}, []string{"edge-2/web", "edge-2/web_3"}},
+		{"enabled", ServiceQuery{Enabled: &enabled, Protocol: "http"}, []string{"edge-1/web", "edge-2/web"}},
+		{"name prefix is case-sensitive and literal", ServiceQuery{NamePrefix: "web_"}, []string{"edge-2/web_3"}},
+		{"label value", ServiceQuery{Labels: map[string]string{"env": "prod"}}, []string{"edge-1/web", "edge-2/web"}},
+		{"label key", ServiceQuery{Labels: map[string]string{"env": "", "team": "a"}}, []string{"edge-1/web"}},
+		{"health", ServiceQuery{Health: models.HealthUp}, nil},
+		{"sort by name descending", ServiceQuery{Sort: ServiceSortName, Desc: true, EdgeID: "edge-1"}, []string{"edge-1/web", "edge-1/ssh", "edge-1/Web2"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := storage.ListServices(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, names(page))
+			assert.Equal(t, int64(len(tt.want)), page.Total)
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+
+	// Pages follow each other for every sort field, with ties broken by ID
+	for _, field := range ServiceSorts {
+		for _, desc := range []bool{false, true} {
+			all, err := storage.ListServices(ServiceQuery{Sort: field, Desc: desc})
+			require.NoError(t, err)
+
+			var paged []string
+			query := ServiceQuery{Sort: field, Desc: desc, Limit: 2}
+			for {
+				page, err := storage.ListServices(query)
+				require.NoError(t, err, field)
+				assert.Equal(t, int64(5), page.Total)
+				assert.Equal(t, len(paged), page.Offset)
+				paged = append(paged, names(page)...)
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			assert.Equal(t, names(all), paged, "sort %s desc=%v", field, desc)
+		}
+	}
+
+	// Cursors only continue the query they were made for
+	page, err := storage.ListServices(ServiceQuery{Sort: ServiceSortName, Limit: 1})
+	require.NoError(t, err)
+	_, err = storage.ListServices(ServiceQuery{Sort: ServiceSortName, Desc: true, Cursor: page.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = storage.ListServices(ServiceQuery{Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = storage.ListServices(ServiceQuery{Sort: "local_port"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = storage.ListServices(ServiceQuery{Labels: map[string]string{`a"b`: ""}})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestEdgeServiceConflicts(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	service := func(localID, name string, tunnelPort int) *models.EdgeService {
+		return &models.EdgeService{LocalID: localID, EdgeID: "edge-1", Name: name, TunnelPort: tunnelPort, LocalHost: "localhost", LocalPort: 3000, Protocol: "http"}
+	}
+
+	web := service("svc-1", "web", 8080)
+	require.NoError(t, storage.CreateEdgeService(web))
+	assert.Len(t, web.ID, 8)
+	require.NoError(t, storage.CreateEdgeService(service("svc-2", "api", 8081)))
+
+	tests := []struct {
+		name    string
+		localID string
+		svcName string
+		port    int
+		msg     string
+	}{
+		{"local ID", "svc-1", "db", 8082, `service with local ID "svc-1" already exists on edge edge-1`},
+		{"name", "svc-3", "web", 8082, `service named "web" already exists on edge edge-1`},
+		{"tunnel port", "svc-3", "db", 8080, "service with tunnel port 8080 already exists on edge edge-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := storage.CreateEdgeService(service(tt.localID, tt.svcName, tt.port))
+			assert.ErrorIs(t, err, ErrConflict)
+			assert.EqualError(t, err, tt.msg)
+		})
+	}
+
+	// An upsert of a new local ID must not take a name or port in use
+	_, err := storage.UpsertEdgeService(service("svc-3", "web", 8082))
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = storage.UpsertEdgeService(service("svc-3", "db", 8080))
+	assert.ErrorIs(t, err, ErrConflict)
+
+	// The unique indexes back up the checks
+	err = storage.db.Create(&models.EdgeService{ID: "raw", LocalID: "raw", EdgeID: "edge-1", Name: "raw", TunnelPort: 8081}).Error
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+
+	// Updates are checked against the other services only
+	web.TunnelPort = 8081
+	assert.ErrorIs(t, storage.UpdateEdgeService(web), ErrConflict)
+	web.TunnelPort = 8080
+	web.LocalPort = 4000
+	assert.NoError(t, storage.UpdateEdgeService(web))
+
+	// Other edges may reuse local IDs, names and tunnel ports
+	other := service("svc-1", "web", 8080)
+	other.EdgeID = "edge-2"
+	assert.NoError(t, storage.CreateEdgeService(other))
+}
+
+func TestMigrateLocalIDs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, legacy.Exec(`CREATE TABLE edge_services (
+		id varchar(8) PRIMARY KEY, edge_id varchar(64) NOT NULL, name varchar(128),
+		tunnel_port integer, local_host text, local_port integer, protocol varchar(10),
+		enabled numeric, created_at datetime, updated_at datetime)`).Error)
+	require.NoError(t, legacy.Exec(`INSERT INTO edge_services (id, edge_id, name, tunnel_port, local_host, local_port, protocol, enabled)
+		VALUES ('svc-1', 'edge-1', 'web', 8080, 'localhost', 3000, 'http', true)`).Error)
+	sqlDB, err := legacy.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+	require.NoError(t, storage.Init())
+
+	// The edge-chosen ID becomes the local ID
+	got, err := storage.GetEdgeServiceByLocalID("edge-1", "svc-1")
+	require.NoError(t, err)
+	assert.Equal(t, "svc-1", got.ID)
+	assert.Equal(t, "web", got.Name)
+
+	err = storage.CreateEdgeService(&models.EdgeService{LocalID: "svc-2", EdgeID: "edge-1", Name: "api", TunnelPort: 8080, LocalHost: "localhost", LocalPort: 3001, Protocol: "http"})
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestMigrateDuplicateServices(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, legacy.Exec(`CREATE TABLE edge_services (
+		id varchar(8) PRIMARY KEY, edge_id varchar(64) NOT NULL, name varchar(128),
+		tunnel_port integer, local_host text, local_port integer, protocol varchar(10),
+		enabled numeric, created_at datetime, updated_at datetime)`).Error)
+	require.NoError(t, legacy.Exec(`INSERT INTO edge_services (id, edge_id, name, tunnel_port, local_host, local_port, protocol, enabled) VALUES
+		('svc-1', 'edge-1', 'web', 8080, 'localhost', 3000, 'http', true),
+		('svc-2', 'edge-1', 'web', 8081, 'localhost', 3001, 'http', true),
+		('svc-3', 'edge-1', 'api', 8081, 'localhost', 3002, 'http', true),
+		('svc-4', 'edge-2', 'web', 8080, 'localhost', 3000, 'http', true)`).Error)
+	sqlDB, err := legacy.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	err = storage.Init()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Contains(t, err.Error(), `edge edge-1 service svc-1 (name "web", tunnel port 8080) duplicates name`)
+	assert.Contains(t, err.Error(), `edge edge-1 service svc-2 (name "web", tunnel port 8081) duplicates name`)
+	assert.Contains(t, err.Error(), `edge edge-1 service svc-2 (name "web", tunnel port 8081) duplicates tunnel_port`)
+	assert.Contains(t, err.Error(), `edge edge-1 service svc-3 (name "api", tunnel port 8081) duplicates tunnel_port`)
+	assert.NotContains(t, err.Error(), "svc-4")
+
+	// Starts once the duplicates are resolved
+	require.NoError(t, storage.db.Exec(`UPDATE edge_services SET name = 'web-2', tunnel_port = 8082 WHERE id = 'svc-2'`).Error)
+	require.NoError(t, storage.Init())
+	got, err := storage.GetEdgeServiceByLocalID("edge-1", "svc-2")
+	require.NoError(t, err)
+	assert.Equal(t, "web-2", got.Name)
+}
+
+func TestTransaction(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	service := func(id string, tunnelPort int) *models.EdgeService {
+		return &models.EdgeService{LocalID: id, EdgeID: "edge-1", Name: id, TunnelPort: tunnelPort, LocalHost: "localhost", LocalPort: 3000, Protocol: "http"}
+	}
+
+	// Rolled back on error
+	err := storage.Transaction(func(tx Storage) error {
+		require.NoError(t, tx.CreateEdgeService(service("svc-1", 8080)))
+		return errors.New("abort")
+	})
+	assert.EqualError(t, err, "abort")
+	_, err = storage.GetEdgeServiceByLocalID("edge-1", "svc-1")
+	assert.Error(t, err)
+
+	// Committed on success
+	err = storage.Transaction(func(tx Storage) error {
+		if err := tx.CreateEdgeService(service("svc-1", 8080)); err != nil {
+			return err
+		}
+		_, err := tx.UpsertEdgeService(service("svc-2", 8081))
+		return err
+	})
+	require.NoError(t, err)
+	services, err := storage.ListEdgeServices("edge-1")
+	require.NoError(t, err)
+	assert.Len(t, services, 2)
+}
@@ -10,12 +10,53 @@ type Storage interface {
 	// Close the storage connection
 	Close() error
 
-	// Service metadata management
-	CreateEdgeService(service *models.EdgeService) error
+	// Transaction runs fn with a Storage bound to a single transaction. The
+	// transaction commits if fn returns nil and rolls back otherwise.
+	Transaction(fn func(tx Storage) error) error
+
+	// Service metadata management. Lookups, updates and deletes of a missing
+	// service return ErrNotFound; reusing an ID, or a local ID, name or
+	// tunnel port of the same edge returns ErrConflict.
+	CreateEdgeService(service *models.EdgeService) error // Assigns the ID if empty
 	UpdateEdgeService(service *models.EdgeService) error
+	// UpsertEdgeService creates or updates the service identified by its
+	// edge and local ID, and sets the server-assigned ID.
+	UpsertEdgeService(service *models.EdgeService) (created bool, err error)
+	// UpdateServiceHealth records the last health check of a service; the
+	// other storage methods never change it.
+	UpdateServiceHealth(id string, health models.ServiceHealth) error
 	DeleteEdgeService(id string) error
+	DeleteEdgeServices(edgeID string, ids []string) error // All or nothing
 	GetEdgeService(id string) (*models.EdgeService, error)
+	GetEdgeServiceByLocalID(edgeID, localID string) (*models.EdgeService, error)
 	ListEdgeServices(edgeID string) ([]*models.EdgeService, error)
 	ListAllServices() ([]*models.EdgeService, error)
+	// ListServices returns one page of the services matching query; a bad
+	// query returns ErrInvalidQuery.
+	ListServices(query ServiceQuery) (*ServicePage, error)
 	ListAllEnabledServices() ([]*models.EdgeService, error)
+
+	// Append-only service change history. Entries are kept when their
+	// service is deleted; there is no way to change or remove them.
+	CreateServiceAudit(entry *models.ServiceAudit) error
+	ListServiceAudit(serviceID string) ([]*models.ServiceAudit, error) // Newest first
+
+	// Append-only audit log of authenticated API calls. ListAuditLog returns
+	// one page of the entries matching query; a bad query returns
+	// ErrInvalidQuery.
+	CreateAuditLog(entry *models.AuditLog) error
+	ListAuditLog(query AuditLogQuery) (*AuditLogPage, error)
+
+	// Outbound webhook subscriptions, with the same errors as services
+	CreateWebhook(hook *models.Webhook) error
+	UpdateWebhook(hook *models.Webhook) error
+	DeleteWebhook(id string) error
+	GetWebhook(id string) (*models.Webhook, error)
+	ListWebhooks() ([]*models.Webhook, error)
+
+	// Webhook dead-letter log
+	CreateWebhookDeadLetter(letter *models.WebhookDeadLetter) error
+	GetWebhookDeadLetter(id uint) (*models.WebhookDeadLetter, error)
+	ListWebhookDeadLetters(webhookID string) ([]*models.WebhookDeadLetter, error)
+	DeleteWebhookDeadLetter(id uint) error
 }
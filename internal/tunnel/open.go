@@ -0,0 +1,103 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+)
+
+// maxLineSize bounds the open request and response lines
+const maxLineSize = 64 * 1024
+
+// OpenResponse is the edge's answer to an OpenRequest on a session stream
+type OpenResponse struct {
+	Error string `json:"error,omitempty"` // Empty when the service was reached
+}
+
+// OpenService opens a stream to a service. The stream starts with the open
+// request as a JSON line; the edge connects to the service and answers with
+// an OpenResponse line, after which the stream carries the service's bytes.
+func (s *Session) OpenService(ctx context.Context, service *models.EdgeService) (net.Conn, error) {
+	stream, err := s.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	req := NewOpenRequest(strconv.FormatUint(uint64(stream.ID()), 10), service)
+	var resp OpenResponse
+	if err := writeLine(stream, req); err == nil {
+		err = readLine(stream, &resp)
+	}
+	if err != nil {
+		stream.Reset()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, err
+	}
+	if resp.Error != "" {
+		stream.Close()
+		return nil, fmt.Errorf("edge could not open tunnel: %s", resp.Error)
+	}
+
+	stream.SetDeadline(time.Time{})
+	return stream, nil
+}
+
+// ReadOpenRequest reads the open request at the start of a stream. Used by edges.
+func ReadOpenRequest(r io.Reader) (OpenRequest, error) {
+	var req OpenRequest
+	err := readLine(r, &req)
+	return req, err
+}
+
+// WriteOpenResponse answers an open request; a nil err reports success. Used by edges.
+func WriteOpenResponse(w io.Writer, err error) error {
+	var resp OpenResponse
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return writeLine(w, resp)
+}
+
+func writeLine(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// readLine decodes one JSON line. It reads byte by byte so nothing after
+// the line is consumed.
+func readLine(r io.Reader, v interface{}) error {
+	var line bytes.Buffer
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		if b[0] == '\n' {
+			break
+		}
+		if line.Len() >= maxLineSize {
+			return fmt.Errorf("open line exceeds %d bytes", maxLineSize)
+		}
+		line.WriteByte(b[0])
+	}
+	return json.Unmarshal(line.Bytes(), v)
+}
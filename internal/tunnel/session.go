@@ -0,0 +1,513 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Frames use the yamux layout so edges can use any yamux client: a 12 byte
+// header (version, type, flags, stream ID, length) followed, for data
+// frames, by length bytes of payload.
+const (
+	protoVersion uint8 = 0
+
+	typeData         uint8 = 0 // Length is the payload size
+	typeWindowUpdate uint8 = 1 // Length is the window increment
+	typePing         uint8 = 2 // Length is an opaque value echoed back
+	typeGoAway       uint8 = 3 // Length is the reason code
+
+	flagSYN uint16 = 1 // Opens a stream
+	flagACK uint16 = 2 // Acknowledges a stream or ping
+	flagFIN uint16 = 4 // Half-closes a stream
+	flagRST uint16 = 8 // Resets a stream
+
+	goAwayNormal        uint32 = 0
+	goAwayProtocolError uint32 = 1
+
+	headerSize = 12
+
+	// initialWindow is the receive window every stream starts with
+	initialWindow uint32 = 256 * 1024
+
+	// maxFramePayload bounds data frames so one stream cannot hog the connection
+	maxFramePayload = 64 * 1024
+
+	sendQueueSize      = 64
+	acceptBacklog      = 64
+	connWriteTimeout   = 10 * time.Second
+	pingTimeout        = 10 * time.Second
+	streamCloseTimeout = 30 * time.Second
+)
+
+var (
+	// ErrSessionClosed is returned for operations on a closed session
+	ErrSessionClosed = errors.New("tunnel session closed")
+
+	// ErrStreamClosed is returned for operations on a locally closed stream
+	ErrStreamClosed = errors.New("stream closed")
+
+	// ErrStreamReset is returned once the peer reset a stream
+	ErrStreamReset = errors.New("stream reset by peer")
+
+	// ErrProtocol is returned when the peer violates the framing or flow control
+	ErrProtocol = errors.New("tunnel protocol error")
+)
+
+// Config holds session settings
+type Config struct {
+	// Client selects odd stream IDs; it is set on the side that connected
+	Client bool
+
+	// AcceptStreams accepts streams opened by the peer; otherwise they are reset
+	AcceptStreams bool
+
+	// WindowSize is the receive window per stream (at least 256 KiB)
+	WindowSize uint32
+
+	// KeepAliveInterval is the time between pings (0 disables them). A ping
+	// that is not answered within 10 seconds closes the session.
+	KeepAliveInterval time.Duration
+}
+
+// DefaultConfig returns the settings used for edge sessions on the server
+func DefaultConfig() Config {
+	return Config{
+		WindowSize:        initialWindow,
+		KeepAliveInterval: 30 * time.Second,
+	}
+}
+
+// frame is a queued outgoing frame; done receives the write result if set
+type frame struct {
+	buf  []byte
+	done chan error
+}
+
+// Session multiplexes streams over a single connection
+type Session struct {
+	conn   net.Conn
+	config Config
+
+	mu       sync.Mutex
+	streams  map[uint32]*Stream
+	nextID   uint32
+	goAway   bool // The peer will not accept new streams
+	pings    map[uint32]chan struct{}
+	nextPing uint32
+
+	acceptCh chan *Stream
+	sendCh   chan *frame
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+
+	connectedAt  time.Time
+	totalStreams atomic.Uint64
+	bytesIn      atomic.Uint64
+	bytesOut     atomic.Uint64
+	rtt          atomic.Int64
+}
+
+// NewSession starts a session over conn
+func NewSession(conn net.Conn, cfg Config) *Session {
+	if cfg.WindowSize < initialWindow {
+		cfg.WindowSize = initialWindow
+	}
+
+	s := &Session{
+		conn:        conn,
+		config:      cfg,
+		streams:     make(map[uint32]*Stream),
+		nextID:      2,
+		pings:       make(map[uint32]chan struct{}),
+		acceptCh:    make(chan *Stream, acceptBacklog),
+		sendCh:      make(chan *frame, sendQueueSize),
+		done:        make(chan struct{}),
+		connectedAt: time.Now(),
+	}
+	if cfg.Client {
+		s.nextID = 1
+	}
+
+	go s.recvLoop()
+	go s.sendLoop()
+	if cfg.KeepAliveInterval > 0 {
+		go s.keepAlive()
+	}
+
+	return s
+}
+
+// Open opens a new stream and waits until the peer acknowledges it
+func (s *Session) Open(ctx context.Context) (*Stream, error) {
+	s.mu.Lock()
+	if s.isClosed() {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if s.goAway {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: peer is going away", ErrSessionClosed)
+	}
+	id := s.nextID
+	s.nextID += 2
+	stream := newStream(s, id)
+	s.streams[id] = stream
+	s.mu.Unlock()
+
+	s.totalStreams.Add(1)
+	stream.sendWindowUpdate(flagSYN)
+
+	select {
+	case <-stream.established:
+		stream.mu.Lock()
+		reset := stream.reset
+		stream.mu.Unlock()
+		if reset {
+			return nil, ErrStreamReset
+		}
+		return stream, nil
+	case <-ctx.Done():
+		stream.Reset()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Accept waits for a stream opened by the peer. Requires AcceptStreams.
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case stream := <-s.acceptCh:
+		return stream, nil
+	case <-s.done:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Ping measures the round trip time to the peer
+func (s *Session) Ping() (time.Duration, error) {
+	s.mu.Lock()
+	id := s.nextPing
+	s.nextPing++
+	ch := make(chan struct{})
+	s.pings[id] = ch
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pings, id)
+		s.mu.Unlock()
+	}()
+
+	start := time.Now()
+	s.sendControl(typePing, flagSYN, 0, id)
+
+	timer := time.NewTimer(pingTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ch:
+		rtt := time.Since(start)
+		s.rtt.Store(int64(rtt))
+		return rtt, nil
+	case <-timer.C:
+		return 0, fmt.Errorf("ping: %w", ErrTimeout)
+	case <-s.done:
+		return 0, ErrSessionClosed
+	}
+}
+
+// Close tells the peer the session is going away and closes it
+func (s *Session) Close() error {
+	if s.isClosed() {
+		return nil
+	}
+	s.sendAndWait(encodeHeader(typeGoAway, 0, 0, goAwayNormal))
+	s.closeWithError(ErrSessionClosed)
+	return nil
+}
+
+// Done is closed once the session is closed
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason the session closed, or nil while it is open
+func (s *Session) Err() error {
+	if !s.isClosed() {
+		return nil
+	}
+	return s.closeErr
+}
+
+// NumStreams returns the number of open streams
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+func (s *Session) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeWithError closes the connection and fails every stream
+func (s *Session) closeWithError(err error) {
+	s.closeOnce.Do(func() {
+		s.closeErr = err
+		close(s.done)
+		s.conn.Close()
+
+		s.mu.Lock()
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		s.mu.Unlock()
+
+		for _, stream := range streams {
+			stream.notifyAll()
+		}
+	})
+}
+
+// protocolError tells the peer why the session ends and closes it
+func (s *Session) protocolError(err error) {
+	s.sendControl(typeGoAway, 0, 0, goAwayProtocolError)
+	s.closeWithError(err)
+}
+
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+// recvLoop reads and dispatches frames until the connection fails
+func (s *Session) recvLoop() {
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(s.conn, header); err != nil {
+			if errors.Is(err, io.EOF) || s.isClosed() {
+				err = ErrSessionClosed
+			}
+			s.closeWithError(err)
+			return
+		}
+
+		if header[0] != protoVersion {
+			s.protocolError(fmt.Errorf("%w: unsupported version %d", ErrProtocol, header[0]))
+			return
+		}
+
+		typ := header[1]
+		flags := binary.BigEndian.Uint16(header[2:4])
+		id := binary.BigEndian.Uint32(header[4:8])
+		length := binary.BigEndian.Uint32(header[8:12])
+
+		var err error
+		switch typ {
+		case typeData, typeWindowUpdate:
+			err = s.handleStreamFrame(typ, flags, id, length)
+		case typePing:
+			s.handlePing(flags, length)
+		case typeGoAway:
+			s.mu.Lock()
+			s.goAway = true
+			s.mu.Unlock()
+		default:
+			err = fmt.Errorf("%w: unknown frame type %d", ErrProtocol, typ)
+		}
+		if err != nil {
+			if errors.Is(err, ErrProtocol) {
+				s.protocolError(err)
+			} else {
+				s.closeWithError(err)
+			}
+			return
+		}
+	}
+}
+
+// handleStreamFrame applies a data or window update frame to its stream
+func (s *Session) handleStreamFrame(typ uint8, flags uint16, id, length uint32) error {
+	if flags&flagSYN != 0 {
+		if err := s.incomingStream(id); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	stream := s.streams[id]
+	s.mu.Unlock()
+
+	if stream == nil {
+		// Late frames for a stream that is already gone
+		if typ == typeData && length > 0 {
+			if _, err := io.CopyN(io.Discard, s.conn, int64(length)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if typ == typeWindowUpdate {
+		stream.handleWindowUpdate(flags, length)
+		return nil
+	}
+	return stream.handleData(flags, length, s.conn)
+}
+
+// incomingStream registers a stream opened by the peer, or resets it
+func (s *Session) incomingStream(id uint32) error {
+	// The peer uses the other parity
+	if (id%2 == 1) == s.config.Client {
+		return fmt.Errorf("%w: stream %d has the wrong parity", ErrProtocol, id)
+	}
+
+	s.mu.Lock()
+	if _, exists := s.streams[id]; exists {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: duplicate stream %d", ErrProtocol, id)
+	}
+	if !s.config.AcceptStreams {
+		s.mu.Unlock()
+		s.sendControl(typeWindowUpdate, flagRST, id, 0)
+		return nil
+	}
+	stream := newStream(s, id)
+	s.streams[id] = stream
+	s.mu.Unlock()
+
+	select {
+	case s.acceptCh <- stream:
+		s.totalStreams.Add(1)
+		stream.sendWindowUpdate(flagACK)
+	default:
+		// Backlog full
+		s.removeStream(id)
+		s.sendControl(typeWindowUpdate, flagRST, id, 0)
+	}
+	return nil
+}
+
+// handlePing answers ping requests and completes our own pings
+func (s *Session) handlePing(flags uint16, value uint32) {
+	if flags&flagSYN != 0 {
+		s.sendControl(typePing, flagACK, 0, value)
+		return
+	}
+
+	s.mu.Lock()
+	ch, exists := s.pings[value]
+	delete(s.pings, value)
+	s.mu.Unlock()
+	if exists {
+		close(ch)
+	}
+}
+
+// keepAlive pings the peer and closes the session when it stops answering
+func (s *Session) keepAlive() {
+	ticker := time.NewTicker(s.config.KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Ping(); err != nil {
+				s.closeWithError(err)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// sendLoop writes queued frames in order. Each frame is written with a
+// single Write, so message-based transports carry one frame per message.
+func (s *Session) sendLoop() {
+	for {
+		select {
+		case f := <-s.sendCh:
+			s.conn.SetWriteDeadline(time.Now().Add(connWriteTimeout))
+			_, err := s.conn.Write(f.buf)
+			if f.done != nil {
+				f.done <- err
+			}
+			if err != nil {
+				s.closeWithError(err)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// sendControl queues a frame without waiting for it to be written
+func (s *Session) sendControl(typ uint8, flags uint16, id, length uint32) {
+	select {
+	case s.sendCh <- &frame{buf: encodeHeader(typ, flags, id, length)}:
+	case <-s.done:
+	}
+}
+
+// sendAndWait queues a frame and waits until it is written
+func (s *Session) sendAndWait(buf []byte) error {
+	f := &frame{buf: buf, done: make(chan error, 1)}
+	select {
+	case s.sendCh <- f:
+	case <-s.done:
+		return ErrSessionClosed
+	}
+
+	select {
+	case err := <-f.done:
+		return err
+	case <-s.done:
+		return ErrSessionClosed
+	}
+}
+
+// sendData writes a data frame carrying payload
+func (s *Session) sendData(id uint32, payload []byte) error {
+	buf := make([]byte, headerSize+len(payload))
+	putHeader(buf, typeData, 0, id, uint32(len(payload)))
+	copy(buf[headerSize:], payload)
+	if err := s.sendAndWait(buf); err != nil {
+		return err
+	}
+	s.bytesOut.Add(uint64(len(payload)))
+	return nil
+}
+
+func encodeHeader(typ uint8, flags uint16, id, length uint32) []byte {
+	buf := make([]byte, headerSize)
+	putHeader(buf, typ, flags, id, length)
+	return buf
+}
+
+func putHeader(buf []byte, typ uint8, flags uint16, id, length uint32) {
+	buf[0] = protoVersion
+	buf[1] = typ
+	binary.BigEndian.PutUint16(buf[2:4], flags)
+	binary.BigEndian.PutUint32(buf[4:8], id)
+	binary.BigEndian.PutUint32(buf[8:12], length)
+}
@@ -0,0 +1,294 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionPair connects a server session (opens streams) to an edge session (accepts them)
+func sessionPair(t *testing.T) (server, edge *Session) {
+	a, b := net.Pipe()
+	server = NewSession(a, Config{})
+	edge = NewSession(b, Config{Client: true, AcceptStreams: true})
+	t.Cleanup(func() {
+		server.Close()
+		edge.Close()
+	})
+	return server, edge
+}
+
+func openStream(t *testing.T, server, edge *Session) (local, remote *Stream) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	accepted := make(chan *Stream, 1)
+	go func() {
+		stream, err := edge.Accept()
+		if err == nil {
+			accepted <- stream
+		}
+	}()
+
+	local, err := server.Open(ctx)
+	require.NoError(t, err)
+	select {
+	case remote = <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream not accepted")
+	}
+	return local, remote
+}
+
+func TestSessionStreams(t *testing.T) {
+	server, edge := sessionPair(t)
+	local, remote := openStream(t, server, edge)
+
+	assert.Equal(t, uint32(2), local.ID(), "server streams use even IDs")
+	assert.Equal(t, local.ID(), remote.ID())
+
+	_, err := local.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(remote, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	// Half-close: the peer reads EOF and can still answer
+	require.NoError(t, local.CloseWrite())
+	_, err = remote.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = local.Write([]byte("x"))
+	assert.ErrorIs(t, err, ErrStreamClosed)
+
+	_, err = remote.Write([]byte("bye"))
+	require.NoError(t, err)
+	require.NoError(t, remote.Close())
+	reply, err := io.ReadAll(local)
+	require.NoError(t, err)
+	assert.Equal(t, "bye", string(reply))
+
+	// Released once both sides closed
+	assert.Eventually(t, func() bool {
+		return server.NumStreams() == 0 && edge.NumStreams() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// A second stream gets the next ID
+	local2, _ := openStream(t, server, edge)
+	assert.Equal(t, uint32(4), local2.ID())
+}
+
+func TestSessionFlowControl(t *testing.T) {
+	server, edge := sessionPair(t)
+	local, remote := openStream(t, server, edge)
+
+	// The writer blocks once the peer's window is full
+	data := make([]byte, int(initialWindow)+100*1024)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := local.Write(data)
+		written <- err
+	}()
+
+	assert.Eventually(t, func() bool {
+		return remote.Stats().Buffered == int(initialWindow)
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint32(0), local.Stats().SendWindow)
+	select {
+	case <-written:
+		t.Fatal("write finished although the window was exhausted")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Reading returns window to the writer
+	received := make([]byte, len(data))
+	_, err = io.ReadFull(remote, received)
+	require.NoError(t, err)
+	require.NoError(t, <-written)
+	assert.True(t, bytes.Equal(data, received))
+}
+
+func TestSessionLargeTransfer(t *testing.T) {
+	server, edge := sessionPair(t)
+	local, remote := openStream(t, server, edge)
+
+	data := make([]byte, 4*1024*1024)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	// Echo back
+	go func() {
+		io.Copy(remote, remote)
+		remote.Close()
+	}()
+	go func() {
+		local.Write(data)
+		local.CloseWrite()
+	}()
+
+	received, err := io.ReadAll(local)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, received))
+
+	stats := server.Stats()
+	assert.Equal(t, uint64(len(data)), stats.BytesOut)
+	assert.Equal(t, uint64(len(data)), stats.BytesIn)
+	assert.Equal(t, uint64(1), stats.TotalStreams)
+}
+
+func TestSessionReset(t *testing.T) {
+	server, edge := sessionPair(t)
+	local, remote := openStream(t, server, edge)
+
+	remote.Reset()
+	_, err := local.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrStreamReset)
+	_, err = local.Write([]byte("x"))
+	assert.ErrorIs(t, err, ErrStreamReset)
+}
+
+func TestSessionRejectsStreams(t *testing.T) {
+	a, b := net.Pipe()
+	server := NewSession(a, Config{})
+	edge := NewSession(b, Config{Client: true})
+	defer server.Close()
+	defer edge.Close()
+
+	// Neither side accepts streams, so the open is reset
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := edge.Open(ctx)
+	assert.ErrorIs(t, err, ErrStreamReset)
+	assert.Equal(t, 0, edge.NumStreams())
+}
+
+func TestSessionOpenTimeout(t *testing.T) {
+	// The peer never answers
+	a, b := net.Pipe()
+	defer b.Close()
+	go io.Copy(io.Discard, b)
+
+	server := NewSession(a, Config{})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := server.Open(ctx)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Equal(t, 0, server.NumStreams())
+}
+
+func TestSessionDeadlines(t *testing.T) {
+	server, edge := sessionPair(t)
+	local, _ := openStream(t, server, edge)
+
+	require.NoError(t, local.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err := local.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+}
+
+func TestSessionPingAndClose(t *testing.T) {
+	server, edge := sessionPair(t)
+	local, remote := openStream(t, server, edge)
+
+	rtt, err := server.Ping()
+	require.NoError(t, err)
+	assert.Greater(t, rtt, time.Duration(0))
+	assert.Greater(t, server.Stats().RTTMillis, 0.0)
+
+	// Closing the session fails blocked streams on both sides
+	require.NoError(t, server.Close())
+	_, err = local.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrSessionClosed)
+
+	select {
+	case <-edge.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("edge session not closed")
+	}
+	_, err = remote.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrSessionClosed)
+
+	_, err = server.Open(context.Background())
+	assert.ErrorIs(t, err, ErrSessionClosed)
+}
+
+func TestSessionProtocolError(t *testing.T) {
+	a, b := net.Pipe()
+	server := NewSession(a, Config{})
+	defer server.Close()
+
+	go io.Copy(io.Discard, b)
+	// Unknown frame version
+	b.Write([]byte{9, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0})
+
+	select {
+	case <-server.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not closed")
+	}
+	assert.ErrorIs(t, server.Err(), ErrProtocol)
+}
+
+func TestOpenService(t *testing.T) {
+	server, edge := sessionPair(t)
+
+	// Fake edge: refuses "db", echoes everything else
+	go func() {
+		for {
+			stream, err := edge.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer stream.Close()
+				req, err := ReadOpenRequest(stream)
+				if err != nil {
+					return
+				}
+				if req.LocalID == "db" {
+					WriteOpenResponse(stream, errors.New("connection refused"))
+					return
+				}
+				WriteOpenResponse(stream, nil)
+				stream.Write([]byte(req.ServiceID + ":"))
+				io.Copy(stream, stream)
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := server.OpenService(ctx, &models.EdgeService{ID: "abcd1234", LocalID: "web", EdgeID: "edge-1"})
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, len("abcd1234:ping"))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd1234:ping", string(buf))
+	conn.Close()
+
+	_, err = server.OpenService(ctx, &models.EdgeService{ID: "dbdbdbdb", LocalID: "db", EdgeID: "edge-1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+}
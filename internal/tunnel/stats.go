@@ -0,0 +1,54 @@
+package tunnel
+
+import (
+	"sort"
+	"time"
+)
+
+// Stats describes a session and its open streams
+type Stats struct {
+	ConnectedAt   time.Time     `json:"connected_at"`
+	ActiveStreams int           `json:"active_streams"`
+	TotalStreams  uint64        `json:"total_streams"` // Streams opened by either side since connecting
+	BytesIn       uint64        `json:"bytes_in"`      // Payload bytes received
+	BytesOut      uint64        `json:"bytes_out"`     // Payload bytes sent
+	RTTMillis     float64       `json:"rtt_ms"`        // Last ping round trip (0 before the first ping)
+	Streams       []StreamStats `json:"streams"`
+}
+
+// StreamStats describes one stream
+type StreamStats struct {
+	ID         uint32    `json:"id"`
+	OpenedAt   time.Time `json:"opened_at"`
+	BytesIn    uint64    `json:"bytes_in"`
+	BytesOut   uint64    `json:"bytes_out"`
+	SendWindow uint32    `json:"send_window"` // Bytes the peer can accept before it reads more
+	Buffered   int       `json:"buffered"`    // Received bytes not read yet
+}
+
+// Stats returns the session's counters
+func (s *Session) Stats() Stats {
+	s.mu.Lock()
+	streams := make([]*Stream, 0, len(s.streams))
+	for _, stream := range s.streams {
+		streams = append(streams, stream)
+	}
+	s.mu.Unlock()
+
+	stats := Stats{
+		ConnectedAt:   s.connectedAt,
+		ActiveStreams: len(streams),
+		TotalStreams:  s.totalStreams.Load(),
+		BytesIn:       s.bytesIn.Load(),
+		BytesOut:      s.bytesOut.Load(),
+		RTTMillis:     float64(s.rtt.Load()) / float64(time.Millisecond),
+		Streams:       make([]StreamStats, 0, len(streams)),
+	}
+	for _, stream := range streams {
+		stats.Streams = append(stats.Streams, stream.Stats())
+	}
+	sort.Slice(stats.Streams, func(i, j int) bool {
+		return stats.Streams[i].ID < stats.Streams[j].ID
+	})
+	return stats
+}
@@ -0,0 +1,353 @@
+package tunnel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stream is one multiplexed byte stream. It implements net.Conn; CloseWrite
+// half-closes it. The stream is released once both sides closed.
+type Stream struct {
+	id       uint32
+	session  *Session
+	openedAt time.Time
+
+	mu            sync.Mutex
+	recvBuf       bytes.Buffer
+	recvWindow    uint32 // Bytes the peer may still send
+	sendWindow    uint32 // Bytes we may still send
+	writeClosed   bool   // FIN sent
+	readClosed    bool   // Closed locally; received data is discarded
+	remoteClosed  bool   // FIN received
+	reset         bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	closeTimer    *time.Timer
+
+	recvNotify  chan struct{}
+	sendNotify  chan struct{}
+	established chan struct{}
+	estOnce     sync.Once
+
+	bytesIn  atomic.Uint64
+	bytesOut atomic.Uint64
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		id:          id,
+		session:     s,
+		openedAt:    time.Now(),
+		recvWindow:  initialWindow,
+		sendWindow:  initialWindow,
+		recvNotify:  make(chan struct{}, 1),
+		sendNotify:  make(chan struct{}, 1),
+		established: make(chan struct{}),
+	}
+}
+
+// ID returns the stream ID
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Read reads received bytes, blocking until data arrives, the peer closes
+// the stream or the read deadline passes
+func (st *Stream) Read(p []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.recvBuf.Len() > 0 {
+			n, _ := st.recvBuf.Read(p)
+			st.mu.Unlock()
+			st.sendWindowUpdate(0)
+			return n, nil
+		}
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return 0, ErrStreamReset
+		case st.remoteClosed:
+			st.mu.Unlock()
+			return 0, io.EOF
+		case st.readClosed:
+			st.mu.Unlock()
+			return 0, ErrStreamClosed
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := st.wait(st.recvNotify, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write sends p, blocking while the peer's receive window is exhausted
+func (st *Stream) Write(p []byte) (int, error) {
+	total := 0
+	for total < len(p) {
+		st.mu.Lock()
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return total, ErrStreamReset
+		case st.writeClosed:
+			st.mu.Unlock()
+			return total, ErrStreamClosed
+		}
+		if st.sendWindow == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err := st.wait(st.sendNotify, deadline); err != nil {
+				return total, err
+			}
+			continue
+		}
+		n := min(int(st.sendWindow), len(p)-total, maxFramePayload)
+		st.sendWindow -= uint32(n)
+		st.mu.Unlock()
+
+		if err := st.session.sendData(st.id, p[total:total+n]); err != nil {
+			return total, err
+		}
+		st.bytesOut.Add(uint64(n))
+		total += n
+	}
+	return total, nil
+}
+
+// CloseWrite half-closes the stream: the peer reads EOF once it has read
+// everything sent so far, and reads continue until the peer closes too
+func (st *Stream) CloseWrite() error {
+	st.mu.Lock()
+	if st.writeClosed || st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.writeClosed = true
+	release := st.remoteClosed
+	st.mu.Unlock()
+
+	st.notifyAll()
+	st.session.sendControl(typeWindowUpdate, flagFIN, st.id, 0)
+	if release {
+		st.session.removeStream(st.id)
+	}
+	return nil
+}
+
+// Close closes the stream in both directions. Unread data is discarded. If
+// the peer does not close its side in time the stream is reset.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.readClosed || st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.readClosed = true
+	st.recvBuf.Reset()
+	if !st.remoteClosed {
+		st.closeTimer = time.AfterFunc(streamCloseTimeout, func() { st.Reset() })
+	}
+	st.mu.Unlock()
+
+	st.notifyAll()
+	return st.CloseWrite()
+}
+
+// Reset aborts the stream in both directions
+func (st *Stream) Reset() {
+	st.mu.Lock()
+	if st.reset {
+		st.mu.Unlock()
+		return
+	}
+	st.reset = true
+	if st.closeTimer != nil {
+		st.closeTimer.Stop()
+	}
+	st.mu.Unlock()
+
+	st.notifyAll()
+	st.session.sendControl(typeWindowUpdate, flagRST, st.id, 0)
+	st.session.removeStream(st.id)
+}
+
+// handleData buffers a data frame's payload read from r
+func (st *Stream) handleData(flags uint16, length uint32, r io.Reader) error {
+	if length > 0 {
+		// Cheap bound before allocating; the exact window is checked below
+		if length > st.session.config.WindowSize {
+			return fmt.Errorf("%w: stream %d exceeded its receive window", ErrProtocol, st.id)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+
+		// Window and buffer change together so window updates never count
+		// bytes twice
+		st.mu.Lock()
+		if length > st.recvWindow {
+			st.mu.Unlock()
+			return fmt.Errorf("%w: stream %d exceeded its receive window", ErrProtocol, st.id)
+		}
+		st.recvWindow -= length
+		if !st.readClosed {
+			st.recvBuf.Write(payload)
+		}
+		st.mu.Unlock()
+
+		st.bytesIn.Add(uint64(length))
+		st.session.bytesIn.Add(uint64(length))
+		notify(st.recvNotify)
+	}
+
+	st.handleFlags(flags)
+	return nil
+}
+
+// handleWindowUpdate grows the send window
+func (st *Stream) handleWindowUpdate(flags uint16, delta uint32) {
+	st.handleFlags(flags)
+	if delta == 0 {
+		return
+	}
+
+	st.mu.Lock()
+	st.sendWindow += delta
+	st.mu.Unlock()
+	notify(st.sendNotify)
+}
+
+// handleFlags applies the ACK, FIN and RST flags of a frame
+func (st *Stream) handleFlags(flags uint16) {
+	if flags&(flagACK|flagRST) != 0 {
+		st.mu.Lock()
+		if flags&flagRST != 0 {
+			st.reset = true
+			if st.closeTimer != nil {
+				st.closeTimer.Stop()
+			}
+		}
+		st.mu.Unlock()
+		st.estOnce.Do(func() { close(st.established) })
+	}
+
+	if flags&flagRST != 0 {
+		st.notifyAll()
+		st.session.removeStream(st.id)
+		return
+	}
+
+	if flags&flagFIN != 0 {
+		st.mu.Lock()
+		st.remoteClosed = true
+		release := st.writeClosed
+		if release && st.closeTimer != nil {
+			st.closeTimer.Stop()
+		}
+		st.mu.Unlock()
+
+		st.notifyAll()
+		if release {
+			st.session.removeStream(st.id)
+		}
+	}
+}
+
+// sendWindowUpdate returns consumed receive window to the peer once at
+// least half of it is used up. Frames with flags (SYN, ACK) are always sent.
+func (st *Stream) sendWindowUpdate(flags uint16) {
+	st.mu.Lock()
+	max := st.session.config.WindowSize
+	delta := max - uint32(st.recvBuf.Len()) - st.recvWindow
+	if flags == 0 && delta < max/2 {
+		st.mu.Unlock()
+		return
+	}
+	st.recvWindow += delta
+	st.mu.Unlock()
+
+	st.session.sendControl(typeWindowUpdate, flags, st.id, delta)
+}
+
+// wait blocks until ch is signaled, the deadline passes or the session closes
+func (st *Stream) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-st.session.done:
+		return ErrSessionClosed
+	}
+}
+
+// notifyAll wakes blocked readers and writers so they recheck the state
+func (st *Stream) notifyAll() {
+	notify(st.recvNotify)
+	notify(st.sendNotify)
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the stream's counters
+func (st *Stream) Stats() StreamStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return StreamStats{
+		ID:         st.id,
+		OpenedAt:   st.openedAt,
+		BytesIn:    st.bytesIn.Load(),
+		BytesOut:   st.bytesOut.Load(),
+		SendWindow: st.sendWindow,
+		Buffered:   st.recvBuf.Len(),
+	}
+}
+
+func (st *Stream) LocalAddr() net.Addr  { return st.session.conn.LocalAddr() }
+func (st *Stream) RemoteAddr() net.Addr { return st.session.conn.RemoteAddr() }
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	notify(st.recvNotify)
+	return nil
+}
+
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	notify(st.sendNotify)
+	return nil
+}
@@ -0,0 +1,46 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+)
+
+// ErrEdgeOffline is returned when the edge owning a service is not connected
+var ErrEdgeOffline = errors.New("edge is not connected")
+
+// ErrTimeout is returned when the edge does not open a stream in time
+var ErrTimeout = errors.New("timed out waiting for the edge to open a tunnel")
+
+// Dialer opens byte streams to edge services. The edge connects the stream
+// to the service's local address; for https services it also terminates TLS
+// so the stream always carries plaintext HTTP.
+type Dialer interface {
+	DialService(ctx context.Context, service *models.EdgeService) (net.Conn, error)
+}
+
+// OpenRequest asks an edge to open a stream to one of its services
+type OpenRequest struct {
+	StreamID  string                `json:"streamId"`
+	ServiceID string                `json:"serviceId"` // Server-assigned ID
+	LocalID   string                `json:"localId"`   // The edge's own service ID
+	Protocol  string                `json:"protocol"`
+	LocalHost string                `json:"localHost"`
+	LocalPort int                   `json:"localPort"`
+	Options   models.ServiceOptions `json:"options"`
+}
+
+// NewOpenRequest builds the open request for a service
+func NewOpenRequest(streamID string, service *models.EdgeService) OpenRequest {
+	return OpenRequest{
+		StreamID:  streamID,
+		ServiceID: service.ID,
+		LocalID:   service.LocalID,
+		Protocol:  service.Protocol,
+		LocalHost: service.LocalHost,
+		LocalPort: service.LocalPort,
+		Options:   service.Options,
+	}
+}
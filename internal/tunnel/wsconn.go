@@ -0,0 +1,113 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+// closeWait bounds the close frame sent when a stream is closed
+const closeWait = time.Second
+
+// WebSocketConn is the part of a WebSocket connection a stream uses
+type WebSocketConn interface {
+	NextReader() (messageType int, r io.Reader, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	Close() error
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// WSConn carries a byte stream over a WebSocket as binary messages. Message
+// boundaries are not significant. A normal close from the peer reads as io.EOF.
+type WSConn struct {
+	ws      WebSocketConn
+	readMu  sync.Mutex
+	reader  io.Reader
+	writeMu sync.Mutex
+	once    sync.Once
+	done    chan struct{}
+}
+
+// NewWSConn wraps a WebSocket connection as a net.Conn
+func NewWSConn(ws WebSocketConn) *WSConn {
+	return &WSConn{ws: ws, done: make(chan struct{})}
+}
+
+// Read reads stream bytes, spanning message boundaries
+func (c *WSConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for {
+		if c.reader == nil {
+			_, r, err := c.ws.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			c.reader = r
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Write sends p as one binary message
+func (c *WSConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends a close frame and closes the WebSocket
+func (c *WSConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(closeWait),
+		)
+		err = c.ws.Close()
+		close(c.done)
+	})
+	return err
+}
+
+// Done is closed once the stream is closed
+func (c *WSConn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *WSConn) LocalAddr() net.Addr  { return c.ws.LocalAddr() }
+func (c *WSConn) RemoteAddr() net.Addr { return c.ws.RemoteAddr() }
+
+func (c *WSConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *WSConn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *WSConn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
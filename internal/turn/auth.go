@@ -1,16 +1,12 @@
 package turn
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"log/slog"
 	"net"
-	"strconv"
-	"strings"
-	"sync"
-	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/authguard"
+	"github.com/arqut/arqut-server-ce/internal/authhook"
 	"github.com/pion/turn/v4"
 )
 
@@ -19,131 +15,159 @@ type AuthHandler struct {
 	mode   string
 	logger *slog.Logger
 
-	// REST auth (mutex-protected for secret rotation)
-	secretMutex sync.RWMutex
-	secret      string
-	oldSecrets  []string
-	ttl         int
+	// REST auth (shared with the API and signaling servers)
+	issuer *CredentialIssuer
 
 	// Static auth
 	staticUsers map[string]string // username -> password
+
+	// Chain auth (ordered list of backends tried in "chain" mode)
+	chain []string
+
+	// Webhook auth (external authorization endpoint)
+	webhook *authhook.Client
+
+	// Failure tracker shared with the API key middleware (nil = disabled)
+	guard *authguard.Guard
 }
 
+// defaultAuthChain is the backend order used by "chain" mode when none is configured
+var defaultAuthChain = []string{"rest", "static"}
+
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(mode string, secret string, oldSecrets []string, ttl int, staticUsers map[string]string, logger *slog.Logger) *AuthHandler {
+func NewAuthHandler(mode string, issuer *CredentialIssuer, staticUsers map[string]string, logger *slog.Logger) *AuthHandler {
 	return &AuthHandler{
 		mode:        mode,
 		logger:      logger,
-		secret:      secret,
-		oldSecrets:  oldSecrets,
-		ttl:         ttl,
+		issuer:      issuer,
 		staticUsers: staticUsers,
+		chain:       defaultAuthChain,
 	}
 }
 
 // Authenticate implements turn.AuthHandler interface
 func (h *AuthHandler) AuthenticateRequest(username, realm string, srcAddr net.Addr) ([]byte, bool) {
-	switch h.mode {
-	case "rest":
-		return h.restAuth(username, realm, srcAddr)
-	case "static":
-		return h.staticAuth(username, realm, srcAddr)
-	default:
-		h.logger.Error("Unknown auth mode", "mode", h.mode)
+	keys := guardKeys(username, srcAddr)
+	if remaining, banned := h.guard.Check(keys...); banned {
+		h.logger.Warn("TURN auth rejected: temporarily banned",
+			"username", username,
+			"addr", srcAddr.String(),
+			"remaining", remaining,
+		)
 		return nil, false
 	}
+
+	var key []byte
+	var ok bool
+	if h.mode == "chain" {
+		key, ok = h.chainAuth(username, realm, srcAddr)
+	} else {
+		key, ok = h.backendAuth(h.mode, username, realm, srcAddr)
+	}
+
+	if !ok {
+		h.guard.Failure(keys...)
+	}
+	return key, ok
 }
 
-// restAuth handles REST-style authentication (coturn-compatible)
-// Username format: <peerType>:<peerID>:<unix_expiry>
-// Password: base64(HMAC-SHA256(secret, username))
-func (h *AuthHandler) restAuth(username, realm string, srcAddr net.Addr) ([]byte, bool) {
-	h.logger.Debug("REST auth attempt",
+// OnAuth receives the message integrity verdict from the TURN server.
+// AuthenticateRequest only returns the expected key, so a wrong password is
+// only visible here.
+func (h *AuthHandler) OnAuth(srcAddr, dstAddr net.Addr, protocol, username, realm, method string, verdict bool) {
+	keys := guardKeys(username, srcAddr)
+	if verdict {
+		h.guard.Success(keys...)
+		return
+	}
+
+	h.logger.Warn("TURN auth failed: invalid password",
 		"username", username,
-		"realm", realm,
 		"addr", srcAddr.String(),
+		"method", method,
 	)
+	h.guard.Failure(keys...)
+}
 
-	// Parse username: <peerType>:<peerID>:<unix_expiry>
-	parts := strings.SplitN(username, ":", 3)
-	if len(parts) != 3 {
-		h.logger.Warn("REST auth failed: invalid username format",
-			"username", username,
-			"expected", "peerType:peerID:timestamp",
-		)
-		return nil, false
+// guardKeys returns the failure tracking keys for a TURN request
+func guardKeys(username string, srcAddr net.Addr) []string {
+	return []string{
+		authguard.IPKey(authguard.AddrIP(srcAddr)),
+		authguard.UserKey(username),
 	}
+}
 
-	peerType := parts[0]
-	peerID := parts[1]
-	timestampStr := parts[2]
-
-	// Parse expiry timestamp
-	expiry, err := strconv.ParseInt(timestampStr, 10, 64)
-	if err != nil {
-		h.logger.Warn("REST auth failed: invalid expiry timestamp",
-			"username", username,
-			"error", err,
-		)
-		return nil, false
+// SetChain sets the ordered list of backends tried in "chain" mode
+func (h *AuthHandler) SetChain(backends []string) {
+	if len(backends) == 0 {
+		backends = defaultAuthChain
 	}
+	h.chain = backends
+}
 
-	// Check if credential has expired
-	expiryTime := time.Unix(expiry, 0)
-	if expiryTime.Before(time.Now()) {
-		h.logger.Warn("REST auth failed: credential expired",
-			"username", username,
-			"expired_at", expiryTime,
-		)
+// backendAuth authenticates against a single named backend
+func (h *AuthHandler) backendAuth(backend, username, realm string, srcAddr net.Addr) ([]byte, bool) {
+	switch backend {
+	case "rest":
+		return h.restAuth(username, realm, srcAddr)
+	case "static":
+		return h.staticAuth(username, realm, srcAddr)
+	case "webhook":
+		return h.webhookAuth(username, realm, srcAddr)
+	default:
+		h.logger.Error("Unknown auth mode", "mode", backend)
 		return nil, false
 	}
+}
 
-	// Check if expiry is too far in the future (prevent abuse)
-	maxFutureTime := time.Now().Add(48 * time.Hour)
-	if expiryTime.After(maxFutureTime) {
-		h.logger.Warn("REST auth failed: expiry too far in future",
+// chainAuth tries each configured backend in order and returns the first match.
+// This lets long-lived devices use static credentials while browsers use
+// ephemeral REST credentials on the same listener.
+func (h *AuthHandler) chainAuth(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+	for _, backend := range h.chain {
+		if key, ok := h.backendAuth(backend, username, realm, srcAddr); ok {
+			return key, true
+		}
+		h.logger.Debug("Auth backend rejected credentials, trying next",
+			"backend", backend,
 			"username", username,
-			"expiry", expiryTime,
 		)
-		return nil, false
 	}
 
-	// Try current and old secrets
-	h.secretMutex.RLock()
-	currentSecret := h.secret
-	oldSecrets := h.oldSecrets
-	h.secretMutex.RUnlock()
-
-	secrets := []string{currentSecret}
-	secrets = append(secrets, oldSecrets...)
-
-	for _, secret := range secrets {
-		if secret == "" {
-			continue
-		}
-
-		// Generate expected password: base64(HMAC-SHA256(secret, username))
-		mac := hmac.New(sha256.New, []byte(secret))
-		mac.Write([]byte(username))
-		expectedPassword := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	h.logger.Warn("Chain auth failed: no backend accepted credentials",
+		"username", username,
+		"chain", h.chain,
+	)
+	return nil, false
+}
 
-		// Generate HA1: MD5(username:realm:password)
-		ha1 := turn.GenerateAuthKey(username, realm, expectedPassword)
+// restAuth handles REST-style authentication (coturn-compatible)
+// Username format: <peerType>:<peerID>:<unix_expiry> or <unix_expiry>[:<user>]
+// Password: base64(HMAC-SHA256(secret, username))
+func (h *AuthHandler) restAuth(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+	h.logger.Debug("REST auth attempt",
+		"username", username,
+		"realm", realm,
+		"addr", srcAddr.String(),
+	)
 
-		h.logger.Info("REST auth successful",
+	key, info, err := h.issuer.AuthKey(username, realm)
+	if err != nil {
+		h.logger.Warn("REST auth failed",
 			"username", username,
-			"peer_type", peerType,
-			"peer_id", peerID,
-			"expires", expiryTime,
-			"addr", srcAddr.String(),
+			"error", err,
 		)
-		return ha1, true
+		return nil, false
 	}
 
-	h.logger.Warn("REST auth failed: no valid secret",
+	h.logger.Info("REST auth successful",
 		"username", username,
+		"peer_type", info.PeerType,
+		"peer_id", info.PeerID,
+		"expires", info.Expiry,
+		"addr", srcAddr.String(),
 	)
-	return nil, false
+	return key, true
 }
 
 // staticAuth handles static user authentication
@@ -170,14 +194,66 @@ func (h *AuthHandler) staticAuth(username, realm string, srcAddr net.Addr) ([]by
 	return turn.GenerateAuthKey(username, realm, password), true
 }
 
-// UpdateSecrets updates the REST auth secrets (for hot rotation)
-func (h *AuthHandler) UpdateSecrets(current string, old []string, ttl int) {
-	h.secretMutex.Lock()
-	defer h.secretMutex.Unlock()
+// webhookAuth asks the external authorization endpoint for the user's password.
+// The endpoint must return the long-term password because TURN derives the
+// HA1 key from it; a fail-open decision without a password is rejected.
+func (h *AuthHandler) webhookAuth(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+	if h.webhook == nil {
+		h.logger.Error("Webhook auth failed: no auth webhook configured")
+		return nil, false
+	}
+
+	// pion calls this from the listener's read loop: bound the wait so an
+	// unresponsive endpoint cannot stall everyone else on the listener
+	ctx := context.Background()
+	if timeout := h.webhook.TURNTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	decision, err := h.webhook.Authorize(ctx, authhook.Request{
+		Kind:       authhook.KindTURN,
+		Username:   username,
+		Realm:      realm,
+		RemoteAddr: srcAddr.String(),
+	})
+	if err != nil {
+		h.logger.Warn("Webhook auth failed: endpoint error",
+			"username", username,
+			"error", err,
+		)
+		return nil, false
+	}
+
+	if !decision.Allow || decision.Password == "" {
+		h.logger.Warn("Webhook auth failed: denied",
+			"username", username,
+			"reason", decision.Reason,
+		)
+		return nil, false
+	}
+
+	h.logger.Info("Webhook auth successful",
+		"username", username,
+		"addr", srcAddr.String(),
+	)
+
+	return turn.GenerateAuthKey(username, realm, decision.Password), true
+}
+
+// SetWebhook sets the external authorization client used by the "webhook" backend
+func (h *AuthHandler) SetWebhook(client *authhook.Client) {
+	h.webhook = client
+}
 
-	h.secret = current
-	h.oldSecrets = old
-	h.ttl = ttl
+// SetGuard sets the failure tracker used to throttle repeated auth failures
+func (h *AuthHandler) SetGuard(guard *authguard.Guard) {
+	h.guard = guard
+}
 
+// UpdateSecrets updates the REST auth secrets (for hot rotation)
+func (h *AuthHandler) UpdateSecrets(current string, old []string, ttl int) {
+	h.issuer.UpdateSecrets(current, old, ttl)
 	h.logger.Info("Secrets updated", "ttl", ttl)
 }
@@ -4,14 +4,20 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/arqut/arqut-server-ce/internal/authguard"
+	"github.com/arqut/arqut-server-ce/internal/authhook"
+	"github.com/arqut/arqut-server-ce/internal/config"
 	"github.com/pion/turn/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,26 +39,33 @@ func generateRESTPassword(secret, username string) string {
 	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
 
+// newTestIssuer creates a credential issuer with the given REST secrets
+func newTestIssuer(secret string, oldSecrets []string, ttl int) *CredentialIssuer {
+	return NewCredentialIssuer(&config.AuthConfig{
+		Secret:     secret,
+		OldSecrets: oldSecrets,
+		TTLSeconds: ttl,
+	})
+}
+
 func TestNewAuthHandler(t *testing.T) {
 	handler := NewAuthHandler(
 		"rest",
-		"test-secret",
-		[]string{"old-secret"},
-		86400,
+		newTestIssuer("test-secret", []string{"old-secret"}, 86400),
 		nil,
 		testLogger(),
 	)
 
 	require.NotNil(t, handler)
 	assert.Equal(t, "rest", handler.mode)
-	assert.Equal(t, "test-secret", handler.secret)
-	assert.Equal(t, []string{"old-secret"}, handler.oldSecrets)
-	assert.Equal(t, 86400, handler.ttl)
+	assert.Equal(t, "test-secret", handler.issuer.secret)
+	assert.Equal(t, []string{"old-secret"}, handler.issuer.oldSecrets)
+	assert.Equal(t, 86400, handler.issuer.ttl)
 }
 
 func TestAuthHandler_RESTAuth_Success(t *testing.T) {
 	secret := "test-secret-2025"
-	handler := NewAuthHandler("rest", secret, nil, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer(secret, nil, 86400), nil, testLogger())
 
 	// Generate valid credentials
 	expiry := time.Now().Add(1 * time.Hour).Unix()
@@ -72,7 +85,7 @@ func TestAuthHandler_RESTAuth_Success(t *testing.T) {
 
 func TestAuthHandler_RESTAuth_ExpiredCredential(t *testing.T) {
 	secret := "test-secret"
-	handler := NewAuthHandler("rest", secret, nil, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer(secret, nil, 86400), nil, testLogger())
 
 	// Generate expired credentials
 	expiry := time.Now().Add(-1 * time.Hour).Unix()
@@ -87,7 +100,7 @@ func TestAuthHandler_RESTAuth_ExpiredCredential(t *testing.T) {
 
 func TestAuthHandler_RESTAuth_FutureTooFar(t *testing.T) {
 	secret := "test-secret"
-	handler := NewAuthHandler("rest", secret, nil, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer(secret, nil, 86400), nil, testLogger())
 
 	// Generate credentials too far in future (>48 hours)
 	expiry := time.Now().Add(72 * time.Hour).Unix()
@@ -101,7 +114,7 @@ func TestAuthHandler_RESTAuth_FutureTooFar(t *testing.T) {
 }
 
 func TestAuthHandler_RESTAuth_InvalidUsernameFormat(t *testing.T) {
-	handler := NewAuthHandler("rest", "secret", nil, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer("secret", nil, 86400), nil, testLogger())
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
 
 	tests := []struct {
@@ -124,7 +137,7 @@ func TestAuthHandler_RESTAuth_InvalidUsernameFormat(t *testing.T) {
 }
 
 func TestAuthHandler_RESTAuth_InvalidTimestamp(t *testing.T) {
-	handler := NewAuthHandler("rest", "secret", nil, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer("secret", nil, 86400), nil, testLogger())
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
 
 	tests := []struct {
@@ -151,9 +164,7 @@ func TestAuthHandler_RESTAuth_OldSecrets(t *testing.T) {
 
 	handler := NewAuthHandler(
 		"rest",
-		currentSecret,
-		[]string{oldSecret, "very-old-secret"},
-		86400,
+		newTestIssuer(currentSecret, []string{oldSecret, "very-old-secret"}, 86400),
 		nil,
 		testLogger(),
 	)
@@ -196,7 +207,7 @@ func TestAuthHandler_RESTAuth_OldSecrets(t *testing.T) {
 }
 
 func TestAuthHandler_RESTAuth_EmptySecret(t *testing.T) {
-	handler := NewAuthHandler("rest", "", []string{""}, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer("", []string{""}, 86400), nil, testLogger())
 
 	expiry := time.Now().Add(1 * time.Hour).Unix()
 	username := generateRESTUsername("edge", "peer", expiry)
@@ -214,7 +225,7 @@ func TestAuthHandler_StaticAuth_Success(t *testing.T) {
 		"user2": "password2",
 	}
 
-	handler := NewAuthHandler("static", "", nil, 0, staticUsers, testLogger())
+	handler := NewAuthHandler("static", newTestIssuer("", nil, 0), staticUsers, testLogger())
 
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
 
@@ -228,7 +239,7 @@ func TestAuthHandler_StaticAuth_UserNotFound(t *testing.T) {
 		"user1": "password1",
 	}
 
-	handler := NewAuthHandler("static", "", nil, 0, staticUsers, testLogger())
+	handler := NewAuthHandler("static", newTestIssuer("", nil, 0), staticUsers, testLogger())
 
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
 
@@ -244,7 +255,7 @@ func TestAuthHandler_StaticAuth_MultipleUsers(t *testing.T) {
 		"charlie": "charlie-pass",
 	}
 
-	handler := NewAuthHandler("static", "", nil, 0, staticUsers, testLogger())
+	handler := NewAuthHandler("static", newTestIssuer("", nil, 0), staticUsers, testLogger())
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
 
 	tests := []struct {
@@ -271,8 +282,169 @@ func TestAuthHandler_StaticAuth_MultipleUsers(t *testing.T) {
 	}
 }
 
+func TestAuthHandler_ChainAuth(t *testing.T) {
+	secret := "chain-secret"
+	staticUsers := map[string]string{
+		"device-1": "device-pass",
+	}
+
+	handler := NewAuthHandler("chain", newTestIssuer(secret, nil, 86400), staticUsers, testLogger())
+	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
+
+	t.Run("accepts REST credentials", func(t *testing.T) {
+		username := generateRESTUsername("client", "browser-1", time.Now().Add(1*time.Hour).Unix())
+		expectedHA1 := turn.GenerateAuthKey(username, "test.com", generateRESTPassword(secret, username))
+
+		result, ok := handler.AuthenticateRequest(username, "test.com", srcAddr)
+		assert.True(t, ok)
+		assert.Equal(t, expectedHA1, result)
+	})
+
+	t.Run("falls back to static users", func(t *testing.T) {
+		expectedHA1 := turn.GenerateAuthKey("device-1", "test.com", "device-pass")
+
+		result, ok := handler.AuthenticateRequest("device-1", "test.com", srcAddr)
+		assert.True(t, ok)
+		assert.Equal(t, expectedHA1, result)
+	})
+
+	t.Run("rejects unknown users", func(t *testing.T) {
+		result, ok := handler.AuthenticateRequest("unknown", "test.com", srcAddr)
+		assert.False(t, ok)
+		assert.Nil(t, result)
+	})
+
+	t.Run("rejects expired REST credentials without static match", func(t *testing.T) {
+		username := generateRESTUsername("client", "browser-1", time.Now().Add(-1*time.Hour).Unix())
+		result, ok := handler.AuthenticateRequest(username, "test.com", srcAddr)
+		assert.False(t, ok)
+		assert.Nil(t, result)
+	})
+}
+
+func TestAuthHandler_ChainAuth_Order(t *testing.T) {
+	// A static user whose name also parses as a REST username
+	username := generateRESTUsername("edge", "fixed", time.Now().Add(1*time.Hour).Unix())
+	staticUsers := map[string]string{username: "static-pass"}
+
+	handler := NewAuthHandler("chain", newTestIssuer("secret", nil, 86400), staticUsers, testLogger())
+	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
+
+	handler.SetChain([]string{"static", "rest"})
+	result, ok := handler.AuthenticateRequest(username, "test.com", srcAddr)
+	require.True(t, ok)
+	assert.Equal(t, turn.GenerateAuthKey(username, "test.com", "static-pass"), result)
+
+	handler.SetChain([]string{"rest", "static"})
+	result, ok = handler.AuthenticateRequest(username, "test.com", srcAddr)
+	require.True(t, ok)
+	assert.Equal(t, turn.GenerateAuthKey(username, "test.com", generateRESTPassword("secret", username)), result)
+}
+
+func TestAuthHandler_SetChain_Default(t *testing.T) {
+	handler := NewAuthHandler("chain", newTestIssuer("secret", nil, 86400), nil, testLogger())
+	handler.SetChain(nil)
+	assert.Equal(t, []string{"rest", "static"}, handler.chain)
+}
+
+func TestAuthHandler_WebhookAuth(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req authhook.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Kind == authhook.KindTURN && req.Username == "infra-device" {
+			json.NewEncoder(w).Encode(authhook.Decision{Allow: true, Password: "device-pass"})
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer endpoint.Close()
+
+	client := authhook.New(&config.AuthWebhookConfig{
+		URL:      endpoint.URL,
+		Timeout:  time.Second,
+		CacheTTL: time.Minute,
+	}, testLogger())
+
+	handler := NewAuthHandler("webhook", newTestIssuer("", nil, 86400), nil, testLogger())
+	handler.SetWebhook(client)
+	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
+
+	result, ok := handler.AuthenticateRequest("infra-device", "test.com", srcAddr)
+	assert.True(t, ok)
+	assert.Equal(t, turn.GenerateAuthKey("infra-device", "test.com", "device-pass"), result)
+
+	result, ok = handler.AuthenticateRequest("someone-else", "test.com", srcAddr)
+	assert.False(t, ok)
+	assert.Nil(t, result)
+}
+
+func TestAuthHandler_WebhookAuth_NotConfigured(t *testing.T) {
+	handler := NewAuthHandler("webhook", newTestIssuer("", nil, 86400), nil, testLogger())
+	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
+
+	result, ok := handler.AuthenticateRequest("user", "test.com", srcAddr)
+	assert.False(t, ok)
+	assert.Nil(t, result)
+}
+
+func TestAuthHandler_WebhookAuth_FailOpenWithoutPassword(t *testing.T) {
+	endpoint := httptest.NewServer(http.NotFoundHandler())
+	url := endpoint.URL
+	endpoint.Close()
+
+	client := authhook.New(&config.AuthWebhookConfig{
+		URL:      url,
+		Timeout:  time.Second,
+		FailOpen: true,
+	}, testLogger())
+
+	handler := NewAuthHandler("webhook", newTestIssuer("", nil, 86400), nil, testLogger())
+	handler.SetWebhook(client)
+	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
+
+	// TURN needs a password to derive the key, so fail-open cannot authorize
+	_, ok := handler.AuthenticateRequest("user", "test.com", srcAddr)
+	assert.False(t, ok)
+}
+
+func TestAuthHandler_WebhookAuth_HangingEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer endpoint.Close()
+	defer close(release)
+
+	client := authhook.New(&config.AuthWebhookConfig{
+		URL:           endpoint.URL,
+		Timeout:       5 * time.Second,
+		CacheTTL:      time.Minute,
+		TURNTimeout:   100 * time.Millisecond,
+		ErrorCacheTTL: time.Minute,
+	}, testLogger())
+
+	handler := NewAuthHandler("chain", newTestIssuer("", nil, 86400), map[string]string{"device": "device-pass"}, testLogger())
+	handler.SetChain([]string{"webhook", "static"})
+	handler.SetWebhook(client)
+	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
+
+	// The webhook is given up on well before the HTTP timeout and the
+	// static backend still serves the user
+	start := time.Now()
+	result, ok := handler.AuthenticateRequest("device", "test.com", srcAddr)
+	assert.True(t, ok)
+	assert.Equal(t, turn.GenerateAuthKey("device", "test.com", "device-pass"), result)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// The failure is cached, so later requests do not wait again
+	start = time.Now()
+	_, ok = handler.AuthenticateRequest("device", "test.com", srcAddr)
+	assert.True(t, ok)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
 func TestAuthHandler_UnknownMode(t *testing.T) {
-	handler := NewAuthHandler("unknown", "", nil, 0, nil, testLogger())
+	handler := NewAuthHandler("unknown", newTestIssuer("", nil, 0), nil, testLogger())
 
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
 	result, ok := handler.AuthenticateRequest("user", "test.com", srcAddr)
@@ -282,17 +454,17 @@ func TestAuthHandler_UnknownMode(t *testing.T) {
 }
 
 func TestAuthHandler_UpdateSecrets(t *testing.T) {
-	handler := NewAuthHandler("rest", "old-secret", nil, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer("old-secret", nil, 86400), nil, testLogger())
 
 	// Update secrets
 	handler.UpdateSecrets("new-secret", []string{"old-secret", "very-old"}, 43200)
 
 	// Verify secrets were updated
-	handler.secretMutex.RLock()
-	assert.Equal(t, "new-secret", handler.secret)
-	assert.Equal(t, []string{"old-secret", "very-old"}, handler.oldSecrets)
-	assert.Equal(t, 43200, handler.ttl)
-	handler.secretMutex.RUnlock()
+	handler.issuer.mu.RLock()
+	assert.Equal(t, "new-secret", handler.issuer.secret)
+	assert.Equal(t, []string{"old-secret", "very-old"}, handler.issuer.oldSecrets)
+	assert.Equal(t, 43200, handler.issuer.ttl)
+	handler.issuer.mu.RUnlock()
 
 	// Verify authentication works with new secret
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
@@ -306,7 +478,7 @@ func TestAuthHandler_UpdateSecrets(t *testing.T) {
 }
 
 func TestAuthHandler_ConcurrentAccess(t *testing.T) {
-	handler := NewAuthHandler("rest", "secret", []string{"old"}, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer("secret", []string{"old"}, 86400), nil, testLogger())
 
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
 	expiry := time.Now().Add(1 * time.Hour).Unix()
@@ -349,7 +521,7 @@ func TestAuthHandler_ConcurrentAccess(t *testing.T) {
 }
 
 func TestAuthHandler_RESTAuth_BoundaryExpiry(t *testing.T) {
-	handler := NewAuthHandler("rest", "secret", nil, 86400, nil, testLogger())
+	handler := NewAuthHandler("rest", newTestIssuer("secret", nil, 86400), nil, testLogger())
 	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
 
 	tests := []struct {
@@ -398,3 +570,62 @@ func TestGenerateRESTCredentials(t *testing.T) {
 	expectedPassword := base64.StdEncoding.EncodeToString(mac.Sum(nil))
 	assert.Equal(t, expectedPassword, password)
 }
+
+func newTestGuard() *authguard.Guard {
+	return authguard.New(&config.AuthGuardConfig{
+		Enabled:        true,
+		MaxFailures:    2,
+		Window:         time.Minute,
+		BanDuration:    time.Minute,
+		MaxBanDuration: time.Hour,
+	}, testLogger())
+}
+
+func TestAuthHandler_Guard_BansAfterRejections(t *testing.T) {
+	handler := NewAuthHandler("static", newTestIssuer("", nil, 0), map[string]string{"alice": "pw"}, testLogger())
+	guard := newTestGuard()
+	handler.SetGuard(guard)
+
+	attacker, _ := net.ResolveUDPAddr("udp", "192.0.2.1:12345")
+	_, ok := handler.AuthenticateRequest("mallory", "test.com", attacker)
+	assert.False(t, ok)
+	_, ok = handler.AuthenticateRequest("trudy", "test.com", attacker)
+	assert.False(t, ok)
+
+	// Source IP is banned, even for a valid user
+	_, ok = handler.AuthenticateRequest("alice", "test.com", attacker)
+	assert.False(t, ok)
+
+	// Other sources are unaffected
+	other, _ := net.ResolveUDPAddr("udp", "192.0.2.2:12345")
+	_, ok = handler.AuthenticateRequest("alice", "test.com", other)
+	assert.True(t, ok)
+}
+
+func TestAuthHandler_Guard_WrongPasswordVerdict(t *testing.T) {
+	handler := NewAuthHandler("static", newTestIssuer("", nil, 0), map[string]string{"alice": "pw"}, testLogger())
+	guard := newTestGuard()
+	handler.SetGuard(guard)
+
+	// Wrong passwords are only reported through the integrity verdict;
+	// failures from different IPs still ban the username
+	dst, _ := net.ResolveUDPAddr("udp", "127.0.0.1:3478")
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		src, _ := net.ResolveUDPAddr("udp", ip+":12345")
+		handler.OnAuth(src, dst, "UDP", "alice", "test.com", "Allocate", false)
+	}
+
+	src, _ := net.ResolveUDPAddr("udp", "192.0.2.3:12345")
+	_, ok := handler.AuthenticateRequest("alice", "test.com", src)
+	assert.False(t, ok, "username is banned")
+
+	guard.Clear(authguard.UserKey("alice"))
+	_, ok = handler.AuthenticateRequest("alice", "test.com", src)
+	assert.True(t, ok)
+
+	// A successful verdict resets the failure count
+	handler.OnAuth(src, dst, "UDP", "alice", "test.com", "Allocate", false)
+	handler.OnAuth(src, dst, "UDP", "alice", "test.com", "Allocate", true)
+	handler.OnAuth(src, dst, "UDP", "alice", "test.com", "Allocate", false)
+	assert.Empty(t, guard.Bans())
+}
@@ -0,0 +1,251 @@
+package turn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/pion/turn/v4"
+)
+
+// Username formats for minted credentials
+const (
+	UsernameFormatPeer      = "peer"      // <peerType>:<peerID>:<expiry>
+	UsernameFormatTimestamp = "timestamp" // <expiry>:<peerType>:<peerID> (coturn use-auth-secret style)
+)
+
+// defaultMaxTTL bounds credential lifetimes (seconds) when no max_ttl_seconds is configured
+const defaultMaxTTL = 48 * 60 * 60
+
+// Credential verification errors
+var (
+	ErrInvalidUsername = errors.New("invalid username format")
+	ErrExpired         = errors.New("credential expired")
+	ErrExpiryTooFar    = errors.New("expiry too far in future")
+	ErrNoSecret        = errors.New("no secret configured")
+)
+
+// Credentials is a minted TURN REST credential
+type Credentials struct {
+	Username string
+	Password string
+	TTL      int
+	Expiry   int64
+}
+
+// UsernameInfo holds the fields encoded in a REST username
+type UsernameInfo struct {
+	PeerType string // Empty for plain coturn "<expiry>:<user>" usernames
+	PeerID   string
+	Expiry   time.Time
+}
+
+// CredentialIssuer mints and verifies coturn-compatible REST credentials.
+// A single instance is shared by the TURN auth handler, the REST API and the
+// signaling server so that secret rotation reaches all of them at once.
+type CredentialIssuer struct {
+	mu         sync.RWMutex
+	secret     string
+	oldSecrets []string
+	ttl        int
+	format     string
+
+	// Lifetime policy: global bounds plus per peer type overrides
+	policy  config.TTLPolicy
+	peerTTL map[string]config.TTLPolicy
+}
+
+// NewCredentialIssuer creates a credential issuer from the TURN auth config
+func NewCredentialIssuer(cfg *config.AuthConfig) *CredentialIssuer {
+	format := cfg.UsernameFormat
+	if format == "" {
+		format = UsernameFormatPeer
+	}
+
+	maxTTL := cfg.MaxTTLSeconds
+	if maxTTL <= 0 {
+		maxTTL = defaultMaxTTL
+	}
+
+	return &CredentialIssuer{
+		secret:     cfg.Secret,
+		oldSecrets: cfg.OldSecrets,
+		ttl:        cfg.TTLSeconds,
+		format:     format,
+		policy:     config.TTLPolicy{Min: cfg.MinTTLSeconds, Max: maxTTL},
+		peerTTL:    cfg.PeerTTL,
+	}
+}
+
+// Issue mints credentials for a peer. A ttl of zero uses the configured default.
+// The lifetime is clamped to the global and peer type policy plus any extra
+// limits supplied by the caller (e.g. the API key's policy).
+// Password: base64(HMAC-SHA256(secret, username))
+func (c *CredentialIssuer) Issue(peerType, peerID string, ttl int, limits ...config.TTLPolicy) Credentials {
+	c.mu.RLock()
+	secret := c.secret
+	format := c.format
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	c.mu.RUnlock()
+
+	ttl = c.clampTTL(peerType, ttl, limits)
+
+	expiry := time.Now().Unix() + int64(ttl)
+
+	var username string
+	if format == UsernameFormatTimestamp {
+		username = fmt.Sprintf("%d:%s:%s", expiry, peerType, peerID)
+	} else {
+		username = fmt.Sprintf("%s:%s:%d", peerType, peerID, expiry)
+	}
+
+	return Credentials{
+		Username: username,
+		Password: computePassword(secret, username),
+		TTL:      ttl,
+		Expiry:   expiry,
+	}
+}
+
+// clampTTL restricts ttl to the intersection of all applicable policies.
+// If the policies do not overlap, the smallest maximum wins.
+func (c *CredentialIssuer) clampTTL(peerType string, ttl int, limits []config.TTLPolicy) int {
+	policies := append([]config.TTLPolicy{c.policy}, limits...)
+	if peerPolicy, ok := c.peerTTL[peerType]; ok {
+		policies = append(policies, peerPolicy)
+	}
+
+	minTTL, maxTTL := 0, 0
+	for _, p := range policies {
+		if p.Min > minTTL {
+			minTTL = p.Min
+		}
+		if p.Max > 0 && (maxTTL == 0 || p.Max < maxTTL) {
+			maxTTL = p.Max
+		}
+	}
+
+	if ttl < minTTL {
+		ttl = minTTL
+	}
+	if maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+	return ttl
+}
+
+// maxTTL returns the longest lifetime accepted for a peer type
+func (c *CredentialIssuer) maxTTL(peerType string) time.Duration {
+	maxTTL := c.policy.Max
+	if peerPolicy, ok := c.peerTTL[peerType]; ok && peerPolicy.Max > 0 && peerPolicy.Max < maxTTL {
+		maxTTL = peerPolicy.Max
+	}
+	return time.Duration(maxTTL) * time.Second
+}
+
+// TTL returns the default credential lifetime in seconds
+func (c *CredentialIssuer) TTL() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ttl
+}
+
+// AuthKey returns the TURN long-term key (HA1) for a REST username after
+// checking its format and expiry. pion accepts a single key per request, so
+// the key is always derived from the current secret.
+func (c *CredentialIssuer) AuthKey(username, realm string) ([]byte, *UsernameInfo, error) {
+	info, err := c.check(username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.RLock()
+	secret := c.secret
+	c.mu.RUnlock()
+
+	if secret == "" {
+		return nil, info, ErrNoSecret
+	}
+	return turn.GenerateAuthKey(username, realm, computePassword(secret, username)), info, nil
+}
+
+// UpdateSecrets updates the signing secrets (for hot rotation)
+func (c *CredentialIssuer) UpdateSecrets(current string, old []string, ttl int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.secret = current
+	c.oldSecrets = old
+	c.ttl = ttl
+}
+
+// check parses a username and validates its expiry window
+func (c *CredentialIssuer) check(username string) (*UsernameInfo, error) {
+	info, err := ParseUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if info.Expiry.Before(now) {
+		return info, ErrExpired
+	}
+	if info.Expiry.After(now.Add(c.maxTTL(info.PeerType))) {
+		return info, ErrExpiryTooFar
+	}
+
+	return info, nil
+}
+
+// ParseUsername parses both supported REST username formats:
+//
+//	<peerType>:<peerID>:<expiry>   (default)
+//	<expiry>[:<user>]              (coturn timestamp-first; <user> may be <peerType>:<peerID>)
+func ParseUsername(username string) (*UsernameInfo, error) {
+	parts := strings.SplitN(username, ":", 2)
+
+	// Timestamp-first: the leading field is the expiry
+	if expiry, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+		info := &UsernameInfo{Expiry: time.Unix(expiry, 0)}
+		if len(parts) == 2 {
+			if peer := strings.SplitN(parts[1], ":", 2); len(peer) == 2 {
+				info.PeerType, info.PeerID = peer[0], peer[1]
+			} else {
+				info.PeerID = parts[1]
+			}
+		}
+		return info, nil
+	}
+
+	parts = strings.SplitN(username, ":", 3)
+	if len(parts) != 3 {
+		return nil, ErrInvalidUsername
+	}
+
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid expiry timestamp", ErrInvalidUsername)
+	}
+
+	return &UsernameInfo{
+		PeerType: parts[0],
+		PeerID:   parts[1],
+		Expiry:   time.Unix(expiry, 0),
+	}, nil
+}
+
+// computePassword derives the REST password: base64(HMAC-SHA256(secret, username))
+func computePassword(secret, username string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,208 @@
+package turn
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/pion/turn/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialIssuer_Issue(t *testing.T) {
+	t.Run("peer format", func(t *testing.T) {
+		issuer := newTestIssuer("secret", nil, 3600)
+		creds := issuer.Issue("edge", "edge-1", 0)
+
+		parts := strings.Split(creds.Username, ":")
+		require.Len(t, parts, 3)
+		assert.Equal(t, "edge", parts[0])
+		assert.Equal(t, "edge-1", parts[1])
+		assert.Equal(t, fmt.Sprint(creds.Expiry), parts[2])
+		assert.Equal(t, 3600, creds.TTL, "zero TTL uses the configured default")
+		assert.Equal(t, generateRESTPassword("secret", creds.Username), creds.Password)
+	})
+
+	t.Run("timestamp format", func(t *testing.T) {
+		issuer := NewCredentialIssuer(&config.AuthConfig{
+			Secret:         "secret",
+			TTLSeconds:     3600,
+			UsernameFormat: UsernameFormatTimestamp,
+		})
+		creds := issuer.Issue("client", "c-1", 600)
+
+		assert.Equal(t, fmt.Sprintf("%d:client:c-1", creds.Expiry), creds.Username)
+		assert.Equal(t, 600, creds.TTL)
+		assert.Equal(t, generateRESTPassword("secret", creds.Username), creds.Password)
+	})
+}
+
+func TestParseUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		want     *UsernameInfo
+		wantErr  bool
+	}{
+		{"peer format", "edge:edge-1:1736590800", &UsernameInfo{PeerType: "edge", PeerID: "edge-1", Expiry: time.Unix(1736590800, 0)}, false},
+		{"timestamp with peer", "1736590800:client:c-1", &UsernameInfo{PeerType: "client", PeerID: "c-1", Expiry: time.Unix(1736590800, 0)}, false},
+		{"coturn timestamp with user", "1736590800:alice", &UsernameInfo{PeerID: "alice", Expiry: time.Unix(1736590800, 0)}, false},
+		{"coturn bare timestamp", "1736590800", &UsernameInfo{Expiry: time.Unix(1736590800, 0)}, false},
+		{"too few parts", "edge:edge-1", nil, true},
+		{"bad expiry", "edge:edge-1:soon", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseUsername(tt.username)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidUsername)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCredentialIssuer_AuthKey(t *testing.T) {
+	issuer := newTestIssuer("current", []string{"old"}, 3600)
+	future := time.Now().Add(time.Hour).Unix()
+
+	t.Run("current secret", func(t *testing.T) {
+		username := generateRESTUsername("edge", "e1", future)
+		key, info, err := issuer.AuthKey(username, "test.com")
+		require.NoError(t, err)
+		assert.Equal(t, "e1", info.PeerID)
+		assert.Equal(t, turn.GenerateAuthKey(username, "test.com", generateRESTPassword("current", username)), key)
+	})
+
+	t.Run("old secret is not accepted", func(t *testing.T) {
+		username := generateRESTUsername("edge", "e1", future)
+		key, _, err := issuer.AuthKey(username, "test.com")
+		require.NoError(t, err)
+		assert.NotEqual(t, turn.GenerateAuthKey(username, "test.com", generateRESTPassword("old", username)), key)
+	})
+
+	t.Run("timestamp-first username", func(t *testing.T) {
+		username := fmt.Sprintf("%d:alice", future)
+		key, _, err := issuer.AuthKey(username, "test.com")
+		require.NoError(t, err)
+		assert.Equal(t, turn.GenerateAuthKey(username, "test.com", generateRESTPassword("current", username)), key)
+	})
+
+	t.Run("no secret", func(t *testing.T) {
+		username := generateRESTUsername("edge", "e1", future)
+		_, _, err := newTestIssuer("", []string{"old"}, 3600).AuthKey(username, "test.com")
+		assert.ErrorIs(t, err, ErrNoSecret)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		username := generateRESTUsername("edge", "e1", time.Now().Add(-time.Minute).Unix())
+		_, _, err := issuer.AuthKey(username, "test.com")
+		assert.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("too far in future", func(t *testing.T) {
+		username := generateRESTUsername("edge", "e1", time.Now().Add(72*time.Hour).Unix())
+		_, _, err := issuer.AuthKey(username, "test.com")
+		assert.ErrorIs(t, err, ErrExpiryTooFar)
+	})
+}
+
+func TestCredentialIssuer_TTLPolicy(t *testing.T) {
+	issuer := NewCredentialIssuer(&config.AuthConfig{
+		Secret:        "secret",
+		TTLSeconds:    86400,
+		MinTTLSeconds: 60,
+		MaxTTLSeconds: 86400,
+		PeerTTL: map[string]config.TTLPolicy{
+			"client": {Min: 300, Max: 3600},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		peerType string
+		ttl      int
+		limits   []config.TTLPolicy
+		want     int
+	}{
+		{"default within global bounds", "edge", 0, nil, 86400},
+		{"below global min", "edge", 10, nil, 60},
+		{"above global max", "edge", 100000, nil, 86400},
+		{"peer type max", "client", 0, nil, 3600},
+		{"peer type min", "client", 60, nil, 300},
+		{"caller limit tightens", "edge", 0, []config.TTLPolicy{{Max: 1200}}, 1200},
+		{"caller limit cannot loosen", "client", 0, []config.TTLPolicy{{Max: 7200}}, 3600},
+		{"non-overlapping policies use smallest max", "client", 0, []config.TTLPolicy{{Min: 5000}}, 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds := issuer.Issue(tt.peerType, "p1", tt.ttl, tt.limits...)
+			assert.Equal(t, tt.want, creds.TTL)
+		})
+	}
+}
+
+func TestCredentialIssuer_MaxTTLEnforcedOnAuth(t *testing.T) {
+	issuer := NewCredentialIssuer(&config.AuthConfig{
+		Secret:        "secret",
+		TTLSeconds:    600,
+		MaxTTLSeconds: 3600,
+		PeerTTL: map[string]config.TTLPolicy{
+			"client": {Max: 900},
+		},
+	})
+
+	edge := generateRESTUsername("edge", "e1", time.Now().Add(2*time.Hour).Unix())
+	_, _, err := issuer.AuthKey(edge, "test.com")
+	assert.ErrorIs(t, err, ErrExpiryTooFar, "global max_ttl_seconds replaces the fixed 48h ceiling")
+
+	client := generateRESTUsername("client", "c1", time.Now().Add(30*time.Minute).Unix())
+	_, _, err = issuer.AuthKey(client, "test.com")
+	assert.ErrorIs(t, err, ErrExpiryTooFar, "peer type max applies to TURN auth too")
+
+	edge = generateRESTUsername("edge", "e1", time.Now().Add(30*time.Minute).Unix())
+	_, _, err = issuer.AuthKey(edge, "test.com")
+	assert.NoError(t, err)
+}
+
+func TestCredentialIssuer_UpdateSecrets(t *testing.T) {
+	issuer := newTestIssuer("before", nil, 3600)
+	issuer.UpdateSecrets("after", []string{"before"}, 600)
+
+	creds := issuer.Issue("client", "c1", 0)
+	assert.Equal(t, generateRESTPassword("after", creds.Username), creds.Password)
+	assert.Equal(t, 600, issuer.TTL())
+}
+
+func TestAuthHandler_RESTAuth_TimestampFirst(t *testing.T) {
+	handler := NewAuthHandler("rest", newTestIssuer("secret", nil, 86400), nil, testLogger())
+	srcAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:12345")
+
+	username := fmt.Sprintf("%d:alice", time.Now().Add(time.Hour).Unix())
+	key, ok := handler.AuthenticateRequest(username, "test.com", srcAddr)
+	require.True(t, ok)
+	assert.Equal(t, turn.GenerateAuthKey(username, "test.com", generateRESTPassword("secret", username)), key)
+}
+
+func TestServer_CredentialsShared(t *testing.T) {
+	server, err := New(&config.TurnConfig{
+		Realm: "test.com",
+		Auth:  config.AuthConfig{Mode: "rest", Secret: "before", TTLSeconds: 3600},
+	}, nil, testLogger())
+	require.NoError(t, err)
+
+	// Rotation through the server reaches every holder of the issuer
+	issuer := server.Credentials()
+	server.UpdateSecrets("after", nil, 3600)
+
+	creds := issuer.Issue("edge", "e1", 0)
+	assert.Equal(t, generateRESTPassword("after", creds.Username), creds.Password)
+}
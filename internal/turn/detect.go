@@ -0,0 +1,75 @@
+package turn
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/pion/stun/v3"
+)
+
+// detectTimeout bounds the STUN self-query at startup
+const detectTimeout = 5 * time.Second
+
+// ResolvePublicIP replaces a public_ip of "auto" with the address reported
+// by the configured STUN server. Other values are left untouched.
+func ResolvePublicIP(cfg *config.TurnConfig, logger *slog.Logger) error {
+	if cfg.PublicIP != config.PublicIPAuto {
+		return nil
+	}
+
+	ip, err := DetectPublicIP(cfg.DetectSTUN, detectTimeout)
+	if err != nil {
+		return fmt.Errorf("detecting public IP via %s: %w", cfg.DetectSTUN, err)
+	}
+
+	cfg.PublicIP = ip.String()
+	logger.Info("Detected public IP", "ip", cfg.PublicIP, "stun_server", cfg.DetectSTUN)
+	return nil
+}
+
+// DetectPublicIP sends a STUN binding request to server (host:port) and
+// returns the IPv4 address it observed for this host
+func DetectPublicIP(server string, timeout time.Duration) (net.IP, error) {
+	conn, err := net.Dial("udp4", server)
+	if err != nil {
+		return nil, fmt.Errorf("dialing STUN server: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("setting deadline: %w", err)
+	}
+
+	request, err := stun.Build(stun.TransactionID, stun.BindingRequest)
+	if err != nil {
+		return nil, fmt.Errorf("building binding request: %w", err)
+	}
+	if _, err := conn.Write(request.Raw); err != nil {
+		return nil, fmt.Errorf("sending binding request: %w", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("reading binding response: %w", err)
+		}
+
+		response := &stun.Message{Raw: buf[:n]}
+		if err := response.Decode(); err != nil || response.TransactionID != request.TransactionID {
+			continue // not our response
+		}
+		if response.Type != stun.BindingSuccess {
+			return nil, fmt.Errorf("unexpected STUN response: %s", response.Type)
+		}
+
+		var mapped stun.XORMappedAddress
+		if err := mapped.GetFrom(response); err != nil {
+			return nil, fmt.Errorf("reading mapped address: %w", err)
+		}
+		return mapped.IP, nil
+	}
+}
@@ -0,0 +1,63 @@
+package turn
+
+import (
+	"net"
+
+	"github.com/pion/turn/v4"
+)
+
+// newRelayGenerator creates the relay address generator for one address family.
+// relayIP is advertised to clients while relay sockets are bound to bindIP,
+// which differ behind 1:1 NAT. IPv6 generators are wrapped so relay sockets
+// are opened as udp6; pion always requests udp4 regardless of the client's family.
+func (s *Server) newRelayGenerator(relayIP, bindIP net.IP) turn.RelayAddressGenerator {
+	isV6 := relayIP.To4() == nil
+
+	// Listen/ListenPacket addresses are built as "<Address>:<port>"
+	address := bindIP.String()
+	if isV6 {
+		address = "[" + address + "]"
+	}
+
+	var generator turn.RelayAddressGenerator
+	if s.config.RelayPortRange.Min > 0 && s.config.RelayPortRange.Max > 0 {
+		generator = &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: relayIP,
+			MinPort:      uint16(s.config.RelayPortRange.Min),
+			MaxPort:      uint16(s.config.RelayPortRange.Max),
+			Address:      address,
+		}
+		s.logger.Info("Using port range relay generator",
+			"relay", relayIP.String(),
+			"bind", bindIP.String(),
+			"min", s.config.RelayPortRange.Min,
+			"max", s.config.RelayPortRange.Max,
+		)
+	} else {
+		generator = &turn.RelayAddressGeneratorStatic{
+			RelayAddress: relayIP,
+			Address:      address,
+		}
+		s.logger.Info("Using static relay generator", "relay", relayIP.String(), "bind", bindIP.String())
+	}
+
+	if isV6 {
+		return &ipv6RelayGenerator{RelayAddressGenerator: generator}
+	}
+	return generator
+}
+
+// ipv6RelayGenerator forces relay allocations onto IPv6 sockets
+type ipv6RelayGenerator struct {
+	turn.RelayAddressGenerator
+}
+
+// AllocatePacketConn allocates a UDP relay on an IPv6 socket
+func (g *ipv6RelayGenerator) AllocatePacketConn(_ string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	return g.RelayAddressGenerator.AllocatePacketConn("udp6", requestedPort)
+}
+
+// AllocateConn allocates a TCP relay on an IPv6 socket
+func (g *ipv6RelayGenerator) AllocateConn(_ string, requestedPort int) (net.Conn, net.Addr, error) {
+	return g.RelayAddressGenerator.AllocateConn("tcp6", requestedPort)
+}
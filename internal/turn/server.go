@@ -6,8 +6,13 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"strconv"
 
+	"github.com/arqut/arqut-server-ce/internal/authguard"
+	"github.com/arqut/arqut-server-ce/internal/authhook"
 	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/pion/dtls/v3"
 	"github.com/pion/turn/v4"
 )
 
@@ -18,6 +23,7 @@ type Server struct {
 	authHandler *AuthHandler
 	turnServer  *turn.Server
 	tlsConfig   *tls.Config
+	events      *events.Bus
 	ctx         context.Context
 	cancel      context.CancelFunc
 }
@@ -35,12 +41,13 @@ func New(cfg *config.TurnConfig, tlsConfig *tls.Config, logger *slog.Logger) (*S
 	// Create auth handler
 	authHandler := NewAuthHandler(
 		cfg.Auth.Mode,
-		cfg.Auth.Secret,
-		cfg.Auth.OldSecrets,
-		cfg.Auth.TTLSeconds,
+		NewCredentialIssuer(&cfg.Auth),
 		staticUsers,
 		logger.With("component", "turn-auth"),
 	)
+	if cfg.Auth.Mode == "chain" {
+		authHandler.SetChain(cfg.Auth.Chain)
+	}
 
 	s := &Server{
 		config:      cfg,
@@ -56,140 +63,213 @@ func New(cfg *config.TurnConfig, tlsConfig *tls.Config, logger *slog.Logger) (*S
 
 // Start starts the TURN server
 func (s *Server) Start() error {
-	// Create relay address generator
-	var relayAddressGenerator turn.RelayAddressGenerator
+	// Relay generators per address family. Without an advertised IPv6
+	// address, clients on IPv6 listeners are given IPv4 relays (RFC 6156 default).
+	relayV4 := s.newRelayGenerator(s.relayIPv4(), s.bindIPv4())
+	relayV6 := relayV4
+	if relayIP := net.ParseIP(s.config.PublicIPv6); relayIP != nil {
+		relayV6 = s.newRelayGenerator(relayIP, relayIP)
+	}
 
-	if s.config.RelayPortRange.Min > 0 && s.config.RelayPortRange.Max > 0 {
-		relayIP := net.ParseIP(s.config.PublicIP)
-		if relayIP == nil {
-			relayIP = net.ParseIP("127.0.0.1")
-		}
+	var packetConnConfigs []turn.PacketConnConfig
+	var listenerConfigs []turn.ListenerConfig
+	fail := func(err error) error {
+		closeListeners(packetConnConfigs, listenerConfigs)
+		return err
+	}
 
-		relayAddressGenerator = &turn.RelayAddressGeneratorPortRange{
-			RelayAddress: relayIP,
-			MinPort:      uint16(s.config.RelayPortRange.Min),
-			MaxPort:      uint16(s.config.RelayPortRange.Max),
-			Address:      relayIP.String(),
+	explicit := len(s.config.ListenAddresses) > 0
+	for _, addr := range s.listenAddresses() {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fail(fmt.Errorf("invalid listen address: %s", addr))
 		}
-		s.logger.Info("Using port range relay generator",
-			"min", s.config.RelayPortRange.Min,
-			"max", s.config.RelayPortRange.Max,
-		)
-	} else {
-		relayIP := net.ParseIP(s.config.PublicIP)
-		if relayIP == nil {
-			relayIP = net.ParseIP("127.0.0.1")
+
+		family, relay := "4", relayV4
+		if ip.To4() == nil {
+			family, relay = "6", relayV6
 		}
 
-		relayAddressGenerator = &turn.RelayAddressGeneratorStatic{
-			RelayAddress: relayIP,
-			Address:      relayIP.String(),
+		packetConns, listeners, err := s.listen(addr, family, relay)
+		if err != nil {
+			// The default IPv6 wildcard is optional: hosts without IPv6
+			// should still serve IPv4. Configured addresses must come up.
+			if !explicit && family == "6" {
+				s.logger.Warn("IPv6 listeners not available, serving IPv4 only", "addr", addr, "error", err)
+				continue
+			}
+			return fail(err)
 		}
-		s.logger.Info("Using static relay generator")
+
+		packetConnConfigs = append(packetConnConfigs, packetConns...)
+		listenerConfigs = append(listenerConfigs, listeners...)
 	}
 
-	// Create packet conn configs for UDP
-	var packetConnConfigs []turn.PacketConnConfig
+	if len(packetConnConfigs) == 0 && len(listenerConfigs) == 0 {
+		return fmt.Errorf("no TURN listeners started: check turn.ports and turn.listen_addresses")
+	}
 
+	// Create TURN server config
+	turnConfig := turn.ServerConfig{
+		Realm:       s.config.Realm,
+		AuthHandler: s.authHandler.AuthenticateRequest,
+		EventHandler: turn.EventHandler{
+			OnAuth:              s.authHandler.OnAuth,
+			OnAllocationCreated: s.onAllocationCreated,
+			OnAllocationDeleted: s.onAllocationDeleted,
+		},
+		PacketConnConfigs: packetConnConfigs,
+		ListenerConfigs:   listenerConfigs,
+	}
+
+	// Create and start TURN server
+	turnServer, err := turn.NewServer(turnConfig)
+	if err != nil {
+		return fail(fmt.Errorf("creating TURN server: %w", err))
+	}
+
+	s.turnServer = turnServer
+	s.logger.Info("TURN server started successfully", "realm", s.config.Realm)
+
+	return nil
+}
+
+// listen opens the UDP, TCP, TLS and DTLS listeners for one local address.
+// On failure every listener already opened for that address is closed.
+func (s *Server) listen(addr, family string, relay turn.RelayAddressGenerator) (packetConns []turn.PacketConnConfig, listeners []turn.ListenerConfig, err error) {
+	defer func() {
+		if err == nil {
+			return
+		}
+		closeListeners(packetConns, listeners)
+		packetConns, listeners = nil, nil
+	}()
+
+	// UDP listener
 	if s.config.Ports.UDP > 0 {
-		// UDP4
-		udpAddr := fmt.Sprintf("%s:%d", s.config.PublicIP, s.config.Ports.UDP)
-		udpConn4, err := net.ListenPacket("udp4", udpAddr)
+		udpAddr := net.JoinHostPort(addr, strconv.Itoa(s.config.Ports.UDP))
+		udpConn, err := net.ListenPacket("udp"+family, udpAddr)
 		if err != nil {
-			return fmt.Errorf("creating UDP4 listener: %w", err)
+			return packetConns, listeners, fmt.Errorf("creating UDP%s listener: %w", family, err)
 		}
 
-		packetConnConfigs = append(packetConnConfigs, turn.PacketConnConfig{
-			PacketConn:            udpConn4,
-			RelayAddressGenerator: relayAddressGenerator,
+		packetConns = append(packetConns, turn.PacketConnConfig{
+			PacketConn:            udpConn,
+			RelayAddressGenerator: relay,
 		})
-		s.logger.Info("TURN UDP4 listener started", "addr", udpAddr)
-
-		// Try UDP6 (non-fatal if it fails)
-		udpConn6, err := net.ListenPacket("udp6", udpAddr)
-		if err == nil {
-			packetConnConfigs = append(packetConnConfigs, turn.PacketConnConfig{
-				PacketConn:            udpConn6,
-				RelayAddressGenerator: relayAddressGenerator,
-			})
-			s.logger.Info("TURN UDP6 listener started", "addr", udpAddr)
-		} else {
-			s.logger.Debug("IPv6 UDP not available", "error", err)
-		}
+		s.logger.Info("TURN UDP"+family+" listener started", "addr", udpAddr)
 	}
 
-	// Create listener configs for TCP and TLS
-	var listenerConfigs []turn.ListenerConfig
-
 	// TCP listener
 	if s.config.Ports.TCP > 0 {
-		tcpAddr := fmt.Sprintf("%s:%d", s.config.PublicIP, s.config.Ports.TCP)
-
-		// TCP4
-		tcpListener4, err := net.Listen("tcp4", tcpAddr)
+		tcpAddr := net.JoinHostPort(addr, strconv.Itoa(s.config.Ports.TCP))
+		tcpListener, err := net.Listen("tcp"+family, tcpAddr)
 		if err != nil {
-			return fmt.Errorf("creating TCP4 listener: %w", err)
+			return packetConns, listeners, fmt.Errorf("creating TCP%s listener: %w", family, err)
 		}
 
-		listenerConfigs = append(listenerConfigs, turn.ListenerConfig{
-			Listener:              tcpListener4,
-			RelayAddressGenerator: relayAddressGenerator,
+		listeners = append(listeners, turn.ListenerConfig{
+			Listener:              tcpListener,
+			RelayAddressGenerator: relay,
 		})
-		s.logger.Info("TURN TCP4 listener started", "addr", tcpAddr)
-
-		// Try TCP6 (non-fatal if it fails)
-		tcpListener6, err := net.Listen("tcp6", tcpAddr)
-		if err == nil {
-			listenerConfigs = append(listenerConfigs, turn.ListenerConfig{
-				Listener:              tcpListener6,
-				RelayAddressGenerator: relayAddressGenerator,
-			})
-			s.logger.Info("TURN TCP6 listener started", "addr", tcpAddr)
-		} else {
-			s.logger.Debug("IPv6 TCP not available", "error", err)
-		}
+		s.logger.Info("TURN TCP"+family+" listener started", "addr", tcpAddr)
 	}
 
 	// TLS listener
 	if s.config.Ports.TLS > 0 && s.tlsConfig != nil {
-		tlsAddr := fmt.Sprintf("%s:%d", s.config.PublicIP, s.config.Ports.TLS)
-
-		tlsListener, err := tls.Listen("tcp4", tlsAddr, s.tlsConfig)
+		tlsAddr := net.JoinHostPort(addr, strconv.Itoa(s.config.Ports.TLS))
+		tlsListener, err := tls.Listen("tcp"+family, tlsAddr, s.tlsConfig)
 		if err != nil {
-			return fmt.Errorf("creating TLS listener: %w", err)
+			return packetConns, listeners, fmt.Errorf("creating TLS%s listener: %w", family, err)
 		}
 
-		// Use static relay generator for TLS
-		tlsRelayGenerator := &turn.RelayAddressGeneratorStatic{
-			RelayAddress: net.ParseIP(s.config.PublicIP),
-			Address:      "0.0.0.0",
-		}
-
-		listenerConfigs = append(listenerConfigs, turn.ListenerConfig{
+		listeners = append(listeners, turn.ListenerConfig{
 			Listener:              tlsListener,
-			RelayAddressGenerator: tlsRelayGenerator,
+			RelayAddressGenerator: relay,
 		})
-		s.logger.Info("TURNS TLS4 listener started", "addr", tlsAddr)
+		s.logger.Info("TURNS TLS"+family+" listener started", "addr", tlsAddr)
 	}
 
-	// Create TURN server config
-	turnConfig := turn.ServerConfig{
-		Realm:             s.config.Realm,
-		AuthHandler:       s.authHandler.AuthenticateRequest,
-		PacketConnConfigs: packetConnConfigs,
-		ListenerConfigs:   listenerConfigs,
+	// DTLS listener (TURN over DTLS, same certificate source as TLS)
+	if s.config.Ports.DTLS > 0 {
+		if s.tlsConfig == nil {
+			s.logger.Warn("DTLS port configured but no TLS certificate available, skipping DTLS listener")
+		} else {
+			dtlsAddr := &net.UDPAddr{
+				IP:   net.ParseIP(addr),
+				Port: s.config.Ports.DTLS,
+			}
+
+			dtlsListener, err := dtls.Listen("udp"+family, dtlsAddr, dtlsConfigFromTLS(s.tlsConfig))
+			if err != nil {
+				return packetConns, listeners, fmt.Errorf("creating DTLS%s listener: %w", family, err)
+			}
+
+			listeners = append(listeners, turn.ListenerConfig{
+				Listener:              dtlsListener,
+				RelayAddressGenerator: relay,
+			})
+			s.logger.Info("TURNS DTLS"+family+" listener started", "addr", dtlsAddr.String())
+		}
 	}
 
-	// Create and start TURN server
-	turnServer, err := turn.NewServer(turnConfig)
-	if err != nil {
-		return fmt.Errorf("creating TURN server: %w", err)
+	return packetConns, listeners, nil
+}
+
+// closeListeners closes listeners that were opened but not handed to pion
+func closeListeners(packetConns []turn.PacketConnConfig, listeners []turn.ListenerConfig) {
+	for _, pc := range packetConns {
+		pc.PacketConn.Close()
 	}
+	for _, l := range listeners {
+		l.Listener.Close()
+	}
+}
 
-	s.turnServer = turnServer
-	s.logger.Info("TURN server started successfully", "realm", s.config.Realm)
+// listenAddresses returns the local addresses to bind listeners on. Without
+// configured addresses both wildcards are used and IPv6 may fail.
+func (s *Server) listenAddresses() []string {
+	if len(s.config.ListenAddresses) > 0 {
+		return s.config.ListenAddresses
+	}
+	return config.DefaultListenAddresses
+}
 
-	return nil
+// relayIPv4 returns the advertised IPv4 relay address
+func (s *Server) relayIPv4() net.IP {
+	relayIP := net.ParseIP(s.config.PublicIP)
+	if relayIP == nil {
+		relayIP = net.ParseIP("127.0.0.1")
+	}
+	return relayIP
+}
+
+// bindIPv4 returns the local address IPv4 relay sockets are bound to.
+// Defaults to all interfaces so a public IP that is not assigned to any
+// interface (cloud 1:1 NAT) still works.
+func (s *Server) bindIPv4() net.IP {
+	bindIP := net.ParseIP(s.config.BindIP)
+	if bindIP == nil {
+		bindIP = net.IPv4zero
+	}
+	return bindIP
+}
+
+// dtlsConfigFromTLS builds a DTLS server config that serves the same
+// certificates as the TLS listener, including hot-reloaded ACME certificates
+func dtlsConfigFromTLS(tlsConfig *tls.Config) *dtls.Config {
+	cfg := &dtls.Config{
+		Certificates:         tlsConfig.Certificates,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+
+	if tlsConfig.GetCertificate != nil {
+		cfg.GetCertificate = func(hello *dtls.ClientHelloInfo) (*tls.Certificate, error) {
+			return tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: hello.ServerName})
+		}
+	}
+
+	return cfg
 }
 
 // Stop gracefully stops the TURN server
@@ -212,3 +292,42 @@ func (s *Server) Stop() error {
 func (s *Server) UpdateSecrets(current string, old []string, ttl int) {
 	s.authHandler.UpdateSecrets(current, old, ttl)
 }
+
+// Credentials returns the credential issuer shared with the API and signaling servers
+func (s *Server) Credentials() *CredentialIssuer {
+	return s.authHandler.issuer
+}
+
+// SetAuthWebhook sets the external authorization client for webhook auth
+func (s *Server) SetAuthWebhook(client *authhook.Client) {
+	s.authHandler.SetWebhook(client)
+}
+
+// SetEventBus sets the bus that allocation events are published to
+func (s *Server) SetEventBus(bus *events.Bus) {
+	s.events = bus
+}
+
+// onAllocationCreated publishes a relay allocation
+func (s *Server) onAllocationCreated(srcAddr, dstAddr net.Addr, protocol, username, realm string, relayAddr net.Addr, requestedPort int) {
+	s.events.Publish(events.TurnAllocationCreated, events.AllocationData{
+		Username:  username,
+		Protocol:  protocol,
+		SrcAddr:   srcAddr.String(),
+		RelayAddr: relayAddr.String(),
+	})
+}
+
+// onAllocationDeleted publishes the end of a relay allocation
+func (s *Server) onAllocationDeleted(srcAddr, dstAddr net.Addr, protocol, username, realm string) {
+	s.events.Publish(events.TurnAllocationDeleted, events.AllocationData{
+		Username: username,
+		Protocol: protocol,
+		SrcAddr:  srcAddr.String(),
+	})
+}
+
+// SetAuthGuard sets the failure tracker that bans repeatedly failing sources
+func (s *Server) SetAuthGuard(guard *authguard.Guard) {
+	s.authHandler.SetGuard(guard)
+}
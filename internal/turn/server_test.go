@@ -0,0 +1,340 @@
+package turn
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/pion/dtls/v3"
+	"github.com/pion/turn/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSignedCert creates a throwaway certificate for localhost
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// freeUDPPort returns a UDP port that was free at the time of the call
+func freeUDPPort(t *testing.T) int {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestDTLSConfigFromTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+
+	t.Run("static certificates", func(t *testing.T) {
+		cfg := dtlsConfigFromTLS(&tls.Config{Certificates: []tls.Certificate{cert}})
+		assert.Len(t, cfg.Certificates, 1)
+		assert.Nil(t, cfg.GetCertificate)
+	})
+
+	t.Run("hot-reloaded certificates", func(t *testing.T) {
+		var requestedName string
+		cfg := dtlsConfigFromTLS(&tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				requestedName = hello.ServerName
+				return &cert, nil
+			},
+		})
+
+		require.NotNil(t, cfg.GetCertificate)
+		got, err := cfg.GetCertificate(&dtls.ClientHelloInfo{ServerName: "turn.example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, &cert, got)
+		assert.Equal(t, "turn.example.com", requestedName)
+	})
+}
+
+func TestServer_DTLSListener(t *testing.T) {
+	cert := selfSignedCert(t)
+	port := freeUDPPort(t)
+
+	cfg := &config.TurnConfig{
+		Realm:    "test.com",
+		PublicIP: "127.0.0.1",
+		Ports:    config.TurnPorts{DTLS: port},
+		Auth: config.AuthConfig{
+			Mode:   "rest",
+			Secret: "secret",
+		},
+	}
+
+	server, err := New(cfg, &tls.Config{Certificates: []tls.Certificate{cert}}, testLogger())
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := dtls.Dial("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: port}, &dtls.Config{
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.HandshakeContext(ctx), "DTLS handshake should succeed")
+}
+
+func TestServer_DTLSWithoutCertificateIsSkipped(t *testing.T) {
+	cfg := &config.TurnConfig{
+		Realm:    "test.com",
+		PublicIP: "127.0.0.1",
+		Ports:    config.TurnPorts{UDP: freeUDPPort(t), DTLS: freeUDPPort(t)},
+		Auth: config.AuthConfig{
+			Mode:   "rest",
+			Secret: "secret",
+		},
+	}
+
+	// UDP still starts; DTLS is skipped without a certificate source
+	server, err := New(cfg, nil, testLogger())
+	require.NoError(t, err)
+	assert.NoError(t, server.Start())
+	server.Stop()
+}
+
+func TestNewRelayGenerator(t *testing.T) {
+	server, err := New(&config.TurnConfig{
+		Realm:          "test.com",
+		RelayPortRange: config.PortRange{Min: 40000, Max: 40100},
+		Auth:           config.AuthConfig{Mode: "rest", Secret: "secret"},
+	}, nil, testLogger())
+	require.NoError(t, err)
+
+	t.Run("ipv4 uses pion generator directly", func(t *testing.T) {
+		gen := server.newRelayGenerator(net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.1"))
+		portRange, ok := gen.(*turn.RelayAddressGeneratorPortRange)
+		require.True(t, ok)
+		assert.Equal(t, "127.0.0.1", portRange.Address)
+		require.NoError(t, gen.Validate())
+	})
+
+	t.Run("behind NAT advertises public IP but binds locally", func(t *testing.T) {
+		// 203.0.113.1 is not on any interface; binding to it would fail
+		gen := server.newRelayGenerator(net.ParseIP("203.0.113.1"), net.IPv4zero)
+		require.NoError(t, gen.Validate())
+
+		conn, relayAddr, err := gen.AllocatePacketConn("udp4", 0)
+		require.NoError(t, err, "relay socket should bind on the local address")
+		defer conn.Close()
+
+		assert.Equal(t, "203.0.113.1", relayAddr.(*net.UDPAddr).IP.String())
+	})
+
+	t.Run("ipv6 is bracketed and forced onto udp6", func(t *testing.T) {
+		gen := server.newRelayGenerator(net.ParseIP("::1"), net.ParseIP("::1"))
+		wrapped, ok := gen.(*ipv6RelayGenerator)
+		require.True(t, ok)
+		assert.Equal(t, "[::1]", wrapped.RelayAddressGenerator.(*turn.RelayAddressGeneratorPortRange).Address)
+		require.NoError(t, gen.Validate())
+
+		conn, relayAddr, err := gen.AllocatePacketConn("udp4", 0)
+		if err != nil {
+			t.Skipf("IPv6 loopback not available: %v", err)
+		}
+		defer conn.Close()
+
+		assert.Equal(t, "::1", relayAddr.(*net.UDPAddr).IP.String())
+		assert.Equal(t, "::1", conn.LocalAddr().(*net.UDPAddr).IP.String())
+	})
+}
+
+func TestServer_ListenAddresses(t *testing.T) {
+	port := freeUDPPort(t)
+
+	cfg := &config.TurnConfig{
+		Realm:    "test.com",
+		PublicIP: "127.0.0.1",
+		Ports:    config.TurnPorts{UDP: port},
+		Auth:     config.AuthConfig{Mode: "rest", Secret: "secret"},
+	}
+
+	// Default addresses: the IPv6 wildcard may fail, IPv4 listeners must come up
+	server, err := New(cfg, nil, testLogger())
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	_, err = net.ListenPacket("udp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	assert.Error(t, err, "UDP4 port should be held by the TURN server")
+}
+
+func TestServer_ConfiguredIPv6AddressMustListen(t *testing.T) {
+	port := freeUDPPort(t)
+
+	cfg := &config.TurnConfig{
+		Realm:           "test.com",
+		PublicIP:        "127.0.0.1",
+		ListenAddresses: []string{"127.0.0.1", "2001:db8::1"}, // Documentation prefix, never local
+		Ports:           config.TurnPorts{UDP: port},
+		Auth:            config.AuthConfig{Mode: "rest", Secret: "secret"},
+	}
+
+	server, err := New(cfg, nil, testLogger())
+	require.NoError(t, err)
+	assert.ErrorContains(t, server.Start(), "UDP6")
+
+	// The IPv4 listener opened before the failure is released
+	conn, err := net.ListenPacket("udp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestServer_NoListeners(t *testing.T) {
+	cfg := &config.TurnConfig{
+		Realm:           "test.com",
+		ListenAddresses: []string{"127.0.0.1"},
+		Auth:            config.AuthConfig{Mode: "rest", Secret: "secret"},
+	}
+
+	server, err := New(cfg, nil, testLogger())
+	require.NoError(t, err)
+	assert.ErrorContains(t, server.Start(), "no TURN listeners started")
+}
+
+func TestServer_InvalidListenAddress(t *testing.T) {
+	cfg := &config.TurnConfig{
+		Realm:           "test.com",
+		ListenAddresses: []string{"bogus"},
+		Ports:           config.TurnPorts{UDP: freeUDPPort(t)},
+		Auth:            config.AuthConfig{Mode: "rest", Secret: "secret"},
+	}
+
+	server, err := New(cfg, nil, testLogger())
+	require.NoError(t, err)
+	assert.ErrorContains(t, server.Start(), "invalid listen address")
+}
+
+func TestDetectPublicIP(t *testing.T) {
+	// The TURN server answers STUN binding requests itself
+	port := freeUDPPort(t)
+	server, err := New(&config.TurnConfig{
+		Realm:           "test.com",
+		PublicIP:        "127.0.0.1",
+		ListenAddresses: []string{"127.0.0.1"},
+		Ports:           config.TurnPorts{UDP: port},
+		Auth:            config.AuthConfig{Mode: "rest", Secret: "secret"},
+	}, nil, testLogger())
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	stunAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	ip, err := DetectPublicIP(stunAddr, 2*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip.String())
+
+	t.Run("resolves auto", func(t *testing.T) {
+		cfg := &config.TurnConfig{PublicIP: config.PublicIPAuto, DetectSTUN: stunAddr}
+		require.NoError(t, ResolvePublicIP(cfg, testLogger()))
+		assert.Equal(t, "127.0.0.1", cfg.PublicIP)
+	})
+
+	t.Run("leaves explicit address alone", func(t *testing.T) {
+		cfg := &config.TurnConfig{PublicIP: "203.0.113.1", DetectSTUN: stunAddr}
+		require.NoError(t, ResolvePublicIP(cfg, testLogger()))
+		assert.Equal(t, "203.0.113.1", cfg.PublicIP)
+	})
+
+	t.Run("unreachable server", func(t *testing.T) {
+		_, err := DetectPublicIP(net.JoinHostPort("127.0.0.1", strconv.Itoa(freeUDPPort(t))), 200*time.Millisecond)
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_AllocationEvents(t *testing.T) {
+	port := freeUDPPort(t)
+
+	server, err := New(&config.TurnConfig{
+		Realm:           "test.com",
+		PublicIP:        "127.0.0.1",
+		ListenAddresses: []string{"127.0.0.1"},
+		Ports:           config.TurnPorts{UDP: port},
+		RelayPortRange:  config.PortRange{Min: 50000, Max: 50100},
+		Auth: config.AuthConfig{
+			Mode:        "static",
+			StaticUsers: []config.StaticUser{{Username: "alice", Password: "pw"}},
+		},
+	}, nil, testLogger())
+	require.NoError(t, err)
+
+	bus := events.NewBus(testLogger())
+	sub := bus.Subscribe(10, "turn.*")
+	defer sub.Close()
+	server.SetEventBus(bus)
+
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: addr,
+		TURNServerAddr: addr,
+		Conn:           conn,
+		Username:       "alice",
+		Password:       "pw",
+		Realm:          "test.com",
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	select {
+	case ev := <-sub.Events():
+		assert.Equal(t, events.TurnAllocationCreated, ev.Type)
+		data := ev.Data.(events.AllocationData)
+		assert.Equal(t, "alice", data.Username)
+		assert.Equal(t, conn.LocalAddr().String(), data.SrcAddr)
+		assert.Equal(t, relayConn.LocalAddr().String(), data.RelayAddr)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no allocation event")
+	}
+
+	relayConn.Close()
+
+	select {
+	case ev := <-sub.Events():
+		assert.Equal(t, events.TurnAllocationDeleted, ev.Type)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no allocation deleted event")
+	}
+}
@@ -0,0 +1,441 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Arqut-Event"
+	HeaderDelivery  = "X-Arqut-Delivery"  // Stable across retries of the same delivery
+	HeaderTimestamp = "X-Arqut-Timestamp" // Unix seconds, part of the signed message
+	HeaderSignature = "X-Arqut-Signature" // "sha256=" + hex HMAC of "<timestamp>.<body>"
+)
+
+// SecretPrefix is the prefix of generated signing secrets
+const SecretPrefix = "whsec_"
+
+// ErrQueueFull is returned when a redelivery cannot be queued
+var ErrQueueFull = errors.New("webhook delivery queue is full")
+
+// ErrStopped is returned when the dispatcher is no longer running
+var ErrStopped = errors.New("webhook dispatcher is stopped")
+
+// Sign computes the signature header value for a payload
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateID returns a random webhook ID
+func GenerateID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateSecret returns a random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ValidateURL checks that raw is an absolute http or https URL
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url scheme must be http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url must include a host")
+	}
+	return nil
+}
+
+// delivery is one event bound for one webhook
+type delivery struct {
+	id        string
+	webhookID string
+	url       string
+	secret    string
+	eventID   uint64
+	eventType string
+	payload   []byte
+}
+
+// Dispatcher delivers bus events to the enabled webhooks stored in the
+// database. Each delivery is retried with exponential backoff; deliveries
+// that still fail, or that cannot be queued, are written to the dead-letter log.
+type Dispatcher struct {
+	cfg    config.WebhooksConfig
+	store  storage.Storage
+	http   *http.Client
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	hooks []*models.Webhook
+
+	queue    chan *delivery
+	sub      *events.Subscription
+	ctx      context.Context
+	cancel   context.CancelFunc
+	loopDone chan struct{}
+	workers  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// New creates a webhook dispatcher
+func New(cfg *config.WebhooksConfig, store storage.Storage, logger *slog.Logger) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		cfg:   *cfg,
+		store: store,
+		http: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect is treated as a failed delivery rather than
+			// silently turned into a GET
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: logger.With("component", "webhooks"),
+		queue:  make(chan *delivery, cfg.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start loads the webhook subscriptions and begins delivering events from bus
+func (d *Dispatcher) Start(bus *events.Bus) error {
+	if err := d.Reload(); err != nil {
+		return err
+	}
+
+	d.sub = bus.Subscribe(d.cfg.QueueSize)
+	d.loopDone = make(chan struct{})
+	go d.dispatchLoop()
+
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.workers.Add(1)
+		go d.worker()
+	}
+
+	d.logger.Info("Webhook dispatcher started", "workers", d.cfg.Workers)
+	return nil
+}
+
+// Stop stops accepting events, aborts in-flight deliveries and dead-letters
+// everything still pending
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		if d.sub != nil {
+			d.sub.Close()
+			<-d.loopDone
+		}
+		d.cancel()
+		d.workers.Wait()
+		d.logger.Info("Webhook dispatcher stopped")
+	})
+}
+
+// Reload refreshes the cached subscriptions from storage. Call it after
+// webhooks are created, changed or deleted.
+func (d *Dispatcher) Reload() error {
+	all, err := d.store.ListWebhooks()
+	if err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	hooks := make([]*models.Webhook, 0, len(all))
+	for _, hook := range all {
+		if hook.Enabled {
+			hooks = append(hooks, hook)
+		}
+	}
+
+	d.mu.Lock()
+	d.hooks = hooks
+	d.mu.Unlock()
+
+	d.logger.Debug("Webhooks loaded", "enabled", len(hooks), "total", len(all))
+	return nil
+}
+
+// Redeliver queues a dead-lettered event for another round of delivery
+// attempts and removes it from the log. If delivery fails again a new
+// dead letter is recorded.
+func (d *Dispatcher) Redeliver(deadLetterID uint) error {
+	if d.ctx.Err() != nil {
+		return ErrStopped
+	}
+
+	letter, err := d.store.GetWebhookDeadLetter(deadLetterID)
+	if err != nil {
+		return err
+	}
+	hook, err := d.store.GetWebhook(letter.WebhookID)
+	if err != nil {
+		return err
+	}
+
+	del, err := newDelivery(hook, letter.EventID, letter.EventType, []byte(letter.Payload))
+	if err != nil {
+		return err
+	}
+
+	select {
+	case d.queue <- del:
+	default:
+		return ErrQueueFull
+	}
+
+	if err := d.store.DeleteWebhookDeadLetter(deadLetterID); err != nil {
+		d.logger.Warn("Failed to remove redelivered dead letter", "id", deadLetterID, "error", err)
+	}
+	return nil
+}
+
+// dispatchLoop fans bus events out to the matching webhooks
+func (d *Dispatcher) dispatchLoop() {
+	defer close(d.loopDone)
+
+	for ev := range d.sub.Events() {
+		d.mu.RLock()
+		hooks := d.hooks
+		d.mu.RUnlock()
+
+		var payload []byte
+		for _, hook := range hooks {
+			if !events.Match(hook.Events, ev.Type) {
+				continue
+			}
+
+			if payload == nil {
+				var err error
+				if payload, err = json.Marshal(ev); err != nil {
+					d.logger.Error("Failed to marshal event", "type", ev.Type, "id", ev.ID, "error", err)
+					break
+				}
+			}
+
+			del, err := newDelivery(hook, ev.ID, ev.Type, payload)
+			if err != nil {
+				d.logger.Error("Failed to create delivery", "webhook", hook.ID, "error", err)
+				continue
+			}
+
+			select {
+			case d.queue <- del:
+			default:
+				d.deadLetter(del, 0, 0, "delivery queue full")
+			}
+		}
+	}
+
+	if dropped := d.sub.Dropped(); dropped > 0 {
+		d.logger.Warn("Events dropped before reaching webhooks", "count", dropped)
+	}
+}
+
+// worker delivers queued events until the dispatcher stops, then
+// dead-letters whatever is still queued
+func (d *Dispatcher) worker() {
+	defer d.workers.Done()
+
+	for {
+		select {
+		case del := <-d.queue:
+			d.deliver(del)
+		case <-d.ctx.Done():
+			for {
+				select {
+				case del := <-d.queue:
+					d.deadLetter(del, 0, 0, "server shutting down")
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver attempts a delivery until it succeeds, fails permanently or runs
+// out of attempts
+func (d *Dispatcher) deliver(del *delivery) {
+	var (
+		status  int
+		lastErr error
+	)
+
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		status, lastErr = d.send(del)
+		if lastErr == nil {
+			d.logger.Debug("Webhook delivered",
+				"webhook", del.webhookID,
+				"event", del.eventType,
+				"attempt", attempt,
+			)
+			return
+		}
+
+		d.logger.Warn("Webhook delivery failed",
+			"webhook", del.webhookID,
+			"event", del.eventType,
+			"attempt", attempt,
+			"status", status,
+			"error", lastErr,
+		)
+
+		if !retryable(status, lastErr) || attempt == d.cfg.MaxAttempts {
+			d.deadLetter(del, attempt, status, lastErr.Error())
+			return
+		}
+
+		timer := time.NewTimer(d.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			d.deadLetter(del, attempt, status, lastErr.Error())
+			return
+		}
+	}
+}
+
+// send performs a single delivery attempt and returns the response status
+func (d *Dispatcher) send(del *delivery) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, del.url, bytes.NewReader(del.payload))
+	if err != nil {
+		return 0, fmt.Errorf("creating webhook request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "arqut-webhooks/1")
+	req.Header.Set(HeaderEvent, del.eventType)
+	req.Header.Set(HeaderDelivery, del.id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if del.secret != "" {
+		req.Header.Set(HeaderSignature, Sign(del.secret, timestamp, del.payload))
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("calling webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given failed attempt
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.RetryBackoff << (attempt - 1)
+	if delay > d.cfg.MaxRetryBackoff || delay <= 0 {
+		delay = d.cfg.MaxRetryBackoff
+	}
+	return delay
+}
+
+// deadLetter records an undeliverable event
+func (d *Dispatcher) deadLetter(del *delivery, attempts, status int, reason string) {
+	// The webhook may have been deleted while the delivery was pending
+	if _, err := d.store.GetWebhook(del.webhookID); err != nil {
+		d.logger.Debug("Dropping undeliverable event for removed webhook", "webhook", del.webhookID)
+		return
+	}
+
+	letter := &models.WebhookDeadLetter{
+		WebhookID:  del.webhookID,
+		EventID:    del.eventID,
+		EventType:  del.eventType,
+		Payload:    string(del.payload),
+		Attempts:   attempts,
+		LastStatus: status,
+		LastError:  reason,
+	}
+	if err := d.store.CreateWebhookDeadLetter(letter); err != nil {
+		d.logger.Error("Failed to record webhook dead letter",
+			"webhook", del.webhookID,
+			"event", del.eventType,
+			"error", err,
+		)
+		return
+	}
+
+	d.logger.Warn("Webhook event dead-lettered",
+		"webhook", del.webhookID,
+		"event", del.eventType,
+		"attempts", attempts,
+		"reason", reason,
+	)
+}
+
+func newDelivery(hook *models.Webhook, eventID uint64, eventType string, payload []byte) (*delivery, error) {
+	id, err := GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	return &delivery{
+		id:        id,
+		webhookID: hook.ID,
+		url:       hook.URL,
+		secret:    hook.Secret,
+		eventID:   eventID,
+		eventType: eventType,
+		payload:   payload,
+	}, nil
+}
+
+// retryable reports whether a failed attempt may succeed later: network
+// errors, server errors, 408 and 429. Other client errors are permanent.
+func retryable(status int, err error) bool {
+	if err == nil {
+		return false
+	}
+	switch {
+	case status == 0:
+		return true
+	case status >= 500:
+		return true
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arqut/arqut-server-ce/internal/config"
+	"github.com/arqut/arqut-server-ce/internal/events"
+	"github.com/arqut/arqut-server-ce/internal/pkg/models"
+	"github.com/arqut/arqut-server-ce/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *storage.SQLiteStorage {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "webhooks.db"))
+	require.NoError(t, err)
+	require.NoError(t, store.Init())
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func testConfig() *config.WebhooksConfig {
+	return &config.WebhooksConfig{
+		Timeout:         time.Second,
+		MaxAttempts:     3,
+		RetryBackoff:    time.Millisecond,
+		MaxRetryBackoff: 5 * time.Millisecond,
+		Workers:         2,
+		QueueSize:       10,
+	}
+}
+
+func startDispatcher(t *testing.T, store storage.Storage, cfg *config.WebhooksConfig) (*Dispatcher, *events.Bus) {
+	bus := events.NewBus(slog.Default())
+	d := New(cfg, store, slog.Default())
+	require.NoError(t, d.Start(bus))
+	t.Cleanup(d.Stop)
+	return d, bus
+}
+
+func TestSign(t *testing.T) {
+	sig := Sign("secret", 1700000000, []byte(`{"id":1}`))
+	assert.Equal(t, sig, Sign("secret", 1700000000, []byte(`{"id":1}`)))
+	assert.NotEqual(t, sig, Sign("other", 1700000000, []byte(`{"id":1}`)))
+	assert.NotEqual(t, sig, Sign("secret", 1700000001, []byte(`{"id":1}`)))
+	assert.Len(t, sig, len("sha256=")+64)
+}
+
+func TestValidateURL(t *testing.T) {
+	assert.NoError(t, ValidateURL("https://example.com/hook"))
+	assert.NoError(t, ValidateURL("http://10.0.0.1:8080/hook"))
+	assert.Error(t, ValidateURL("ftp://example.com"))
+	assert.Error(t, ValidateURL("/relative"))
+	assert.Error(t, ValidateURL("https://"))
+}
+
+func TestDispatcher_DeliversSignedEvents(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan received, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Clone(), body}
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t)
+	require.NoError(t, store.CreateWebhook(&models.Webhook{
+		ID:      "wh-services",
+		URL:     srv.URL,
+		Events:  []string{"service.*"},
+		Secret:  "s3cret",
+		Enabled: true,
+	}))
+	require.NoError(t, store.CreateWebhook(&models.Webhook{
+		ID:      "wh-disabled",
+		URL:     srv.URL,
+		Enabled: false,
+	}))
+
+	_, bus := startDispatcher(t, store, testConfig())
+
+	bus.Publish(events.PeerConnected, events.PeerData{ID: "p1"})
+	bus.Publish(events.ServiceDeleted, events.ServiceData{ID: "svc-1", EdgeID: "edge-1"})
+
+	var r received
+	select {
+	case r = <-got:
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	assert.Equal(t, events.ServiceDeleted, r.header.Get(HeaderEvent))
+	assert.NotEmpty(t, r.header.Get(HeaderDelivery))
+	ts, err := strconv.ParseInt(r.header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign("s3cret", ts, r.body), r.header.Get(HeaderSignature))
+
+	var ev events.Event
+	require.NoError(t, json.Unmarshal(r.body, &ev))
+	assert.Equal(t, events.ServiceDeleted, ev.Type)
+
+	// Neither the filtered peer event nor the disabled hook produce deliveries
+	select {
+	case extra := <-got:
+		t.Fatalf("unexpected delivery: %s", extra.header.Get(HeaderEvent))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDispatcher_RetriesThenDeadLetters(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t)
+	require.NoError(t, store.CreateWebhook(&models.Webhook{ID: "wh-1", URL: srv.URL, Enabled: true}))
+
+	_, bus := startDispatcher(t, store, testConfig())
+	bus.Publish(events.PeerDisconnected, events.PeerData{ID: "edge-1", Type: "edge"})
+
+	var letters []*models.WebhookDeadLetter
+	require.Eventually(t, func() bool {
+		letters, _ = store.ListWebhookDeadLetters("wh-1")
+		return len(letters) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, letters[0].LastStatus)
+	assert.Equal(t, events.PeerDisconnected, letters[0].EventType)
+	assert.Contains(t, letters[0].Payload, `"edge-1"`)
+}
+
+func TestDispatcher_ClientErrorIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t)
+	require.NoError(t, store.CreateWebhook(&models.Webhook{ID: "wh-1", URL: srv.URL, Enabled: true}))
+
+	_, bus := startDispatcher(t, store, testConfig())
+	bus.Publish(events.EdgeRegistered, events.PeerData{ID: "edge-1"})
+
+	require.Eventually(t, func() bool {
+		letters, _ := store.ListWebhookDeadLetters("wh-1")
+		return len(letters) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestDispatcher_Redeliver(t *testing.T) {
+	var healthy atomic.Bool
+	delivered := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		delivered <- struct{}{}
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t)
+	require.NoError(t, store.CreateWebhook(&models.Webhook{ID: "wh-1", URL: srv.URL, Enabled: true}))
+
+	d, bus := startDispatcher(t, store, testConfig())
+	bus.Publish(events.ServiceCreated, events.ServiceData{ID: "svc-1"})
+
+	var letters []*models.WebhookDeadLetter
+	require.Eventually(t, func() bool {
+		letters, _ = store.ListWebhookDeadLetters("wh-1")
+		return len(letters) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	healthy.Store(true)
+	require.NoError(t, d.Redeliver(letters[0].ID))
+
+	select {
+	case <-delivered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("redelivery not attempted")
+	}
+
+	letters, err := store.ListWebhookDeadLetters("wh-1")
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+
+	assert.Error(t, d.Redeliver(9999))
+}
+
+func TestDispatcher_Reload(t *testing.T) {
+	got := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get(HeaderEvent)
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t)
+	d, bus := startDispatcher(t, store, testConfig())
+
+	require.NoError(t, store.CreateWebhook(&models.Webhook{ID: "wh-1", URL: srv.URL, Enabled: true}))
+	require.NoError(t, d.Reload())
+
+	bus.Publish(events.PeerConnected, events.PeerData{ID: "p1"})
+	select {
+	case typ := <-got:
+		assert.Equal(t, events.PeerConnected, typ)
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook added after start was not delivered")
+	}
+}